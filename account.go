@@ -0,0 +1,85 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Headers mirroring the OpenAI organization and project the request is billed to
+const (
+	OrganizationHeader = "X-OpenAI-Organization"
+	ProjectHeader      = "X-OpenAI-Project"
+)
+
+// OpenAIAccount configures the OpenAI organization and project of the requests. Organization and project replace the
+// values sent by the client; the allowed lists reject requests for any other value.
+type OpenAIAccount struct {
+	Organization         string   `json:"organization"`
+	Project              string   `json:"project"`
+	AllowedOrganizations []string `json:"allowedOrganizations"`
+	AllowedProjects      []string `json:"allowedProjects"`
+}
+
+// openAIAccountHeader is one of the account headers with its policy
+type openAIAccountHeader struct {
+	name    string
+	mirror  string
+	option  string
+	value   string
+	allowed map[string]bool
+}
+
+func newOpenAIAccount(config *OpenAIAccount) []openAIAccountHeader {
+	if config == nil {
+		return nil
+	}
+	return []openAIAccountHeader{
+		{name: "OpenAI-Organization", mirror: OrganizationHeader, option: "organization", value: config.Organization, allowed: allowedSet(config.AllowedOrganizations)},
+		{name: "OpenAI-Project", mirror: ProjectHeader, option: "project", value: config.Project, allowed: allowedSet(config.AllowedProjects)},
+	}
+}
+
+// allowedSet returns the allowed values as a set, or nil when every value is allowed
+func allowedSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	return toSet(values)
+}
+
+// enforceOpenAIAccount injects the configured organization and project, rejects requests for an organization or
+// project that is not allowed and mirrors both into the X-OpenAI-* headers. It returns true when the request was
+// rejected. Read only instances count violations without rejecting.
+func (e *Handler) enforceOpenAIAccount(w http.ResponseWriter, r *http.Request) bool {
+	for _, header := range e.openAIAccount {
+		value := r.Header.Get(header.name)
+		if header.value != "" && value != header.value {
+			if value != "" {
+				e.metrics.incLabel("openai_account_overridden", header.option)
+			}
+			value = header.value
+			r.Header.Set(header.name, value)
+		}
+
+		if header.allowed != nil && !header.allowed[value] {
+			e.metrics.incLabel("openai_account_violations", header.option)
+			if !e.readOnly {
+				e.reject(w, rejection{
+					status:    http.StatusForbidden,
+					errorType: "invalid_request_error",
+					code:      header.option + "_not_allowed",
+					message:   fmt.Sprintf("The %s %q is not allowed.", header.option, value),
+					values:    map[string]string{header.option: value},
+				})
+				return true
+			}
+		}
+
+		if value == "" {
+			r.Header.Del(header.mirror)
+			continue
+		}
+		e.setHeader(r.Header, header.mirror, value)
+	}
+	return false
+}
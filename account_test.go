@@ -0,0 +1,116 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIAccount_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name             string
+		account          OpenAIAccount
+		readOnly         bool
+		organization     string
+		project          string
+		wantStatus       int
+		wantOrganization string
+		wantProject      string
+		wantMirrored     string
+	}{
+		{
+			name:             "mirrored",
+			organization:     "org-acme",
+			project:          "proj_chat",
+			wantStatus:       http.StatusOK,
+			wantOrganization: "org-acme",
+			wantProject:      "proj_chat",
+			wantMirrored:     "proj_chat",
+		},
+		{
+			name:             "injected",
+			account:          OpenAIAccount{Organization: "org-acme", Project: "proj_chat"},
+			project:          "proj_other",
+			wantStatus:       http.StatusOK,
+			wantOrganization: "org-acme",
+			wantProject:      "proj_chat",
+			wantMirrored:     "proj_chat",
+		},
+		{
+			name:         "allowed project",
+			account:      OpenAIAccount{AllowedProjects: []string{"proj_chat", "proj_batch"}},
+			project:      "proj_batch",
+			wantStatus:   http.StatusOK,
+			wantProject:  "proj_batch",
+			wantMirrored: "proj_batch",
+		},
+		{
+			name:       "project not allowed",
+			account:    OpenAIAccount{AllowedProjects: []string{"proj_chat"}},
+			project:    "proj_other",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing project",
+			account:    OpenAIAccount{AllowedProjects: []string{"proj_chat"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:             "organization not allowed under read only",
+			account:          OpenAIAccount{AllowedOrganizations: []string{"org-acme"}},
+			readOnly:         true,
+			organization:     "org-other",
+			wantStatus:       http.StatusOK,
+			wantOrganization: "org-other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.OpenAIAccount = &tt.account
+			config.ReadOnly = tt.readOnly
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			if tt.organization != "" {
+				req.Header.Set("OpenAI-Organization", tt.organization)
+			}
+			if tt.project != "" {
+				req.Header.Set("OpenAI-Project", tt.project)
+			}
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(recorder.Body.String(), "\"code\":\"project_not_allowed\"") {
+					t.Errorf("expected a project_not_allowed error but got %s", recorder.Body.String())
+				}
+				return
+			}
+			if got.Get("OpenAI-Organization") != tt.wantOrganization {
+				t.Errorf("expected organization %q but got %q", tt.wantOrganization, got.Get("OpenAI-Organization"))
+			}
+			if got.Get("OpenAI-Project") != tt.wantProject {
+				t.Errorf("expected project %q but got %q", tt.wantProject, got.Get("OpenAI-Project"))
+			}
+			if got.Get(ProjectHeader) != tt.wantMirrored {
+				t.Errorf("expected mirrored project %q but got %q", tt.wantMirrored, got.Get(ProjectHeader))
+			}
+			if got.Get(OrganizationHeader) != got.Get("OpenAI-Organization") {
+				t.Errorf("expected mirrored organization %q but got %q", got.Get("OpenAI-Organization"), got.Get(OrganizationHeader))
+			}
+		})
+	}
+}
@@ -0,0 +1,637 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AnthropicTranslation configures the translation of chat completion requests to the Anthropic Messages API and of
+// their responses back, so traffic can fail over to Claude behind the same client facing API
+type AnthropicTranslation struct {
+	Path             string            `json:"path"`
+	Models           map[string]string `json:"models"`
+	DefaultMaxTokens int               `json:"defaultMaxTokens"`
+	Version          string            `json:"version"`
+	APIKey           string            `json:"apiKey"`
+}
+
+// anthropicTranslation is the AnthropicTranslation config with defaults applied
+type anthropicTranslation struct {
+	path             string
+	models           map[string]string
+	defaultMaxTokens int
+	version          string
+	apiKey           string
+}
+
+func newAnthropicTranslation(config *AnthropicTranslation) (*anthropicTranslation, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	t := &anthropicTranslation{
+		path:             "/v1/messages",
+		models:           config.Models,
+		defaultMaxTokens: 4096,
+		version:          "2023-06-01",
+		apiKey:           config.APIKey,
+	}
+	if config.Path != "" {
+		if !strings.HasPrefix(config.Path, "/") {
+			return nil, fmt.Errorf("invalid anthropicTranslation path %q", config.Path)
+		}
+		t.path = config.Path
+	}
+	if config.DefaultMaxTokens < 0 {
+		return nil, fmt.Errorf("invalid anthropicTranslation defaultMaxTokens %d", config.DefaultMaxTokens)
+	}
+	if config.DefaultMaxTokens > 0 {
+		t.defaultMaxTokens = config.DefaultMaxTokens
+	}
+	if config.Version != "" {
+		t.version = config.Version
+	}
+	return t, nil
+}
+
+// anthropicRequest is the part of a chat completion request that has a Messages API equivalent
+type anthropicRequest struct {
+	members       map[string]json.RawMessage
+	includeUsage  bool
+	parallelCalls *bool
+}
+
+// chatToAnthropic converts the members of a chat completion request to the members of a Messages API request. System
+// and developer messages become the system prompt, tool calls and results become tool use and tool result blocks and
+// consecutive messages of the same role are merged, as the Messages API requires alternating roles. An error is
+// returned for fields that have no Messages API equivalent.
+func (t *anthropicTranslation) chatToAnthropic(members map[string]json.RawMessage) (*anthropicRequest, error) {
+	request := &anthropicRequest{members: map[string]json.RawMessage{}}
+	translated := request.members
+	var toolChoice map[string]interface{}
+	for field, value := range members {
+		var err error
+		switch field {
+		case "model":
+			var model string
+			if err = json.Unmarshal(value, &model); err == nil {
+				if mapped, ok := t.models[model]; ok {
+					model = mapped
+				}
+				translated["model"], err = json.Marshal(model)
+			}
+		case "messages":
+			var system string
+			var messages json.RawMessage
+			if system, messages, err = translateAnthropicMessages(value); err == nil {
+				translated["messages"] = messages
+				if system != "" {
+					translated["system"], err = json.Marshal(system)
+				}
+			}
+		case "max_completion_tokens":
+			if string(value) != "null" {
+				translated["max_tokens"] = value
+			}
+		case "max_tokens":
+			// max_completion_tokens replaces the deprecated max_tokens when both are sent
+			if completion, ok := members["max_completion_tokens"]; string(value) != "null" && (!ok || string(completion) == "null") {
+				translated["max_tokens"] = value
+			}
+		case "temperature":
+			var temperature float64
+			if err = json.Unmarshal(value, &temperature); err == nil && temperature > 1 {
+				err = errors.New("temperature above 1")
+			}
+			translated["temperature"] = value
+		case "top_p", "stream":
+			translated[field] = value
+		case "stop":
+			var stop []string
+			if err = json.Unmarshal(value, &stop); err != nil {
+				var single string
+				if err = json.Unmarshal(value, &single); err == nil {
+					stop = []string{single}
+				}
+			}
+			translated["stop_sequences"], _ = json.Marshal(stop)
+		case "user":
+			translated["metadata"], err = json.Marshal(map[string]json.RawMessage{"user_id": value})
+		case "tools":
+			translated["tools"], err = translateAnthropicTools(value)
+		case "tool_choice":
+			toolChoice, err = translateAnthropicToolChoice(value)
+		case "parallel_tool_calls":
+			var parallel bool
+			if err = json.Unmarshal(value, &parallel); err == nil {
+				request.parallelCalls = &parallel
+			}
+		case "stream_options":
+			var options struct {
+				IncludeUsage bool `json:"include_usage"`
+			}
+			err = json.Unmarshal(value, &options)
+			request.includeUsage = options.IncludeUsage
+		default:
+			if field == "n" && string(value) == "1" || string(value) == "null" {
+				continue
+			}
+			err = fmt.Errorf("unsupported field %s", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := translated["messages"]; !ok {
+		return nil, errors.New("no messages")
+	}
+	if _, ok := translated["max_tokens"]; !ok {
+		translated["max_tokens"], _ = json.Marshal(t.defaultMaxTokens)
+	}
+	if request.parallelCalls != nil && !*request.parallelCalls {
+		if toolChoice == nil {
+			toolChoice = map[string]interface{}{"type": "auto"}
+		}
+		toolChoice["disable_parallel_tool_use"] = true
+	}
+	if toolChoice != nil {
+		translated["tool_choice"], _ = json.Marshal(toolChoice)
+	}
+	return request, nil
+}
+
+// translateAnthropicMessages returns the system prompt and the Messages API messages of the chat messages
+func translateAnthropicMessages(value json.RawMessage) (string, json.RawMessage, error) {
+	var messages []translatedMessage
+	if err := json.Unmarshal(value, &messages); err != nil {
+		return "", nil, err
+	}
+
+	var system []string
+	type anthropicMessage struct {
+		Role    string        `json:"role"`
+		Content []interface{} `json:"content"`
+	}
+	var translated []*anthropicMessage
+	add := func(role string, blocks ...interface{}) {
+		if len(translated) > 0 && translated[len(translated)-1].Role == role {
+			last := translated[len(translated)-1]
+			last.Content = append(last.Content, blocks...)
+			return
+		}
+		translated = append(translated, &anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, message := range messages {
+		switch message.Role {
+		case "system", "developer":
+			text, err := systemText(message.Content)
+			if err != nil {
+				return "", nil, err
+			}
+			system = append(system, text)
+		case "tool":
+			text, err := systemText(message.Content)
+			if err != nil {
+				return "", nil, err
+			}
+			add("user", map[string]interface{}{"type": "tool_result", "tool_use_id": message.ToolCallID, "content": text})
+		case "user", "assistant":
+			var blocks []interface{}
+			if len(message.Content) > 0 && string(message.Content) != "null" {
+				var err error
+				if blocks, err = anthropicContent(message.Content); err != nil {
+					return "", nil, err
+				}
+			}
+			for _, call := range message.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					return "", nil, errors.New("tool call arguments are not JSON")
+				}
+				blocks = append(blocks, map[string]interface{}{"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": input})
+			}
+			if len(blocks) > 0 {
+				add(message.Role, blocks...)
+			}
+		default:
+			return "", nil, fmt.Errorf("unsupported message role %s", message.Role)
+		}
+	}
+	if len(translated) == 0 {
+		return "", nil, errors.New("no user or assistant messages")
+	}
+
+	data, err := json.Marshal(translated)
+	return strings.Join(system, "\n\n"), data, err
+}
+
+// systemText returns the text of message content that is a string or a list of text parts
+func systemText(value json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text, nil
+	}
+	var parts []chatContentPart
+	if err := json.Unmarshal(value, &parts); err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("unsupported content part %s", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// anthropicContent converts message content to Messages API text and image blocks. Images given as a data URL are sent
+// as base64 sources, others as URL sources.
+func anthropicContent(value json.RawMessage) ([]interface{}, error) {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return []interface{}{map[string]interface{}{"type": "text", "text": text}}, nil
+	}
+
+	var parts []chatContentPart
+	if err := json.Unmarshal(value, &parts); err != nil {
+		return nil, err
+	}
+	blocks := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": part.Text})
+		case part.Type == "image_url" && strings.HasPrefix(part.ImageURL.URL, "data:"):
+			header, data, ok := strings.Cut(strings.TrimPrefix(part.ImageURL.URL, "data:"), ",")
+			mediaType, base64, _ := strings.Cut(header, ";")
+			if !ok || base64 != "base64" {
+				return nil, errors.New("unsupported image data URL")
+			}
+			blocks = append(blocks, map[string]interface{}{
+				"type":   "image",
+				"source": map[string]string{"type": "base64", "media_type": mediaType, "data": data},
+			})
+		case part.Type == "image_url" && part.ImageURL.URL != "":
+			blocks = append(blocks, map[string]interface{}{
+				"type":   "image",
+				"source": map[string]string{"type": "url", "url": part.ImageURL.URL},
+			})
+		default:
+			return nil, fmt.Errorf("unsupported content part %s", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// translateAnthropicTools converts chat function tools to Messages API tools
+func translateAnthropicTools(value json.RawMessage) (json.RawMessage, error) {
+	var tools []chatTool
+	if err := json.Unmarshal(value, &tools); err != nil {
+		return nil, err
+	}
+	translated := make([]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool %s", tool.Type)
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		anthropicTool := map[string]interface{}{"name": tool.Function.Name, "input_schema": schema}
+		if tool.Function.Description != "" {
+			anthropicTool["description"] = tool.Function.Description
+		}
+		translated = append(translated, anthropicTool)
+	}
+	return json.Marshal(translated)
+}
+
+// translateAnthropicToolChoice converts the auto, none and required choices and a forced function
+func translateAnthropicToolChoice(value json.RawMessage) (map[string]interface{}, error) {
+	var choice string
+	if err := json.Unmarshal(value, &choice); err == nil {
+		switch choice {
+		case "auto", "none":
+			return map[string]interface{}{"type": choice}, nil
+		case "required":
+			return map[string]interface{}{"type": "any"}, nil
+		}
+		return nil, fmt.Errorf("unsupported tool_choice %s", choice)
+	}
+	var forced chatToolCall
+	if err := json.Unmarshal(value, &forced); err != nil || forced.Type != "function" {
+		return nil, errors.New("unsupported tool_choice")
+	}
+	return map[string]interface{}{"type": "tool", "name": forced.Function.Name}, nil
+}
+
+// anthropicFinishReasons maps the stop reasons of the Messages API to chat completion finish reasons
+var anthropicFinishReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"pause_turn":    "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+	"refusal":       "content_filter",
+}
+
+// anthropicUsage is the usage of a Messages API response
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+}
+
+// chatUsage returns the usage as chat completion usage, whose prompt tokens include the cached ones
+func (u anthropicUsage) chatUsage() map[string]interface{} {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	return map[string]interface{}{
+		"prompt_tokens":         prompt,
+		"completion_tokens":     u.OutputTokens,
+		"total_tokens":          prompt + u.OutputTokens,
+		"prompt_tokens_details": map[string]int64{"cached_tokens": u.CacheReadInputTokens},
+	}
+}
+
+// anthropicToChat converts a Messages API response to a chat completion with a single choice, and a Messages API error
+// to an OpenAI error
+func anthropicToChat(status int, data []byte, created int64) ([]byte, error) {
+	if status < 200 || status >= 300 {
+		var failure struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &failure); err != nil || failure.Error.Type == "" {
+			return nil, errors.New("no error")
+		}
+		return json.Marshal(errorBody{Error: errorDetail{Message: failure.Error.Message, Type: failure.Error.Type, Code: failure.Error.Type}})
+	}
+
+	var response struct {
+		ID         string `json:"id"`
+		Model      string `json:"model"`
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage *anthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if response.Content == nil {
+		return nil, errors.New("no content")
+	}
+
+	var text strings.Builder
+	var toolCalls []interface{}
+	for _, block := range response.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       block.ID,
+				"type":     "function",
+				"function": map[string]string{"name": block.Name, "arguments": string(block.Input)},
+			})
+		}
+	}
+	message := map[string]interface{}{"role": "assistant", "content": nil, "refusal": nil}
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	finishReason, ok := anthropicFinishReasons[response.StopReason]
+	if !ok {
+		finishReason = "stop"
+	}
+
+	completion := map[string]interface{}{
+		"id":      response.ID,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   response.Model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       message,
+			"logprobs":      nil,
+			"finish_reason": finishReason,
+		}},
+	}
+	if response.Usage != nil {
+		completion["usage"] = response.Usage.chatUsage()
+	}
+	return json.Marshal(completion)
+}
+
+// anthropicStream translates the events of a Messages API stream to chat completion chunks
+type anthropicStream struct {
+	includeUsage bool
+	created      int64
+	pending      []byte
+	id           string
+	model        string
+	// tools maps the index of a tool use block to the index of its tool call
+	tools map[int]int
+	usage anthropicUsage
+}
+
+// anthropicEvent is the part of a Messages API stream event that has a chat completion equivalent
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *struct {
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+// translate returns the chunks of the events that are complete, keeping an incomplete event until its end arrives
+func (s *anthropicStream) translate(data []byte) []byte {
+	s.pending = append(s.pending, data...)
+	var out bytes.Buffer
+	for {
+		end := bytes.Index(s.pending, []byte("\n\n"))
+		if end < 0 {
+			return out.Bytes()
+		}
+		event := s.pending[:end]
+		s.pending = s.pending[end+2:]
+		for _, line := range strings.Split(string(event), "\n") {
+			if payload, ok := strings.CutPrefix(strings.TrimSuffix(line, "\r"), "data:"); ok {
+				s.event([]byte(strings.TrimSpace(payload)), &out)
+			}
+		}
+	}
+}
+
+// event writes the chunks of a single event
+func (s *anthropicStream) event(payload []byte, out *bytes.Buffer) {
+	var event anthropicEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.id, s.model, s.usage = event.Message.ID, event.Message.Model, event.Message.Usage
+		s.chunk(out, map[string]interface{}{"role": "assistant", "content": ""}, nil)
+	case "content_block_start":
+		if event.ContentBlock.Type == "tool_use" {
+			index := len(s.tools)
+			s.tools[event.Index] = index
+			s.chunk(out, map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+				"index":    index,
+				"id":       event.ContentBlock.ID,
+				"type":     "function",
+				"function": map[string]string{"name": event.ContentBlock.Name, "arguments": ""},
+			}}}, nil)
+		}
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			s.chunk(out, map[string]interface{}{"content": event.Delta.Text}, nil)
+		case "input_json_delta":
+			s.chunk(out, map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+				"index":    s.tools[event.Index],
+				"function": map[string]string{"arguments": event.Delta.PartialJSON},
+			}}}, nil)
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+		finishReason, ok := anthropicFinishReasons[event.Delta.StopReason]
+		if !ok {
+			finishReason = "stop"
+		}
+		s.chunk(out, map[string]interface{}{}, finishReason)
+	case "message_stop":
+		if s.includeUsage {
+			s.write(out, map[string]interface{}{"choices": []interface{}{}, "usage": s.usage.chatUsage()})
+		}
+		out.WriteString("data: [DONE]\n\n")
+	case "error":
+		if data, err := json.Marshal(map[string]json.RawMessage{"error": event.Error}); err == nil {
+			out.WriteString("data: " + string(data) + "\n\n")
+		}
+	}
+}
+
+// chunk writes a chat completion chunk with a single choice
+func (s *anthropicStream) chunk(out *bytes.Buffer, delta map[string]interface{}, finishReason interface{}) {
+	s.write(out, map[string]interface{}{"choices": []interface{}{map[string]interface{}{
+		"index":         0,
+		"delta":         delta,
+		"logprobs":      nil,
+		"finish_reason": finishReason,
+	}}})
+}
+
+// write writes a chat completion chunk event
+func (s *anthropicStream) write(out *bytes.Buffer, chunk map[string]interface{}) {
+	chunk["id"] = s.id
+	chunk["object"] = "chat.completion.chunk"
+	chunk["created"] = s.created
+	chunk["model"] = s.model
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return
+	}
+	out.WriteString("data: " + string(data) + "\n\n")
+}
+
+// translateToAnthropic rewrites a chat completion request to the Messages API, moves the API key to x-api-key and
+// returns the writer that translates the response back. A request that cannot be translated is rejected, as the
+// Anthropic upstream could not serve it either.
+func (e *Handler) translateToAnthropic(w http.ResponseWriter, r *http.Request, kinds []EndpointKind) (http.ResponseWriter, *translationWriter, bool) {
+	if !containsKind(kinds, ChatCompletionEndpoint) {
+		return w, nil, false
+	}
+
+	var request *anthropicRequest
+	err := rewriteBody(r, func(members map[string]json.RawMessage) error {
+		var err error
+		if request, err = e.anthropicTranslation.chatToAnthropic(members); err != nil {
+			return err
+		}
+		for field := range members {
+			delete(members, field)
+		}
+		for field, value := range request.members {
+			members[field] = value
+		}
+		return nil
+	})
+	if err != nil {
+		e.reject(w, rejection{
+			status:    http.StatusBadRequest,
+			errorType: "invalid_request_error",
+			code:      "untranslatable_request",
+			message:   fmt.Sprintf("The request cannot be served by the Anthropic Messages API: %s.", err.Error()),
+		})
+		return w, nil, true
+	}
+
+	r.URL.Path = e.anthropicTranslation.path
+	r.URL.RawPath = ""
+	r.RequestURI = r.URL.RequestURI()
+	r.Header.Set(TranslationHeader, "anthropic")
+	r.Header.Set("Anthropic-Version", e.anthropicTranslation.version)
+	key := e.anthropicTranslation.apiKey
+	if authorization := r.Header.Get("Authorization"); key == "" && len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		key = strings.TrimSpace(authorization[7:])
+	}
+	if key != "" {
+		r.Header.Set("X-Api-Key", key)
+	}
+	for _, header := range []string{"Authorization", "OpenAI-Organization", "OpenAI-Project"} {
+		r.Header.Del(header)
+	}
+	// an encoded response or error could not be translated back
+	r.Header.Del("Accept-Encoding")
+	e.metrics.inc("anthropic_translated_total")
+
+	created := time.Now().Unix()
+	translation := newTranslationWriter(w, "anthropic", func(status int, data []byte) ([]byte, error) {
+		return anthropicToChat(status, data, created)
+	})
+	translation.translateErrors = true
+	translation.stream = &anthropicStream{includeUsage: request.includeUsage, created: created, tools: map[int]int{}}
+	return translation, translation, false
+}
@@ -0,0 +1,327 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatToAnthropic(t *testing.T) {
+	input := `{
+		"model": "gpt-4.1",
+		"max_completion_tokens": 200,
+		"max_tokens": 100,
+		"n": 1,
+		"stop": "END",
+		"user": "alice",
+		"parallel_tool_calls": false,
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "developer", "content": [{"type": "text", "text": "Answer in English."}]},
+			{"role": "user", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}]},
+			{"role": "user", "content": "Quickly."},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "description": "Looks up", "parameters": {"type": "object"}}}],
+		"tool_choice": "required"
+	}`
+	want := `{
+		"model": "claude-sonnet-4-5",
+		"max_tokens": 200,
+		"stop_sequences": ["END"],
+		"metadata": {"user_id": "alice"},
+		"system": "Be brief.\n\nAnswer in English.",
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is this?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}},
+				{"type": "text", "text": "Quickly."}
+			]},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "call_1", "name": "lookup", "input": {"q": "cat"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "content": "a cat"}]}
+		],
+		"tools": [{"name": "lookup", "description": "Looks up", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any", "disable_parallel_tool_use": true}
+	}`
+
+	translation, err := newAnthropicTranslation(&AnthropicTranslation{Models: map[string]string{"gpt-4.1": "claude-sonnet-4-5"}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &members); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	request, err := translation.chatToAnthropic(members)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	data, err := json.Marshal(request.members)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	var got, expected interface{}
+	_ = json.Unmarshal(data, &got)
+	_ = json.Unmarshal([]byte(want), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %s but got %s", want, data)
+	}
+}
+
+func TestAnthropicToChat(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     string
+	}{
+		{
+			name:   "message",
+			status: http.StatusOK,
+			response: `{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4-5", "stop_reason": "end_turn",
+				"content": [{"type": "text", "text": "A cat."}],
+				"usage": {"input_tokens": 10, "output_tokens": 3, "cache_read_input_tokens": 2}}`,
+			want: `{"id": "msg_1", "object": "chat.completion", "created": 1700000000, "model": "claude-sonnet-4-5", "choices": [
+				{"index": 0, "message": {"role": "assistant", "content": "A cat.", "refusal": null}, "logprobs": null, "finish_reason": "stop"}
+			], "usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15, "prompt_tokens_details": {"cached_tokens": 2}}}`,
+		},
+		{
+			name:   "tool use",
+			status: http.StatusOK,
+			response: `{"id": "msg_2", "type": "message", "role": "assistant", "model": "claude-sonnet-4-5", "stop_reason": "tool_use",
+				"content": [{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {"q": "cat"}}]}`,
+			want: `{"id": "msg_2", "object": "chat.completion", "created": 1700000000, "model": "claude-sonnet-4-5", "choices": [
+				{"index": 0, "message": {"role": "assistant", "content": null, "refusal": null, "tool_calls": [{"id": "toolu_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\": \"cat\"}"}}]}, "logprobs": null, "finish_reason": "tool_calls"}
+			]}`,
+		},
+		{
+			name:     "error",
+			status:   http.StatusTooManyRequests,
+			response: `{"type": "error", "error": {"type": "rate_limit_error", "message": "Slow down."}}`,
+			want:     `{"error": {"message": "Slow down.", "type": "rate_limit_error", "param": null, "code": "rate_limit_error"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := anthropicToChat(tt.status, []byte(tt.response), 1700000000)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			var got, expected interface{}
+			_ = json.Unmarshal(data, &got)
+			_ = json.Unmarshal([]byte(tt.want), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %s but got %s", tt.want, data)
+			}
+		})
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := "event: message_start\ndata: {\"type\": \"message_start\", \"message\": {\"id\": \"msg_1\", \"model\": \"claude-sonnet-4-5\", \"usage\": {\"input_tokens\": 10, \"output_tokens\": 1}}}\n\n" +
+		"event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"index\": 0, \"delta\": {\"type\": \"text_delta\", \"text\": \"Hi\"}}\n\n" +
+		"event: message_delta\ndata: {\"type\": \"message_delta\", \"delta\": {\"stop_reason\": \"max_tokens\"}, \"usage\": {\"output_tokens\": 4}}\n\n" +
+		"event: message_stop\ndata: {\"type\": \"message_stop\"}\n\n"
+
+	stream := &anthropicStream{includeUsage: true, created: 1700000000, tools: map[int]int{}}
+	var out []byte
+	// split the events mid line, as the upstream may flush anywhere
+	for i := 0; i < len(events); i += 7 {
+		end := i + 7
+		if end > len(events) {
+			end = len(events)
+		}
+		out = append(out, stream.translate([]byte(events[i:end]))...)
+	}
+
+	chunks := strings.Split(strings.TrimSuffix(string(out), "\n\n"), "\n\n")
+	if len(chunks) != 5 || chunks[4] != "data: [DONE]" {
+		t.Fatalf("expected 4 chunks and the done marker but got %q", out)
+	}
+	var deltas []string
+	for _, chunk := range chunks[:4] {
+		var completion struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *struct {
+				TotalTokens int `json:"total_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(chunk, "data: ")), &completion); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		if completion.Object != "chat.completion.chunk" {
+			t.Errorf("expected a chunk but got %s", chunk)
+		}
+		switch {
+		case completion.Usage != nil:
+			deltas = append(deltas, "usage")
+			if completion.Usage.TotalTokens != 14 {
+				t.Errorf("expected 14 total tokens but got %d", completion.Usage.TotalTokens)
+			}
+		case completion.Choices[0].FinishReason != nil:
+			deltas = append(deltas, *completion.Choices[0].FinishReason)
+		default:
+			deltas = append(deltas, completion.Choices[0].Delta.Content)
+		}
+	}
+	if want := []string{"", "Hi", "length", "usage"}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("expected deltas %q but got %q", want, deltas)
+	}
+}
+
+func TestAnthropicTranslation_ServeHTTP(t *testing.T) {
+	response := `{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4-5", "stop_reason": "end_turn", "content": [{"type": "text", "text": "Hi."}]}`
+	tests := []struct {
+		name       string
+		apiKey     string
+		input      string
+		wantStatus int
+		wantKey    string
+	}{
+		{name: "bearer token", input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantStatus: http.StatusOK, wantKey: "sk-ant-client"},
+		{name: "configured key", apiKey: "sk-ant-gateway", input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantStatus: http.StatusOK, wantKey: "sk-ant-gateway"},
+		{name: "unsupported field", input: "{\"model\": \"gpt-4.1\", \"logprobs\": true, \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.AnthropicTranslation = &AnthropicTranslation{APIKey: tt.apiKey}
+
+			var upstream *http.Request
+			var body map[string]json.RawMessage
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream = r
+				data, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(data, &body)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(response))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.input))
+			req.Header.Set("Authorization", "Bearer sk-ant-client")
+			req.Header.Set("OpenAI-Organization", "org-1")
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if upstream != nil {
+					t.Errorf("expected the request not to reach the upstream")
+				}
+				return
+			}
+
+			if upstream.URL.Path != "/v1/messages" {
+				t.Errorf("expected path /v1/messages but got %s", upstream.URL.Path)
+			}
+			if got := upstream.Header.Get("X-Api-Key"); got != tt.wantKey {
+				t.Errorf("expected x-api-key %s but got %s", tt.wantKey, got)
+			}
+			for _, name := range []string{"Authorization", "OpenAI-Organization"} {
+				if upstream.Header.Get(name) != "" {
+					t.Errorf("expected header %s to be removed", name)
+				}
+			}
+			if upstream.Header.Get("Anthropic-Version") != "2023-06-01" {
+				t.Errorf("expected the default anthropic-version but got %s", upstream.Header.Get("Anthropic-Version"))
+			}
+			if string(body["max_tokens"]) != "4096" {
+				t.Errorf("expected the default max_tokens but got %s", body["max_tokens"])
+			}
+			if !strings.Contains(recorder.Body.String(), "\"object\":\"chat.completion\"") || recorder.Header().Get(TranslationHeader) != "anthropic" {
+				t.Errorf("expected a translated chat completion but got %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestAnthropicTranslationEncoding_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "success", status: http.StatusOK, response: `{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4-5", "stop_reason": "end_turn", "content": [{"type": "text", "text": "Hi."}]}`, wantStatus: http.StatusOK, wantBody: "\"object\":\"chat.completion\""},
+		{name: "error", status: http.StatusTooManyRequests, response: `{"type": "error", "error": {"type": "rate_limit_error", "message": "Slow down."}}`, wantStatus: http.StatusTooManyRequests, wantBody: "\"message\":\"Slow down.\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.AnthropicTranslation = &AnthropicTranslation{}
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					w.Header().Set("Content-Encoding", "gzip")
+					w.WriteHeader(tt.status)
+					_, _ = w.Write(gzipped(tt.response))
+					return
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4.1", "messages": [{"role": "user", "content": "Hi"}]}`))
+			req.Header.Set("Authorization", "Bearer sk-ant-client")
+			req.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if recorder.Header().Get("Content-Encoding") != "" || !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("expected a translated body with %s but got %q", tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestInvalidAnthropicTranslation_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*Config)
+	}{
+		{name: "relative path", config: func(c *Config) { c.AnthropicTranslation = &AnthropicTranslation{Path: "v1/messages"} }},
+		{name: "negative max tokens", config: func(c *Config) { c.AnthropicTranslation = &AnthropicTranslation{DefaultMaxTokens: -1} }},
+		{name: "combined with responses", config: func(c *Config) {
+			c.AnthropicTranslation = &AnthropicTranslation{}
+			c.ResponsesTranslation = &ResponsesTranslation{}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			tt.config(config)
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
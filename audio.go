@@ -0,0 +1,122 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+)
+
+// defaultMP3Bitrate is assumed for MP3 audio without a readable frame header, in bits per second
+const defaultMP3Bitrate = 128000
+
+// mp3Bitrates are the Layer III bitrates in kbps by bitrate index, for MPEG-1 and for MPEG-2 and 2.5
+var mp3Bitrates = [2][15]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// audioSeconds estimates the total duration of the input_audio parts from the size of their base64 payload. WAV audio
+// is measured with the byte rate from its header, MP3 audio with the bitrate of its first frame. Parts in other formats
+// are not estimated.
+func audioSeconds(parts []chatContentPart) (float64, bool) {
+	found := false
+	seconds := 0.0
+	for _, part := range parts {
+		if part.Type != "input_audio" {
+			continue
+		}
+		var duration float64
+		var ok bool
+		switch strings.ToLower(part.InputAudio.Format) {
+		case "wav":
+			duration, ok = wavSeconds(part.InputAudio.Data)
+		case "mp3":
+			duration, ok = mp3Seconds(part.InputAudio.Data)
+		}
+		if ok {
+			found = true
+			seconds += duration
+		}
+	}
+	return seconds, found
+}
+
+// wavSeconds divides the size of the data chunk by the byte rate in the format chunk
+func wavSeconds(data string) (float64, bool) {
+	header := decodeBase64At(data, 0, 256)
+	if len(header) < 44 || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return 0, false
+	}
+	byteRate := binary.LittleEndian.Uint32(header[28:32])
+	start := bytes.Index(header[12:], []byte("data"))
+	if byteRate == 0 || start < 0 {
+		return 0, false
+	}
+	samples := base64Length(data) - (12 + start + 8)
+	if samples < 0 {
+		return 0, false
+	}
+	return float64(samples) / float64(byteRate), true
+}
+
+// mp3Seconds divides the size of the audio by the bitrate of the first frame after an ID3v2 tag
+func mp3Seconds(data string) (float64, bool) {
+	size := base64Length(data)
+	offset := 0
+	if tag := decodeBase64At(data, 0, 10); len(tag) == 10 && string(tag[0:3]) == "ID3" {
+		// the tag size is a 28 bit synchsafe integer that excludes the 10 byte header
+		offset = 10 + (int(tag[6]&0x7f)<<21 | int(tag[7]&0x7f)<<14 | int(tag[8]&0x7f)<<7 | int(tag[9]&0x7f))
+	}
+	if offset >= size {
+		return 0, false
+	}
+
+	frame := decodeBase64At(data, offset, 4)
+	if len(frame) < 4 {
+		return 0, false
+	}
+	bitrate := defaultMP3Bitrate
+	if frame[0] == 0xff && frame[1]&0xe0 == 0xe0 && frame[1]&0x06 == 0x02 {
+		table := 1
+		if frame[1]&0x18 == 0x18 {
+			table = 0
+		}
+		if index := frame[2] >> 4; index > 0 && index < 15 {
+			bitrate = mp3Bitrates[table][index] * 1000
+		}
+	}
+	return float64(size-offset) * 8 / float64(bitrate), true
+}
+
+// base64Length returns the decoded length of standard base64 data
+func base64Length(data string) int {
+	data = strings.TrimRight(data, "=")
+	return len(data) * 3 / 4
+}
+
+// decodeBase64At decodes up to n bytes at the byte offset of standard base64 data, without decoding what precedes it
+func decodeBase64At(data string, offset int, n int) []byte {
+	start := offset / 3 * 4
+	if start >= len(data) {
+		return nil
+	}
+	end := start + (n/3+2)*4
+	if end > len(data) {
+		end = len(data)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data[start:end])
+	if err != nil {
+		// data that ends without padding only decodes with the raw encoding
+		decoded, _ = base64.RawStdEncoding.DecodeString(strings.TrimRight(data[start:end], "="))
+	}
+	if skip := offset % 3; skip < len(decoded) {
+		decoded = decoded[skip:]
+	} else {
+		decoded = nil
+	}
+	if len(decoded) > n {
+		decoded = decoded[:n]
+	}
+	return decoded
+}
@@ -0,0 +1,90 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wavData returns a base64 mono 16 bit WAV file of the given duration at 16 kHz
+func wavData(seconds float64) string {
+	samples := int(seconds * 16000 * 2)
+	var data bytes.Buffer
+	data.WriteString("RIFF")
+	_ = binary.Write(&data, binary.LittleEndian, uint32(36+samples))
+	data.WriteString("WAVEfmt ")
+	for _, value := range []interface{}{uint32(16), uint16(1), uint16(1), uint32(16000), uint32(32000), uint16(2), uint16(16)} {
+		_ = binary.Write(&data, binary.LittleEndian, value)
+	}
+	data.WriteString("data")
+	_ = binary.Write(&data, binary.LittleEndian, uint32(samples))
+	data.Write(make([]byte, samples))
+	return base64.StdEncoding.EncodeToString(data.Bytes())
+}
+
+// mp3Data returns base64 MP3 data with an ID3v2 tag and a first frame header of the given MPEG-1 bitrate index
+func mp3Data(size int, bitrateIndex byte) string {
+	var data bytes.Buffer
+	data.Write([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 1, 0})
+	data.Write(make([]byte, 128))
+	data.Write([]byte{0xff, 0xfb, bitrateIndex << 4, 0})
+	data.Write(make([]byte, size-4))
+	return base64.StdEncoding.EncodeToString(data.Bytes())
+}
+
+func TestAudioSeconds_ServeHTTP(t *testing.T) {
+	audio := func(data string, format string) string {
+		return "{\"type\": \"input_audio\", \"input_audio\": {\"data\": \"" + data + "\", \"format\": \"" + format + "\"}}"
+	}
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{name: "wav", parts: []string{audio(wavData(2.5), "wav")}, want: "2.5"},
+		{name: "mp3 bitrate", parts: []string{audio(mp3Data(64000, 5), "mp3")}, want: "8.0"},
+		{name: "mp3 default bitrate", parts: []string{audio(mp3Data(32000, 0), "mp3")}, want: "2.0"},
+		{name: "several", parts: []string{audio(wavData(1), "wav"), audio(wavData(0.5), "WAV")}, want: "1.5"},
+		{name: "unknown format", parts: []string{audio("AAAA", "flac")}, want: ""},
+		{name: "invalid wav", parts: []string{audio("AAAA", "wav")}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("X-OpenAI-Audio-Seconds")
+			}), defaultConfig(), tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			input := "{\"model\": \"gpt-4o-audio-preview\", \"messages\": [{\"role\": \"user\", \"content\": [" + strings.Join(tt.parts, ", ") + "]}]}"
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+			if got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeBase64At(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding} {
+		encoded := encoding.EncodeToString(data)
+		for offset := 0; offset < len(data); offset++ {
+			want := data[offset:]
+			if len(want) > 4 {
+				want = want[:4]
+			}
+			if got := decodeBase64At(encoded, offset, 4); string(got) != string(want) {
+				t.Errorf("expected %q at %d but got %q", want, offset, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Auth schemes the API key of a request can be normalized to
+const (
+	AuthSchemeBearer = "bearer"
+	AuthSchemeAPIKey = "api-key"
+)
+
+// normalizeAuthScheme moves the API key to the configured scheme and removes the other one, so the same clients can
+// be routed to OpenAI, which expects Authorization: Bearer, or to Azure OpenAI, which expects the api-key header. When
+// a request carries both, the key of the configured scheme wins.
+func (e *Handler) normalizeAuthScheme(r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+	bearer := ""
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		bearer = strings.TrimSpace(authorization[7:])
+	}
+	apiKey := r.Header.Get("Api-Key")
+
+	switch e.authScheme {
+	case AuthSchemeBearer:
+		if apiKey == "" {
+			return
+		}
+		if bearer == "" {
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		r.Header.Del("Api-Key")
+	case AuthSchemeAPIKey:
+		if bearer == "" {
+			return
+		}
+		if apiKey == "" {
+			r.Header.Set("Api-Key", bearer)
+		}
+		r.Header.Del("Authorization")
+	}
+	e.metrics.incLabel("auth_scheme_normalized", e.authScheme)
+}
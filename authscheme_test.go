@@ -0,0 +1,68 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthScheme_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name              string
+		authScheme        string
+		readOnly          bool
+		authorization     string
+		apiKey            string
+		wantAuthorization string
+		wantAPIKey        string
+	}{
+		{name: "api key to bearer", authScheme: AuthSchemeBearer, apiKey: "sk-azure", wantAuthorization: "Bearer sk-azure"},
+		{name: "bearer kept", authScheme: AuthSchemeBearer, authorization: "Bearer sk-openai", apiKey: "sk-azure", wantAuthorization: "Bearer sk-openai"},
+		{name: "bearer to api key", authScheme: AuthSchemeAPIKey, authorization: "Bearer sk-openai", wantAPIKey: "sk-openai"},
+		{name: "api key kept", authScheme: AuthSchemeAPIKey, authorization: "Bearer sk-openai", apiKey: "sk-azure", wantAPIKey: "sk-azure"},
+		{name: "other scheme", authScheme: AuthSchemeAPIKey, authorization: "Basic dXNlcjpwYXNz", wantAuthorization: "Basic dXNlcjpwYXNz"},
+		{name: "disabled", authorization: "Bearer sk-openai", apiKey: "sk-azure", wantAuthorization: "Bearer sk-openai", wantAPIKey: "sk-azure"},
+		{name: "read only", authScheme: AuthSchemeBearer, readOnly: true, apiKey: "sk-azure", wantAPIKey: "sk-azure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.AuthScheme = tt.authScheme
+			config.ReadOnly = tt.readOnly
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("Api-Key", tt.apiKey)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.Get("Authorization") != tt.wantAuthorization {
+				t.Errorf("expected Authorization %q but got %q", tt.wantAuthorization, got.Get("Authorization"))
+			}
+			if got.Get("Api-Key") != tt.wantAPIKey {
+				t.Errorf("expected api-key %q but got %q", tt.wantAPIKey, got.Get("Api-Key"))
+			}
+		})
+	}
+}
+
+func TestInvalidAuthScheme_New(t *testing.T) {
+	config := defaultConfig()
+	config.AuthScheme = "basic"
+	if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "invalid auth scheme"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
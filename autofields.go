@@ -0,0 +1,111 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxAutoFieldValueBytes limits the length of a value emitted by the auto fields, so prompts sent as a plain string
+// never end up in a header
+const maxAutoFieldValueBytes = 256
+
+// AutoFields emits every top level string, number and boolean of the body as a header, so new request parameters show
+// up without configuring them one by one
+type AutoFields struct {
+	Prefix    string   `json:"prefix"`
+	Deny      []string `json:"deny"`
+	MaxFields int      `json:"maxFields"`
+}
+
+// autoFields names the headers of the top level scalar fields that are not mapped in requestFields
+type autoFields struct {
+	prefix    string
+	deny      map[string]bool
+	maxFields int
+}
+
+func newAutoFields(config *AutoFields, requestFields map[string]interface{}, neverEmit []string) (*autoFields, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = "X-OpenAI-"
+	}
+	if !validHeaderName(prefix + "Field") {
+		return nil, fmt.Errorf("invalid autoFields prefix %q", config.Prefix)
+	}
+	if config.MaxFields < 0 {
+		return nil, fmt.Errorf("invalid autoFields maxFields %d", config.MaxFields)
+	}
+	maxFields := config.MaxFields
+	if maxFields == 0 {
+		maxFields = 20
+	}
+
+	deny := config.Deny
+	if deny == nil {
+		deny = []string{"prompt", "input", "instructions", "suffix", "system"}
+	}
+	denied := toSet(deny)
+	// fields in requestFields keep the header they are mapped to, or stay unmapped when mapped to false
+	for field := range requestFields {
+		denied[field] = true
+	}
+	for _, field := range neverEmit {
+		denied[field] = true
+	}
+
+	return &autoFields{prefix: prefix, deny: denied, maxFields: maxFields}, nil
+}
+
+// headers returns the header of every top level scalar member that is not denied, in field name order up to the
+// maximum number of fields, with its value translated. Long strings and strings with control characters are left out.
+func (a *autoFields) headers(members map[string]json.RawMessage, format numberFormat, translate func(field string, value string) string) map[string]string {
+	fields := make([]string, 0, len(members))
+	for field := range members {
+		if !a.deny[field] {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	headers := map[string]string{}
+	for _, field := range fields {
+		if len(headers) == a.maxFields {
+			break
+		}
+		value, ok := autoFieldValue(members[field], format)
+		if !ok {
+			continue
+		}
+		name := a.prefix + kebabCase(field, true)
+		if validHeaderName(name) {
+			headers[name] = translate(field, value)
+		}
+	}
+	return headers
+}
+
+// autoFieldValue returns the header value of a string, number or boolean member
+func autoFieldValue(raw json.RawMessage, format numberFormat) (string, bool) {
+	value, ok := scalarText(raw)
+	if !ok || len(value) > maxAutoFieldValueBytes {
+		return "", false
+	}
+	if strings.IndexFunc(value, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+		return "", false
+	}
+	if raw[0] == '"' || format.raw || !strings.ContainsAny(value, ".eE") {
+		return value, true
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value, true
+	}
+	return format.formatFloat(number), true
+}
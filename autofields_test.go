@@ -0,0 +1,114 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAutoFields_ServeHTTP(t *testing.T) {
+	input := "{\"model\": \"gpt-4.1\", \"service_tier\": \"flex\", \"temperature\": 0.70, \"n\": 2, \"store\": true, " +
+		"\"prompt\": \"hello\", \"metadata\": {\"team\": \"search\"}, \"verbosity\": \"" + strings.Repeat("a", 300) + "\", " +
+		"\"stop\": \"line\\nbreak\"}"
+	tests := []struct {
+		name       string
+		autoFields *AutoFields
+		fields     map[string]interface{}
+		want       map[string]string
+	}{
+		{
+			name:       "defaults",
+			autoFields: &AutoFields{},
+			fields:     map[string]interface{}{"model": "X-Model"},
+			want: map[string]string{
+				"X-Model":               "gpt-4.1",
+				"X-OpenAI-Model":        "",
+				"X-OpenAI-Service-Tier": "flex",
+				"X-OpenAI-Temperature":  "0.7",
+				"X-OpenAI-N":            "2",
+				"X-OpenAI-Store":        "true",
+				"X-OpenAI-Prompt":       "",
+				"X-OpenAI-Metadata":     "",
+				"X-OpenAI-Verbosity":    "",
+				"X-OpenAI-Stop":         "",
+			},
+		},
+		{
+			name:       "prefix and deny",
+			autoFields: &AutoFields{Prefix: "X-Param-", Deny: []string{"store"}},
+			fields:     map[string]interface{}{},
+			want: map[string]string{
+				"X-Param-Model":        "gpt-4.1",
+				"X-Param-Service-Tier": "flex",
+				"X-Param-Prompt":       "hello",
+				"X-Param-Store":        "",
+			},
+		},
+		{
+			name:       "max fields",
+			autoFields: &AutoFields{MaxFields: 2},
+			fields:     map[string]interface{}{},
+			want: map[string]string{
+				"X-OpenAI-Model":        "gpt-4.1",
+				"X-OpenAI-N":            "2",
+				"X-OpenAI-Service-Tier": "",
+			},
+		},
+		{
+			name:       "unmapped field",
+			autoFields: &AutoFields{},
+			fields:     map[string]interface{}{"service_tier": false},
+			want: map[string]string{
+				"X-OpenAI-Model":        "gpt-4.1",
+				"X-OpenAI-Service-Tier": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.RequestFields = tt.fields
+			config.AutoFields = tt.autoFields
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+			if got.Get(ParseFailureHeader) != "" {
+				t.Errorf("expected no parse failure but got %q", got.Get(ParseFailureHeader))
+			}
+		})
+	}
+}
+
+func TestInvalidAutoFields_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoFields *AutoFields
+	}{
+		{name: "prefix", autoFields: &AutoFields{Prefix: "X OpenAI "}},
+		{name: "max fields", autoFields: &AutoFields{MaxFields: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.AutoFields = tt.autoFields
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package traefik_openai_header
+
+import "net/http"
+
+// BackendHeader names the backend pool the model of the request is routed to
+const BackendHeader = "X-LLM-Backend"
+
+// routeBackend returns the backend configured for the model in modelBackends, or the default backend when the model
+// is missing or not listed
+func (e *Handler) routeBackend(model string) string {
+	if len(e.modelBackends) == 0 && e.defaultBackend == "" {
+		return ""
+	}
+	backend, ok := e.modelBackends[model]
+	if !ok || model == "" {
+		e.metrics.inc("backend_unmapped_total")
+		backend = e.defaultBackend
+	}
+	if backend != "" {
+		e.metrics.incLabel("requests_by_backend", backend)
+	}
+	return backend
+}
+
+// clearBackend removes the backend headers sent by the client, so a client cannot pick its own backend pool when
+// routers match on them
+func (e *Handler) clearBackend(r *http.Request, mapper *headerMapper) {
+	if len(e.modelBackends) == 0 && e.defaultBackend == "" {
+		return
+	}
+	for _, name := range mapper.fieldHeaders("backend") {
+		r.Header.Del(name)
+	}
+}
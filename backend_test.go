@@ -0,0 +1,48 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModelBackends_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		defaultBackend string
+		want           string
+	}{
+		{name: "listed model", input: "{\"model\": \"gpt-4.1\"}", want: "azure-pool"},
+		{name: "other listed model", input: "{\"model\": \"gpt-4o\"}", want: "openai-pool"},
+		{name: "unlisted model", input: "{\"model\": \"o3\"}", want: ""},
+		{name: "unlisted model with default", input: "{\"model\": \"o3\"}", defaultBackend: "openai-pool", want: "openai-pool"},
+		{name: "no model with default", input: "{\"user\": \"alice\"}", defaultBackend: "openai-pool", want: "openai-pool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ModelBackends = map[string]string{"gpt-4.1": "azure-pool", "gpt-4o": "openai-pool"}
+			config.DefaultBackend = tt.defaultBackend
+			config.ValueMappings = map[string]map[string]string{"model": {"gpt-4.1": "tier-premium"}}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.input))
+			req.Header.Set(BackendHeader, "client-pool")
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.Get(BackendHeader) != tt.want {
+				t.Errorf("expected backend %q but got %q", tt.want, got.Get(BackendHeader))
+			}
+		})
+	}
+}
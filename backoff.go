@@ -0,0 +1,135 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const BackoffHeader = "X-OpenAI-Backoff-Ms"
+
+// rateLimitResetHeaders report when the rate limits of OpenAI (as a duration) and Anthropic (as a timestamp) reset
+var rateLimitResetHeaders = []string{
+	"X-Ratelimit-Reset-Requests",
+	"X-Ratelimit-Reset-Tokens",
+	"Anthropic-Ratelimit-Requests-Reset",
+	"Anthropic-Ratelimit-Tokens-Reset",
+	"Anthropic-Ratelimit-Input-Tokens-Reset",
+	"Anthropic-Ratelimit-Output-Tokens-Reset",
+}
+
+// Backoff configures the backoff hints added to rate limited and overloaded upstream responses
+type Backoff struct {
+	Default string `json:"default"`
+	Max     string `json:"max"`
+}
+
+// backoff is the parsed Backoff config
+type backoff struct {
+	defaultDelay time.Duration
+	maxDelay     time.Duration
+}
+
+func newBackoff(config *Backoff) (*backoff, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	b := &backoff{defaultDelay: time.Second, maxDelay: time.Minute}
+	var err error
+	if config.Default != "" {
+		if b.defaultDelay, err = time.ParseDuration(config.Default); err != nil || b.defaultDelay <= 0 {
+			return nil, fmt.Errorf("invalid backoff default %q", config.Default)
+		}
+	}
+	if config.Max != "" {
+		if b.maxDelay, err = time.ParseDuration(config.Max); err != nil || b.maxDelay <= 0 {
+			return nil, fmt.Errorf("invalid backoff max %q", config.Max)
+		}
+	}
+	return b, nil
+}
+
+// hint sets the backoff hint on the headers of a 429 or 529 response. The delay comes from Retry-After, from the rate
+// limit reset headers or else from the default; Retry-After is synthesized when the upstream did not send it so that
+// clients do not retry immediately.
+func (b *backoff) hint(header http.Header, now time.Time) {
+	delay, ok := retryAfter(header, now)
+	if !ok {
+		if delay, ok = rateLimitReset(header, now); !ok {
+			delay = b.defaultDelay
+		}
+	}
+	if delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+
+	if header.Get("Retry-After") == "" {
+		header.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(delay.Seconds())), 10))
+	}
+	header.Set(BackoffHeader, strconv.FormatInt(delay.Milliseconds(), 10))
+}
+
+// retryAfter returns the delay of the retry-after-ms header or of Retry-After in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return nonNegative(date.Sub(now)), true
+	}
+	return 0, false
+}
+
+// rateLimitReset returns the longest delay until a reported rate limit resets
+func rateLimitReset(header http.Header, now time.Time) (time.Duration, bool) {
+	var longest time.Duration
+	found := false
+	for _, name := range rateLimitResetHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			reset, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				continue
+			}
+			delay = reset.Sub(now)
+		}
+		if delay = nonNegative(delay); !found || delay > longest {
+			longest, found = delay, true
+		}
+	}
+	return longest, found
+}
+
+func nonNegative(delay time.Duration) time.Duration {
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// newBackoffWriter adds backoff hints to rate limited (429) and overloaded (529) responses before their headers are
+// sent
+func newBackoffWriter(w http.ResponseWriter, backoff *backoff) http.ResponseWriter {
+	writer := &responseWriter{ResponseWriter: w}
+	writer.onHeader = func(status int) {
+		if status == http.StatusTooManyRequests || status == 529 {
+			backoff.hint(writer.Header(), time.Now())
+		}
+	}
+	return writer
+}
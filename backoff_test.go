@@ -0,0 +1,102 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		upstream       map[string]string
+		wantRetryAfter string
+		wantBackoff    string
+	}{
+		{
+			name:           "retry after seconds",
+			status:         http.StatusTooManyRequests,
+			upstream:       map[string]string{"Retry-After": "7"},
+			wantRetryAfter: "7",
+			wantBackoff:    "7000",
+		},
+		{
+			name:           "retry after ms",
+			status:         http.StatusTooManyRequests,
+			upstream:       map[string]string{"Retry-After-Ms": "250"},
+			wantRetryAfter: "1",
+			wantBackoff:    "250",
+		},
+		{
+			name:           "openai reset headers",
+			status:         http.StatusTooManyRequests,
+			upstream:       map[string]string{"X-Ratelimit-Reset-Requests": "1.5s", "X-Ratelimit-Reset-Tokens": "6m0s"},
+			wantRetryAfter: "60",
+			wantBackoff:    "60000",
+		},
+		{
+			name:           "anthropic overloaded",
+			status:         529,
+			upstream:       map[string]string{},
+			wantRetryAfter: "2",
+			wantBackoff:    "2000",
+		},
+		{
+			name:           "success",
+			status:         http.StatusOK,
+			upstream:       map[string]string{},
+			wantRetryAfter: "",
+			wantBackoff:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Backoff = &Backoff{Default: "2s"}
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for name, value := range tt.upstream {
+					w.Header().Set(name, value)
+				}
+				w.WriteHeader(tt.status)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+			if got := recorder.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("expected Retry-After %q but got %q", tt.wantRetryAfter, got)
+			}
+			if got := recorder.Header().Get(BackoffHeader); got != tt.wantBackoff {
+				t.Errorf("expected %s %q but got %q", BackoffHeader, tt.wantBackoff, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("Anthropic-Ratelimit-Requests-Reset", "2025-06-01T12:00:03Z")
+	header.Set("Anthropic-Ratelimit-Tokens-Reset", "2025-06-01T11:59:00Z")
+
+	delay, ok := rateLimitReset(header, now)
+	if !ok || delay != 3*time.Second {
+		t.Errorf("expected a delay of 3s but got %v (%v)", delay, ok)
+	}
+}
+
+func TestInvalidBackoff_New(t *testing.T) {
+	config := CreateConfig()
+	config.Backoff = &Backoff{Max: "soon"}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid backoff max")
+	}
+}
@@ -0,0 +1,85 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const baggageHeader = "Baggage"
+
+// maxBaggageBytes is the size limit of the baggage header defined by the W3C Baggage specification
+const maxBaggageBytes = 8192
+
+// appendBaggage adds the configured field values as list members to the W3C baggage header, replacing members with the
+// same key that were set by the client. Values of hashFields are hashed and personal data is redacted like in the
+// extracted headers; baggageHashFields are only hashed in the baggage, so their header can keep the raw value.
+func (e *Handler) appendBaggage(r *http.Request, mapper *headerMapper, values map[string]string) {
+	if len(e.baggageFields) == 0 || len(values) == 0 {
+		return
+	}
+
+	values = mapper.emitted(values)
+	members := map[string]string{}
+	for field, key := range e.baggageFields {
+		value, ok := values[field]
+		if !ok || value == "" || key == "" {
+			continue
+		}
+		value = mapper.valueMasks.mask(field, value)
+		if mapper.hashFields[field] || e.baggageHashFields[field] {
+			value = hashValue(value)
+		} else {
+			value = mapper.redactor.redact(field, value)
+		}
+		members[key] = encodeBaggageValue(value)
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	var list []string
+	for _, header := range r.Header.Values(baggageHeader) {
+		for _, member := range strings.Split(header, ",") {
+			member = strings.TrimSpace(member)
+			key, _, _ := strings.Cut(member, "=")
+			if _, replaced := members[strings.TrimSpace(key)]; member != "" && !replaced {
+				list = append(list, member)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	size := len(strings.Join(list, ","))
+	for _, key := range keys {
+		member := fmt.Sprintf("%s=%s", key, members[key])
+		if size+len(member)+1 > maxBaggageBytes {
+			fmt.Println("Baggage header limit reached, dropping", key)
+			continue
+		}
+		list = append(list, member)
+		size += len(member) + 1
+	}
+
+	r.Header.Set(baggageHeader, strings.Join(list, ","))
+}
+
+// encodeBaggageValue percent-encodes all characters outside the baggage-octet range of the W3C Baggage specification
+func encodeBaggageValue(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0x21 || (c >= 0x23 && c <= 0x2B && c != '%') || (c >= 0x2D && c <= 0x3A) || (c >= 0x3C && c <= 0x5B) || (c >= 0x5D && c <= 0x7E) {
+			builder.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&builder, "%%%02X", c)
+	}
+	return builder.String()
+}
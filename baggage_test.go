@@ -0,0 +1,90 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBaggage_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		existing string
+		fields   map[string]string
+		hash     []string
+		hashed   []string
+		want     string
+	}{
+		{
+			name:   "disabled",
+			input:  "{\"model\": \"gpt-4.1\"}",
+			fields: map[string]string{},
+			want:   "",
+		},
+		{
+			name:   "model and hashed user",
+			input:  "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}",
+			fields: map[string]string{"model": "llm.model", "user": "llm.user"},
+			hash:   []string{"user"},
+			want:   "llm.model=gpt-4.1,llm.user=" + hashValue("alice"),
+		},
+		{
+			name:   "user hashed by hashFields",
+			input:  "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}",
+			fields: map[string]string{"user": "llm.user"},
+			hashed: []string{"user"},
+			want:   "llm.user=" + hashValue("alice"),
+		},
+		{
+			name:     "appends to and replaces existing members",
+			input:    "{\"model\": \"gpt 4.1%\"}",
+			existing: "tenant=acme;ttl=1, llm.model=spoofed",
+			fields:   map[string]string{"model": "llm.model"},
+			want:     "tenant=acme;ttl=1,llm.model=gpt%204.1%25",
+		},
+		{
+			name:     "missing field",
+			input:    "{\"model\": \"gpt-4.1\"}",
+			existing: "tenant=acme",
+			fields:   map[string]string{"user": "llm.user"},
+			want:     "tenant=acme",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.BaggageFields = tt.fields
+			config.BaggageHashFields = tt.hash
+			config.HashFields = tt.hashed
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			request := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input))
+			if tt.existing != "" {
+				request.Header.Set("baggage", tt.existing)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), request)
+
+			if got.Get("baggage") != tt.want {
+				t.Errorf("expected baggage %q but got %q", tt.want, got.Get("baggage"))
+			}
+			// baggageHashFields only hash the baggage, hashFields the header as well
+			wantUser := "alice"
+			if len(tt.hashed) > 0 {
+				wantUser = hashValue("alice")
+			}
+			if user := got.Get("X-OpenAI-User"); len(tt.hash)+len(tt.hashed) > 0 && user != wantUser {
+				t.Errorf("expected the user header %q but got %q", wantUser, user)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Banned content actions controlling what happens to a request whose prompt text matches a banned pattern
+const (
+	BannedContentActionFlag   = "flag"
+	BannedContentActionRedact = "redact"
+	BannedContentActionReject = "reject"
+)
+
+// BannedContent configures terms that must not be sent upstream in the prompt text
+type BannedContent struct {
+	Patterns    map[string]string `json:"patterns"`
+	Action      string            `json:"action"`
+	Placeholder string            `json:"placeholder"`
+	Message     string            `json:"message"`
+}
+
+// bannedContent is the compiled BannedContent policy
+type bannedContent struct {
+	detector *patternDetector
+	redactor *promptRedactor
+	action   string
+	message  string
+}
+
+func newBannedContent(config *BannedContent) (*bannedContent, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if len(config.Patterns) == 0 {
+		return nil, errors.New("bannedContent requires at least one pattern")
+	}
+
+	action := config.Action
+	switch action {
+	case "":
+		action = BannedContentActionFlag
+	case BannedContentActionFlag, BannedContentActionRedact, BannedContentActionReject:
+	default:
+		return nil, fmt.Errorf("invalid bannedContent action %q", config.Action)
+	}
+
+	patterns, err := compileNamedPatterns("bannedContent", config.Patterns, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholder := config.Placeholder
+	if placeholder == "" {
+		placeholder = "[redacted]"
+	}
+
+	message := config.Message
+	if message == "" {
+		message = "The request contains content that is not allowed."
+	}
+
+	return &bannedContent{
+		detector: &patternDetector{patterns: patterns},
+		redactor: &promptRedactor{patterns: patterns, placeholder: placeholder},
+		action:   action,
+		message:  message,
+	}, nil
+}
+
+// enforceBannedContent redacts or rejects a request whose prompt text was flagged with banned content. It returns true
+// when the request was answered. Read only instances only flag.
+func (e *Handler) enforceBannedContent(w http.ResponseWriter, r *http.Request, values map[string]string) bool {
+	if e.bannedContent == nil || e.readOnly || values["banned_content"] == "" {
+		return false
+	}
+
+	switch e.bannedContent.action {
+	case BannedContentActionReject:
+		e.reject(w, rejection{
+			status:    http.StatusBadRequest,
+			errorType: "invalid_request_error",
+			code:      "banned_content",
+			message:   e.bannedContent.message,
+			values:    map[string]string{"patterns": values["banned_content"]},
+		})
+		return true
+	case BannedContentActionRedact:
+		if err := rewriteBody(r, e.bannedContent.redactor.redactPrompt); err != nil {
+			return e.fail(w, fmt.Errorf("unable to redact body: %w", err))
+		}
+	}
+	return false
+}
+
+// enforceUnscannedBannedContent scans the complete body when extraction did not scan its prompt text, because the body
+// was larger than maxBodyBytes, bypassed, not parsed or not read in time, so the policy never depends on the size or
+// shape of a request. A body that cannot be scanned is handled according to failureMode. It returns true when the
+// request was answered. Read only instances and the flag action never read the body for it.
+func (e *Handler) enforceUnscannedBannedContent(w http.ResponseWriter, r *http.Request, kinds []EndpointKind) bool {
+	if e.bannedContent == nil || e.bannedContent.action == BannedContentActionFlag || e.readOnly {
+		return false
+	}
+	var kind EndpointKind
+	for _, candidate := range []EndpointKind{ChatCompletionEndpoint, AnthropicMessagesEndpoint, AnthropicCountTokensEndpoint} {
+		if containsKind(kinds, candidate) {
+			kind = candidate
+			break
+		}
+	}
+	if kind == "" {
+		return false
+	}
+
+	e.metrics.inc("banned_content_full_scans_total")
+	if expectsContinue(r) {
+		return e.fail(w, errors.New("unable to scan for banned content: the client waits for 100 Continue"))
+	}
+	data, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return e.fail(w, fmt.Errorf("unable to scan for banned content: %w", err))
+	}
+	if len(data) == 0 {
+		return false
+	}
+	if e.jsonLimits != nil {
+		if limit := e.jsonLimits.exceeded(data); limit != "" {
+			return e.fail(w, fmt.Errorf("unable to scan for banned content: the body exceeds the %s limit", limit))
+		}
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return e.fail(w, fmt.Errorf("unable to scan for banned content: %w", err))
+	}
+
+	terms := e.bannedContent.detector.detect(promptTexts(kind, members))
+	if len(terms) == 0 {
+		return false
+	}
+	return e.enforceBannedContent(w, r, map[string]string{"banned_content": strings.Join(terms, ",")})
+}
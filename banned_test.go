@@ -0,0 +1,190 @@
+package traefik_openai_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBannedContent_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		readOnly   bool
+		uri        string
+		input      string
+		wantStatus int
+		wantHeader string
+		wantBody   string
+	}{
+		{
+			name:       "flag",
+			action:     BannedContentActionFlag,
+			uri:        "/v1/chat/completions",
+			input:      "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Status of Falcon?\"}]}",
+			wantStatus: http.StatusOK,
+			wantHeader: "falcon",
+			wantBody:   "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Status of Falcon?\"}]}",
+		},
+		{
+			name:       "redact string content",
+			action:     BannedContentActionRedact,
+			uri:        "/v1/chat/completions",
+			input:      "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Status of Falcon and Osprey?\"}]}",
+			wantStatus: http.StatusOK,
+			wantHeader: "falcon,osprey",
+			wantBody:   "{\"messages\":[{\"content\":\"Status of [redacted] and [redacted]?\",\"role\":\"user\"}],\"model\":\"gpt-4.1\"}",
+		},
+		{
+			name:       "redact text parts and system prompt",
+			action:     BannedContentActionRedact,
+			uri:        "/v1/messages",
+			input:      "{\"model\":\"claude-sonnet-4-5\",\"system\":\"You work on falcon.\",\"messages\":[{\"role\":\"user\",\"content\":[{\"type\":\"text\",\"text\":\"falcon roadmap\"},{\"type\":\"image\",\"source\":{\"data\":\"falcon\"}}]}]}",
+			wantStatus: http.StatusOK,
+			wantHeader: "falcon",
+			wantBody:   "{\"messages\":[{\"content\":[{\"text\":\"[redacted] roadmap\",\"type\":\"text\"},{\"source\":{\"data\":\"falcon\"},\"type\":\"image\"}],\"role\":\"user\"}],\"model\":\"claude-sonnet-4-5\",\"system\":\"You work on [redacted].\"}",
+		},
+		{
+			name:       "reject",
+			action:     BannedContentActionReject,
+			uri:        "/v1/chat/completions",
+			input:      "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Status of Falcon?\"}]}",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "read only only flags",
+			action:     BannedContentActionReject,
+			readOnly:   true,
+			uri:        "/v1/chat/completions",
+			input:      "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Status of Falcon?\"}]}",
+			wantStatus: http.StatusOK,
+			wantHeader: "falcon",
+			wantBody:   "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Status of Falcon?\"}]}",
+		},
+		{
+			name:       "clean",
+			action:     BannedContentActionReject,
+			uri:        "/v1/chat/completions",
+			input:      "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Hello!\"}]}",
+			wantStatus: http.StatusOK,
+			wantBody:   "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"Hello!\"}]}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ReadOnly = tt.readOnly
+			config.BannedContent = &BannedContent{
+				Action:   tt.action,
+				Patterns: map[string]string{"falcon": "(?i)\\bfalcon\\b", "osprey": "(?i)\\bosprey\\b"},
+			}
+
+			var got http.Header
+			var body string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", tt.uri, strings.NewReader(tt.input)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(recorder.Body.String(), "\"code\":\"banned_content\"") {
+					t.Errorf("expected a banned_content error but got %s", recorder.Body.String())
+				}
+				return
+			}
+			if got.Get("X-OpenAI-Banned-Content") != tt.wantHeader {
+				t.Errorf("expected header %q but got %q", tt.wantHeader, got.Get("X-OpenAI-Banned-Content"))
+			}
+			if body != tt.wantBody {
+				t.Errorf("expected body %s but got %s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestBannedContentLargeBody_ServeHTTP(t *testing.T) {
+	padding := strings.Repeat("a", 4096)
+	banned := "{\"model\":\"gpt-4.1\",\"messages\":[{\"role\":\"user\",\"content\":\"" + padding + "\"},{\"role\":\"user\",\"content\":\"Status of Falcon?\"}]}"
+	tests := []struct {
+		name        string
+		action      string
+		failureMode string
+		config      func(*Config)
+		input       string
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "over maxBodyBytes", action: BannedContentActionReject, config: func(c *Config) { c.MaxBodyBytes = 1024 }, input: banned, wantStatus: http.StatusBadRequest, wantCode: "banned_content"},
+		{name: "over bypassAboveBytes", action: BannedContentActionReject, config: func(c *Config) { c.BypassAboveBytes = 1024 }, input: banned, wantStatus: http.StatusBadRequest, wantCode: "banned_content"},
+		{name: "clean over maxBodyBytes", action: BannedContentActionReject, config: func(c *Config) { c.MaxBodyBytes = 1024 }, input: strings.Replace(banned, "Falcon", "Eagle", 1), wantStatus: http.StatusOK},
+		{name: "redacted over maxBodyBytes", action: BannedContentActionRedact, config: func(c *Config) { c.MaxBodyBytes = 1024 }, input: banned, wantStatus: http.StatusOK},
+		{name: "exceeding json limits", action: BannedContentActionReject, failureMode: FailureModeClosed, config: func(c *Config) { c.JSONLimits = &JSONLimits{MaxDepth: 2} }, input: banned, wantStatus: http.StatusServiceUnavailable, wantCode: "middleware_failure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.BannedContent = &BannedContent{Action: tt.action, Patterns: map[string]string{"falcon": "(?i)\\bfalcon\\b"}}
+			if tt.failureMode != "" {
+				config.FailureMode = tt.failureMode
+			}
+			tt.config(config)
+
+			var body string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantCode != "" && !strings.Contains(recorder.Body.String(), "\"code\":\""+tt.wantCode+"\"") {
+				t.Errorf("expected a %s error but got %s", tt.wantCode, recorder.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && strings.Contains(body, "Falcon") {
+				t.Errorf("expected the banned term not to reach the upstream but got %s", body)
+			}
+		})
+	}
+}
+
+func TestInvalidBannedContent_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *BannedContent
+	}{
+		{name: "no patterns", config: &BannedContent{}},
+		{name: "invalid pattern", config: &BannedContent{Patterns: map[string]string{"broken": "(falcon"}}},
+		{name: "invalid action", config: &BannedContent{Patterns: map[string]string{"falcon": "falcon"}, Action: "block"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.BannedContent = tt.config
+			if _, err := New(nil, http.NotFoundHandler(), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
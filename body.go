@@ -0,0 +1,139 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxUnknownLengthBodyBytes caps the body buffered for extraction when complete bodies are buffered but the request
+// has no Content-Length, such as a chunked upload, and no bypassAboveBytes is configured
+const maxUnknownLengthBodyBytes = 32 << 20
+
+// errBodyTooLarge reports that a body of unknown length grew beyond the cap on buffered bodies
+var errBodyTooLarge = errors.New("body too large")
+
+// streamedBody forwards the buffered prefix followed by the unread remainder of the original body
+type streamedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// readBodyPrefix reads at most limit bytes of the body for extraction and replaces the request body so that the
+// upstream still receives the complete body. A limit of zero or less reads the whole body.
+// truncated reports whether the body may continue beyond the returned prefix.
+func readBodyPrefix(r *http.Request, limit int64) (prefix []byte, truncated bool, err error) {
+	if limit <= 0 {
+		prefix, err = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(prefix))
+		return prefix, false, err
+	}
+
+	prefix, err = io.ReadAll(io.LimitReader(r.Body, limit))
+	r.Body = streamedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), r.Body),
+		Closer: r.Body,
+	}
+	return prefix, int64(len(prefix)) == limit, err
+}
+
+// readBodyPrefixContext reads the body prefix like readBodyPrefix, but stops waiting for it when the context is done
+// and returns the context error. The prefix is read in the background, so the request body still holds the complete
+// body: the upstream receives the bytes read so far, then the rest as the client sends it.
+func readBodyPrefixContext(ctx context.Context, r *http.Request, limit int64) ([]byte, bool, error) {
+	if ctx.Done() == nil {
+		return readBodyPrefix(r, limit)
+	}
+
+	reader := &backgroundReader{body: r.Body, done: make(chan struct{})}
+	go reader.read(limit)
+
+	select {
+	case <-reader.done:
+	case <-ctx.Done():
+		r.Body = streamedBody{Reader: io.MultiReader(reader, r.Body), Closer: r.Body}
+		return nil, false, ctx.Err()
+	}
+
+	if limit <= 0 {
+		r.Body = io.NopCloser(bytes.NewReader(reader.prefix))
+		return reader.prefix, false, reader.err
+	}
+	r.Body = streamedBody{Reader: io.MultiReader(bytes.NewReader(reader.prefix), r.Body), Closer: r.Body}
+	return reader.prefix, int64(len(reader.prefix)) == limit, reader.err
+}
+
+// backgroundReader reads a body prefix in the background. As a reader it returns the prefix once it is complete.
+type backgroundReader struct {
+	body   io.Reader
+	done   chan struct{}
+	prefix []byte
+	err    error
+	once   sync.Once
+	rest   io.Reader
+}
+
+func (b *backgroundReader) read(limit int64) {
+	defer close(b.done)
+	if limit <= 0 {
+		b.prefix, b.err = io.ReadAll(b.body)
+		return
+	}
+	b.prefix, b.err = io.ReadAll(io.LimitReader(b.body, limit))
+}
+
+func (b *backgroundReader) Read(data []byte) (int, error) {
+	b.once.Do(func() {
+		<-b.done
+		b.rest = bytes.NewReader(b.prefix)
+	})
+	n, err := b.rest.Read(data)
+	if err == io.EOF && b.err != nil {
+		return n, b.err
+	}
+	return n, err
+}
+
+// rewriteBodyFields replaces top level fields of the JSON request body with the given JSON values. The complete body is
+// read, so this should only be used once extraction decided the body has to change. The body is left as it was when
+// it is not a JSON object.
+func rewriteBodyFields(r *http.Request, fields map[string]json.RawMessage) error {
+	return rewriteBody(r, func(members map[string]json.RawMessage) error {
+		for field, value := range fields {
+			members[field] = value
+		}
+		return nil
+	})
+}
+
+// rewriteBody lets rewrite change the top level fields of the complete JSON request body. The body is left as it was
+// when it is not a JSON object or rewrite fails.
+func rewriteBody(r *http.Request, rewrite func(members map[string]json.RawMessage) error) error {
+	data, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	if err := rewrite(members); err != nil {
+		return err
+	}
+
+	rewritten, err := json.Marshal(members)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	return nil
+}
@@ -0,0 +1,389 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamedBody_ServeHTTP(t *testing.T) {
+	image := strings.Repeat("A", 4096)
+	tests := []struct {
+		name         string
+		input        string
+		maxBodyBytes int64
+		want         map[string]string
+	}{
+		{
+			name:         "small body",
+			input:        "{\"model\": \"gpt-4.1\", \"stream\": true}",
+			maxBodyBytes: 1024,
+			want:         map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-Stream": "true"},
+		},
+		{
+			name:         "fields before large messages",
+			input:        "{\"model\": \"gpt-4.1\", \"stream\": true, \"messages\": [{\"role\": \"user\", \"content\": [{\"type\": \"image_url\", \"image_url\": {\"url\": \"data:image/png;base64," + image + "\"}}]}], \"user\": \"alice\"}",
+			maxBodyBytes: 1024,
+			want:         map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-Stream": "true", "X-OpenAI-User": ""},
+		},
+		{
+			name:         "unlimited",
+			input:        "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"" + image + "\"}], \"user\": \"alice\"}",
+			maxBodyBytes: 0,
+			want:         map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MaxBodyBytes = tt.maxBodyBytes
+
+			var got http.Header
+			var body string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				data, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("unexpected error reading forwarded body %v", err)
+				}
+				body = string(data)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			if body != tt.input {
+				t.Errorf("expected the complete body to be forwarded, got %d of %d bytes", len(body), len(tt.input))
+			}
+			if got.Get(ParseFailureHeader) != "" {
+				t.Errorf("not expected parse failure %v", got.Get(ParseFailureHeader))
+			}
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeMembers(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		truncated bool
+		want      []string
+		error     bool
+	}{
+		{name: "complete", data: "{\"model\": \"gpt-4.1\", \"n\": 1}", want: []string{"model", "n"}},
+		{name: "invalid", data: "INVALID JSON", error: true},
+		{name: "array", data: "[1, 2]", error: true},
+		{name: "truncated value", data: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"us", truncated: true, want: []string{"model"}},
+		{name: "truncated key", data: "{\"model\": \"gpt-4.1\", \"tempera", truncated: true, want: []string{"model"}},
+		{name: "truncated invalid", data: "INVALID JSON", truncated: true, error: true},
+		{name: "truncated array", data: "[1, 2", truncated: true, error: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMembers([]byte(tt.data), tt.truncated)
+			if (err != nil) != tt.error {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("expected members %v but got %v", tt.want, got)
+			}
+			for _, key := range tt.want {
+				if _, ok := got[key]; !ok {
+					t.Errorf("expected member %v in %v", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBypassAboveBytes_ServeHTTP(t *testing.T) {
+	input := "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}"
+	tests := []struct {
+		name             string
+		bypassAboveBytes int64
+		markSkipped      bool
+		contentLength    int64
+		want             map[string]string
+	}{
+		{
+			name:             "disabled",
+			bypassAboveBytes: 0,
+			contentLength:    int64(len(input)),
+			want:             map[string]string{"X-OpenAI-Model": "gpt-4.1", SkippedHeader: ""},
+		},
+		{
+			name:             "below threshold",
+			bypassAboveBytes: 1024,
+			markSkipped:      true,
+			contentLength:    int64(len(input)),
+			want:             map[string]string{"X-OpenAI-Model": "gpt-4.1", SkippedHeader: ""},
+		},
+		{
+			name:             "above threshold",
+			bypassAboveBytes: 10,
+			contentLength:    int64(len(input)),
+			want:             map[string]string{"X-OpenAI-Model": "", SkippedHeader: ""},
+		},
+		{
+			name:             "above threshold marked",
+			bypassAboveBytes: 10,
+			markSkipped:      true,
+			contentLength:    int64(len(input)),
+			want:             map[string]string{"X-OpenAI-Model": "", SkippedHeader: "too-large"},
+		},
+		{
+			name:             "unknown length",
+			bypassAboveBytes: 10,
+			markSkipped:      true,
+			contentLength:    -1,
+			want:             map[string]string{"X-OpenAI-Model": "gpt-4.1", SkippedHeader: ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.BypassAboveBytes = tt.bypassAboveBytes
+			config.MarkSkipped = tt.markSkipped
+
+			var got http.Header
+			var body string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			request := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input))
+			request.ContentLength = tt.contentLength
+			e.ServeHTTP(httptest.NewRecorder(), request)
+
+			if body != input {
+				t.Errorf("expected the body to be forwarded untouched, got %q", body)
+			}
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestChunkedBody_ServeHTTP(t *testing.T) {
+	input := "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"messages\": [{\"role\": \"user\", \"content\": \"" + strings.Repeat("a", 4096) + "\"}]}"
+	tests := []struct {
+		name             string
+		maxBodyBytes     int64
+		bypassAboveBytes int64
+		want             map[string]string
+		bypassed         int64
+	}{
+		{
+			name:         "prefix",
+			maxBodyBytes: 64,
+			want:         map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "alice", SkippedHeader: ""},
+		},
+		{
+			name:         "complete within the default cap",
+			maxBodyBytes: 0,
+			want:         map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "alice", SkippedHeader: ""},
+		},
+		{
+			name:             "complete within bypassAboveBytes",
+			maxBodyBytes:     0,
+			bypassAboveBytes: int64(len(input)),
+			want:             map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "alice", SkippedHeader: ""},
+		},
+		{
+			name:             "complete above bypassAboveBytes",
+			maxBodyBytes:     0,
+			bypassAboveBytes: int64(len(input)) - 1,
+			want:             map[string]string{"X-OpenAI-Model": "", "X-OpenAI-User": "", SkippedHeader: "too-large"},
+			bypassed:         1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MaxBodyBytes = tt.maxBodyBytes
+			config.BypassAboveBytes = tt.bypassAboveBytes
+			config.MarkSkipped = true
+
+			var got http.Header
+			var body string
+			var chunked bool
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				chunked = r.ContentLength == -1 && len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			// a body of unknown length is sent chunked
+			reader, writer := io.Pipe()
+			go func() {
+				for i := 0; i < len(input); i += 1000 {
+					_, _ = io.WriteString(writer, input[i:min(i+1000, len(input))])
+				}
+				_ = writer.Close()
+			}()
+			resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", reader)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if !chunked {
+				t.Errorf("expected a chunked request")
+			}
+			if body != input {
+				t.Errorf("expected the complete body to be forwarded, got %d bytes", len(body))
+			}
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+			if count := e.(*Handler).metrics.snapshot().Counters["unknown_length_bypassed_total"]; count != tt.bypassed {
+				t.Errorf("expected %d bypassed bodies but got %d", tt.bypassed, count)
+			}
+		})
+	}
+}
+
+func TestExtractionTimeout_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.ExtractionTimeout = "20ms"
+
+	var body string
+	var model string
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		model = r.Header.Get("X-OpenAI-Model")
+	}), config, "timeout")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(writer, "{\"model\": ")
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.WriteString(writer, "\"gpt-4.1\"}")
+		_ = writer.Close()
+	}()
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", reader))
+
+	if body != "{\"model\": \"gpt-4.1\"}" {
+		t.Errorf("expected the complete body to be forwarded but got %q", body)
+	}
+	if model != "" {
+		t.Errorf("expected no extraction after the timeout but got %q", model)
+	}
+	if count := e.(*Handler).metrics.snapshot().Counters["extraction_timeouts_total"]; count != 1 {
+		t.Errorf("expected the timeout to be counted but got %d", count)
+	}
+}
+
+func TestExtractionCanceled_ServeHTTP(t *testing.T) {
+	forwarded := false
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		forwarded = true
+	}), defaultConfig(), "canceled")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/v1/chat/completions", reader).WithContext(ctx)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	if forwarded {
+		t.Errorf("expected a canceled request not to be forwarded")
+	}
+	if count := e.(*Handler).metrics.snapshot().Counters["extraction_canceled_total"]; count != 1 {
+		t.Errorf("expected the cancellation to be counted but got %d", count)
+	}
+}
+
+func TestInvalidExtractionTimeout_New(t *testing.T) {
+	for _, timeout := range []string{"soon", "0s", "-1s"} {
+		config := defaultConfig()
+		config.ExtractionTimeout = timeout
+		if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, timeout); err == nil {
+			t.Errorf("expected an error for %q", timeout)
+		}
+	}
+}
+
+func TestRequestBytes_ServeHTTP(t *testing.T) {
+	input := "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}"
+	tests := []struct {
+		name          string
+		contentLength int64
+		maxBodyBytes  int64
+		spoofed       string
+		want          string
+	}{
+		{name: "content length", contentLength: int64(len(input)), maxBodyBytes: 1 << 20, want: "37"},
+		{name: "spoofed", contentLength: int64(len(input)), maxBodyBytes: 1 << 20, spoofed: "1", want: "37"},
+		{name: "unknown length read completely", contentLength: -1, maxBodyBytes: 1 << 20, want: "37"},
+		{name: "unknown length read partially", contentLength: -1, maxBodyBytes: 16, spoofed: "1", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MaxBodyBytes = tt.maxBodyBytes
+
+			var got string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get(RequestBytesHeader)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			request := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input))
+			request.ContentLength = tt.contentLength
+			if tt.spoofed != "" {
+				request.Header.Set(RequestBytesHeader, tt.spoofed)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), request)
+
+			if got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Body read timeout actions controlling what happens to a request whose body is not read within the bodyReadTimeout
+const (
+	BodyReadTimeoutActionBypass = "bypass"
+	BodyReadTimeoutActionReject = "reject"
+)
+
+// errBodyReadTimeout reports that the body prefix was not read within the bodyReadTimeout
+var errBodyReadTimeout = errors.New("body read timeout")
+
+// handleSlowBody bypasses extraction for a request whose body was not read within the bodyReadTimeout, or rejects it
+// with a 408. It returns true when the request was answered. Read only instances always bypass.
+func (e *Handler) handleSlowBody(w http.ResponseWriter, r *http.Request) bool {
+	e.metrics.inc("body_read_timeouts_total")
+	if e.bodyReadTimeoutAction == BodyReadTimeoutActionReject && !e.readOnly {
+		e.reject(w, rejection{
+			status:    http.StatusRequestTimeout,
+			errorType: "invalid_request_error",
+			code:      "body_read_timeout",
+			message:   "The request body was not received in time.",
+		})
+		return true
+	}
+	if e.markSkipped {
+		r.Header.Set(SkippedHeader, "slow-body")
+	}
+	e.setCostCenter(r, nil)
+	return false
+}
@@ -0,0 +1,121 @@
+package traefik_openai_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyReadTimeout_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		readOnly    bool
+		wantStatus  int
+		wantSkipped string
+	}{
+		{name: "bypass", wantStatus: http.StatusOK, wantSkipped: "slow-body"},
+		{name: "reject", action: BodyReadTimeoutActionReject, wantStatus: http.StatusRequestTimeout},
+		{name: "read only", action: BodyReadTimeoutActionReject, readOnly: true, wantStatus: http.StatusOK, wantSkipped: "slow-body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.BodyReadTimeout = "20ms"
+			config.BodyReadTimeoutAction = tt.action
+			config.MarkSkipped = true
+			config.ReadOnly = tt.readOnly
+			config.CostCenter = &CostCenter{Field: "metadata.project", Default: "shared"}
+
+			var upstream *http.Request
+			var body string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				upstream = r
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			reader, writer := io.Pipe()
+			go func() {
+				_, _ = io.WriteString(writer, "{\"model\": ")
+				time.Sleep(100 * time.Millisecond)
+				_, _ = io.WriteString(writer, "\"gpt-4.1\"}")
+				_ = writer.Close()
+			}()
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/v1/chat/completions", reader)
+			req.Header.Set(costCenterHeader, "chosen-by-client")
+			e.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus == http.StatusRequestTimeout {
+				if upstream != nil || !strings.Contains(recorder.Body.String(), "\"code\":\"body_read_timeout\"") {
+					t.Errorf("expected the request to be rejected but got %s", recorder.Body.String())
+				}
+				return
+			}
+			if got := upstream.Header.Get(SkippedHeader); got != tt.wantSkipped {
+				t.Errorf("expected skipped %q but got %q", tt.wantSkipped, got)
+			}
+			if got := upstream.Header.Get(costCenterHeader); got != "shared" {
+				t.Errorf("expected the default cost center to replace the client's but got %q", got)
+			}
+			if upstream.Header.Get("X-OpenAI-Model") != "" {
+				t.Errorf("expected extraction to be bypassed")
+			}
+			if body != "{\"model\": \"gpt-4.1\"}" {
+				t.Errorf("expected the complete body to be forwarded but got %q", body)
+			}
+		})
+	}
+}
+
+func TestBodyReadTimeoutFastBody_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.BodyReadTimeout = "1s"
+
+	var model string
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		model = r.Header.Get("X-OpenAI-Model")
+	}), config, "fast")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+	if model != "gpt-4.1" {
+		t.Errorf("expected a body read in time to be extracted but got %q", model)
+	}
+}
+
+func TestInvalidBodyReadTimeout_New(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		action  string
+	}{
+		{name: "timeout", timeout: "slow"},
+		{name: "zero", timeout: "0s"},
+		{name: "action", timeout: "1s", action: "drop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.BodyReadTimeout = tt.timeout
+			config.BodyReadTimeoutAction = tt.action
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Budget actions controlling what happens to a request of a tenant that exhausted its monthly budget
+const (
+	BudgetActionReject = "reject"
+	BudgetActionFlag   = "flag"
+)
+
+// Budget stores
+const (
+	BudgetStoreMemory = "memory"
+	BudgetStoreRedis  = "redis"
+)
+
+// Headers set on the request and the response when a tenant nears or exceeds its monthly budget
+const (
+	BudgetWarningHeader  = "X-OpenAI-Budget-Warning"
+	BudgetExceededHeader = "X-OpenAI-Budget-Exceeded"
+)
+
+// Budget configures a monthly spend limit in USD per tenant. Spend is accumulated from the usage the upstream reports,
+// priced with the configured prices and the price catalog.
+type Budget struct {
+	Monthly  float64            `json:"monthly"`
+	Tenants  map[string]float64 `json:"tenants"`
+	Warnings []float64          `json:"warnings"`
+	Action   string             `json:"action"`
+	Store    string             `json:"store"`
+}
+
+// spendStore accumulates spend in micro dollars per tenant and month
+type spendStore interface {
+	spent(tenant string, month string) (int64, error)
+	add(tenant string, month string, amount int64) error
+}
+
+// budget is the compiled Budget policy
+type budget struct {
+	monthly  float64
+	tenants  map[string]float64
+	warnings []float64
+	action   string
+	prices   *prices
+	store    spendStore
+	// unsettled is the spend that could not be added to the store yet, retried with the next charge of the tenant
+	unsettled *memorySpendStore
+	now       func() time.Time
+}
+
+func newBudget(config *Budget, prices *prices, redis *RedisConfig) (*budget, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if !prices.available() {
+		return nil, errors.New("budget requires prices or a priceCatalog")
+	}
+	if config.Monthly < 0 {
+		return nil, fmt.Errorf("invalid budget monthly %v", config.Monthly)
+	}
+	for tenant, limit := range config.Tenants {
+		if limit < 0 {
+			return nil, fmt.Errorf("invalid budget for tenant %s", tenant)
+		}
+	}
+
+	warnings := config.Warnings
+	if warnings == nil {
+		warnings = []float64{0.8}
+	}
+	for _, warning := range warnings {
+		if warning <= 0 || warning >= 1 {
+			return nil, fmt.Errorf("invalid budget warning %v", warning)
+		}
+	}
+	warnings = append([]float64{}, warnings...)
+	sort.Float64s(warnings)
+
+	action := config.Action
+	switch action {
+	case "":
+		action = BudgetActionReject
+	case BudgetActionReject, BudgetActionFlag:
+	default:
+		return nil, fmt.Errorf("invalid budget action %q", config.Action)
+	}
+
+	var store spendStore
+	switch config.Store {
+	case "", BudgetStoreMemory:
+		store = &memorySpendStore{spend: map[string]int64{}}
+	case BudgetStoreRedis:
+		client, err := newRedisClient(redis)
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget store: %w", err)
+		}
+		store = &redisSpendStore{client: client}
+	default:
+		return nil, fmt.Errorf("invalid budget store %q", config.Store)
+	}
+
+	return &budget{
+		monthly:   config.Monthly,
+		tenants:   config.Tenants,
+		warnings:  warnings,
+		action:    action,
+		prices:    prices,
+		store:     store,
+		unsettled: &memorySpendStore{spend: map[string]int64{}},
+		now:       time.Now,
+	}, nil
+}
+
+// limit returns the monthly budget of the tenant, or 0 when the tenant has no budget
+func (b *budget) limit(tenant string) float64 {
+	if limit, ok := b.tenants[tenant]; ok {
+		return limit
+	}
+	return b.monthly
+}
+
+// month returns the current calendar month in UTC, which keys the accumulated spend
+func (b *budget) month() string {
+	return b.now().UTC().Format("2006-01")
+}
+
+// budgetTenant returns the tenant spend is accounted to: the tenant of a tenant handler, or the value of the tenant
+// header or the host of the request
+func (e *Handler) budgetTenant(r *http.Request) string {
+	if e.tenantName != "" {
+		return e.tenantName
+	}
+	return e.tenantKey(r)
+}
+
+// enforceBudget flags the request with the highest warning threshold the spend of its tenant crossed, and rejects it
+// once the budget is exhausted. It returns true when the request was answered. Read only instances only flag. When the
+// spend cannot be read the request fails with the failure mode. The budget left is reported as a quota that resets at
+// the start of the next month.
+func (e *Handler) enforceBudget(w http.ResponseWriter, r *http.Request, tenant string, quotas *quotaHeaders) bool {
+	limit := e.budget.limit(tenant)
+	if limit <= 0 {
+		return false
+	}
+
+	micros, err := e.budget.store.spent(tenant, e.budget.month())
+	if err != nil {
+		return e.fail(w, fmt.Errorf("unable to read budget spend: %w", err))
+	}
+	unsettled, _ := e.budget.unsettled.spent(tenant, e.budget.month())
+	spent := float64(micros+unsettled) / 1e6
+
+	now := e.budget.now().UTC()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	quotas.observe(limit, limit-spent, nextMonth.Sub(now), 2)
+
+	if spent >= limit {
+		if e.budget.action == BudgetActionReject && !e.readOnly {
+			e.reject(w, rejection{
+				status:    http.StatusTooManyRequests,
+				errorType: "insufficient_quota",
+				code:      "budget_exceeded",
+				message:   "The monthly budget is exhausted.",
+				values: map[string]string{
+					"tenant": tenant,
+					"budget": strconv.FormatFloat(limit, 'f', -1, 64),
+					"spent":  strconv.FormatFloat(spent, 'f', 2, 64),
+				},
+			})
+			return true
+		}
+		r.Header.Set(BudgetExceededHeader, "true")
+		w.Header().Set(BudgetExceededHeader, "true")
+		return false
+	}
+
+	for i := len(e.budget.warnings) - 1; i >= 0; i-- {
+		if spent >= limit*e.budget.warnings[i] {
+			warning := strconv.FormatFloat(e.budget.warnings[i]*100, 'f', -1, 64)
+			r.Header.Set(BudgetWarningHeader, warning)
+			w.Header().Set(BudgetWarningHeader, warning)
+			break
+		}
+	}
+	return false
+}
+
+// chargeBudget adds the cost of a successful response to the spend of the tenant. The cost is priced from the usage
+// the upstream reported, or estimated from the size of the request and its output token limit when the response did
+// not report usage. Responses answered from the cache or coalesced with a duplicate are not charged. The response is
+// already sent when it is charged, so a cost the store does not take is kept as unsettled spend of the tenant, which
+// still counts against its budget and is added to the store with its next charge.
+func (e *Handler) chargeBudget(r *http.Request, tenant string, values map[string]string, meter *usageWriter) {
+	if meter.status < 200 || meter.status > 299 {
+		return
+	}
+	if meter.Header().Get(CacheHeader) == "hit" || meter.Header().Get(DeduplicatedHeader) == "coalesced" {
+		return
+	}
+
+	if meter.encoded {
+		e.metrics.incLabel("usage_encoded_responses", "budget")
+	}
+	usage, ok := meter.result()
+	if !ok {
+		usage = estimateUsage(r, values)
+	}
+	model := values["model"]
+	if model == "" {
+		model = usage.model
+	}
+
+	price, ok := e.budget.prices.lookup(model)
+	if !ok {
+		e.metrics.inc("budget_unpriced_total")
+		return
+	}
+	micros := int64(price.cost(usage)*1e6 + 0.5)
+	if micros <= 0 {
+		return
+	}
+	month := e.budget.month()
+	micros += e.budget.unsettled.take(tenant, month)
+	if err := e.budget.store.add(tenant, month, micros); err != nil {
+		_ = e.budget.unsettled.add(tenant, month, micros)
+		e.metrics.inc("budget_charge_failures_total")
+		fmt.Println("Unable to charge budget", err.Error())
+	}
+}
+
+// estimateUsage estimates the usage of a request from the prompt tokens estimated from its text and images, or from
+// its size at about four bytes per token when its messages were not extracted, and its output token limit
+func estimateUsage(r *http.Request, values map[string]string) tokenUsage {
+	var usage tokenUsage
+	if tokens, err := strconv.ParseInt(values["estimated_prompt_tokens"], 10, 64); err == nil {
+		usage.input = tokens
+	} else if r.ContentLength > 0 {
+		usage.input = r.ContentLength / 4
+	}
+	for _, field := range []string{"max_completion_tokens", "max_tokens", "max_output_tokens"} {
+		if limit, err := strconv.ParseInt(values[field], 10, 64); err == nil {
+			usage.output = limit
+			break
+		}
+	}
+	return usage
+}
+
+// memorySpendStore keeps the spend of the current month in memory. Spend of earlier months is dropped.
+type memorySpendStore struct {
+	mu    sync.Mutex
+	month string
+	spend map[string]int64
+}
+
+func (s *memorySpendStore) spent(tenant string, month string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if month != s.month {
+		return 0, nil
+	}
+	return s.spend[tenant], nil
+}
+
+func (s *memorySpendStore) add(tenant string, month string, amount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if month != s.month {
+		s.month = month
+		s.spend = map[string]int64{}
+	}
+	s.spend[tenant] += amount
+	return nil
+}
+
+// take removes the spend of the tenant and returns it
+func (s *memorySpendStore) take(tenant string, month string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if month != s.month {
+		return 0
+	}
+	amount := s.spend[tenant]
+	delete(s.spend, tenant)
+	return amount
+}
+
+// redisSpendStore keeps the spend in Redis, so the budget holds across replicas. Keys expire after the month is over.
+type redisSpendStore struct {
+	client *redisClient
+}
+
+func (s *redisSpendStore) key(tenant string, month string) string {
+	return "budget:" + month + ":" + tenant
+}
+
+func (s *redisSpendStore) spent(tenant string, month string) (int64, error) {
+	value, err := s.client.get(s.key(tenant, month))
+	if err == errRedisNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (s *redisSpendStore) add(tenant string, month string, amount int64) error {
+	key := s.client.key(s.key(tenant, month))
+	if _, err := s.client.do("INCRBY", key, strconv.FormatInt(amount, 10)); err != nil {
+		return err
+	}
+	_, err := s.client.do("PEXPIRE", key, strconv.FormatInt((35*24*time.Hour).Milliseconds(), 10))
+	return err
+}
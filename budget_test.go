@@ -0,0 +1,395 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceTableLookup(t *testing.T) {
+	prices := priceTable{"gpt-4o": {Input: 2.5, Output: 10}, "gpt-4o-mini": {Input: 0.15, Output: 0.6}}
+
+	tests := []struct {
+		model string
+		want  float64
+		found bool
+	}{
+		{model: "gpt-4o", want: 2.5, found: true},
+		{model: "gpt-4o-2024-08-06", want: 2.5, found: true},
+		{model: "gpt-4o-mini-2024-07-18", want: 0.15, found: true},
+		{model: "gpt-4", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, ok := prices.lookup(tt.model)
+			if ok != tt.found || price.Input != tt.want {
+				t.Errorf("expected %v %v but got %v %v", tt.want, tt.found, price.Input, ok)
+			}
+		})
+	}
+
+	if cost := (ModelPrice{Input: 2.5, Output: 10}).cost(tokenUsage{input: 1000, output: 500}); cost != 0.0075 {
+		t.Errorf("expected a cost of 0.0075 but got %v", cost)
+	}
+}
+
+func TestUsageWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        tokenUsage
+		found       bool
+	}{
+		{
+			name:        "chat completion",
+			contentType: "application/json",
+			body:        `{"model": "gpt-4o-2024-08-06", "usage": {"prompt_tokens": 12, "completion_tokens": 34}}`,
+			want:        tokenUsage{model: "gpt-4o-2024-08-06", input: 12, output: 34},
+			found:       true,
+		},
+		{
+			name:        "chat completion stream",
+			contentType: "text/event-stream",
+			body: "data: {\"model\": \"gpt-4o\", \"choices\": [], \"usage\": null}\n\n" +
+				"data: {\"model\": \"gpt-4o\", \"choices\": [], \"usage\": {\"prompt_tokens\": 5, \"completion_tokens\": 7}}\n\n" +
+				"data: [DONE]\n\n",
+			want:  tokenUsage{model: "gpt-4o", input: 5, output: 7},
+			found: true,
+		},
+		{
+			name:        "anthropic stream",
+			contentType: "text/event-stream",
+			body: "event: message_start\ndata: {\"type\": \"message_start\", \"message\": {\"model\": \"claude-sonnet-4\", \"usage\": {\"input_tokens\": 25, \"output_tokens\": 1}}}\n\n" +
+				"event: message_delta\ndata: {\"type\": \"message_delta\", \"usage\": {\"output_tokens\": 15}}\n\n",
+			want:  tokenUsage{model: "claude-sonnet-4", input: 25, output: 15},
+			found: true,
+		},
+		{
+			name:        "gemini",
+			contentType: "application/json",
+			body:        `{"modelVersion": "gemini-2.5-pro", "usageMetadata": {"promptTokenCount": 3, "candidatesTokenCount": 4}}`,
+			want:        tokenUsage{model: "gemini-2.5-pro", input: 3, output: 4},
+			found:       true,
+		},
+		{
+			name:        "no usage",
+			contentType: "application/json",
+			body:        `{"model": "gpt-4o"}`,
+			want:        tokenUsage{model: "gpt-4o"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			meter := newUsageWriter(recorder)
+			meter.Header().Set("Content-Type", tt.contentType)
+			for _, chunk := range strings.SplitAfter(tt.body, "\"") {
+				_, _ = io.WriteString(meter, chunk)
+			}
+
+			usage, ok := meter.result()
+			if usage != tt.want || ok != tt.found {
+				t.Errorf("expected %+v %v but got %+v %v", tt.want, tt.found, usage, ok)
+			}
+			if recorder.Body.String() != tt.body {
+				t.Errorf("expected the body to be passed on")
+			}
+		})
+	}
+}
+
+func TestBudget_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		readOnly     bool
+		requests     int
+		wantStatus   int
+		wantWarning  string
+		wantExceeded string
+	}{
+		{name: "under budget", requests: 1, wantStatus: http.StatusOK},
+		{name: "warning", requests: 9, wantStatus: http.StatusOK, wantWarning: "80"},
+		{name: "exhausted", requests: 11, wantStatus: http.StatusTooManyRequests},
+		{name: "flag", action: BudgetActionFlag, requests: 11, wantStatus: http.StatusOK, wantExceeded: "true"},
+		{name: "read only", readOnly: true, requests: 11, wantStatus: http.StatusOK, wantExceeded: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ReadOnly = tt.readOnly
+			config.Prices = map[string]ModelPrice{"gpt-4o": {Input: 0, Output: 100000}}
+			config.Budget = &Budget{Monthly: 10, Action: tt.action}
+
+			var upstream *http.Request
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream = r
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"model": "gpt-4o-2024-08-06", "usage": {"prompt_tokens": 10, "completion_tokens": 10}}`)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				upstream = nil
+				recorder = httptest.NewRecorder()
+				e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\"}")))
+			}
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests {
+				if upstream != nil || !strings.Contains(recorder.Body.String(), "\"code\":\"budget_exceeded\"") {
+					t.Errorf("expected the request to be rejected but got %s", recorder.Body.String())
+				}
+				return
+			}
+			if got := upstream.Header.Get(BudgetWarningHeader); got != tt.wantWarning {
+				t.Errorf("expected warning %q but got %q", tt.wantWarning, got)
+			}
+			if got := recorder.Header().Get(BudgetWarningHeader); got != tt.wantWarning {
+				t.Errorf("expected response warning %q but got %q", tt.wantWarning, got)
+			}
+			if got := upstream.Header.Get(BudgetExceededHeader); got != tt.wantExceeded {
+				t.Errorf("expected exceeded %q but got %q", tt.wantExceeded, got)
+			}
+		})
+	}
+}
+
+func TestBudgetTenants_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.TenantHeader = "X-Tenant"
+	config.Prices = map[string]ModelPrice{"gpt-4o": {Output: 1000000}}
+	config.Budget = &Budget{Monthly: 1, Tenants: map[string]float64{"unlimited": 0}}
+
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"usage": {"completion_tokens": 2}}`)
+	}), config, "tenants")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	serve := func(tenant string) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\"}"))
+		req.Header.Set("X-Tenant", tenant)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if serve("a") != http.StatusOK || serve("a") != http.StatusTooManyRequests {
+		t.Errorf("expected the second request of tenant a to exceed its budget")
+	}
+	if serve("b") != http.StatusOK {
+		t.Errorf("expected tenant b to have its own budget")
+	}
+	if serve("unlimited") != http.StatusOK || serve("unlimited") != http.StatusOK {
+		t.Errorf("expected a budget of 0 to be unlimited")
+	}
+}
+
+func TestBudgetEstimate_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.Prices = map[string]ModelPrice{"gpt-4o": {Output: 1000000}}
+	config.Budget = &Budget{Monthly: 100}
+
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{}`)
+	}), config, "estimate")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	handler := e.(*Handler)
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\", \"max_tokens\": 5}")))
+
+	spent, _ := handler.budget.store.spent("example.com", handler.budget.month())
+	if spent != 5000000 {
+		t.Errorf("expected the output token limit to be charged but got %d", spent)
+	}
+}
+
+func TestBudgetEncoding_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		always      bool
+		wantSpent   int64
+		wantEncoded int64
+	}{
+		{name: "negotiated", wantSpent: 2000000},
+		{name: "always", always: true, wantSpent: 5000000, wantEncoded: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Prices = map[string]ModelPrice{"gpt-4o": {Output: 1000000}}
+			config.Budget = &Budget{Monthly: 100}
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.always || strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					w.Header().Set("Content-Encoding", "gzip")
+					_, _ = w.Write(gzipped(`{"usage": {"completion_tokens": 2}}`))
+					return
+				}
+				_, _ = io.WriteString(w, `{"usage": {"completion_tokens": 2}}`)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			handler := e.(*Handler)
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\", \"max_tokens\": 5}"))
+			req.Header.Set("Accept-Encoding", "gzip")
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			// an encoded response falls back to the estimate from the output token limit
+			if spent, _ := handler.budget.store.spent("example.com", handler.budget.month()); spent != tt.wantSpent {
+				t.Errorf("expected %d to be charged but got %d", tt.wantSpent, spent)
+			}
+			if got := handler.metrics.snapshot().Labeled["usage_encoded_responses"]["budget"]; got != tt.wantEncoded {
+				t.Errorf("expected %d encoded responses but got %d", tt.wantEncoded, got)
+			}
+		})
+	}
+}
+
+func TestBudgetRedis_ServeHTTP(t *testing.T) {
+	server := newFakeRedis(t)
+	config := defaultConfig()
+	config.Redis = &RedisConfig{Address: server.address(), Password: "secret"}
+	config.Prices = map[string]ModelPrice{"gpt-4o": {Input: 1000000}}
+	config.Budget = &Budget{Monthly: 100, Store: BudgetStoreRedis}
+
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"usage": {"prompt_tokens": 3}}`)
+	}), config, "redis")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	e.(*Handler).budget.now = func() time.Time {
+		return time.Date(2025, 6, 30, 23, 0, 0, 0, time.UTC)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\"}")))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if value := server.values["openai-header:budget:2025-06:example.com"]; value != "3000000" {
+		t.Errorf("expected the spend to be stored in redis but got %v", server.values)
+	}
+}
+
+// flakySpendStore is a memory spend store whose reads or writes fail
+type flakySpendStore struct {
+	memorySpendStore
+	failSpent bool
+	failAdd   bool
+}
+
+func (s *flakySpendStore) spent(tenant string, month string) (int64, error) {
+	if s.failSpent {
+		return 0, errors.New("store unavailable")
+	}
+	return s.memorySpendStore.spent(tenant, month)
+}
+
+func (s *flakySpendStore) add(tenant string, month string, amount int64) error {
+	if s.failAdd {
+		return errors.New("store unavailable")
+	}
+	return s.memorySpendStore.add(tenant, month, amount)
+}
+
+func TestBudgetStoreFailure_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode string
+		failSpent   bool
+		failAdd     bool
+		requests    int
+		wantStatus  int
+	}{
+		{name: "read fails open", failSpent: true, requests: 1, wantStatus: http.StatusOK},
+		{name: "read fails closed", failureMode: FailureModeClosed, failSpent: true, requests: 1, wantStatus: http.StatusServiceUnavailable},
+		{name: "charge fails", failAdd: true, requests: 11, wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.FailureMode = tt.failureMode
+			config.Prices = map[string]ModelPrice{"gpt-4o": {Input: 0, Output: 100000}}
+			config.Budget = &Budget{Monthly: 10}
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"usage": {"prompt_tokens": 10, "completion_tokens": 10}}`)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			store := &flakySpendStore{memorySpendStore: memorySpendStore{spend: map[string]int64{}}, failSpent: tt.failSpent, failAdd: tt.failAdd}
+			e.(*Handler).budget.store = store
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				recorder = httptest.NewRecorder()
+				e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\"}")))
+			}
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if !tt.failAdd {
+				return
+			}
+
+			// the unsettled spend is added to the store with the next charge once the store is back
+			store.failAdd = false
+			e.(*Handler).budget.tenants = map[string]float64{"example.com": 100}
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4o\"}")))
+			if spent, _ := store.spent("example.com", e.(*Handler).budget.month()); spent != 11000000 {
+				t.Errorf("expected the unsettled spend to be added to the store but got %d", spent)
+			}
+		})
+	}
+}
+
+func TestInvalidBudget_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices map[string]ModelPrice
+		budget *Budget
+	}{
+		{name: "no prices", budget: &Budget{Monthly: 1}},
+		{name: "negative price", prices: map[string]ModelPrice{"gpt-4o": {Input: -1}}},
+		{name: "negative monthly", prices: map[string]ModelPrice{"gpt-4o": {}}, budget: &Budget{Monthly: -1}},
+		{name: "warning", prices: map[string]ModelPrice{"gpt-4o": {}}, budget: &Budget{Monthly: 1, Warnings: []float64{1.5}}},
+		{name: "action", prices: map[string]ModelPrice{"gpt-4o": {}}, budget: &Budget{Monthly: 1, Action: "block"}},
+		{name: "store", prices: map[string]ModelPrice{"gpt-4o": {}}, budget: &Budget{Monthly: 1, Store: "disk"}},
+		{name: "redis", prices: map[string]ModelPrice{"gpt-4o": {}}, budget: &Budget{Monthly: 1, Store: BudgetStoreRedis}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Prices = tt.prices
+			config.Budget = tt.budget
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
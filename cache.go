@@ -0,0 +1,251 @@
+package traefik_openai_header
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CacheHeader = "X-OpenAI-Cache"
+
+// Response cache stores
+const (
+	CacheStoreMemory = "memory"
+	CacheStoreRedis  = "redis"
+)
+
+// ResponseCache configures serving repeated deterministic chat completions from a cache
+type ResponseCache struct {
+	Store            string `json:"store"`
+	TTL              string `json:"ttl"`
+	MaxEntries       int    `json:"maxEntries"`
+	MaxResponseBytes int64  `json:"maxResponseBytes"`
+}
+
+// responseStore keeps encoded responses for a limited time
+type responseStore interface {
+	get(key string) ([]byte, bool, error)
+	set(key string, value []byte, ttl time.Duration) error
+}
+
+// responseCache serves cached responses for requests with the same cache key
+type responseCache struct {
+	store            responseStore
+	ttl              time.Duration
+	maxResponseBytes int64
+}
+
+// cachedResponse is a response as it is kept in the store
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func newResponseCache(config *ResponseCache, redis *RedisConfig) (*responseCache, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	ttl := 5 * time.Minute
+	if config.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(config.TTL); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid responseCache ttl %q", config.TTL)
+		}
+	}
+
+	maxResponseBytes := config.MaxResponseBytes
+	if maxResponseBytes <= 0 {
+		maxResponseBytes = 1 << 20
+	}
+
+	var store responseStore
+	switch config.Store {
+	case "", CacheStoreMemory:
+		maxEntries := config.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = 1000
+		}
+		store = newMemoryStore(maxEntries)
+	case CacheStoreRedis:
+		client, err := newRedisClient(redis)
+		if err != nil {
+			return nil, fmt.Errorf("invalid responseCache store: %w", err)
+		}
+		store = &redisStore{client: client}
+	default:
+		return nil, fmt.Errorf("invalid responseCache store %q", config.Store)
+	}
+
+	return &responseCache{store: store, ttl: ttl, maxResponseBytes: maxResponseBytes}, nil
+}
+
+// key returns the cache key of a deterministic, non-streaming chat completion. Requests with another endpoint kind,
+// a temperature other than 0 or without an extracted cache key are not cached. The key includes the fingerprint of the
+// API key, whichever header carries it, so responses are never shared between API keys, the path and endpoint kind
+// so they are never shared between APIs, and the accepted encodings so an encoded body is only replayed to clients
+// that accept it.
+func (c *responseCache) key(r *http.Request, kinds []EndpointKind, values map[string]string) (string, bool) {
+	if !containsKind(kinds, ChatCompletionEndpoint) || values["cache_key"] == "" || values["stream"] == "true" {
+		return "", false
+	}
+	temperature, err := strconv.ParseFloat(values["temperature"], 64)
+	if err != nil || temperature != 0 {
+		return "", false
+	}
+
+	scope := strings.Join([]string{string(ChatCompletionEndpoint), r.URL.Path, keyFingerprint(r), r.Header.Get("Accept-Encoding"), values["cache_key"]}, "\n")
+	sum := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// serveCached answers the request from the cache, or passes it on and caches a successful response. Only the headers of
+// the upstream response are cached, and a cached header never replaces one the middleware already set on the response,
+// such as the quota or daily request headers.
+func (e *Handler) serveCached(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok, err := e.responseCache.store.get(key)
+	if err != nil {
+		if e.fail(w, fmt.Errorf("unable to read response cache: %w", err)) {
+			return
+		}
+		ok = false
+	}
+
+	var cached cachedResponse
+	if ok && json.Unmarshal(data, &cached) == nil {
+		for name, values := range cached.Header {
+			if _, ok := w.Header()[name]; !ok {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set(CacheHeader, "hit")
+		w.WriteHeader(cached.Status)
+		_, _ = w.Write(cached.Body)
+		return
+	}
+
+	w.Header().Set(CacheHeader, "miss")
+	before := w.Header().Clone()
+	var header http.Header
+	capture := newCaptureWriter(w, e.responseCache.maxResponseBytes)
+	capture.onHeader = func(int) {
+		header = changedHeader(before, w.Header())
+	}
+	e.next.ServeHTTP(capture, r)
+
+	if capture.status != http.StatusOK || capture.overflow {
+		return
+	}
+	data, err = json.Marshal(cachedResponse{Status: capture.status, Header: header, Body: capture.body.Bytes()})
+	if err != nil {
+		return
+	}
+	if err := e.responseCache.store.set(key, data, e.responseCache.ttl); err != nil {
+		fmt.Println("Unable to write response cache", err.Error())
+	}
+}
+
+// changedHeader returns the headers that were added or changed since the header was cloned
+func changedHeader(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for name, values := range after {
+		if previous, ok := before[name]; !ok || strings.Join(previous, "\n") != strings.Join(values, "\n") {
+			changed[name] = append([]string(nil), values...)
+		}
+	}
+	return changed
+}
+
+// containsKind reports whether the kind is one of the matched kinds
+func containsKind(kinds []EndpointKind, kind EndpointKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryStore is a least recently used cache of the instance
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryStore(maxEntries int) *memoryStore {
+	return &memoryStore{maxEntries: maxEntries, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+func (s *memoryStore) get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (s *memoryStore) set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &memoryEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// redisStore shares cached responses between Traefik instances through Redis
+type redisStore struct {
+	client *redisClient
+}
+
+func (s *redisStore) get(key string) ([]byte, bool, error) {
+	value, err := s.client.get("cache:" + key)
+	if errors.Is(err, errRedisNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(value), true, nil
+}
+
+func (s *redisStore) set(key string, value []byte, ttl time.Duration) error {
+	return s.client.set("cache:"+key, string(value), ttl)
+}
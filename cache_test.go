@@ -0,0 +1,258 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCache_ServeHTTP(t *testing.T) {
+	deterministic := "{\"model\": \"gpt-4.1\", \"temperature\": 0, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}"
+	tests := []struct {
+		name      string
+		first     string
+		second    string
+		secondKey string
+		wantCalls int
+		wantCache string
+	}{
+		{
+			name:      "identical deterministic request",
+			first:     deterministic,
+			second:    "{\"messages\": [{\"content\": \"Hello!\", \"role\": \"user\"}], \"temperature\": 0.0, \"model\": \"gpt-4.1\"}",
+			wantCalls: 1,
+			wantCache: "hit",
+		},
+		{
+			name:      "different prompt",
+			first:     deterministic,
+			second:    "{\"model\": \"gpt-4.1\", \"temperature\": 0, \"messages\": [{\"role\": \"user\", \"content\": \"Hi!\"}]}",
+			wantCalls: 2,
+			wantCache: "miss",
+		},
+		{
+			name:      "different api key",
+			first:     deterministic,
+			second:    deterministic,
+			secondKey: "Bearer sk-other",
+			wantCalls: 2,
+			wantCache: "miss",
+		},
+		{
+			name:      "non zero temperature",
+			first:     "{\"model\": \"gpt-4.1\", \"temperature\": 0.7, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			second:    "{\"model\": \"gpt-4.1\", \"temperature\": 0.7, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			wantCalls: 2,
+			wantCache: "",
+		},
+		{
+			name:      "streaming",
+			first:     "{\"model\": \"gpt-4.1\", \"temperature\": 0, \"stream\": true, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			second:    "{\"model\": \"gpt-4.1\", \"temperature\": 0, \"stream\": true, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			wantCalls: 2,
+			wantCache: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ResponseCache = &ResponseCache{}
+
+			calls := 0
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte("{\"id\": \"chatcmpl-1\"}"))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			first := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.first))
+			first.Header.Set("Authorization", "Bearer sk-test")
+			e.ServeHTTP(httptest.NewRecorder(), first)
+
+			second := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.second))
+			second.Header.Set("Authorization", "Bearer sk-test")
+			if tt.secondKey != "" {
+				second.Header.Set("Authorization", tt.secondKey)
+			}
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, second)
+
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d upstream calls but got %d", tt.wantCalls, calls)
+			}
+			if got := recorder.Header().Get(CacheHeader); got != tt.wantCache {
+				t.Errorf("expected %s %q but got %q", CacheHeader, tt.wantCache, got)
+			}
+			if recorder.Body.String() != "{\"id\": \"chatcmpl-1\"}" || recorder.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected response %v %s", recorder.Header(), recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestResponseCacheScope_ServeHTTP(t *testing.T) {
+	deterministic := "{\"model\": \"gpt-4.1\", \"temperature\": 0, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}"
+	tests := []struct {
+		name       string
+		authScheme string
+		header     string
+		first      string
+		second     string
+		wantCalls  int
+	}{
+		{name: "different api-key", header: "Api-Key", first: "sk-azure-1", second: "sk-azure-2", wantCalls: 2},
+		{name: "same api-key", header: "Api-Key", first: "sk-azure-1", second: "sk-azure-1", wantCalls: 1},
+		{name: "different x-api-key", header: "X-Api-Key", first: "sk-1", second: "sk-2", wantCalls: 2},
+		{name: "different normalized bearer", authScheme: AuthSchemeAPIKey, header: "Authorization", first: "Bearer sk-1", second: "Bearer sk-2", wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ResponseCache = &ResponseCache{}
+			config.AuthScheme = tt.authScheme
+
+			calls := 0
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte("{\"id\": \"chatcmpl-1\"}"))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			for _, key := range []string{tt.first, tt.second} {
+				req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(deterministic))
+				req.Header.Set(tt.header, key)
+				e.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d upstream calls but got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestResponseCacheHeaders_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.ResponseCache = &ResponseCache{}
+	config.DailyRequests = &DailyRequests{}
+
+	calls := 0
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped("{\"id\": \"chatcmpl-1\"}"))
+			return
+		}
+		_, _ = w.Write([]byte("{\"id\": \"chatcmpl-1\"}"))
+	}), config, "headers")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	tests := []struct {
+		encoding  string
+		wantCache string
+		wantDaily string
+		wantCalls int
+	}{
+		{encoding: "gzip", wantCache: "miss", wantDaily: "1", wantCalls: 1},
+		{encoding: "gzip", wantCache: "hit", wantDaily: "2", wantCalls: 1},
+		{encoding: "", wantCache: "miss", wantDaily: "3", wantCalls: 2},
+		{encoding: "", wantCache: "hit", wantDaily: "4", wantCalls: 2},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"temperature\": 0, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}"))
+		req.Header.Set("Authorization", "Bearer sk-test")
+		if tt.encoding != "" {
+			req.Header.Set("Accept-Encoding", tt.encoding)
+		}
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+
+		if got := recorder.Header().Get(CacheHeader); got != tt.wantCache {
+			t.Errorf("request %d: expected %s %q but got %q", i, CacheHeader, tt.wantCache, got)
+		}
+		if got := recorder.Header().Get(DailyRequestsHeader); got != tt.wantDaily {
+			t.Errorf("request %d: expected the fresh daily count %s but got %s", i, tt.wantDaily, got)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("request %d: expected %d upstream calls but got %d", i, tt.wantCalls, calls)
+		}
+		if got := recorder.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("request %d: expected content encoding %q but got %q", i, tt.encoding, got)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := newMemoryStore(2)
+	_ = store.set("a", []byte("1"), time.Minute)
+	_ = store.set("b", []byte("2"), time.Minute)
+	if _, ok, _ := store.get("a"); !ok {
+		t.Errorf("expected a to be cached")
+	}
+	_ = store.set("c", []byte("3"), time.Minute)
+	if _, ok, _ := store.get("b"); ok {
+		t.Errorf("expected the least recently used entry b to be evicted")
+	}
+	if _, ok, _ := store.get("a"); !ok {
+		t.Errorf("expected a to stay cached")
+	}
+
+	_ = store.set("d", []byte("4"), -time.Second)
+	if _, ok, _ := store.get("d"); ok {
+		t.Errorf("expected the expired entry d to be missed")
+	}
+}
+
+func TestInvalidResponseCache_New(t *testing.T) {
+	config := CreateConfig()
+	config.ResponseCache = &ResponseCache{Store: CacheStoreRedis}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for a redis store without redis address")
+	}
+
+	config = CreateConfig()
+	config.ResponseCache = &ResponseCache{TTL: "soon"}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid ttl")
+	}
+}
+
+func TestRedisResponseCache_ServeHTTP(t *testing.T) {
+	server := newFakeRedis(t)
+	config := defaultConfig()
+	config.ResponseCache = &ResponseCache{Store: CacheStoreRedis}
+	config.Redis = &RedisConfig{Address: server.address()}
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		_, _ = w.Write([]byte("{\"id\": \"chatcmpl-1\"}"))
+	})
+	input := "{\"model\": \"gpt-4.1\", \"temperature\": 0, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}"
+
+	// two instances sharing the store, like Traefik replicas
+	for _, name := range []string{"first", "second"} {
+		e, err := New(nil, next, config, name)
+		if err != nil {
+			t.Fatalf("Failed initializing Handler: %s", err)
+		}
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the second instance to serve from redis, got %d upstream calls", calls)
+	}
+}
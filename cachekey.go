@@ -0,0 +1,116 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// cacheKeyFields are the chat completion members that determine the output of a request. Members such as user,
+// metadata and stream only affect bookkeeping or delivery and are left out of the cache key.
+var cacheKeyFields = []string{
+	"model",
+	"messages",
+	"temperature",
+	"top_p",
+	"frequency_penalty",
+	"presence_penalty",
+	"top_k",
+	"min_p",
+	"repetition_penalty",
+	"seed",
+	"max_completion_tokens",
+	"max_tokens",
+	"stop",
+	"n",
+	"logit_bias",
+	"response_format",
+	"logprobs",
+	"top_logprobs",
+	"tools",
+	"tool_choice",
+	"parallel_tool_calls",
+	"functions",
+	"function_call",
+	"prediction",
+	"reasoning_effort",
+	"modalities",
+	"audio",
+}
+
+// cacheKey returns a hash over the model, the canonicalized messages and the sampling parameters of a chat completion,
+// so requests that only differ in formatting share a key. ok is false when the body has no messages, which is also
+// the case when they do not fit in the extracted prefix.
+func cacheKey(members map[string]json.RawMessage) (string, bool) {
+	if _, ok := members["messages"]; !ok {
+		return "", false
+	}
+
+	var canonical bytes.Buffer
+	canonical.WriteByte('{')
+	for _, field := range cacheKeyFields {
+		raw, ok := members[field]
+		if !ok || string(bytes.TrimSpace(raw)) == "null" {
+			continue
+		}
+		value, err := canonicalJSON(raw)
+		if err != nil {
+			return "", false
+		}
+		if canonical.Len() > 1 {
+			canonical.WriteByte(',')
+		}
+		canonical.WriteString(strconv.Quote(field))
+		canonical.WriteByte(':')
+		canonical.WriteString(value)
+	}
+	canonical.WriteByte('}')
+
+	sum := sha256.Sum256(canonical.Bytes())
+	return hex.EncodeToString(sum[:]), true
+}
+
+// canonicalJSON re-encodes a JSON value with sorted object keys, no insignificant whitespace and numbers in their
+// shortest form
+func canonicalJSON(raw json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(canonicalNumbers(value))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// canonicalNumbers rewrites the numbers of a decoded JSON value so that 1, 1.0 and 1e0 encode the same way. Integers
+// are kept as written to preserve large seeds exactly.
+func canonicalNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		text := v.String()
+		if !strings.ContainsAny(text, ".eE") {
+			return v
+		}
+		number, err := v.Float64()
+		if err != nil {
+			return v
+		}
+		return json.Number(strconv.FormatFloat(number, 'g', -1, 64))
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = canonicalNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = canonicalNumbers(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,109 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := "{\"model\": \"gpt-4.1\", \"temperature\": 0.5, \"seed\": 9007199254740993, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}"
+	tests := []struct {
+		name   string
+		input  string
+		same   bool
+		wantOk bool
+	}{
+		{
+			name:   "identical",
+			input:  base,
+			same:   true,
+			wantOk: true,
+		},
+		{
+			name:   "formatting and key order",
+			input:  "{\"messages\":[{\"content\":\"Hello!\",\"role\":\"user\"}],\"seed\":9007199254740993,\"temperature\":5e-1,\"model\":\"gpt-4.1\"}",
+			same:   true,
+			wantOk: true,
+		},
+		{
+			name:   "bookkeeping fields",
+			input:  "{\"model\": \"gpt-4.1\", \"temperature\": 0.5, \"seed\": 9007199254740993, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}], \"user\": \"alice\", \"stream\": true, \"metadata\": {\"project\": \"checkout\"}}",
+			same:   true,
+			wantOk: true,
+		},
+		{
+			name:   "different message",
+			input:  "{\"model\": \"gpt-4.1\", \"temperature\": 0.5, \"seed\": 9007199254740993, \"messages\": [{\"role\": \"user\", \"content\": \"Hi!\"}]}",
+			wantOk: true,
+		},
+		{
+			name:   "different seed",
+			input:  "{\"model\": \"gpt-4.1\", \"temperature\": 0.5, \"seed\": 9007199254740992, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			wantOk: true,
+		},
+		{
+			name:   "different sampling",
+			input:  "{\"model\": \"gpt-4.1\", \"temperature\": 0.7, \"seed\": 9007199254740993, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			wantOk: true,
+		},
+		{
+			name:  "no messages",
+			input: "{\"model\": \"gpt-4.1\", \"temperature\": 0.5}",
+		},
+	}
+
+	want, ok := cacheKey(members(t, base))
+	if !ok {
+		t.Fatalf("expected a cache key for %s", base)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cacheKey(members(t, tt.input))
+			if ok != tt.wantOk {
+				t.Fatalf("expected ok %v but got %v", tt.wantOk, ok)
+			}
+			if ok && (got == want) != tt.same {
+				t.Errorf("expected same key %v, got %s and %s", tt.same, got, want)
+			}
+		})
+	}
+}
+
+func TestCacheKeyFields(t *testing.T) {
+	base := "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]"
+	want, ok := cacheKey(members(t, base+"}"))
+	if !ok {
+		t.Fatalf("expected a cache key for %s", base)
+	}
+	tests := []struct {
+		name  string
+		field string
+	}{
+		{name: "logprobs", field: "\"logprobs\": true"},
+		{name: "top_logprobs", field: "\"top_logprobs\": 5"},
+		{name: "parallel_tool_calls", field: "\"parallel_tool_calls\": false"},
+		{name: "functions", field: "\"functions\": [{\"name\": \"lookup\", \"parameters\": {\"type\": \"object\"}}]"},
+		{name: "function_call", field: "\"function_call\": \"none\""},
+		{name: "prediction", field: "\"prediction\": {\"type\": \"content\", \"content\": \"Hello\"}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cacheKey(members(t, base+", "+tt.field+"}"))
+			if !ok {
+				t.Fatalf("expected a cache key")
+			}
+			if got == want {
+				t.Errorf("expected %s to change the cache key", tt.name)
+			}
+		})
+	}
+}
+
+func members(t *testing.T, input string) map[string]json.RawMessage {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &members); err != nil {
+		t.Fatalf("invalid test input %s: %s", input, err)
+	}
+	return members
+}
@@ -0,0 +1,47 @@
+package traefik_openai_header
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Canary configures the deterministic bucketing of requests into a canary cohort
+type Canary struct {
+	Percentage int      `json:"percentage"`
+	Fields     []string `json:"fields"`
+	Salt       string   `json:"salt"`
+}
+
+func newCanary(config *Canary) (*Canary, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Percentage < 0 || config.Percentage > 100 {
+		return nil, fmt.Errorf("invalid canary percentage %d", config.Percentage)
+	}
+	canary := *config
+	if len(canary.Fields) == 0 {
+		canary.Fields = []string{"user"}
+	}
+	return &canary, nil
+}
+
+// bucket returns whether the request belongs to the canary cohort. The cohort is decided by the first of the fields that
+// is set or else by the fingerprint of the API key, whichever header carries it, so the same user or key always lands in
+// the same bucket. ok is false when the request has neither.
+func (c *Canary) bucket(r *http.Request, values map[string]string, members map[string]json.RawMessage) (canary string, ok bool) {
+	field, value, ok := firstFieldValue(c.Fields, values, members)
+	if !ok {
+		field, value = "key", keyFingerprint(r)
+		if value == "" {
+			return "", false
+		}
+	}
+
+	sum := sha256.Sum256([]byte(c.Salt + "\x00" + field + "\x00" + value))
+	return strconv.FormatBool(binary.BigEndian.Uint64(sum[:8])%100 < uint64(c.Percentage)), true
+}
@@ -0,0 +1,110 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanary_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		percentage    int
+		authorization string
+		input         string
+		want          string
+	}{
+		{name: "everyone", percentage: 100, input: "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}", want: "true"},
+		{name: "nobody", percentage: 0, input: "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}", want: "false"},
+		{name: "api key", percentage: 100, authorization: "Bearer sk-test", input: "{\"model\": \"gpt-4.1\"}", want: "true"},
+		{name: "no key", percentage: 100, input: "{\"model\": \"gpt-4.1\"}", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Canary = &Canary{Percentage: tt.percentage}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.Get("X-OpenAI-Canary") != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got.Get("X-OpenAI-Canary"))
+			}
+		})
+	}
+}
+
+func TestCanaryBucket(t *testing.T) {
+	five, _ := newCanary(&Canary{Percentage: 5})
+	ten, _ := newCanary(&Canary{Percentage: 10})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+
+	inFive := 0
+	for i := 0; i < 10000; i++ {
+		values := map[string]string{"user": fmt.Sprintf("user-%d", i)}
+		small, _ := five.bucket(req, values, nil)
+		again, _ := five.bucket(req, values, nil)
+		large, _ := ten.bucket(req, values, nil)
+		if small != again {
+			t.Fatalf("expected the bucket of %s to be stable", values["user"])
+		}
+		if small == "true" {
+			inFive++
+			if large != "true" {
+				t.Fatalf("expected %s to stay in the cohort when the percentage is raised", values["user"])
+			}
+		}
+	}
+	if inFive < 400 || inFive > 600 {
+		t.Errorf("expected about 500 of 10000 users in a 5%% cohort but got %d", inFive)
+	}
+}
+
+func TestCanaryBucketByKey(t *testing.T) {
+	canary, _ := newCanary(&Canary{Percentage: 50})
+
+	inCohort := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("sk-%d", i)
+		azure := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		azure.Header.Set("Api-Key", key)
+		bearer := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		bearer.Header.Set("Authorization", "Bearer "+key)
+
+		byAPIKey, ok := canary.bucket(azure, map[string]string{}, nil)
+		if !ok {
+			t.Fatalf("expected an api-key request to be bucketed")
+		}
+		if byBearer, _ := canary.bucket(bearer, map[string]string{}, nil); byBearer != byAPIKey {
+			t.Fatalf("expected %s to land in the same bucket whichever header carries it", key)
+		}
+		if byAPIKey == "true" {
+			inCohort++
+		}
+	}
+	if inCohort < 400 || inCohort > 600 {
+		t.Errorf("expected about 500 of 1000 api-keys in a 50%% cohort but got %d", inCohort)
+	}
+}
+
+func TestInvalidCanary_New(t *testing.T) {
+	config := CreateConfig()
+	config.Canary = &Canary{Percentage: 101}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid canary percentage")
+	}
+}
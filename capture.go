@@ -0,0 +1,224 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Capture configures the sampled recording of redacted request bodies for replay, to a spool directory or to an S3
+// compatible object storage URL
+type Capture struct {
+	SampleRate   float64  `json:"sampleRate"`
+	Directory    string   `json:"directory"`
+	URL          string   `json:"url"`
+	Region       string   `json:"region"`
+	AccessKey    string   `json:"accessKey"`
+	SecretKey    string   `json:"secretKey"`
+	Timeout      string   `json:"timeout"`
+	QueueSize    int      `json:"queueSize"`
+	MaxBodyBytes int64    `json:"maxBodyBytes"`
+	RedactFields []string `json:"redactFields"`
+}
+
+// captureRecord is a captured request, tagged with the headers extracted from it
+type captureRecord struct {
+	Time    time.Time         `json:"time"`
+	Method  string            `json:"method"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Kinds   []EndpointKind    `json:"kinds"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// capture writes the sampled records from a single worker so the request never waits for the disk or the storage
+type capture struct {
+	sampleRate float64
+	directory  string
+	url        string
+	region     string
+	accessKey  string
+	secretKey  string
+	client     *http.Client
+	queue      chan captureRecord
+	body       *bodyRedactor
+	metrics    *metrics
+}
+
+func newCapture(ctx context.Context, config *Capture, m *metrics) (*capture, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid capture sampleRate %v", config.SampleRate)
+	}
+	if (config.Directory == "") == (config.URL == "") {
+		return nil, errors.New("capture requires either a directory or a url")
+	}
+	if config.URL != "" {
+		target, err := url.Parse(config.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("invalid capture url %q", config.URL)
+		}
+	}
+	if config.Directory != "" {
+		if info, err := os.Stat(config.Directory); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid capture directory %q", config.Directory)
+		}
+	}
+
+	timeout := 5 * time.Second
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid capture timeout %q", config.Timeout)
+		}
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	c := &capture{
+		sampleRate: config.SampleRate,
+		directory:  config.Directory,
+		url:        strings.TrimSuffix(config.URL, "/"),
+		region:     region,
+		accessKey:  config.AccessKey,
+		secretKey:  config.SecretKey,
+		client:     &http.Client{Timeout: timeout},
+		queue:      make(chan captureRecord, queueSize),
+		body:       newBodyRedactor(config.MaxBodyBytes, config.RedactFields),
+		metrics:    m,
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go c.run(ctx)
+	return c, nil
+}
+
+// run stores the queued records until the context is done
+func (c *capture) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case record := <-c.queue:
+			if err := c.store(record); err != nil {
+				c.metrics.inc("captures_failed_total")
+				fmt.Println("Unable to capture request", err.Error())
+				continue
+			}
+			c.metrics.inc("captures_total")
+		}
+	}
+}
+
+// store writes the record as a JSON document named after its time and a random suffix
+func (c *capture) store(record captureRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := record.Time.Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix) + ".json"
+
+	if c.directory != "" {
+		// write to a hidden file first so consumers of the spool never read a partial record
+		tmp := filepath.Join(c.directory, "."+name)
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, filepath.Join(c.directory, name))
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.url+"/"+name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.accessKey != "" {
+		signV4(req, data, c.accessKey, c.secretKey, c.region, time.Now())
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("capture storage responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sampled decides whether a request is captured
+func (c *capture) sampled() bool {
+	if c.sampleRate >= 1 {
+		return true
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<53))
+	if err != nil {
+		return false
+	}
+	return float64(n.Int64())/(1<<53) < c.sampleRate
+}
+
+// captureRequest queues a sampled request with its redacted body and the headers extracted from it. Requests whose
+// body cannot be captured are skipped and records are dropped when the queue is full.
+func (e *Handler) captureRequest(r *http.Request, mapper *headerMapper, kinds []EndpointKind, values map[string]string) {
+	if e.capture == nil || values == nil || !e.capture.sampled() {
+		return
+	}
+
+	body := e.capture.body.redactedBody(r, mapper.neverEmit)
+	if body == nil {
+		e.metrics.inc("captures_skipped_total")
+		return
+	}
+
+	headers := map[string]string{}
+	for field, value := range mapper.emitted(values) {
+		for _, name := range mapper.fieldHeaders(field) {
+			headers[name] = mapper.translate(field, value)
+		}
+	}
+	record := captureRecord{
+		Time:    time.Now().UTC(),
+		Method:  r.Method,
+		Host:    r.Host,
+		Path:    r.URL.Path,
+		Kinds:   kinds,
+		Headers: headers,
+		Body:    body,
+	}
+
+	select {
+	case e.capture.queue <- record:
+	default:
+		e.metrics.inc("captures_dropped_total")
+	}
+}
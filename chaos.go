@@ -0,0 +1,124 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// ChaosHeader marks responses whose failure was injected, so they can be told apart from real provider failures
+const ChaosHeader = "X-OpenAI-Chaos"
+
+// Chaos configures the injection of provider-like failures into matched requests
+type Chaos struct {
+	ErrorRate       float64 `json:"errorRate"`
+	ErrorStatusCode int     `json:"errorStatusCode"`
+	Latency         string  `json:"latency"`
+	LatencyRate     float64 `json:"latencyRate"`
+	AbortStreamRate float64 `json:"abortStreamRate"`
+	AbortAfterBytes int64   `json:"abortAfterBytes"`
+}
+
+// chaos is the parsed Chaos config
+type chaos struct {
+	errorRate       float64
+	errorStatusCode int
+	latency         time.Duration
+	latencyRate     float64
+	abortStreamRate float64
+	abortAfterBytes int64
+	random          func() float64
+}
+
+func newChaos(config *Chaos) (*chaos, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	for name, rate := range map[string]float64{"errorRate": config.ErrorRate, "latencyRate": config.LatencyRate, "abortStreamRate": config.AbortStreamRate} {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid chaos %s %v", name, rate)
+		}
+	}
+
+	c := &chaos{
+		errorRate:       config.ErrorRate,
+		errorStatusCode: config.ErrorStatusCode,
+		latencyRate:     config.LatencyRate,
+		abortStreamRate: config.AbortStreamRate,
+		abortAfterBytes: config.AbortAfterBytes,
+		random:          rand.Float64,
+	}
+	if c.errorStatusCode == 0 {
+		c.errorStatusCode = http.StatusTooManyRequests
+	}
+	if c.errorStatusCode < 400 || c.errorStatusCode > 599 {
+		return nil, fmt.Errorf("invalid chaos errorStatusCode %d", config.ErrorStatusCode)
+	}
+	if config.Latency != "" {
+		var err error
+		if c.latency, err = time.ParseDuration(config.Latency); err != nil || c.latency < 0 {
+			return nil, fmt.Errorf("invalid chaos latency %q", config.Latency)
+		}
+		if c.latencyRate == 0 {
+			c.latencyRate = 1
+		}
+	}
+	if c.abortAfterBytes <= 0 {
+		c.abortAfterBytes = 1024
+	}
+	return c, nil
+}
+
+// injectChaos delays the request, answers it with an injected error or arranges for its stream to be aborted. It
+// returns true when the request was answered and the writer to use otherwise.
+func (e *Handler) injectChaos(w http.ResponseWriter, r *http.Request, values map[string]string) (http.ResponseWriter, bool) {
+	c := e.chaos
+	if c == nil || e.readOnly {
+		return w, false
+	}
+
+	if c.latency > 0 && c.random() < c.latencyRate {
+		e.metrics.inc("chaos_latency_total")
+		select {
+		case <-time.After(c.latency):
+		case <-r.Context().Done():
+		}
+	}
+
+	if c.errorRate > 0 && c.random() < c.errorRate {
+		e.metrics.inc("chaos_errors_total")
+		w.Header().Set(ChaosHeader, "error")
+		if c.errorStatusCode == http.StatusTooManyRequests {
+			writeError(w, c.errorStatusCode, "requests", "rate_limit_exceeded", "Rate limit reached. Please try again later.")
+		} else {
+			writeError(w, c.errorStatusCode, "server_error", "server_error", "The server had an error while processing your request.")
+		}
+		return w, true
+	}
+
+	if values["stream"] == "true" && c.abortStreamRate > 0 && c.random() < c.abortStreamRate {
+		e.metrics.inc("chaos_aborted_streams_total")
+		w.Header().Set(ChaosHeader, "abort")
+		return newAbortWriter(w, c.abortAfterBytes), false
+	}
+	return w, false
+}
+
+// newAbortWriter aborts the response after a number of bytes, like a provider connection dropping mid-stream
+func newAbortWriter(w http.ResponseWriter, remaining int64) http.ResponseWriter {
+	writer := &responseWriter{ResponseWriter: w}
+	writer.onWrite = func(data []byte) {
+		if int64(len(data)) < remaining {
+			remaining -= int64(len(data))
+			return
+		}
+		// the bytes before the abort still reach the client
+		_, _ = writer.ResponseWriter.Write(data[:remaining])
+		writer.Flush()
+		// ErrAbortHandler makes the server drop the connection without logging a stack trace
+		panic(http.ErrAbortHandler)
+	}
+	return writer
+}
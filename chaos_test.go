@@ -0,0 +1,112 @@
+package traefik_openai_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChaosErrors_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		chaos      *Chaos
+		readOnly   bool
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "rate limit", chaos: &Chaos{ErrorRate: 1}, wantStatus: http.StatusTooManyRequests, wantCode: "rate_limit_exceeded"},
+		{name: "overloaded", chaos: &Chaos{ErrorRate: 1, ErrorStatusCode: 529}, wantStatus: 529, wantCode: "server_error"},
+		{name: "no errors", chaos: &Chaos{}, wantStatus: http.StatusOK},
+		{name: "read only", chaos: &Chaos{ErrorRate: 1}, readOnly: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Chaos = tt.chaos
+			config.ReadOnly = tt.readOnly
+
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantCode != "" && !strings.Contains(recorder.Body.String(), "\"code\":\""+tt.wantCode+"\"") {
+				t.Errorf("expected code %s but got %s", tt.wantCode, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestChaosLatency_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.Chaos = &Chaos{Latency: "50ms"}
+
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "latency")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	start := time.Now()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected at least 50ms of latency but took %v", elapsed)
+	}
+
+	start = time.Now()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("expected unmatched requests not to be delayed but took %v", elapsed)
+	}
+}
+
+func TestChaosAbortStream_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.Chaos = &Chaos{AbortStreamRate: 1, AbortAfterBytes: 100}
+
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 100; i++ {
+			_, _ = io.WriteString(w, "data: {\"choices\": [{\"delta\": {\"content\": \"token\"}}]}\n\n")
+		}
+	}), config, "abort")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader("{\"model\": \"gpt-4.1\", \"stream\": true}"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err == nil {
+		t.Errorf("expected the stream to be aborted")
+	}
+	if len(body) != 100 {
+		t.Errorf("expected 100 bytes before the abort but got %d", len(body))
+	}
+	if response.Header.Get(ChaosHeader) != "abort" {
+		t.Errorf("expected the abort to be marked")
+	}
+}
+
+func TestInvalidChaos_New(t *testing.T) {
+	config := CreateConfig()
+	config.Chaos = &Chaos{ErrorRate: 1.5}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid error rate")
+	}
+}
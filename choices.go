@@ -0,0 +1,120 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ChoicesClampedHeader lists the choice counts lowered by the choice limit, as field=requested, on the request and the
+// response
+const ChoicesClampedHeader = "X-OpenAI-Choices-Clamped"
+
+// Choice limit actions controlling what happens to a request asking for more choices than allowed
+const (
+	ChoiceLimitActionClamp  = "clamp"
+	ChoiceLimitActionReject = "reject"
+)
+
+// choiceFields are the fields that multiply the generated output of a single request
+var choiceFields = []string{"n", "best_of"}
+
+// ChoiceLimit caps n and best_of, which multiply the output cost of a single request without counting against request
+// rate limits
+type ChoiceLimit struct {
+	Max    int    `json:"max"`
+	Action string `json:"action"`
+}
+
+// choiceLimit is the ChoiceLimit config with defaults applied
+type choiceLimit struct {
+	max    int
+	action string
+}
+
+func newChoiceLimit(config *ChoiceLimit) (*choiceLimit, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Max < 0 {
+		return nil, fmt.Errorf("invalid choiceLimit max %d", config.Max)
+	}
+
+	limit := &choiceLimit{max: config.Max, action: config.Action}
+	if limit.max == 0 {
+		limit.max = 1
+	}
+	switch limit.action {
+	case "":
+		limit.action = ChoiceLimitActionClamp
+	case ChoiceLimitActionClamp, ChoiceLimitActionReject:
+	default:
+		return nil, fmt.Errorf("invalid choiceLimit action %q", config.Action)
+	}
+	return limit, nil
+}
+
+// exceeded returns the extracted choice fields above the limit. The counts are parsed as numbers, as rawNumbers keeps
+// them as written, such as 1e1 or 10.0.
+func (l *choiceLimit) exceeded(values map[string]string) []string {
+	var exceeded []string
+	for _, field := range choiceFields {
+		if count, err := strconv.ParseFloat(values[field], 64); err == nil && count > float64(l.max) {
+			exceeded = append(exceeded, field)
+		}
+	}
+	return exceeded
+}
+
+// limitChoices lowers n and best_of of chat and legacy completions to the limit, or rejects the request, when the
+// extracted counts exceed it. The body is only rewritten when a count is clamped. It returns true when the request was
+// answered. Read only instances only count.
+func (e *Handler) limitChoices(w http.ResponseWriter, r *http.Request, kinds []EndpointKind, values map[string]string) bool {
+	if !containsKind(kinds, ChatCompletionEndpoint) && !containsKind(kinds, CompletionEndpoint) {
+		return false
+	}
+	exceeded := e.choiceLimit.exceeded(values)
+	if len(exceeded) == 0 {
+		return false
+	}
+
+	requested := make([]string, 0, len(exceeded))
+	for _, field := range exceeded {
+		e.metrics.incLabel("choices_exceeded", field)
+		requested = append(requested, field+"="+values[field])
+	}
+	if e.readOnly {
+		return false
+	}
+	if e.choiceLimit.action == ChoiceLimitActionReject {
+		e.reject(w, rejection{
+			status:    http.StatusBadRequest,
+			errorType: "invalid_request_error",
+			code:      "too_many_choices",
+			message:   fmt.Sprintf("The request asks for more than %d choices.", e.choiceLimit.max),
+			values:    map[string]string{"max": strconv.Itoa(e.choiceLimit.max), "requested": strings.Join(requested, ",")},
+		})
+		return true
+	}
+
+	limit := strconv.Itoa(e.choiceLimit.max)
+	err := rewriteBody(r, func(members map[string]json.RawMessage) error {
+		for _, field := range exceeded {
+			members[field] = json.RawMessage(limit)
+		}
+		return nil
+	})
+	if err != nil {
+		return e.fail(w, fmt.Errorf("unable to limit choices: %w", err))
+	}
+	for _, field := range exceeded {
+		values[field] = limit
+	}
+
+	clamped := strings.Join(requested, ",")
+	r.Header.Set(ChoicesClampedHeader, clamped)
+	w.Header().Set(ChoicesClampedHeader, clamped)
+	return false
+}
@@ -0,0 +1,98 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChoiceLimit_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       ChoiceLimit
+		readOnly    bool
+		rawNumbers  bool
+		uri         string
+		input       string
+		wantStatus  int
+		wantN       string
+		wantBestOf  string
+		wantClamped string
+	}{
+		{name: "within limit", input: "{\"model\": \"gpt-4.1\", \"n\": 1}", wantStatus: http.StatusOK, wantN: "1"},
+		{name: "clamped", input: "{\"model\": \"gpt-4.1\", \"n\": 10}", wantStatus: http.StatusOK, wantN: "1", wantClamped: "n=10"},
+		{name: "legacy completion clamped to max", limit: ChoiceLimit{Max: 2}, uri: "/v1/completions", input: "{\"model\": \"gpt-3.5-turbo-instruct\", \"n\": 3, \"best_of\": 5}", wantStatus: http.StatusOK, wantN: "2", wantBestOf: "2", wantClamped: "n=3,best_of=5"},
+		{name: "raw exponent clamped", rawNumbers: true, input: "{\"model\": \"gpt-4.1\", \"n\": 1e1}", wantStatus: http.StatusOK, wantN: "1", wantClamped: "n=1e1"},
+		{name: "raw decimal clamped", rawNumbers: true, input: "{\"model\": \"gpt-4.1\", \"n\": 10.0}", wantStatus: http.StatusOK, wantN: "1", wantClamped: "n=10.0"},
+		{name: "rejected", limit: ChoiceLimit{Action: ChoiceLimitActionReject}, input: "{\"model\": \"gpt-4.1\", \"n\": 10}", wantStatus: http.StatusBadRequest},
+		{name: "other endpoint", uri: "/v1/batches", input: "{\"endpoint\": \"/v1/chat/completions\", \"n\": 10}", wantStatus: http.StatusOK, wantN: "10"},
+		{name: "read only", readOnly: true, input: "{\"model\": \"gpt-4.1\", \"n\": 10}", wantStatus: http.StatusOK, wantN: "10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			limit := tt.limit
+			config.ChoiceLimit = &limit
+			config.ReadOnly = tt.readOnly
+			config.RawNumbers = tt.rawNumbers
+
+			var body map[string]json.RawMessage
+			var clamped string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(data, &body)
+				clamped = r.Header.Get(ChoicesClampedHeader)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			uri := tt.uri
+			if uri == "" {
+				uri = "/v1/chat/completions"
+			}
+			e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, uri, strings.NewReader(tt.input)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if body != nil {
+					t.Errorf("expected the request not to reach the upstream")
+				}
+				return
+			}
+			if string(body["n"]) != tt.wantN || string(body["best_of"]) != tt.wantBestOf {
+				t.Errorf("expected n %q and best_of %q but got %s and %s", tt.wantN, tt.wantBestOf, body["n"], body["best_of"])
+			}
+			if clamped != tt.wantClamped || recorder.Header().Get(ChoicesClampedHeader) != tt.wantClamped {
+				t.Errorf("expected clamped header %q but got %q", tt.wantClamped, clamped)
+			}
+		})
+	}
+}
+
+func TestInvalidChoiceLimit_New(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit ChoiceLimit
+	}{
+		{name: "negative max", limit: ChoiceLimit{Max: -1}},
+		{name: "unknown action", limit: ChoiceLimit{Action: "drop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ChoiceLimit = &tt.limit
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Command openai-header runs the middleware against a request body offline and prints the headers it would emit.
+//
+// Usage:
+//
+//	openai-header [-config plugin.json] [-path /v1/chat/completions] [-H 'Name: value'] [payload.json]
+//
+// The payload is read from stdin when no file (or "-") is given.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+
+	traefik_openai_header "github.com/rinokadijk/traefik-openai-header"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// loadConfig decodes the configuration over the built-in one. A requestFields map replaces the default fields instead
+// of being merged into them, as it does in the plugin, so a config listing a few fields only emits those.
+func loadConfig(data []byte, config *traefik_openai_header.Config) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	if _, ok := members["requestFields"]; ok {
+		config.RequestFields = nil
+	}
+	return json.Unmarshal(data, config)
+}
+
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header %q must be formatted as 'Name: value'", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("openai-header", flag.ContinueOnError)
+	configFile := flags.String("config", "", "JSON file with the plugin configuration, defaults to the built-in configuration")
+	path := flags.String("path", "/v1/chat/completions", "request URI the payload is sent to")
+	method := flags.String("method", http.MethodPost, "request method")
+	var headers headerFlags
+	flags.Var(&headers, "H", "inbound request header formatted as 'Name: value', may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := traefik_openai_header.CreateConfig()
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return err
+		}
+		if err := loadConfig(data, config); err != nil {
+			return fmt.Errorf("invalid config %s: %w", *configFile, err)
+		}
+	}
+
+	var payload []byte
+	var err error
+	switch flags.NArg() {
+	case 0:
+		payload, err = io.ReadAll(stdin)
+	case 1:
+		if flags.Arg(0) == "-" {
+			payload, err = io.ReadAll(stdin)
+		} else {
+			payload, err = os.ReadFile(flags.Arg(0))
+		}
+	default:
+		return errors.New("expected at most one payload file")
+	}
+	if err != nil {
+		return err
+	}
+
+	var forwarded *http.Request
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler, err := traefik_openai_header.New(context.Background(), next, config, "openai-header")
+	if err != nil {
+		return err
+	}
+
+	request := httptest.NewRequest(*method, *path, bytes.NewReader(payload))
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		request.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	inbound := request.Header.Clone()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if forwarded == nil {
+		fmt.Fprintf(stdout, "Rejected: %d %s\n", recorder.Code, http.StatusText(recorder.Code))
+		if body := strings.TrimSpace(recorder.Body.String()); body != "" {
+			fmt.Fprintln(stdout, body)
+		}
+		return nil
+	}
+
+	fmt.Fprintln(stdout, "Request headers:")
+	printHeaders(stdout, forwarded.Header, inbound)
+	if len(recorder.Header()) > 0 {
+		fmt.Fprintln(stdout, "Response headers:")
+		printHeaders(stdout, recorder.Header(), http.Header{})
+	}
+	return nil
+}
+
+// printHeaders prints the headers that were added or changed compared to the original headers
+func printHeaders(w io.Writer, headers http.Header, original http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if strings.Join(headers[name], ",") != strings.Join(original[name], ",") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fmt.Fprintf(w, "  %s: %s\n", name, value)
+		}
+	}
+}
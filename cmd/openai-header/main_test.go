@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{"requestFields": {"model": "X-Model"}, "mirrorResponseFields": ["model"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	payload := filepath.Join(dir, "payload.json")
+	if err := os.WriteFile(payload, []byte(`{"model": "gpt-4.1", "user": "alice"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "stdin with default config",
+			args:  []string{"-H", "User-Agent: curl/8.0"},
+			stdin: `{"model": "gpt-4.1", "user": "alice"}`,
+			want:  []string{"X-Openai-Model: gpt-4.1", "X-Openai-User: alice", "X-Openai-User-Agent: curl/8.0"},
+		},
+		{
+			name:    "file with config",
+			args:    []string{"-config", config, payload},
+			want:    []string{"Request headers:", "X-Model: gpt-4.1", "Response headers:"},
+			notWant: []string{"X-Openai-Model", "X-Openai-User"},
+		},
+		{
+			name:  "parse failure",
+			args:  []string{"-"},
+			stdin: "INVALID JSON",
+			want:  []string{"X-Openai-Parse-Failure: "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := run(tt.args, strings.NewReader(tt.stdin), &stdout); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, stdout.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(stdout.String(), notWant) {
+					t.Errorf("expected output not to contain %q, got:\n%s", notWant, stdout.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// Condition tests an extracted field value. Matches is a regex the value has to match, Glob a shell pattern such as
+// gpt-4*, Equals a value it has to be equal to and GreaterThan and LessThan numeric bounds; a condition with none of
+// them only requires the field to be present. Absent inverts the presence check.
+type Condition struct {
+	Field       string   `json:"field"`
+	Matches     string   `json:"matches"`
+	Glob        string   `json:"glob"`
+	Equals      *string  `json:"equals"`
+	GreaterThan *float64 `json:"greaterThan"`
+	LessThan    *float64 `json:"lessThan"`
+	Absent      bool     `json:"absent"`
+}
+
+// condition is a compiled Condition
+type condition struct {
+	field       string
+	matches     *regexp.Regexp
+	glob        string
+	equals      *string
+	greaterThan *float64
+	lessThan    *float64
+	absent      bool
+}
+
+// compileConditions compiles the conditions of a config option
+func compileConditions(option string, conditions []Condition) ([]condition, error) {
+	compiled := make([]condition, 0, len(conditions))
+	for _, c := range conditions {
+		if c.Field == "" {
+			return nil, fmt.Errorf("invalid %s condition: missing field", option)
+		}
+		if _, err := path.Match(c.Glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s condition glob %q: %w", option, c.Glob, err)
+		}
+		compiledCondition := condition{
+			field:       c.Field,
+			glob:        c.Glob,
+			equals:      c.Equals,
+			greaterThan: c.GreaterThan,
+			lessThan:    c.LessThan,
+			absent:      c.Absent,
+		}
+		if c.Matches != "" {
+			regex, err := regexp.Compile(c.Matches)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s condition regex %q: %w", option, c.Matches, err)
+			}
+			compiledCondition.matches = regex
+		}
+		compiled = append(compiled, compiledCondition)
+	}
+	return compiled, nil
+}
+
+// holds reports whether the extracted field values satisfy the condition
+func (c condition) holds(values map[string]string) bool {
+	value, ok := values[c.field]
+	if c.absent || !ok {
+		return c.absent && !ok
+	}
+	if c.equals != nil && value != *c.equals {
+		return false
+	}
+	if c.matches != nil && !c.matches.MatchString(value) {
+		return false
+	}
+	if c.glob != "" {
+		if matched, _ := path.Match(c.glob, value); !matched {
+			return false
+		}
+	}
+	if c.greaterThan != nil || c.lessThan != nil {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		if c.greaterThan != nil && number <= *c.greaterThan {
+			return false
+		}
+		if c.lessThan != nil && number >= *c.lessThan {
+			return false
+		}
+	}
+	return true
+}
+
+// allHold reports whether the extracted field values satisfy all conditions
+func allHold(conditions []condition, values map[string]string) bool {
+	for _, c := range conditions {
+		if !c.holds(values) {
+			return false
+		}
+	}
+	return true
+}
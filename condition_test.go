@@ -0,0 +1,104 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderConditions_ServeHTTP(t *testing.T) {
+	falseValue := "false"
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{
+			name:  "condition holds",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"stream\": false}",
+			want:  map[string]string{"X-OpenAI-User": "alice", "X-OpenAI-Stream": "false", "X-OpenAI-Model": "gpt-4.1"},
+		},
+		{
+			name:  "regex does not match",
+			input: "{\"model\": \"o3\", \"user\": \"alice\"}",
+			want:  map[string]string{"X-OpenAI-User": "", "X-OpenAI-Model": "o3"},
+		},
+		{
+			name:  "value not equal",
+			input: "{\"model\": \"gpt-4.1\", \"stream\": true}",
+			want:  map[string]string{"X-OpenAI-Stream": ""},
+		},
+		{
+			name:  "field missing",
+			input: "{\"user\": \"alice\"}",
+			want:  map[string]string{"X-OpenAI-User": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.HeaderConditions = map[string][]Condition{
+				"user":   {{Field: "model", Matches: "^gpt-4"}},
+				"stream": {{Field: "stream", Equals: &falseValue}},
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidHeaderConditions_New(t *testing.T) {
+	config := CreateConfig()
+	config.HeaderConditions = map[string][]Condition{"user": {{Field: "model", Matches: "^gpt-4("}}}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid condition regex")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	values := map[string]string{"model": "gpt-4.1-mini", "temperature": "0.7", "stream": "true"}
+	tests := []struct {
+		name      string
+		condition Condition
+		want      bool
+	}{
+		{name: "present", condition: Condition{Field: "model"}, want: true},
+		{name: "missing", condition: Condition{Field: "user"}, want: false},
+		{name: "absent", condition: Condition{Field: "user", Absent: true}, want: true},
+		{name: "not absent", condition: Condition{Field: "model", Absent: true}, want: false},
+		{name: "glob", condition: Condition{Field: "model", Glob: "gpt-4*"}, want: true},
+		{name: "glob mismatch", condition: Condition{Field: "model", Glob: "o*"}, want: false},
+		{name: "greater than", condition: Condition{Field: "temperature", GreaterThan: floatPointer(0.5)}, want: true},
+		{name: "not less than", condition: Condition{Field: "temperature", LessThan: floatPointer(0.5)}, want: false},
+		{name: "range", condition: Condition{Field: "temperature", GreaterThan: floatPointer(0.5), LessThan: floatPointer(1)}, want: true},
+		{name: "non numeric", condition: Condition{Field: "stream", GreaterThan: floatPointer(0)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions, err := compileConditions("test", []Condition{tt.condition})
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if got := allHold(conditions, values); got != tt.want {
+				t.Errorf("expected %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadConfigFrom returns the config with the options of the JSON file that configFrom points at, for configurations
+// too large for the Traefik dynamic config or labels. An option in the file replaces the inline option as a whole, so
+// a map or list in the file is not merged with the inline one. The file is read once; configFile is the option for
+// field mappings that change at runtime.
+func loadConfigFrom(config *Config) (*Config, error) {
+	if config.ConfigFrom == "" {
+		return config, nil
+	}
+	path, err := expandEnv(config.ConfigFrom)
+	if err != nil {
+		return nil, err
+	}
+	// the plugin only has the standard library, which cannot parse YAML
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("invalid configFrom %s: only JSON is supported", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configFrom %s: %w", path, err)
+	}
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid configFrom %s: %w", path, err)
+	}
+	if _, ok := file["configFrom"]; ok {
+		return nil, fmt.Errorf("invalid configFrom %s: the file cannot set configFrom", path)
+	}
+
+	inline, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var options map[string]json.RawMessage
+	if err := json.Unmarshal(inline, &options); err != nil {
+		return nil, err
+	}
+	for option, value := range file {
+		options[option] = value
+	}
+	delete(options, "configFrom")
+
+	merged, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(loaded); err != nil {
+		return nil, fmt.Errorf("invalid configFrom %s: %w", path, err)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,73 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFrom_ServeHTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openai-header.json")
+	file := `{
+		"requestFields": {"model": "X-LLM-Model"},
+		"valueMappings": {"model": {"gpt-4.1": "flagship"}},
+		"deniedEndpoints": ["batch"]
+	}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	config := defaultConfig()
+	config.ConfigFrom = path
+	config.StaticHeaders = map[string]string{"X-Gateway": "eu-west-1"}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "config from")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"user\": \"alice\"}")))
+	want := map[string]string{"X-LLM-Model": "flagship", "X-OpenAI-User": "", "X-Gateway": "eu-west-1"}
+	for name, value := range want {
+		if got.Get(name) != value {
+			t.Errorf("expected header %s to be %q but got %q", name, value, got.Get(name))
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/batches", strings.NewReader("{}")))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("expected the denied endpoints of the file to apply but got status %d", recorder.Code)
+	}
+}
+
+func TestInvalidConfigFrom_New(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml":    "requestFields:\n  model: X-OpenAI-Model\n",
+		"invalid.json":   "{\"requestFields\": ",
+		"unknown.json":   "{\"requestField\": {\"model\": \"X-OpenAI-Model\"}}",
+		"recursive.json": "{\"configFrom\": \"other.json\"}",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+	}
+
+	for _, name := range []string{"config.yaml", "invalid.json", "unknown.json", "recursive.json", "missing.json"} {
+		t.Run(name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ConfigFrom = filepath.Join(dir, name)
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// promptText is the text of a single prompt message
+type promptText struct {
+	role string
+	text string
+}
+
+// promptTexts returns the text of the messages of chat completion and Anthropic messages bodies, including the
+// Anthropic system prompt. Non-text content parts are skipped.
+func promptTexts(kind EndpointKind, members map[string]json.RawMessage) []promptText {
+	switch kind {
+	case ChatCompletionEndpoint, AnthropicMessagesEndpoint, AnthropicCountTokensEndpoint:
+	default:
+		return nil
+	}
+
+	var texts []promptText
+	if system, ok := members["system"]; ok && kind != ChatCompletionEndpoint {
+		if text := contentText(system); text != "" {
+			texts = append(texts, promptText{role: "system", text: text})
+		}
+	}
+
+	var messages []chatMessage
+	if err := json.Unmarshal(members["messages"], &messages); err != nil {
+		return texts
+	}
+	for _, message := range messages {
+		if text := contentText(message.Content); text != "" {
+			texts = append(texts, promptText{role: message.Role, text: text})
+		}
+	}
+	return texts
+}
+
+// textTokens estimates the tokens of prompt text at about four bytes per token
+func textTokens(texts ...string) int64 {
+	var size int
+	for _, text := range texts {
+		size += len(text)
+	}
+	return int64(size / 4)
+}
+
+// contentText returns string content as is and joins the text parts of array content
+func contentText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+	if content[0] == '"' {
+		var text string
+		if err := json.Unmarshal(content, &text); err != nil {
+			return ""
+		}
+		return text
+	}
+
+	var parts []chatContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// contentValues returns the field values derived from scanning the prompt text
+func (e *Handler) contentValues(kind EndpointKind, members map[string]json.RawMessage) map[string]string {
+	if e.piiDetector == nil && e.injectionDetector == nil && e.bannedContent == nil && !e.languageDetection {
+		return nil
+	}
+	texts := promptTexts(kind, members)
+	if len(texts) == 0 {
+		return nil
+	}
+
+	values := map[string]string{}
+	if e.piiDetector != nil {
+		if categories := e.piiDetector.detect(texts); len(categories) > 0 {
+			values["pii_detected"] = strings.Join(categories, ",")
+		}
+	}
+	if e.injectionDetector != nil {
+		if markers := e.injectionDetector.detect(texts); len(markers) > 0 {
+			values["injection_suspect"] = strings.Join(markers, ",")
+		}
+	}
+	if e.bannedContent != nil {
+		if terms := e.bannedContent.detector.detect(texts); len(terms) > 0 {
+			values["banned_content"] = strings.Join(terms, ",")
+		}
+	}
+	if e.languageDetection {
+		if language := detectLanguage(userText(texts)); language != "" {
+			values["prompt_lang"] = language
+		}
+	}
+	return values
+}
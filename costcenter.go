@@ -0,0 +1,47 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const costCenterHeader = "X-OpenAI-Cost-Center"
+
+// CostCenter maps a body field such as metadata.project through a lookup table to a cost center header
+type CostCenter struct {
+	Field    string            `json:"field"`
+	Header   string            `json:"header"`
+	Mappings map[string]string `json:"mappings"`
+	Default  string            `json:"default"`
+}
+
+// enabled reports whether cost center attribution is configured
+func (c *CostCenter) enabled() bool {
+	return c != nil && c.Field != ""
+}
+
+// setCostCenter sets the cost center mapped from the body field, or the default when the field is missing or has no
+// mapping. The header is always replaced so clients cannot choose their own cost center.
+func (e *Handler) setCostCenter(r *http.Request, members map[string]json.RawMessage) {
+	if !e.costCenter.enabled() {
+		return
+	}
+
+	header := e.costCenter.Header
+	if header == "" {
+		header = costCenterHeader
+	}
+
+	value, ok := lookupPath(members, e.costCenter.Field)
+	costCenter, mapped := e.costCenter.Mappings[value]
+	if !ok || !mapped {
+		e.metrics.inc("cost_center_unmapped_total")
+		costCenter = e.costCenter.Default
+	}
+
+	if costCenter == "" {
+		r.Header.Del(header)
+		return
+	}
+	r.Header.Set(header, costCenter)
+}
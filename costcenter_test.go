@@ -0,0 +1,113 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCostCenter_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		clientHeader string
+		want         string
+		wantUnmapped int64
+	}{
+		{
+			name:  "mapped",
+			input: "{\"model\": \"gpt-4.1\", \"metadata\": {\"project\": \"checkout\"}}",
+			want:  "cc-1001",
+		},
+		{
+			name:         "unmapped",
+			input:        "{\"model\": \"gpt-4.1\", \"metadata\": {\"project\": \"unknown\"}}",
+			want:         "cc-unallocated",
+			wantUnmapped: 1,
+		},
+		{
+			name:         "missing metadata",
+			input:        "{\"model\": \"gpt-4.1\"}",
+			want:         "cc-unallocated",
+			wantUnmapped: 1,
+		},
+		{
+			name:         "client header replaced",
+			input:        "{\"model\": \"gpt-4.1\", \"metadata\": {\"project\": \"search\"}}",
+			clientHeader: "cc-free",
+			want:         "cc-1002",
+		},
+		{
+			name:         "unparsable body",
+			input:        "INVALID JSON",
+			clientHeader: "cc-free",
+			want:         "cc-unallocated",
+			wantUnmapped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.HeaderPolicy = HeaderPolicyPreserve
+			config.CostCenter = &CostCenter{
+				Field:    "metadata.project",
+				Mappings: map[string]string{"checkout": "cc-1001", "search": "cc-1002"},
+				Default:  "cc-unallocated",
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			request := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input))
+			if tt.clientHeader != "" {
+				request.Header.Set(costCenterHeader, tt.clientHeader)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), request)
+
+			if got.Get(costCenterHeader) != tt.want {
+				t.Errorf("expected cost center %q but got %q", tt.want, got.Get(costCenterHeader))
+			}
+			if unmapped := e.(*Handler).metrics.counter("cost_center_unmapped_total"); unmapped != tt.wantUnmapped {
+				t.Errorf("expected %d unmapped hits but got %d", tt.wantUnmapped, unmapped)
+			}
+		})
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	members := map[string]json.RawMessage{
+		"model":    json.RawMessage("\"gpt-4.1\""),
+		"metadata": json.RawMessage("{\"project\": \"checkout\", \"shard\": 3, \"tags\": [\"a\"], \"owner\": null}"),
+	}
+	tests := []struct {
+		path   string
+		want   string
+		wantOk bool
+	}{
+		{path: "model", want: "gpt-4.1", wantOk: true},
+		{path: "metadata.project", want: "checkout", wantOk: true},
+		{path: "metadata.shard", want: "3", wantOk: true},
+		{path: "metadata.tags"},
+		{path: "metadata.owner"},
+		{path: "metadata.missing"},
+		{path: "model.name"},
+		{path: "metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := lookupPath(members, tt.path)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("expected %q %v but got %q %v", tt.want, tt.wantOk, got, ok)
+			}
+		})
+	}
+}
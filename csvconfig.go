@@ -0,0 +1,121 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseCsvPairs parses the flat key=value,key=value form of a map, which Docker and Kubernetes labels can hold where
+// nested maps are awkward. Blank entries are skipped.
+func parseCsvPairs(option string, csv string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, entry := range strings.Split(csv, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s entry %q", option, entry)
+		}
+		pairs = append(pairs, [2]string{key, strings.TrimSpace(value)})
+	}
+	return pairs, nil
+}
+
+// applyCsvConfig merges the flat forms of the maps into copies of the maps of the config. An entry of a flat form
+// replaces the entry of the map with the same key, so defaults such as the default request fields can be overridden.
+func applyCsvConfig(config *Config) error {
+	if config.RequestFieldsCsv != "" {
+		pairs, err := parseCsvPairs("requestFieldsCsv", config.RequestFieldsCsv)
+		if err != nil {
+			return err
+		}
+		fields := make(map[string]interface{}, len(config.RequestFields)+len(pairs))
+		for field, header := range config.RequestFields {
+			fields[field] = header
+		}
+		for _, pair := range pairs {
+			fields[pair[0]] = pair[1]
+		}
+		config.RequestFields = fields
+	}
+
+	for _, flat := range []struct {
+		option string
+		csv    string
+		values *map[string]string
+	}{
+		{"fallbackModelsCsv", config.FallbackModelsCsv, &config.FallbackModels},
+		{"modelBackendsCsv", config.ModelBackendsCsv, &config.ModelBackends},
+		{"staticHeadersCsv", config.StaticHeadersCsv, &config.StaticHeaders},
+		{"baggageFieldsCsv", config.BaggageFieldsCsv, &config.BaggageFields},
+	} {
+		if flat.csv == "" {
+			continue
+		}
+		pairs, err := parseCsvPairs(flat.option, flat.csv)
+		if err != nil {
+			return err
+		}
+		values := make(map[string]string, len(*flat.values)+len(pairs))
+		for key, value := range *flat.values {
+			values[key] = value
+		}
+		for _, pair := range pairs {
+			values[pair[0]] = pair[1]
+		}
+		*flat.values = values
+	}
+
+	if config.ValueMappingsCsv != "" {
+		pairs, err := parseCsvPairs("valueMappingsCsv", config.ValueMappingsCsv)
+		if err != nil {
+			return err
+		}
+		mappings := make(map[string]map[string]string, len(config.ValueMappings))
+		for field, mapping := range config.ValueMappings {
+			mappings[field] = mapping
+		}
+		copied := map[string]bool{}
+		for _, pair := range pairs {
+			// field:value=mapped, as field names may contain dots
+			field, value, ok := strings.Cut(pair[0], ":")
+			if !ok || field == "" {
+				return fmt.Errorf("invalid valueMappingsCsv entry %q", pair[0]+"="+pair[1])
+			}
+			if !copied[field] {
+				mapping := make(map[string]string, len(mappings[field])+1)
+				for from, to := range mappings[field] {
+					mapping[from] = to
+				}
+				mappings[field] = mapping
+				copied[field] = true
+			}
+			mappings[field][value] = pair[1]
+		}
+		config.ValueMappings = mappings
+	}
+
+	if config.RejectionStatusCodesCsv != "" {
+		pairs, err := parseCsvPairs("rejectionStatusCodesCsv", config.RejectionStatusCodesCsv)
+		if err != nil {
+			return err
+		}
+		codes := make(map[string]int, len(config.RejectionStatusCodes)+len(pairs))
+		for code, status := range config.RejectionStatusCodes {
+			codes[code] = status
+		}
+		for _, pair := range pairs {
+			status, err := strconv.Atoi(pair[1])
+			if err != nil {
+				return fmt.Errorf("invalid rejectionStatusCodesCsv status %q for %s", pair[1], pair[0])
+			}
+			codes[pair[0]] = status
+		}
+		config.RejectionStatusCodes = codes
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCsvConfig_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.RequestFieldsCsv = "model=X-LLM-Model, user = X-LLM-User,,temperature=false"
+	config.StaticHeadersCsv = "X-Gateway=eu-west-1"
+	config.ValueMappingsCsv = "model:gpt-4.1=flagship,model:gpt-4.1-mini=small"
+	defaults := config.RequestFields["model"]
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "csv")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"temperature\": 0.2}")))
+
+	want := map[string]string{
+		"X-LLM-Model":          "flagship",
+		"X-LLM-User":           "alice",
+		"X-OpenAI-Model":       "",
+		"X-OpenAI-Temperature": "",
+		"X-Gateway":            "eu-west-1",
+	}
+	for name, value := range want {
+		if got.Get(name) != value {
+			t.Errorf("expected header %s to be %q but got %q", name, value, got.Get(name))
+		}
+	}
+	if config.RequestFields["model"] != defaults {
+		t.Errorf("expected the configured map to be left unchanged but got %v", config.RequestFields["model"])
+	}
+}
+
+func TestApplyCsvConfig(t *testing.T) {
+	config := &Config{
+		FallbackModels:          map[string]string{"gpt-4.1": "gpt-4o"},
+		BaggageFieldsCsv:        "user=llm.user",
+		FallbackModelsCsv:       "o3=o4-mini",
+		RejectionStatusCodesCsv: "banned_content=451",
+		ValueMappings:           map[string]map[string]string{"model": {"gpt-4o": "legacy"}},
+		ValueMappingsCsv:        "metadata.tier:gold=1,model:o3=reasoning",
+	}
+	if err := applyCsvConfig(config); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	if want := map[string]string{"gpt-4.1": "gpt-4o", "o3": "o4-mini"}; !reflect.DeepEqual(config.FallbackModels, want) {
+		t.Errorf("expected fallback models %v but got %v", want, config.FallbackModels)
+	}
+	if want := map[string]string{"user": "llm.user"}; !reflect.DeepEqual(config.BaggageFields, want) {
+		t.Errorf("expected baggage fields %v but got %v", want, config.BaggageFields)
+	}
+	if want := map[string]int{"banned_content": 451}; !reflect.DeepEqual(config.RejectionStatusCodes, want) {
+		t.Errorf("expected rejection status codes %v but got %v", want, config.RejectionStatusCodes)
+	}
+	want := map[string]map[string]string{"model": {"gpt-4o": "legacy", "o3": "reasoning"}, "metadata.tier": {"gold": "1"}}
+	if !reflect.DeepEqual(config.ValueMappings, want) {
+		t.Errorf("expected value mappings %v but got %v", want, config.ValueMappings)
+	}
+}
+
+func TestInvalidCsvConfig_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*Config)
+	}{
+		{name: "entry without value", config: func(c *Config) { c.RequestFieldsCsv = "model" }},
+		{name: "entry without key", config: func(c *Config) { c.StaticHeadersCsv = "=eu-west-1" }},
+		{name: "value mapping without field", config: func(c *Config) { c.ValueMappingsCsv = "gpt-4.1=flagship" }},
+		{name: "status code", config: func(c *Config) { c.RejectionStatusCodesCsv = "banned_content=forbidden" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			tt.config(config)
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Daily request counter stores
+const (
+	DailyRequestsStoreMemory = "memory"
+	DailyRequestsStoreRedis  = "redis"
+)
+
+// Headers set on the request and the response with the daily request count of the API key
+const (
+	DailyRequestsHeader      = "X-OpenAI-Daily-Requests"
+	DailyLimitExceededHeader = "X-OpenAI-Daily-Limit-Exceeded"
+)
+
+// dailyRequestsWindowHours is the number of hourly buckets in the rolling window
+const dailyRequestsWindowHours = 24
+
+// DailyRequests configures counting the requests per API key over a rolling 24 hour window
+type DailyRequests struct {
+	SoftLimit int64  `json:"softLimit"`
+	Store     string `json:"store"`
+}
+
+// requestCounter counts the requests per API key fingerprint in hourly buckets
+type requestCounter interface {
+	// increment counts a request in the bucket of the hour and returns the count over the window ending at that hour
+	increment(fingerprint string, hour int64) (int64, error)
+}
+
+// dailyRequests is the compiled DailyRequests option
+type dailyRequests struct {
+	softLimit int64
+	counter   requestCounter
+	now       func() time.Time
+}
+
+func newDailyRequests(config *DailyRequests, redis *RedisConfig) (*dailyRequests, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.SoftLimit < 0 {
+		return nil, fmt.Errorf("invalid dailyRequests softLimit %d", config.SoftLimit)
+	}
+
+	var counter requestCounter
+	switch config.Store {
+	case "", DailyRequestsStoreMemory:
+		counter = &memoryRequestCounter{counts: map[string]*hourlyCounts{}}
+	case DailyRequestsStoreRedis:
+		client, err := newRedisClient(redis)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dailyRequests store: %w", err)
+		}
+		counter = &redisRequestCounter{client: client}
+	default:
+		return nil, fmt.Errorf("invalid dailyRequests store %q", config.Store)
+	}
+
+	return &dailyRequests{softLimit: config.SoftLimit, counter: counter, now: time.Now}, nil
+}
+
+// keyFingerprint returns a hash of the API key of the request, taken from a bearer token or the x-api-key, Azure's
+// api-key or the x-goog-api-key header, or an empty string when the request carries no key
+func keyFingerprint(r *http.Request) string {
+	key := ""
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		key = strings.TrimSpace(authorization[7:])
+	}
+	for _, header := range []string{"X-Api-Key", "Api-Key", "X-Goog-Api-Key"} {
+		if key == "" {
+			key = r.Header.Get(header)
+		}
+	}
+	if key == "" {
+		return ""
+	}
+	return hashValue(key)
+}
+
+// countDailyRequests counts the request for its API key and sets the count over the last 24 hours, and whether it
+// exceeds the soft limit, on the request and the response. Requests over the soft limit are not rejected; a request
+// that cannot be counted fails with the failure mode. It returns true when the request was answered. The soft limit is
+// reported as a quota that resets at the next hour, when the oldest hour leaves the window.
+func (e *Handler) countDailyRequests(w http.ResponseWriter, r *http.Request, quotas *quotaHeaders) bool {
+	fingerprint := keyFingerprint(r)
+	if fingerprint == "" {
+		return false
+	}
+
+	now := e.dailyRequests.now()
+	hour := now.Unix() / int64(time.Hour/time.Second)
+	count, err := e.dailyRequests.counter.increment(fingerprint, hour)
+	if err != nil {
+		return e.fail(w, fmt.Errorf("unable to count daily requests: %w", err))
+	}
+
+	value := strconv.FormatInt(count, 10)
+	r.Header.Set(DailyRequestsHeader, value)
+	w.Header().Set(DailyRequestsHeader, value)
+	if e.dailyRequests.softLimit > 0 && count > e.dailyRequests.softLimit {
+		r.Header.Set(DailyLimitExceededHeader, "true")
+		w.Header().Set(DailyLimitExceededHeader, "true")
+	}
+	limit := float64(e.dailyRequests.softLimit)
+	quotas.observe(limit, limit-float64(count), now.Truncate(time.Hour).Add(time.Hour).Sub(now), 0)
+	return false
+}
+
+// hourlyCounts is a ring of request counts for the last 24 hours
+type hourlyCounts struct {
+	hours  [dailyRequestsWindowHours]int64
+	counts [dailyRequestsWindowHours]int64
+}
+
+// memoryRequestCounter keeps the counts per instance. Keys without requests in the window are dropped once an hour.
+type memoryRequestCounter struct {
+	mu         sync.Mutex
+	counts     map[string]*hourlyCounts
+	lastPruned int64
+}
+
+func (c *memoryRequestCounter) increment(fingerprint string, hour int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hour != c.lastPruned {
+		c.lastPruned = hour
+		for key, counts := range c.counts {
+			if counts.total(hour) == 0 {
+				delete(c.counts, key)
+			}
+		}
+	}
+
+	counts, ok := c.counts[fingerprint]
+	if !ok {
+		counts = &hourlyCounts{}
+		c.counts[fingerprint] = counts
+	}
+	slot := hour % dailyRequestsWindowHours
+	if counts.hours[slot] != hour {
+		counts.hours[slot] = hour
+		counts.counts[slot] = 0
+	}
+	counts.counts[slot]++
+	return counts.total(hour), nil
+}
+
+// total returns the count over the window ending at the hour
+func (h *hourlyCounts) total(hour int64) int64 {
+	var total int64
+	for slot, count := range h.counts {
+		if hour-h.hours[slot] < dailyRequestsWindowHours {
+			total += count
+		}
+	}
+	return total
+}
+
+// redisRequestCounter keeps the counts in Redis, one key per API key and hour, so they hold across replicas
+type redisRequestCounter struct {
+	client *redisClient
+}
+
+func (c *redisRequestCounter) key(fingerprint string, hour int64) string {
+	return c.client.key("daily:" + fingerprint + ":" + strconv.FormatInt(hour, 10))
+}
+
+func (c *redisRequestCounter) increment(fingerprint string, hour int64) (int64, error) {
+	key := c.key(fingerprint, hour)
+	if _, err := c.client.do("INCR", key); err != nil {
+		return 0, err
+	}
+	if _, err := c.client.do("PEXPIRE", key, strconv.FormatInt(((dailyRequestsWindowHours+1)*time.Hour).Milliseconds(), 10)); err != nil {
+		return 0, err
+	}
+
+	args := []string{"MGET"}
+	for i := int64(0); i < dailyRequestsWindowHours; i++ {
+		args = append(args, c.key(fingerprint, hour-i))
+	}
+	reply, err := c.client.do(args...)
+	if err != nil {
+		return 0, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected MGET reply %v", reply)
+	}
+
+	var total int64
+	for _, value := range values {
+		if text, ok := value.(string); ok {
+			count, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			total += count
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,178 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{name: "bearer", header: "Authorization", value: "Bearer sk-test", want: hashValue("sk-test")},
+		{name: "anthropic", header: "X-Api-Key", value: "sk-ant-test", want: hashValue("sk-ant-test")},
+		{name: "gemini", header: "X-Goog-Api-Key", value: "AIza-test", want: hashValue("AIza-test")},
+		{name: "basic", header: "Authorization", value: "Basic dXNlcjpwYXNz", want: ""},
+		{name: "none", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			if got := keyFingerprint(req); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMemoryRequestCounter(t *testing.T) {
+	counter := &memoryRequestCounter{counts: map[string]*hourlyCounts{}}
+	steps := []struct {
+		key  string
+		hour int64
+		want int64
+	}{
+		{key: "a", hour: 100, want: 1},
+		{key: "a", hour: 100, want: 2},
+		{key: "b", hour: 110, want: 1},
+		{key: "a", hour: 123, want: 3},
+		{key: "a", hour: 124, want: 2},
+		{key: "a", hour: 148, want: 1},
+	}
+	for _, step := range steps {
+		if count, _ := counter.increment(step.key, step.hour); count != step.want {
+			t.Errorf("expected count %d for %s at hour %d but got %d", step.want, step.key, step.hour, count)
+		}
+	}
+	if _, ok := counter.counts["b"]; ok {
+		t.Errorf("expected keys without requests in the window to be dropped")
+	}
+}
+
+func TestDailyRequests_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name         string
+		store        string
+		wantCount    string
+		wantExceeded string
+	}{
+		{name: "memory", wantCount: "3", wantExceeded: "true"},
+		{name: "redis", store: DailyRequestsStoreRedis, wantCount: "3", wantExceeded: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.DailyRequests = &DailyRequests{SoftLimit: 2, Store: tt.store}
+			if tt.store == DailyRequestsStoreRedis {
+				config.Redis = &RedisConfig{Address: newFakeRedis(t).address(), Password: "secret"}
+			}
+
+			var upstream *http.Request
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				upstream = r
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			e.(*Handler).dailyRequests.now = func() time.Time {
+				return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+			}
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+				req.Header.Set("Authorization", "Bearer sk-test")
+				recorder = httptest.NewRecorder()
+				e.ServeHTTP(recorder, req)
+				if i == 0 && upstream.Header.Get(DailyLimitExceededHeader) != "" {
+					t.Errorf("expected the first request not to exceed the soft limit")
+				}
+			}
+
+			if got := upstream.Header.Get(DailyRequestsHeader); got != tt.wantCount {
+				t.Errorf("expected count %q but got %q", tt.wantCount, got)
+			}
+			if got := recorder.Header().Get(DailyRequestsHeader); got != tt.wantCount {
+				t.Errorf("expected response count %q but got %q", tt.wantCount, got)
+			}
+			if got := upstream.Header.Get(DailyLimitExceededHeader); got != tt.wantExceeded {
+				t.Errorf("expected exceeded %q but got %q", tt.wantExceeded, got)
+			}
+		})
+	}
+}
+
+// failingRequestCounter is a request counter whose store is unavailable
+type failingRequestCounter struct{}
+
+func (failingRequestCounter) increment(string, int64) (int64, error) {
+	return 0, errors.New("store unavailable")
+}
+
+func TestDailyRequestsFailure_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode string
+		wantStatus  int
+	}{
+		{name: "open", wantStatus: http.StatusOK},
+		{name: "closed", failureMode: FailureModeClosed, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.FailureMode = tt.failureMode
+			config.DailyRequests = &DailyRequests{SoftLimit: 2}
+
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			e.(*Handler).dailyRequests.counter = failingRequestCounter{}
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			req.Header.Set("Authorization", "Bearer sk-test")
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if recorder.Header().Get(DailyRequestsHeader) != "" {
+				t.Errorf("expected no count but got %s", recorder.Header().Get(DailyRequestsHeader))
+			}
+		})
+	}
+}
+
+func TestInvalidDailyRequests_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *DailyRequests
+	}{
+		{name: "soft limit", config: &DailyRequests{SoftLimit: -1}},
+		{name: "store", config: &DailyRequests{Store: "disk"}},
+		{name: "redis", config: &DailyRequests{Store: DailyRequestsStoreRedis}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.DailyRequests = tt.config
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader holds the suggested upstream timeout of the request in milliseconds
+const DeadlineHeader = "X-OpenAI-Deadline-Ms"
+
+// Deadline configures the upstream timeout suggested from the output token limit of the request
+type Deadline struct {
+	Base     string `json:"base"`
+	PerToken string `json:"perToken"`
+	Max      string `json:"max"`
+	Enforce  bool   `json:"enforce"`
+}
+
+// deadline is the parsed Deadline config
+type deadline struct {
+	base     time.Duration
+	perToken time.Duration
+	max      time.Duration
+	enforce  bool
+}
+
+func newDeadline(config *Deadline) (*deadline, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	d := &deadline{base: 10 * time.Second, perToken: 50 * time.Millisecond, max: 10 * time.Minute, enforce: config.Enforce}
+	var err error
+	if config.Base != "" {
+		if d.base, err = time.ParseDuration(config.Base); err != nil || d.base < 0 {
+			return nil, fmt.Errorf("invalid deadline base %q", config.Base)
+		}
+	}
+	if config.PerToken != "" {
+		if d.perToken, err = time.ParseDuration(config.PerToken); err != nil || d.perToken < 0 {
+			return nil, fmt.Errorf("invalid deadline perToken %q", config.PerToken)
+		}
+	}
+	if config.Max != "" {
+		if d.max, err = time.ParseDuration(config.Max); err != nil || d.max <= 0 {
+			return nil, fmt.Errorf("invalid deadline max %q", config.Max)
+		}
+	}
+	if d.base > d.max {
+		return nil, errors.New("deadline base cannot exceed max")
+	}
+	return d, nil
+}
+
+// timeout returns the base plus the time per token of the output token limit, capped at the maximum. Requests without
+// a limit can generate up to the model maximum, so they get the maximum.
+func (d *deadline) timeout(values map[string]string) time.Duration {
+	for _, field := range []string{"max_completion_tokens", "max_tokens", "max_output_tokens"} {
+		limit, err := strconv.ParseInt(values[field], 10, 64)
+		if err != nil || limit <= 0 {
+			continue
+		}
+		if d.perToken > 0 && limit > int64((d.max-d.base)/d.perToken) {
+			return d.max
+		}
+		return d.base + time.Duration(limit)*d.perToken
+	}
+	return d.max
+}
+
+// setDeadline sets the suggested upstream timeout on the request and, when enforced, shortens the deadline of the
+// request context to it. The returned function releases the context and must be called once the request is served.
+func (e *Handler) setDeadline(r *http.Request, values map[string]string) (*http.Request, func()) {
+	timeout := e.deadline.timeout(values)
+	e.setHeader(r.Header, DeadlineHeader, strconv.FormatInt(timeout.Milliseconds(), 10))
+	if !e.deadline.enforce {
+		return r, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			e.metrics.inc("deadlines_exceeded_total")
+		}
+		cancel()
+	}
+}
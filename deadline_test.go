@@ -0,0 +1,93 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadline_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "max completion tokens", input: "{\"model\": \"gpt-4.1\", \"max_completion_tokens\": 1000}", want: "60000"},
+		{name: "max tokens", input: "{\"model\": \"gpt-4.1\", \"max_tokens\": 100}", want: "15000"},
+		{name: "capped", input: "{\"model\": \"gpt-4.1\", \"max_completion_tokens\": 100000}", want: "120000"},
+		{name: "no limit", input: "{\"model\": \"gpt-4.1\"}", want: "120000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Deadline = &Deadline{Max: "2m"}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				if _, ok := r.Context().Deadline(); ok {
+					t.Errorf("expected the request deadline to be left unchanged")
+				}
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.input)))
+			if got.Get(DeadlineHeader) != tt.want {
+				t.Errorf("expected deadline %q but got %q", tt.want, got.Get(DeadlineHeader))
+			}
+		})
+	}
+}
+
+func TestEnforcedDeadline_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.Deadline = &Deadline{Base: "0s", PerToken: "1ms", Enforce: true}
+
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		if !ok || time.Until(deadline) > 10*time.Millisecond {
+			t.Errorf("expected the request deadline to be shortened but got %v", deadline)
+		}
+		<-r.Context().Done()
+		if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be exceeded but got %v", r.Context().Err())
+		}
+	}), config, "enforced deadline")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"max_completion_tokens\": 10}")))
+	if got := e.(*Handler).metrics.snapshot().Counters["deadlines_exceeded_total"]; got != 1 {
+		t.Errorf("expected 1 exceeded deadline but got %d", got)
+	}
+}
+
+func TestInvalidDeadline_New(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline Deadline
+	}{
+		{name: "invalid base", deadline: Deadline{Base: "soon"}},
+		{name: "negative per token", deadline: Deadline{PerToken: "-1ms"}},
+		{name: "zero max", deadline: Deadline{Max: "0s"}},
+		{name: "base above max", deadline: Deadline{Base: "2m", Max: "1m"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Deadline = &tt.deadline
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
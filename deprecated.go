@@ -0,0 +1,34 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// deprecatedParams lists the chat completion fields in a legacy shape that providers are phasing out: max_tokens,
+// replaced by max_completion_tokens, functions and function_call, replaced by tools and tool_choice, and logprobs as the
+// number of the legacy completions API rather than a boolean
+func deprecatedParams(members map[string]json.RawMessage) string {
+	var deprecated []string
+	for _, field := range []string{"max_tokens", "functions", "function_call"} {
+		if value, ok := members[field]; ok && string(bytes.TrimSpace(value)) != "null" {
+			deprecated = append(deprecated, field)
+		}
+	}
+	var logprobs json.Number
+	if value, ok := members["logprobs"]; ok && json.Unmarshal(value, &logprobs) == nil {
+		deprecated = append(deprecated, "logprobs")
+	}
+	return strings.Join(deprecated, ",")
+}
+
+// countDeprecatedParams counts the requests per deprecated field, to find the clients to migrate
+func (e *Handler) countDeprecatedParams(deprecated string) {
+	if deprecated == "" {
+		return
+	}
+	for _, param := range strings.Split(deprecated, ",") {
+		e.metrics.incLabel("deprecated_params", param)
+	}
+}
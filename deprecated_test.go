@@ -0,0 +1,42 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeprecatedParams_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "current shape", input: "{\"model\": \"gpt-4.1\", \"max_completion_tokens\": 100, \"logprobs\": true, \"tools\": []}", want: ""},
+		{name: "max tokens", input: "{\"model\": \"gpt-4.1\", \"max_tokens\": 100}", want: "max_tokens"},
+		{name: "null max tokens", input: "{\"model\": \"gpt-4.1\", \"max_tokens\": null}", want: ""},
+		{name: "functions", input: "{\"model\": \"gpt-4.1\", \"functions\": [{\"name\": \"lookup\"}], \"function_call\": \"auto\"}", want: "functions,function_call"},
+		{name: "integer logprobs", input: "{\"model\": \"gpt-4.1\", \"max_tokens\": 100, \"logprobs\": 5}", want: "max_tokens,logprobs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("X-OpenAI-Deprecated-Params")
+			}), defaultConfig(), tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.input)))
+			if got != tt.want {
+				t.Errorf("expected deprecated params %q but got %q", tt.want, got)
+			}
+			if tt.want != "" && e.(*Handler).metrics.snapshot().Labeled["deprecated_params"][strings.Split(tt.want, ",")[0]] != 1 {
+				t.Errorf("expected the deprecated params to be counted")
+			}
+		})
+	}
+}
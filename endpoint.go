@@ -0,0 +1,87 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// Endpoint registers an additional URI regex for an endpoint kind, for example a gateway path that serves chat
+// completions under another prefix
+type Endpoint struct {
+	Kind     string `json:"kind"`
+	UriRegex string `json:"uriRegex"`
+}
+
+// uriExtractor is the extractor of an endpoint kind claiming the requests whose URI matches a regex
+type uriExtractor struct {
+	extractor
+	endpointKind EndpointKind
+	regex        *regexp.Regexp
+}
+
+func (u uriExtractor) kind() EndpointKind {
+	return u.endpointKind
+}
+
+func (u uriExtractor) match(r *http.Request) bool {
+	return u.regex.MatchString(r.RequestURI)
+}
+
+// compileEndpoints registers the extractor of every endpoint kind for its URI regex, followed by the additionally
+// registered endpoints. Endpoints without a regex are disabled.
+func compileEndpoints(regexes map[EndpointKind]string, registered []Endpoint) ([]endpointExtractor, error) {
+	endpoints := make([]endpointExtractor, 0, len(regexes)+len(registered))
+	for kind, expr := range regexes {
+		if expr == "" {
+			continue
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uri regex for %s: %w", kind, err)
+		}
+		endpoints = append(endpoints, uriExtractor{extractor: extractors[kind], endpointKind: kind, regex: regex})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].kind() < endpoints[j].kind()
+	})
+
+	for i, registration := range registered {
+		kind := EndpointKind(registration.Kind)
+		extractor, ok := extractors[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown endpoints[%d] kind %q", i, registration.Kind)
+		}
+		if registration.UriRegex == "" {
+			return nil, fmt.Errorf("endpoints[%d] requires a uri regex", i)
+		}
+		regex, err := regexp.Compile(registration.UriRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoints[%d] uri regex: %w", i, err)
+		}
+		endpoints = append(endpoints, uriExtractor{extractor: extractor, endpointKind: kind, regex: regex})
+	}
+	return endpoints, nil
+}
+
+// extractorFor returns the first registered extractor of the kind that claims the request
+func (e *Handler) extractorFor(kind EndpointKind, r *http.Request) extractor {
+	for _, endpoint := range e.endpoints {
+		if endpoint.kind() == kind && endpoint.match(r) {
+			return endpoint
+		}
+	}
+	return extractors[kind]
+}
+
+// matchEndpoints returns the kinds of all registered extractors that claim the request, each kind once
+func (e *Handler) matchEndpoints(r *http.Request) []EndpointKind {
+	var kinds []EndpointKind
+	for _, endpoint := range e.endpoints {
+		if endpoint.match(r) && !containsKind(kinds, endpoint.kind()) {
+			kinds = append(kinds, endpoint.kind())
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,263 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpoints_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		uri    string
+		input  string
+		header string
+		want   string
+	}{
+		{
+			name:   "chat completion",
+			uri:    "/v1/chat/completions",
+			input:  "{\"model\": \"gpt-4.1\"}",
+			header: "X-OpenAI-Model",
+			want:   "gpt-4.1",
+		},
+		{
+			name:   "anthropic messages",
+			uri:    "/v1/messages?beta=true",
+			input:  "{\"model\": \"claude-sonnet-4-5\", \"thinking\": {\"type\": \"enabled\", \"budget_tokens\": 2048}}",
+			header: "X-OpenAI-Thinking-Budget-Tokens",
+			want:   "2048",
+		},
+		{
+			name:   "anthropic count tokens",
+			uri:    "/v1/messages/count_tokens",
+			input:  "{\"model\": \"claude-sonnet-4-5\", \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			header: "X-OpenAI-Operation",
+			want:   "count_tokens",
+		},
+		{
+			name:   "anthropic messages without operation",
+			uri:    "/v1/messages",
+			input:  "{\"model\": \"claude-sonnet-4-5\", \"max_tokens\": 1024}",
+			header: "X-OpenAI-Operation",
+			want:   "",
+		},
+		{
+			name:   "gemini stream generate content",
+			uri:    "/v1beta/models/gemini-2.5-pro:streamGenerateContent",
+			input:  "{\"contents\": [{\"parts\": [{\"text\": \"Hello!\"}]}]}",
+			header: "X-OpenAI-Stream",
+			want:   "true",
+		},
+		{
+			name:   "gemini generate content with sse",
+			uri:    "/v1beta/models/gemini-2.5-pro:generateContent?alt=sse",
+			input:  "{\"contents\": [{\"parts\": [{\"text\": \"Hello!\"}]}]}",
+			header: "X-OpenAI-Stream",
+			want:   "true",
+		},
+		{
+			name:   "gemini generate content",
+			uri:    "/v1beta/models/gemini-2.5-pro:generateContent",
+			input:  "{\"contents\": [{\"parts\": [{\"text\": \"Hello!\"}]}], \"generationConfig\": {\"temperature\": 0.2}}",
+			header: "X-OpenAI-Stream",
+			want:   "false",
+		},
+		{
+			name:   "gemini model from path",
+			uri:    "/v1beta/models/gemini-2.5-pro:generateContent",
+			input:  "{\"contents\": [{\"parts\": [{\"text\": \"Hello!\"}]}], \"generationConfig\": {\"temperature\": 0.2}}",
+			header: "X-OpenAI-Model",
+			want:   "gemini-2.5-pro",
+		},
+		{
+			name:   "eval",
+			uri:    "/v1/evals",
+			input:  "{\"name\": \"Sentiment\", \"data_source_config\": {\"type\": \"stored_completions\"}, \"testing_criteria\": []}",
+			header: "X-OpenAI-Eval-Data-Source",
+			want:   "stored_completions",
+		},
+		{
+			name:   "eval run model under test",
+			uri:    "/v1/evals/eval_abc123/runs",
+			input:  "{\"name\": \"gpt-4.1-mini\", \"data_source\": {\"type\": \"completions\", \"model\": \"gpt-4.1-mini\", \"source\": {\"type\": \"stored_completions\"}}}",
+			header: "X-OpenAI-Model",
+			want:   "gpt-4.1-mini",
+		},
+		{
+			name:   "eval run operation",
+			uri:    "/v1/evals/eval_abc123/runs",
+			input:  "{\"data_source\": {\"type\": \"jsonl\"}}",
+			header: "X-OpenAI-Operation",
+			want:   "eval_run",
+		},
+		{
+			name:   "legacy completion echo",
+			uri:    "/v1/completions",
+			input:  "{\"model\": \"gpt-3.5-turbo-instruct\", \"prompt\": \"Say hi\", \"echo\": true}",
+			header: "X-OpenAI-Echo",
+			want:   "true",
+		},
+		{
+			name:   "legacy completion suffix",
+			uri:    "/v1/completions",
+			input:  "{\"model\": \"gpt-3.5-turbo-instruct\", \"prompt\": \"def add(a, b):\", \"suffix\": \"\\n\\nprint(add(1, 2))\"}",
+			header: "X-OpenAI-Suffix",
+			want:   "true",
+		},
+		{
+			name:   "legacy completion without suffix",
+			uri:    "/v1/completions",
+			input:  "{\"model\": \"gpt-3.5-turbo-instruct\", \"prompt\": \"Say hi\", \"suffix\": \"\"}",
+			header: "X-OpenAI-Suffix",
+			want:   "",
+		},
+		{
+			name:   "legacy completion model",
+			uri:    "/v1/completions",
+			input:  "{\"model\": \"gpt-3.5-turbo-instruct\", \"prompt\": \"Say hi\", \"logprobs\": 5}",
+			header: "X-OpenAI-Logprobs",
+			want:   "5",
+		},
+		{
+			name:   "unmatched",
+			uri:    "/v1/models",
+			input:  "{\"model\": \"gpt-4.1\"}",
+			header: "X-OpenAI-Model",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), CreateConfig(), tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", tt.uri, strings.NewReader(tt.input)))
+
+			if got.Get(tt.header) != tt.want {
+				t.Errorf("expected header %v to be %q but got %q", tt.header, tt.want, got.Get(tt.header))
+			}
+		})
+	}
+}
+
+func TestRegisteredEndpoints_ServeHTTP(t *testing.T) {
+	config := CreateConfig()
+	config.HeaderPolicy = HeaderPolicyAppend
+	config.Endpoints = []Endpoint{
+		{Kind: string(ChatCompletionEndpoint), UriRegex: "/openai/deployments/[^/]+/chat/completions"},
+		{Kind: string(ChatCompletionEndpoint), UriRegex: "/v1/chat/"},
+	}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "registered endpoints")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	input := "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}"
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/openai/deployments/prod/chat/completions?api-version=2024-10-21", strings.NewReader(input)))
+	if want := "gpt-4.1"; got.Get("X-OpenAI-Model") != want {
+		t.Errorf("expected model %q but got %q", want, got.Get("X-OpenAI-Model"))
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+	if values := got.Values("X-OpenAI-User"); len(values) != 1 {
+		t.Errorf("expected a kind matched by several endpoints to be extracted once but got %v", values)
+	}
+}
+
+// headerExtractor claims the chat completions that name their endpoint in a header, whatever their URI
+type headerExtractor struct{}
+
+func (headerExtractor) kind() EndpointKind {
+	return ChatCompletionEndpoint
+}
+
+func (headerExtractor) match(r *http.Request) bool {
+	return r.Header.Get("X-Endpoint") == "chat"
+}
+
+func (headerExtractor) extract(d *fieldDecoder, _ *http.Request) (map[string]string, error) {
+	values, err := extractChatCompletionFields(d)
+	values["operation"] = "custom"
+	return values, err
+}
+
+func TestCustomExtractor_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		uri           string
+		endpoint      string
+		wantModel     string
+		wantOperation string
+	}{
+		{name: "claimed by header", uri: "/internal/generate", endpoint: "chat", wantModel: "gpt-4.1", wantOperation: "custom"},
+		{name: "claimed by uri", uri: "/v1/chat/completions", wantModel: "gpt-4.1"},
+		{name: "not claimed", uri: "/internal/generate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), CreateConfig(), tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			e.(*Handler).endpoints = append([]endpointExtractor{headerExtractor{}}, e.(*Handler).endpoints...)
+
+			req := httptest.NewRequest("POST", tt.uri, strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			if tt.endpoint != "" {
+				req.Header.Set("X-Endpoint", tt.endpoint)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.Get("X-OpenAI-Model") != tt.wantModel {
+				t.Errorf("expected model %q but got %q", tt.wantModel, got.Get("X-OpenAI-Model"))
+			}
+			if got.Get("X-OpenAI-Operation") != tt.wantOperation {
+				t.Errorf("expected operation %q but got %q", tt.wantOperation, got.Get("X-OpenAI-Operation"))
+			}
+		})
+	}
+}
+
+func TestInvalidEndpoints_New(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+	}{
+		{name: "unknown kind", endpoint: Endpoint{Kind: "embeddings", UriRegex: "/v1/embeddings"}},
+		{name: "missing regex", endpoint: Endpoint{Kind: string(BatchEndpoint)}},
+		{name: "invalid regex", endpoint: Endpoint{Kind: string(BatchEndpoint), UriRegex: "/v1/batches("}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.Endpoints = []Endpoint{tt.endpoint}
+			if _, err := New(nil, http.NotFoundHandler(), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestInvalidUriRegex_New(t *testing.T) {
+	config := CreateConfig()
+	config.AnthropicMessagesUriRegex = "/v1/messages("
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid uri regex")
+	}
+}
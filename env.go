@@ -0,0 +1,123 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+)
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${ENV_VAR} references with the value of the environment variable
+func expandEnv(value string) (string, error) {
+	var missing string
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return env
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s referenced in config is not set", missing)
+	}
+	return expanded, nil
+}
+
+// valueMaskType is skipped by expandValue: a mask replacement refers to named submatches with the same ${name} syntax
+var valueMaskType = reflect.TypeOf(ValueMask{})
+
+// expandConfig returns a copy of the config with environment variable references expanded in all string values. The
+// config is walked rather than listed field by field, so a new option is expanded without being registered here.
+func expandConfig(config *Config) (*Config, error) {
+	value, err := expandValue(reflect.ValueOf(config).Elem())
+	if err != nil {
+		return nil, err
+	}
+	expanded := value.Interface().(Config)
+	return &expanded, nil
+}
+
+// expandValue returns a copy of the value with environment variable references expanded in every string it holds,
+// following pointers, interfaces, structs, slices and map values. Map keys are field and model names and are kept.
+func expandValue(value reflect.Value) (reflect.Value, error) {
+	switch value.Kind() {
+	case reflect.String:
+		text, err := expandEnv(value.String())
+		if err != nil {
+			return value, err
+		}
+		expanded := reflect.New(value.Type()).Elem()
+		expanded.SetString(text)
+		return expanded, nil
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value, nil
+		}
+		elem, err := expandValue(value.Elem())
+		if err != nil {
+			return value, err
+		}
+		expanded := reflect.New(value.Type().Elem())
+		expanded.Elem().Set(elem)
+		return expanded, nil
+	case reflect.Interface:
+		if value.IsNil() {
+			return value, nil
+		}
+		elem, err := expandValue(value.Elem())
+		if err != nil {
+			return value, err
+		}
+		expanded := reflect.New(value.Type()).Elem()
+		expanded.Set(elem)
+		return expanded, nil
+	case reflect.Struct:
+		if value.Type() == valueMaskType {
+			return value, nil
+		}
+		expanded := reflect.New(value.Type()).Elem()
+		expanded.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if !expanded.Field(i).CanSet() {
+				continue
+			}
+			field, err := expandValue(value.Field(i))
+			if err != nil {
+				return value, err
+			}
+			expanded.Field(i).Set(field)
+		}
+		return expanded, nil
+	case reflect.Slice:
+		if value.IsNil() {
+			return value, nil
+		}
+		expanded := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elem, err := expandValue(value.Index(i))
+			if err != nil {
+				return value, err
+			}
+			expanded.Index(i).Set(elem)
+		}
+		return expanded, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return value, nil
+		}
+		expanded := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			elem, err := expandValue(iter.Value())
+			if err != nil {
+				return value, err
+			}
+			expanded.SetMapIndex(iter.Key(), elem)
+		}
+		return expanded, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,107 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("OPENAI_HEADER_PREFIX", "X-Prod")
+	t.Setenv("OPENAI_HEADER_EMPTY", "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		error bool
+	}{
+		{name: "no reference", input: "X-OpenAI-Model", want: "X-OpenAI-Model"},
+		{name: "reference", input: "${OPENAI_HEADER_PREFIX}-Model", want: "X-Prod-Model"},
+		{name: "empty variable", input: "X${OPENAI_HEADER_EMPTY}-Model", want: "X-Model"},
+		{name: "regex anchors untouched", input: "^/v1/chat/completions$", want: "^/v1/chat/completions$"},
+		{name: "unset variable", input: "${OPENAI_HEADER_UNSET_VARIABLE}", error: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnv(tt.input)
+			if (err != nil) != tt.error {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExpandEnvConfig_ServeHTTP(t *testing.T) {
+	t.Setenv("OPENAI_MODEL_HEADER", "X-Env-Model")
+
+	config := defaultConfig()
+	config.RequestFields["model"] = "${OPENAI_MODEL_HEADER}"
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "env")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+	if got.Get("X-Env-Model") != "gpt-4.1" {
+		t.Errorf("expected expanded header name to be used, got %v", got)
+	}
+	if config.RequestFields["model"] != "${OPENAI_MODEL_HEADER}" {
+		t.Errorf("expected the passed config to be left untouched")
+	}
+
+	config.RequestFields["model"] = "${OPENAI_HEADER_UNSET_VARIABLE}"
+	if _, err := New(nil, http.NotFoundHandler(), config, "env"); err == nil {
+		t.Errorf("expected an error for an unset environment variable")
+	}
+}
+
+func TestExpandConfig(t *testing.T) {
+	t.Setenv("OPENAI_HEADER_REDIS_PASSWORD", "secret")
+	t.Setenv("OPENAI_HEADER_SHADOW_TOKEN", "token")
+	t.Setenv("OPENAI_HEADER_TENANT_HEADER", "X-Tenant-Model")
+
+	config := defaultConfig()
+	config.RequestFields["user"] = []interface{}{"X-User", "${OPENAI_HEADER_TENANT_HEADER}"}
+	config.Redis = &RedisConfig{Address: "localhost:6379", Password: "${OPENAI_HEADER_REDIS_PASSWORD}"}
+	config.Shadow = &Shadow{URL: "http://shadow", Headers: map[string]string{"Authorization": "Bearer ${OPENAI_HEADER_SHADOW_TOKEN}"}}
+	config.Tenants = map[string]TenantConfig{"acme": {RequestFields: map[string]interface{}{"model": "${OPENAI_HEADER_TENANT_HEADER}"}}}
+	config.ValueMasks = map[string][]ValueMask{"user": {{Pattern: `(?P<id>\d+)`, Replacement: "${id}"}}}
+
+	expanded, err := expandConfig(config)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := expanded.RequestFields["user"].([]interface{})[1]; got != "X-Tenant-Model" {
+		t.Errorf("expected the request field list to be expanded, got %v", got)
+	}
+	if expanded.Redis.Password != "secret" {
+		t.Errorf("expected the redis password to be expanded, got %q", expanded.Redis.Password)
+	}
+	if got := expanded.Shadow.Headers["Authorization"]; got != "Bearer token" {
+		t.Errorf("expected the shadow header to be expanded, got %q", got)
+	}
+	if got := expanded.Tenants["acme"].RequestFields["model"]; got != "X-Tenant-Model" {
+		t.Errorf("expected the tenant request field to be expanded, got %v", got)
+	}
+	if got := expanded.ValueMasks["user"][0].Replacement; got != "${id}" {
+		t.Errorf("expected the value mask to be left as it is, got %q", got)
+	}
+	if config.Redis.Password != "${OPENAI_HEADER_REDIS_PASSWORD}" || config.Shadow.Headers["Authorization"] != "Bearer ${OPENAI_HEADER_SHADOW_TOKEN}" {
+		t.Errorf("expected the passed config to be left untouched")
+	}
+
+	config.Tenants["acme"].RequestFields["model"] = "${OPENAI_HEADER_UNSET_VARIABLE}"
+	if _, err := expandConfig(config); err == nil {
+		t.Errorf("expected an error for an unset environment variable")
+	}
+}
@@ -0,0 +1,37 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Expect continue actions controlling how a request with Expect: 100-continue is handled
+const (
+	ExpectContinueExtract = "extract"
+	ExpectContinueBypass  = "bypass"
+)
+
+// expectsContinue reports whether the client waits for a 100 Continue before sending the body
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue")
+}
+
+// continued removes the expectation once the body is being read. The server answers the client with 100 Continue on
+// the first read, so forwarding the expectation would only make the upstream transport wait for a second interim
+// response before sending a body that is already here.
+func (e *Handler) continued(r *http.Request) {
+	if expectsContinue(r) {
+		e.metrics.inc("expect_continue_extracted_total")
+		r.Header.Del("Expect")
+	}
+}
+
+// bypassExpectContinue forwards a request with Expect: 100-continue untouched, so the upstream decides whether the
+// client may send the body
+func (e *Handler) bypassExpectContinue(r *http.Request) {
+	e.metrics.inc("expect_continue_bypassed_total")
+	if e.markSkipped {
+		r.Header.Set(SkippedHeader, "expect-continue")
+	}
+	e.setCostCenter(r, nil)
+}
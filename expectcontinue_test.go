@@ -0,0 +1,103 @@
+package traefik_openai_header
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpectContinue_ServeHTTP(t *testing.T) {
+	body := "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}"
+	tests := []struct {
+		name           string
+		expectContinue string
+		wantModel      string
+		wantExpect     string
+		wantSkipped    string
+	}{
+		{name: "extract", wantModel: "gpt-4.1", wantExpect: "", wantSkipped: ""},
+		{name: "bypass", expectContinue: ExpectContinueBypass, wantModel: "", wantExpect: "100-continue", wantSkipped: "expect-continue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ExpectContinue = tt.expectContinue
+			config.MarkSkipped = true
+
+			received := make(chan http.Header, 1)
+			var forwarded string
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				forwarded = string(data)
+				received <- r.Header.Clone()
+				w.WriteHeader(http.StatusOK)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			request := "POST /v1/chat/completions HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\n" +
+				"Content-Length: " + strconv.Itoa(len(body)) + "\r\nExpect: 100-continue\r\n\r\n"
+			if _, err := io.WriteString(conn, request); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+
+			// the body is only sent once the interim response arrived
+			reader := bufio.NewReader(conn)
+			interim, err := reader.ReadString('\n')
+			if err != nil || !strings.HasPrefix(interim, "HTTP/1.1 100 ") {
+				t.Fatalf("expected 100 Continue but got %q (%v)", interim, err)
+			}
+			if _, err := reader.ReadString('\n'); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if _, err := io.WriteString(conn, body); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+
+			response, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("expected status 200 but got %d", response.StatusCode)
+			}
+
+			got := <-received
+			if forwarded != body {
+				t.Errorf("expected the body to be forwarded but got %q", forwarded)
+			}
+			want := map[string]string{"X-OpenAI-Model": tt.wantModel, "Expect": tt.wantExpect, SkippedHeader: tt.wantSkipped}
+			for name, value := range want {
+				if got.Get(name) != value {
+					t.Errorf("expected header %s to be %q but got %q", name, value, got.Get(name))
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidExpectContinue_New(t *testing.T) {
+	config := defaultConfig()
+	config.ExpectContinue = "reject"
+	if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "invalid expectContinue"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
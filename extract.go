@@ -0,0 +1,691 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EndpointKind identifies the OpenAI API a request body belongs to
+type EndpointKind string
+
+const (
+	// ChatCompletionEndpoint is a /v1/chat/completions request body
+	ChatCompletionEndpoint EndpointKind = "chat_completion"
+	// BatchEndpoint is a /v1/batches request body
+	BatchEndpoint EndpointKind = "batch"
+	// AnthropicMessagesEndpoint is an Anthropic /v1/messages request body
+	AnthropicMessagesEndpoint EndpointKind = "anthropic_messages"
+	// AnthropicCountTokensEndpoint is an Anthropic /v1/messages/count_tokens request body
+	AnthropicCountTokensEndpoint EndpointKind = "anthropic_count_tokens"
+	// GeminiGenerateContentEndpoint is a Gemini models/{model}:generateContent or :streamGenerateContent request body
+	GeminiGenerateContentEndpoint EndpointKind = "gemini_generate_content"
+	// FileUploadEndpoint is a multipart /v1/files upload
+	FileUploadEndpoint EndpointKind = "file_upload"
+	// UploadEndpoint is a /v1/uploads request body creating a multipart large upload
+	UploadEndpoint EndpointKind = "upload"
+	// UploadPartEndpoint is a multipart /v1/uploads/{id}/parts request adding a part to a large upload
+	UploadPartEndpoint EndpointKind = "upload_part"
+	// EvalEndpoint is a /v1/evals request body creating an evaluation
+	EvalEndpoint EndpointKind = "eval"
+	// EvalRunEndpoint is a /v1/evals/{id}/runs request body starting an evaluation run
+	EvalRunEndpoint EndpointKind = "eval_run"
+	// CompletionEndpoint is a legacy /v1/completions request body
+	CompletionEndpoint EndpointKind = "completion"
+)
+
+// Extract returns the headers the plugin would set for the given request body, keyed by header name.
+// Headers that could be extracted are returned together with the parse error, if any.
+func Extract(kind EndpointKind, body []byte, cfg *Config) (map[string]string, error) {
+	if cfg == nil {
+		cfg = CreateConfig()
+	}
+	if len(body) < 1 {
+		return map[string]string{}, errors.New("empty body")
+	}
+	mapper, err := newHeaderMapper(cfg)
+	if err != nil {
+		return nil, err
+	}
+	extractor, ok := extractors[kind]
+	if !ok {
+		return map[string]string{}, fmt.Errorf("unknown endpoint kind %q", kind)
+	}
+	members, err := decodeMembers(body, false)
+	if err != nil {
+		return map[string]string{}, err
+	}
+	values, err := mapper.extract(extractor, kind, members, nil)
+	return mapper.headers(values, members), err
+}
+
+var geminiMethod = regexp.MustCompile(`/models/([^/:]+):(\w+)`)
+
+// decodeMembers decodes the top-level members of a JSON object body in a single pass without interpreting their
+// values. For a truncated body prefix only the members that are complete are returned, so that fields sent before a
+// large value (e.g. base64 images in messages) can still be extracted.
+func decodeMembers(data []byte, truncated bool) (map[string]json.RawMessage, error) {
+	members := map[string]json.RawMessage{}
+	if !truncated {
+		err := json.Unmarshal(data, &members)
+		return members, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil {
+		return members, err
+	} else if token != json.Delim('{') {
+		return members, fmt.Errorf("expected a JSON object but got %v", token)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		key, ok := token.(string)
+		if !ok {
+			break
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+		members[key] = value
+	}
+	return members, nil
+}
+
+// fieldDecoder decodes individual members so that a field with an unexpected shape does not prevent the
+// extraction of the other fields. The decoder of a nested object reports its failures to its parent, prefixed with
+// the path of the object.
+type fieldDecoder struct {
+	members map[string]json.RawMessage
+	format  numberFormat
+	errs    []string
+	parent  *fieldDecoder
+	prefix  string
+}
+
+// object returns a decoder for the members of an object member and reports whether a non-null object was decoded
+func (d *fieldDecoder) object(field string) (*fieldDecoder, bool) {
+	var members map[string]json.RawMessage
+	if !d.decode(field, &members) {
+		return nil, false
+	}
+	return &fieldDecoder{members: members, format: d.format, parent: d, prefix: d.prefix + field + "."}, true
+}
+
+// fail records a decoding failure with the outermost decoder
+func (d *fieldDecoder) fail(message string) {
+	for d.parent != nil {
+		d = d.parent
+	}
+	d.errs = append(d.errs, message)
+}
+
+// decode unmarshals the member into target and reports whether a non-null value was decoded
+func (d *fieldDecoder) decode(field string, target interface{}) bool {
+	raw, ok := d.members[field]
+	if !ok || string(raw) == "null" {
+		return false
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		d.fail(fmt.Sprintf("invalid %s%s: %v", d.prefix, field, err))
+		return false
+	}
+	return true
+}
+
+// decodeBool decodes a boolean member as true or false
+func (d *fieldDecoder) decodeBool(field string) (string, bool) {
+	var value bool
+	if !d.decode(field, &value) {
+		return "", false
+	}
+	return strconv.FormatBool(value), true
+}
+
+// decodeFloat decodes a numeric member and formats it according to the configured number format
+func (d *fieldDecoder) decodeFloat(field string) (string, bool) {
+	var value float64
+	if !d.decode(field, &value) {
+		return "", false
+	}
+	if d.format.raw {
+		return d.rawText(field), true
+	}
+	return d.format.formatFloat(value), true
+}
+
+// decodeInteger decodes a token count member, accepting integral numbers in any JSON notation such as 1e6
+func (d *fieldDecoder) decodeInteger(field string) (string, bool) {
+	var value float64
+	if !d.decode(field, &value) {
+		return "", false
+	}
+	if d.format.raw {
+		return d.rawText(field), true
+	}
+	if value != math.Trunc(value) || math.Abs(value) > 1<<53 {
+		d.fail(fmt.Sprintf("invalid %s%s: %v is not an integer", d.prefix, field, value))
+		return "", false
+	}
+	return strconv.FormatInt(int64(value), 10), true
+}
+
+// rawText returns the member exactly as it was written in the body
+func (d *fieldDecoder) rawText(field string) string {
+	return string(bytes.TrimSpace(d.members[field]))
+}
+
+// err returns the decoding failures of all fields as a single header-safe error
+func (d *fieldDecoder) err() error {
+	if len(d.errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(d.errs, "; "))
+}
+
+func extractChatCompletionFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	var model string
+	d.decode("model", &model)
+	values["model"] = model
+
+	var user string
+	if d.decode("user", &user) && user != "" {
+		values["user"] = user
+	}
+
+	if temperature, ok := d.decodeFloat("temperature"); ok {
+		values["temperature"] = temperature
+	}
+
+	if maxCompletionTokens, ok := d.decodeInteger("max_completion_tokens"); ok {
+		values["max_completion_tokens"] = maxCompletionTokens
+	}
+
+	if maxTokens, ok := d.decodeInteger("max_tokens"); ok {
+		values["max_tokens"] = maxTokens
+	}
+
+	if logprobs, ok := d.decodeBool("logprobs"); ok {
+		values["logprobs"] = logprobs
+	}
+
+	if topLogprobs, ok := d.decodeInteger("top_logprobs"); ok {
+		values["top_logprobs"] = topLogprobs
+	}
+
+	if n, ok := d.decodeInteger("n"); ok {
+		values["n"] = n
+	}
+
+	var toolChoice interface{}
+	if d.decode("tool_choice", &toolChoice) {
+		if choice := formatToolChoice(toolChoice); choice != "" {
+			values["tool_choice"] = choice
+		}
+	}
+
+	if frequencyPenalty, ok := d.decodeFloat("frequency_penalty"); ok {
+		values["frequency_penalty"] = frequencyPenalty
+	}
+
+	if presencePenalty, ok := d.decodeFloat("presence_penalty"); ok {
+		values["presence_penalty"] = presencePenalty
+	}
+
+	if topP, ok := d.decodeFloat("top_p"); ok {
+		values["top_p"] = topP
+	}
+
+	extractSelfHostedSamplingFields(d, values)
+
+	if stream, ok := d.decodeBool("stream"); ok {
+		values["stream"] = stream
+	}
+
+	var promptCacheKey string
+	if d.decode("prompt_cache_key", &promptCacheKey) && promptCacheKey != "" {
+		values["prompt_cache_key"] = promptCacheKey
+	}
+
+	var safetyIdentifier string
+	if d.decode("safety_identifier", &safetyIdentifier) && safetyIdentifier != "" {
+		values["safety_identifier"] = safetyIdentifier
+	}
+
+	if key, ok := cacheKey(d.members); ok {
+		values["cache_key"] = key
+	}
+
+	if deprecated := deprecatedParams(d.members); deprecated != "" {
+		values["deprecated_params"] = deprecated
+	}
+
+	var messages []chatMessage
+	if d.decode("messages", &messages) {
+		values["instruction_role"] = instructionRole(messages)
+
+		// base64 images and audio would inflate an estimate from the body size, so only the text is counted
+		var tokens int64
+		for _, message := range messages {
+			tokens += textTokens(contentText(message.Content))
+		}
+
+		parts := contentParts(messages)
+		if formats, ok := audioInputFormats(parts); ok {
+			values["audio_input"] = "true"
+			if formats != "" {
+				values["audio_format"] = formats
+			}
+			if seconds, ok := audioSeconds(parts); ok {
+				values["audio_seconds"] = strconv.FormatFloat(seconds, 'f', 1, 64)
+			}
+		}
+		if files := countParts(parts, "file"); files > 0 {
+			values["file_input"] = strconv.Itoa(files)
+		}
+		if images, ok := imageTokens(parts); ok {
+			values["image_tokens"] = strconv.Itoa(images)
+			tokens += int64(images)
+		}
+		values["estimated_prompt_tokens"] = strconv.FormatInt(tokens, 10)
+	}
+
+	return values, d.err()
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatContentPart struct {
+	Type       string `json:"type"`
+	Text       string `json:"text"`
+	InputAudio struct {
+		Data   string `json:"data"`
+		Format string `json:"format"`
+	} `json:"input_audio"`
+	ImageURL struct {
+		URL    string `json:"url"`
+		Detail string `json:"detail"`
+	} `json:"image_url"`
+}
+
+// extractSelfHostedSamplingFields extracts the sampling fields that OpenAI compatible servers such as vLLM, SGLang and
+// llama.cpp accept on top of the OpenAI ones
+func extractSelfHostedSamplingFields(d *fieldDecoder, values map[string]string) {
+	if topK, ok := d.decodeInteger("top_k"); ok {
+		values["top_k"] = topK
+	}
+
+	if minP, ok := d.decodeFloat("min_p"); ok {
+		values["min_p"] = minP
+	}
+
+	if repetitionPenalty, ok := d.decodeFloat("repetition_penalty"); ok {
+		values["repetition_penalty"] = repetitionPenalty
+	}
+}
+
+// instructionRole reports whether the conversation carries its instructions in a developer message, a system message,
+// both or neither
+func instructionRole(messages []chatMessage) string {
+	developer, system := false, false
+	for _, message := range messages {
+		switch message.Role {
+		case "developer":
+			developer = true
+		case "system":
+			system = true
+		}
+	}
+	switch {
+	case developer && system:
+		return "both"
+	case developer:
+		return "developer"
+	case system:
+		return "system"
+	}
+	return "none"
+}
+
+// contentParts returns the content parts of all messages whose content is an array of parts rather than a string
+func contentParts(messages []chatMessage) []chatContentPart {
+	var parts []chatContentPart
+	for _, message := range messages {
+		if len(message.Content) == 0 || message.Content[0] != '[' {
+			continue
+		}
+		var messageParts []chatContentPart
+		if err := json.Unmarshal(message.Content, &messageParts); err != nil {
+			continue
+		}
+		parts = append(parts, messageParts...)
+	}
+	return parts
+}
+
+// countParts counts the content parts of a type
+func countParts(parts []chatContentPart, partType string) int {
+	count := 0
+	for _, part := range parts {
+		if part.Type == partType {
+			count++
+		}
+	}
+	return count
+}
+
+// audioInputFormats reports whether there is an input_audio content part and returns the distinct declared formats in
+// order of appearance, comma separated
+func audioInputFormats(parts []chatContentPart) (string, bool) {
+	found := false
+	var formats []string
+	for _, part := range parts {
+		if part.Type != "input_audio" {
+			continue
+		}
+		found = true
+		if format := part.InputAudio.Format; format != "" && !contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return strings.Join(formats, ","), found
+}
+
+// contains reports whether the list contains the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// formatToolChoice converts a tool_choice string or object into a header value like "function:get_current_weather"
+func formatToolChoice(toolChoice interface{}) string {
+	switch choice := toolChoice.(type) {
+	case string:
+		return choice
+	case map[string]interface{}:
+		choiceType, _ := choice["type"].(string)
+		name, _ := choice["name"].(string)
+		if function, ok := choice["function"].(map[string]interface{}); ok {
+			if functionName, ok := function["name"].(string); ok {
+				name = functionName
+			}
+		}
+		if choiceType == "" {
+			return name
+		}
+		if name == "" {
+			return choiceType
+		}
+		return choiceType + ":" + name
+	default:
+		return ""
+	}
+}
+
+// extractCompletionFields extracts the fields of the legacy completions API. echo returns the prompt as part of the
+// completion and is billed as output, so it is emitted whenever it is set; suffix only reports whether one is present.
+func extractCompletionFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	var model string
+	d.decode("model", &model)
+	values["model"] = model
+
+	var user string
+	if d.decode("user", &user) && user != "" {
+		values["user"] = user
+	}
+
+	if temperature, ok := d.decodeFloat("temperature"); ok {
+		values["temperature"] = temperature
+	}
+
+	if topP, ok := d.decodeFloat("top_p"); ok {
+		values["top_p"] = topP
+	}
+
+	extractSelfHostedSamplingFields(d, values)
+
+	if maxTokens, ok := d.decodeInteger("max_tokens"); ok {
+		values["max_tokens"] = maxTokens
+	}
+
+	if logprobs, ok := d.decodeInteger("logprobs"); ok {
+		values["logprobs"] = logprobs
+	}
+
+	for _, field := range []string{"n", "best_of"} {
+		if count, ok := d.decodeInteger(field); ok {
+			values[field] = count
+		}
+	}
+
+	if stream, ok := d.decodeBool("stream"); ok {
+		values["stream"] = stream
+	}
+
+	if echo, ok := d.decodeBool("echo"); ok {
+		values["echo"] = echo
+	}
+
+	var suffix string
+	if d.decode("suffix", &suffix) && suffix != "" {
+		values["suffix"] = "true"
+	}
+
+	// a prompt is a string or a list of strings; token id prompts are left to the size estimate
+	var prompt interface{}
+	if d.decode("prompt", &prompt) {
+		texts := []string{suffix}
+		switch p := prompt.(type) {
+		case string:
+			texts = append(texts, p)
+		case []interface{}:
+			for _, item := range p {
+				if text, ok := item.(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		if len(texts) > 1 {
+			values["estimated_prompt_tokens"] = strconv.FormatInt(textTokens(texts...), 10)
+		}
+	}
+
+	return values, d.err()
+}
+
+func extractBatchFields(d *fieldDecoder) (map[string]string, error) {
+	var completionWindow string
+	d.decode("completion_window", &completionWindow)
+
+	var endpoint string
+	d.decode("endpoint", &endpoint)
+
+	return map[string]string{
+		"completion_window": completionWindow,
+		"oai_endpoint":      endpoint,
+	}, d.err()
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+func extractAnthropicMessagesFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	var model string
+	d.decode("model", &model)
+	values["model"] = model
+
+	var metadata anthropicMetadata
+	if d.decode("metadata", &metadata) && metadata.UserID != "" {
+		values["user"] = metadata.UserID
+	}
+
+	if maxTokens, ok := d.decodeInteger("max_tokens"); ok {
+		values["max_tokens"] = maxTokens
+	}
+
+	if temperature, ok := d.decodeFloat("temperature"); ok {
+		values["temperature"] = temperature
+	}
+
+	if topP, ok := d.decodeFloat("top_p"); ok {
+		values["top_p"] = topP
+	}
+
+	if topK, ok := d.decodeInteger("top_k"); ok {
+		values["top_k"] = topK
+	}
+
+	if stream, ok := d.decodeBool("stream"); ok {
+		values["stream"] = stream
+	}
+
+	if _, ok := d.members["messages"]; ok {
+		var tokens int64
+		for _, text := range promptTexts(AnthropicMessagesEndpoint, d.members) {
+			tokens += textTokens(text.text)
+		}
+		values["estimated_prompt_tokens"] = strconv.FormatInt(tokens, 10)
+	}
+
+	if thinking, ok := d.object("thinking"); ok {
+		var thinkingType string
+		if thinking.decode("type", &thinkingType) && thinkingType != "" {
+			values["thinking_type"] = thinkingType
+		}
+		if budgetTokens, ok := thinking.decodeInteger("budget_tokens"); ok {
+			values["thinking_budget_tokens"] = budgetTokens
+		}
+	}
+
+	return values, d.err()
+}
+
+func extractGeminiGenerateContentFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	if config, ok := d.object("generationConfig"); ok {
+		if temperature, ok := config.decodeFloat("temperature"); ok {
+			values["temperature"] = temperature
+		}
+		if topP, ok := config.decodeFloat("topP"); ok {
+			values["top_p"] = topP
+		}
+		if topK, ok := config.decodeInteger("topK"); ok {
+			values["top_k"] = topK
+		}
+		if maxOutputTokens, ok := config.decodeInteger("maxOutputTokens"); ok {
+			values["max_tokens"] = maxOutputTokens
+		}
+	}
+
+	return values, d.err()
+}
+
+func extractFileUploadFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	var purpose string
+	if d.decode("purpose", &purpose) && purpose != "" {
+		values["purpose"] = purpose
+	}
+
+	var file multipartFile
+	if d.decode("file", &file) && file.Bytes != nil {
+		values["file_size"] = strconv.FormatInt(*file.Bytes, 10)
+	}
+
+	return values, d.err()
+}
+
+func extractUploadFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	for _, field := range []string{"filename", "purpose", "mime_type"} {
+		var value string
+		if d.decode(field, &value) && value != "" {
+			values[field] = value
+		}
+	}
+
+	if bytes, ok := d.decodeInteger("bytes"); ok {
+		values["bytes"] = bytes
+	}
+
+	return values, d.err()
+}
+
+func extractUploadPartFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{}
+
+	var data multipartFile
+	if d.decode("data", &data) && data.Bytes != nil {
+		values["part_size"] = strconv.FormatInt(*data.Bytes, 10)
+	}
+
+	return values, d.err()
+}
+
+type evalDataSource struct {
+	Type string `json:"type"`
+}
+
+func extractEvalFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{"operation": "eval"}
+
+	var dataSourceConfig evalDataSource
+	if d.decode("data_source_config", &dataSourceConfig) && dataSourceConfig.Type != "" {
+		values["data_source_type"] = dataSourceConfig.Type
+	}
+
+	return values, d.err()
+}
+
+func extractEvalRunFields(d *fieldDecoder) (map[string]string, error) {
+	values := map[string]string{"operation": "eval_run"}
+
+	if dataSource, ok := d.object("data_source"); ok {
+		var dataSourceType, model string
+		if dataSource.decode("type", &dataSourceType) && dataSourceType != "" {
+			values["data_source_type"] = dataSourceType
+		}
+		if dataSource.decode("model", &model) && model != "" {
+			values["model"] = model
+		}
+		if samplingParams, ok := dataSource.object("sampling_params"); ok {
+			if temperature, ok := samplingParams.decodeFloat("temperature"); ok {
+				values["temperature"] = temperature
+			}
+			if topP, ok := samplingParams.decodeFloat("top_p"); ok {
+				values["top_p"] = topP
+			}
+			if maxCompletionTokens, ok := samplingParams.decodeInteger("max_completion_tokens"); ok {
+				values["max_completion_tokens"] = maxCompletionTokens
+			}
+		}
+	}
+
+	return values, d.err()
+}
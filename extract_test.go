@@ -0,0 +1,254 @@
+package traefik_openai_header
+
+import (
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name  string
+		kind  EndpointKind
+		input string
+		want  map[string]string
+		error bool
+	}{
+		{
+			name:  "empty",
+			kind:  ChatCompletionEndpoint,
+			input: "",
+			want:  map[string]string{},
+			error: true,
+		},
+		{
+			name:  "non json",
+			kind:  ChatCompletionEndpoint,
+			input: "INVALID JSON",
+			want:  map[string]string{},
+			error: true,
+		},
+		{
+			name:  "chat completion",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"temperature\": 0.5, \"stream\": true, \"tool_choice\": \"auto\"}",
+			want: map[string]string{
+				"X-OpenAI-Model":       "gpt-4.1",
+				"X-OpenAI-User":        "alice",
+				"X-OpenAI-Temperature": "0.5",
+				"X-OpenAI-Stream":      "true",
+				"X-OpenAI-Tool-Choice": "auto",
+			},
+		},
+		{
+			name:  "developer instructions",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"developer\", \"content\": \"Be brief.\"}, {\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			want: map[string]string{
+				"X-OpenAI-Cache-Key":        "cce16a8cd3cb5f7edba21a3057794bbba517684f057bce4b400ec6a0d6ce2562",
+				"X-OpenAI-Model":            "gpt-4.1",
+				"X-OpenAI-Instruction-Role": "developer",
+			},
+		},
+		{
+			name:  "system and developer instructions",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"system\", \"content\": \"Be brief.\"}, {\"role\": \"developer\", \"content\": \"Answer in Dutch.\"}]}",
+			want: map[string]string{
+				"X-OpenAI-Cache-Key":        "97dc3866fe3f5870b2e93ade05afe24ea9aecb04b9343404b0a0d396cf8c12f3",
+				"X-OpenAI-Model":            "gpt-4.1",
+				"X-OpenAI-Instruction-Role": "both",
+			},
+		},
+		{
+			name:  "no instructions",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			want: map[string]string{
+				"X-OpenAI-Cache-Key":        "76aa6382a09fccca3eb752f3fe523746295a65ee77458ea504e2786d338d7686",
+				"X-OpenAI-Model":            "gpt-4.1",
+				"X-OpenAI-Instruction-Role": "none",
+			},
+		},
+		{
+			name:  "input audio",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4o-audio-preview\", \"messages\": [{\"role\": \"user\", \"content\": [{\"type\": \"text\", \"text\": \"What is in this recording?\"}, {\"type\": \"input_audio\", \"input_audio\": {\"data\": \"UklGRg==\", \"format\": \"wav\"}}]}, {\"role\": \"user\", \"content\": [{\"type\": \"input_audio\", \"input_audio\": {\"data\": \"SUQz\", \"format\": \"mp3\"}}, {\"type\": \"input_audio\", \"input_audio\": {\"data\": \"UklGRg==\", \"format\": \"wav\"}}]}]}",
+			want: map[string]string{
+				"X-OpenAI-Cache-Key":        "52985965f053bba7d7bdc2b3d15f224f6dc95dd94d32a7992b4c663372686aa0",
+				"X-OpenAI-Model":            "gpt-4o-audio-preview",
+				"X-OpenAI-Instruction-Role": "none",
+				"X-OpenAI-Audio-Input":      "true",
+				"X-OpenAI-Audio-Format":     "wav,mp3",
+			},
+		},
+		{
+			name:  "file input",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": [{\"type\": \"file\", \"file\": {\"file_id\": \"file-abc123\"}}, {\"type\": \"file\", \"file\": {\"filename\": \"report.pdf\", \"file_data\": \"data:application/pdf;base64,JVBERi0=\"}}, {\"type\": \"text\", \"text\": \"Summarize these documents.\"}]}]}",
+			want: map[string]string{
+				"X-OpenAI-Cache-Key":        "ee40afa1974e856c53fa7313ad659806e9e8bb7f996454457d976a4d275e7eb8",
+				"X-OpenAI-Model":            "gpt-4.1",
+				"X-OpenAI-Instruction-Role": "none",
+				"X-OpenAI-File-Input":       "2",
+			},
+		},
+		{
+			name:  "prompt cache key and safety identifier",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"prompt_cache_key\": \"support-bot-v3\", \"safety_identifier\": \"user-1234\"}",
+			want: map[string]string{
+				"X-OpenAI-Model":             "gpt-4.1",
+				"X-OpenAI-Prompt-Cache-Key":  "support-bot-v3",
+				"X-OpenAI-Safety-Identifier": "user-1234",
+			},
+		},
+		{
+			name:  "self-hosted sampling fields",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"meta-llama/Llama-3.1-8B-Instruct\", \"top_k\": 40, \"min_p\": 0.05, \"repetition_penalty\": 1.1}",
+			want: map[string]string{
+				"X-OpenAI-Model":              "meta-llama/Llama-3.1-8B-Instruct",
+				"X-OpenAI-Top-K":              "40",
+				"X-OpenAI-Min-P":              "0.05",
+				"X-OpenAI-Repetition-Penalty": "1.1",
+			},
+		},
+		{
+			name:  "legacy max_tokens",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"max_tokens\": 300, \"max_completion_tokens\": 200}",
+			want: map[string]string{
+				"X-OpenAI-Model":                 "gpt-4.1",
+				"X-OpenAI-Max-Tokens":            "300",
+				"X-OpenAI-Max-Completion-Tokens": "200",
+				"X-OpenAI-Deprecated-Params":     "max_tokens",
+			},
+		},
+		{
+			name:  "token counts in exponent notation",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"max_tokens\": 1e6, \"max_completion_tokens\": 300.0}",
+			want: map[string]string{
+				"X-OpenAI-Model":                 "gpt-4.1",
+				"X-OpenAI-Max-Tokens":            "1000000",
+				"X-OpenAI-Max-Completion-Tokens": "300",
+				"X-OpenAI-Deprecated-Params":     "max_tokens",
+			},
+		},
+		{
+			name:  "fractional token count",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"max_completion_tokens\": 300.5}",
+			want: map[string]string{
+				"X-OpenAI-Model": "gpt-4.1",
+			},
+			error: true,
+		},
+		{
+			name:  "unexpected shape",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"temperature\": \"hot\", \"model\": \"gpt-4.1\", \"user\": \"alice\", \"stream\": \"yes\", \"top_p\": 0.5}",
+			want: map[string]string{
+				"X-OpenAI-Model": "gpt-4.1",
+				"X-OpenAI-User":  "alice",
+				"X-OpenAI-Top-P": "0.5",
+			},
+			error: true,
+		},
+		{
+			name:  "model with unexpected shape",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": {\"name\": \"gpt-4.1\"}, \"user\": \"alice\"}",
+			want: map[string]string{
+				"X-OpenAI-Model": "",
+				"X-OpenAI-User":  "alice",
+			},
+			error: true,
+		},
+		{
+			name:  "batch",
+			kind:  BatchEndpoint,
+			input: "{\"input_file_id\": \"file-abc123\", \"endpoint\": \"/v1/chat/completions\", \"completion_window\": \"24h\"}",
+			want: map[string]string{
+				"X-OpenAI-Completion-Window": "24h",
+				"X-OpenAI-Endpoint":          "/v1/chat/completions",
+			},
+		},
+		{
+			name:  "anthropic extended thinking",
+			kind:  AnthropicMessagesEndpoint,
+			input: "{\"model\": \"claude-sonnet-4-5\", \"max_tokens\": 16000, \"thinking\": {\"type\": \"enabled\", \"budget_tokens\": 10000}, \"metadata\": {\"user_id\": \"alice\"}, \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			want: map[string]string{
+				"X-OpenAI-Model":                  "claude-sonnet-4-5",
+				"X-OpenAI-User":                   "alice",
+				"X-OpenAI-Max-Tokens":             "16000",
+				"X-OpenAI-Thinking-Type":          "enabled",
+				"X-OpenAI-Thinking-Budget-Tokens": "10000",
+			},
+		},
+		{
+			name:  "anthropic without thinking",
+			kind:  AnthropicMessagesEndpoint,
+			input: "{\"model\": \"claude-sonnet-4-5\", \"max_tokens\": 1024, \"stream\": true}",
+			want: map[string]string{
+				"X-OpenAI-Model":      "claude-sonnet-4-5",
+				"X-OpenAI-Max-Tokens": "1024",
+				"X-OpenAI-Stream":     "true",
+			},
+		},
+		{
+			name:  "chat completion logprobs",
+			kind:  ChatCompletionEndpoint,
+			input: "{\"model\": \"gpt-4.1\", \"logprobs\": true, \"top_logprobs\": 2}",
+			want: map[string]string{
+				"X-OpenAI-Model":        "gpt-4.1",
+				"X-OpenAI-Logprobs":     "true",
+				"X-OpenAI-Top-Logprobs": "2",
+			},
+		},
+		{
+			name:  "completion logprobs",
+			kind:  CompletionEndpoint,
+			input: "{\"model\": \"gpt-3.5-turbo-instruct\", \"logprobs\": 5, \"echo\": false}",
+			want: map[string]string{
+				"X-OpenAI-Model":    "gpt-3.5-turbo-instruct",
+				"X-OpenAI-Logprobs": "5",
+				"X-OpenAI-Echo":     "false",
+			},
+		},
+		{
+			name:  "upload",
+			kind:  UploadEndpoint,
+			input: "{\"purpose\": \"fine-tune\", \"filename\": \"training_examples.jsonl\", \"bytes\": 2147483648, \"mime_type\": \"text/jsonl\"}",
+			want: map[string]string{
+				"X-OpenAI-File-Purpose": "fine-tune",
+				"X-OpenAI-Filename":     "training_examples.jsonl",
+				"X-OpenAI-Upload-Bytes": "2147483648",
+				"X-OpenAI-Mime-Type":    "text/jsonl",
+			},
+		},
+		{
+			name:  "unknown kind",
+			kind:  EndpointKind("unknown"),
+			input: "{\"model\": \"gpt-4.1\"}",
+			want:  map[string]string{},
+			error: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(tt.kind, []byte(tt.input), CreateConfig())
+			if (err != nil) != tt.error {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("expected %v but got %v", tt.want, got)
+			}
+			for header, value := range tt.want {
+				if got[header] != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got[header])
+				}
+			}
+		})
+	}
+}
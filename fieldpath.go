@@ -0,0 +1,82 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// lookupPath returns the scalar value at a dot separated path such as metadata.project in the body members. Strings
+// are returned unquoted, numbers and booleans as sent. ok is false when the path is missing, null or not a scalar.
+func lookupPath(members map[string]json.RawMessage, path string) (value string, ok bool) {
+	segments := strings.Split(path, ".")
+	raw, ok := members[segments[0]]
+	for _, segment := range segments[1:] {
+		if !ok {
+			return "", false
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return "", false
+		}
+		raw, ok = object[segment]
+	}
+	if !ok {
+		return "", false
+	}
+
+	return scalarText(raw)
+}
+
+// deletePath removes the member at a dot separated path such as metadata.ssn from the body members
+func deletePath(members map[string]json.RawMessage, path string) {
+	head, rest, nested := strings.Cut(path, ".")
+	raw, ok := members[head]
+	if !ok {
+		return
+	}
+	if !nested {
+		delete(members, head)
+		return
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return
+	}
+	deletePath(object, rest)
+	if data, err := json.Marshal(object); err == nil {
+		members[head] = data
+	}
+}
+
+// scalarText returns a JSON string unquoted and a JSON number or boolean as sent. ok is false for null, objects and
+// arrays.
+func scalarText(raw json.RawMessage) (value string, ok bool) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) || raw[0] == '{' || raw[0] == '[' {
+		return "", false
+	}
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", false
+		}
+		return value, true
+	}
+	return string(raw), true
+}
+
+// firstFieldValue returns the first of the fields that is set, looked up in the extracted values or else as a path in
+// the body members
+func firstFieldValue(fields []string, values map[string]string, members map[string]json.RawMessage) (field string, value string, ok bool) {
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok || value == "" {
+			value, ok = lookupPath(members, field)
+		}
+		if ok && value != "" {
+			return field, value, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,28 @@
+package traefik_openai_header
+
+import (
+	"strconv"
+	"strings"
+)
+
+// numberFormat controls how numeric fields such as temperature and top_p are written to headers
+type numberFormat struct {
+	precision          int
+	stripTrailingZeros bool
+	// raw emits numbers with their original JSON text instead of reformatting them
+	raw bool
+}
+
+// formatFloat formats the value with the configured number of decimals, or with the shortest representation that
+// round-trips when no precision is configured
+func (f numberFormat) formatFloat(value float64) string {
+	if f.precision <= 0 {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	formatted := strconv.FormatFloat(value, 'f', f.precision, 64)
+	if f.stripTrailingZeros && strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
@@ -0,0 +1,140 @@
+package traefik_openai_header
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNumberFormat(t *testing.T) {
+	tests := []struct {
+		name               string
+		value              float64
+		precision          int
+		stripTrailingZeros bool
+		want               string
+	}{
+		{name: "shortest", value: 0.3, want: "0.3"},
+		{name: "float32 artifact", value: float64(float32(0.3)), precision: 2, want: "0.30"},
+		{name: "precision", value: 0.7, precision: 3, want: "0.700"},
+		{name: "strip trailing zeros", value: 0.7, precision: 3, stripTrailingZeros: true, want: "0.7"},
+		{name: "strip to integer", value: 1, precision: 2, stripTrailingZeros: true, want: "1"},
+		{name: "rounding", value: 0.30000001, precision: 4, stripTrailingZeros: true, want: "0.3"},
+		{name: "integer kept", value: 10, precision: 1, stripTrailingZeros: true, want: "10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := numberFormat{precision: tt.precision, stripTrailingZeros: tt.stripTrailingZeros}
+			if got := format.formatFloat(tt.value); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFloatPrecision_Extract(t *testing.T) {
+	config := CreateConfig()
+	config.FloatPrecision = 2
+	config.StripTrailingZeros = true
+
+	headers, err := Extract(ChatCompletionEndpoint, []byte("{\"model\": \"gpt-4.1\", \"temperature\": 0.30000001, \"top_p\": 0.125, \"presence_penalty\": 1}"), config)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want := map[string]string{"X-OpenAI-Temperature": "0.3", "X-OpenAI-Top-P": "0.12", "X-OpenAI-Presence-Penalty": "1"}
+	for header, value := range want {
+		if headers[header] != value {
+			t.Errorf("expected header %v to be %q but got %q", header, value, headers[header])
+		}
+	}
+}
+
+func TestRawNumbers_Extract(t *testing.T) {
+	config := CreateConfig()
+	config.RawNumbers = true
+	config.FloatPrecision = 2
+
+	headers, err := Extract(ChatCompletionEndpoint, []byte("{\"model\": \"gpt-4.1\", \"temperature\": 0.70, \"top_p\": 1, \"max_tokens\": 1e3, \"max_completion_tokens\": 300.5}"), config)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want := map[string]string{"X-OpenAI-Temperature": "0.70", "X-OpenAI-Top-P": "1", "X-OpenAI-Max-Tokens": "1e3", "X-OpenAI-Max-Completion-Tokens": "300.5"}
+	for header, value := range want {
+		if headers[header] != value {
+			t.Errorf("expected header %v to be %q but got %q", header, value, headers[header])
+		}
+	}
+
+	if _, err := Extract(ChatCompletionEndpoint, []byte("{\"model\": \"gpt-4.1\", \"temperature\": \"0.7\"}"), config); err == nil {
+		t.Errorf("expected a parse failure for a non numeric value")
+	}
+}
+
+func TestNestedNumbers_Extract(t *testing.T) {
+	tests := []struct {
+		name string
+		kind EndpointKind
+		body string
+		want map[string]string
+	}{
+		{
+			name: "gemini",
+			kind: GeminiGenerateContentEndpoint,
+			body: "{\"generationConfig\": {\"temperature\": 0.70, \"topP\": 1.0, \"topK\": 4e1, \"maxOutputTokens\": 1024}}",
+			want: map[string]string{"X-OpenAI-Temperature": "0.70", "X-OpenAI-Top-P": "1.0", "X-OpenAI-Top-K": "4e1", "X-OpenAI-Max-Tokens": "1024"},
+		},
+		{
+			name: "eval run",
+			kind: EvalRunEndpoint,
+			body: "{\"data_source\": {\"type\": \"completions\", \"model\": \"o3\", \"sampling_params\": {\"temperature\": 0.50, \"max_completion_tokens\": 2e3}}}",
+			want: map[string]string{"X-OpenAI-Model": "o3", "X-OpenAI-Temperature": "0.50", "X-OpenAI-Max-Completion-Tokens": "2e3"},
+		},
+		{
+			name: "anthropic thinking",
+			kind: AnthropicMessagesEndpoint,
+			body: "{\"model\": \"claude-sonnet-4\", \"thinking\": {\"type\": \"enabled\", \"budget_tokens\": 1.6e4}}",
+			want: map[string]string{"X-OpenAI-Thinking-Type": "enabled", "X-OpenAI-Thinking-Budget-Tokens": "1.6e4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.RawNumbers = true
+
+			headers, err := Extract(tt.kind, []byte(tt.body), config)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			for header, value := range tt.want {
+				if headers[header] != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, headers[header])
+				}
+			}
+		})
+	}
+}
+
+func TestNestedIntegers_Extract(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    EndpointKind
+		body    string
+		wantErr string
+	}{
+		{name: "gemini", kind: GeminiGenerateContentEndpoint, body: "{\"generationConfig\": {\"maxOutputTokens\": 10.5}}", wantErr: "invalid generationConfig.maxOutputTokens"},
+		{name: "eval run", kind: EvalRunEndpoint, body: "{\"data_source\": {\"sampling_params\": {\"max_completion_tokens\": 1.5}}}", wantErr: "invalid data_source.sampling_params.max_completion_tokens"},
+		{name: "anthropic thinking", kind: AnthropicMessagesEndpoint, body: "{\"thinking\": {\"type\": \"enabled\", \"budget_tokens\": \"many\"}}", wantErr: "invalid thinking.budget_tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Extract(tt.kind, []byte(tt.body), CreateConfig())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
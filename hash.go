@@ -0,0 +1,12 @@
+package traefik_openai_header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashValue returns a stable, non-reversible representation of a value for use in headers
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,152 @@
+package traefik_openai_header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const DeduplicatedHeader = "X-OpenAI-Deduplicated"
+
+// Idempotency modes controlling what happens to a duplicate of a request that is still in flight
+const (
+	IdempotencyModeCoalesce = "coalesce"
+	IdempotencyModeReject   = "reject"
+)
+
+// Idempotency configures the detection of duplicate submissions that are still in flight
+type Idempotency struct {
+	Mode             string `json:"mode"`
+	Header           string `json:"header"`
+	PromptHash       bool   `json:"promptHash"`
+	MaxResponseBytes int64  `json:"maxResponseBytes"`
+}
+
+// deduplicator tracks the requests in flight by idempotency key
+type deduplicator struct {
+	mode             string
+	header           string
+	promptHash       bool
+	maxResponseBytes int64
+
+	mu       sync.Mutex
+	inFlight map[string]*inFlightRequest
+}
+
+// inFlightRequest is closed when the upstream response is complete. response stays nil when it could not be kept for
+// the duplicates, for example because it was too large.
+type inFlightRequest struct {
+	done     chan struct{}
+	response *cachedResponse
+}
+
+func newDeduplicator(config *Idempotency) (*deduplicator, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	mode := config.Mode
+	switch mode {
+	case "":
+		mode = IdempotencyModeCoalesce
+	case IdempotencyModeCoalesce, IdempotencyModeReject:
+	default:
+		return nil, fmt.Errorf("invalid idempotency mode %q", config.Mode)
+	}
+
+	header := config.Header
+	if header == "" {
+		header = "Idempotency-Key"
+	}
+
+	maxResponseBytes := config.MaxResponseBytes
+	if maxResponseBytes <= 0 {
+		maxResponseBytes = 1 << 20
+	}
+
+	return &deduplicator{
+		mode:             mode,
+		header:           header,
+		promptHash:       config.PromptHash,
+		maxResponseBytes: maxResponseBytes,
+		inFlight:         map[string]*inFlightRequest{},
+	}, nil
+}
+
+// key returns the idempotency key of the request: the idempotency header, or the cache key of the prompt when
+// promptHash is enabled. Keys are scoped to the fingerprint of the API key of the request, whichever header carries it.
+func (d *deduplicator) key(r *http.Request, values map[string]string) (string, bool) {
+	key := r.Header.Get(d.header)
+	if key == "" && d.promptHash {
+		key = values["cache_key"]
+	}
+	if key == "" {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(key + "\n" + keyFingerprint(r)))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// serveDeduplicated passes the first request with a key on to next. Duplicates that arrive while it is in flight are
+// rejected, or wait for its response and receive a copy.
+func (e *Handler) serveDeduplicated(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	d := e.deduplicator
+
+	d.mu.Lock()
+	request, duplicate := d.inFlight[key]
+	if !duplicate {
+		request = &inFlightRequest{done: make(chan struct{})}
+		d.inFlight[key] = request
+	}
+	d.mu.Unlock()
+
+	if duplicate {
+		if d.mode == IdempotencyModeReject {
+			e.metrics.inc("duplicate_requests_rejected_total")
+			e.rejectDuplicate(w)
+			return
+		}
+		e.metrics.inc("duplicate_requests_coalesced_total")
+		select {
+		case <-request.done:
+		case <-r.Context().Done():
+			return
+		}
+		if request.response == nil {
+			e.rejectDuplicate(w)
+			return
+		}
+		for name, values := range request.response.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(DeduplicatedHeader, "coalesced")
+		w.WriteHeader(request.response.Status)
+		_, _ = w.Write(request.response.Body)
+		return
+	}
+
+	capture := newCaptureWriter(w, d.maxResponseBytes)
+	defer func() {
+		if capture.status != 0 && !capture.overflow {
+			request.response = &cachedResponse{Status: capture.status, Header: w.Header().Clone(), Body: capture.body.Bytes()}
+		}
+		d.mu.Lock()
+		delete(d.inFlight, key)
+		d.mu.Unlock()
+		close(request.done)
+	}()
+	next.ServeHTTP(capture, r)
+}
+
+// rejectDuplicate responds with a conflict for a duplicate of a request that is in flight
+func (e *Handler) rejectDuplicate(w http.ResponseWriter) {
+	e.reject(w, rejection{
+		status:    http.StatusConflict,
+		errorType: "invalid_request_error",
+		code:      "duplicate_request",
+		message:   "A request with the same idempotency key is already in progress.",
+	})
+}
@@ -0,0 +1,162 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotency_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		promptHash   bool
+		firstKey     string
+		secondKey    string
+		secondInput  string
+		secondAPIKey string
+		wantStatus   int
+		wantCalls    int
+		wantHeader   string
+	}{
+		{
+			name:       "coalesce",
+			mode:       IdempotencyModeCoalesce,
+			firstKey:   "retry-1",
+			secondKey:  "retry-1",
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+			wantHeader: "coalesced",
+		},
+		{
+			name:       "reject",
+			mode:       IdempotencyModeReject,
+			firstKey:   "retry-1",
+			secondKey:  "retry-1",
+			wantStatus: http.StatusConflict,
+			wantCalls:  1,
+		},
+		{
+			name:       "different keys",
+			mode:       IdempotencyModeReject,
+			firstKey:   "retry-1",
+			secondKey:  "retry-2",
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:         "different api-key",
+			mode:         IdempotencyModeReject,
+			firstKey:     "retry-1",
+			secondKey:    "retry-1",
+			secondAPIKey: "sk-azure-2",
+			wantStatus:   http.StatusOK,
+			wantCalls:    2,
+		},
+		{
+			name:       "no key",
+			mode:       IdempotencyModeReject,
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "prompt hash",
+			mode:       IdempotencyModeReject,
+			promptHash: true,
+			wantStatus: http.StatusConflict,
+			wantCalls:  1,
+		},
+		{
+			name:        "prompt hash of another prompt",
+			mode:        IdempotencyModeReject,
+			promptHash:  true,
+			secondInput: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hi!\"}]}",
+			wantStatus:  http.StatusOK,
+			wantCalls:   2,
+		},
+	}
+
+	input := "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Idempotency = &Idempotency{Mode: tt.mode, PromptHash: tt.promptHash}
+
+			started := make(chan struct{}, 2)
+			release := make(chan struct{})
+			var mu sync.Mutex
+			calls := 0
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				mu.Lock()
+				calls++
+				mu.Unlock()
+				started <- struct{}{}
+				<-release
+				_, _ = w.Write([]byte("{\"id\": \"chatcmpl-1\"}"))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			first := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input))
+			first.Header.Set("Api-Key", "sk-azure-1")
+			if tt.firstKey != "" {
+				first.Header.Set("Idempotency-Key", tt.firstKey)
+			}
+			firstDone := make(chan struct{})
+			go func() {
+				e.ServeHTTP(httptest.NewRecorder(), first)
+				close(firstDone)
+			}()
+			<-started
+
+			secondInput := input
+			if tt.secondInput != "" {
+				secondInput = tt.secondInput
+			}
+			second := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(secondInput))
+			if tt.secondKey != "" {
+				second.Header.Set("Idempotency-Key", tt.secondKey)
+			}
+			second.Header.Set("Api-Key", "sk-azure-1")
+			if tt.secondAPIKey != "" {
+				second.Header.Set("Api-Key", tt.secondAPIKey)
+			}
+			recorder := httptest.NewRecorder()
+			secondDone := make(chan struct{})
+			go func() {
+				e.ServeHTTP(recorder, second)
+				close(secondDone)
+			}()
+
+			if tt.wantCalls == 2 {
+				<-started
+			}
+			for tt.wantHeader != "" && e.(*Handler).metrics.counter("duplicate_requests_coalesced_total") == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			if tt.wantStatus == http.StatusConflict {
+				<-secondDone
+			}
+			close(release)
+			<-firstDone
+			<-secondDone
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d upstream calls but got %d", tt.wantCalls, calls)
+			}
+			if got := recorder.Header().Get(DeduplicatedHeader); got != tt.wantHeader {
+				t.Errorf("expected %s %q but got %q", DeduplicatedHeader, tt.wantHeader, got)
+			}
+			if tt.wantStatus == http.StatusOK && recorder.Body.String() != "{\"id\": \"chatcmpl-1\"}" {
+				t.Errorf("unexpected body %s", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIdentityHeader is the default header holding the composite identity of the client
+const ClientIdentityHeader = "X-OpenAI-Client-Identity"
+
+// ClientIdentity configures a single identity string of the client for WAF and anomaly tooling, built from the client
+// IP, a fingerprint of the API key and a hash of the user
+type ClientIdentity struct {
+	Header     string   `json:"header"`
+	Components []string `json:"components"`
+	Depth      int      `json:"depth"`
+	UserFields []string `json:"userFields"`
+}
+
+// clientIdentity is the parsed ClientIdentity config
+type clientIdentity struct {
+	header     string
+	components []string
+	depth      int
+	userFields []string
+}
+
+func newClientIdentity(config *ClientIdentity) (*clientIdentity, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	header := config.Header
+	if header == "" {
+		header = ClientIdentityHeader
+	}
+	if !validHeaderName(header) {
+		return nil, fmt.Errorf("invalid clientIdentity header %q", header)
+	}
+	components := config.Components
+	if len(components) == 0 {
+		components = []string{"ip", "key", "user"}
+	}
+	for _, component := range components {
+		switch component {
+		case "ip", "key", "user":
+		default:
+			return nil, fmt.Errorf("invalid clientIdentity component %q", component)
+		}
+	}
+	if config.Depth < 0 {
+		return nil, errors.New("clientIdentity depth cannot be negative")
+	}
+	userFields := config.UserFields
+	if len(userFields) == 0 {
+		userFields = []string{"user", "safety_identifier"}
+	}
+	return &clientIdentity{header: header, components: components, depth: config.Depth, userFields: userFields}, nil
+}
+
+// clientIP returns the IP of the client. With a depth the IP is taken from X-Forwarded-For, counting from the right
+// like the ipStrategy of Traefik, so it cannot be chosen by the client when the proxies in front append to the header.
+func (c *clientIdentity) clientIP(r *http.Request) string {
+	if c.depth > 0 {
+		var ips []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, ip := range strings.Split(value, ",") {
+				ips = append(ips, strings.TrimSpace(ip))
+			}
+		}
+		if len(ips) < c.depth {
+			return ""
+		}
+		return ips[len(ips)-c.depth]
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// identity joins the components in their configured order, with a dash for a component that is not known
+func (c *clientIdentity) identity(r *http.Request, values map[string]string) string {
+	parts := make([]string, len(c.components))
+	known := false
+	for i, component := range c.components {
+		var part string
+		switch component {
+		case "ip":
+			part = c.clientIP(r)
+		case "key":
+			part = keyFingerprint(r)
+		case "user":
+			for _, field := range c.userFields {
+				if user := values[field]; user != "" {
+					part = hashValue(field + "\x00" + user)
+					break
+				}
+			}
+		}
+		if part == "" {
+			part = "-"
+		} else {
+			known = true
+		}
+		parts[i] = part
+	}
+	if !known {
+		return ""
+	}
+	return strings.Join(parts, "|")
+}
+
+// setClientIdentity replaces the identity header sent by the client with the composite identity of the request
+func (e *Handler) setClientIdentity(r *http.Request, values map[string]string) {
+	r.Header.Del(e.clientIdentity.header)
+	if identity := e.clientIdentity.identity(r, values); identity != "" {
+		r.Header.Set(e.clientIdentity.header, identity)
+	}
+}
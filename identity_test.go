@@ -0,0 +1,110 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIdentity_ServeHTTP(t *testing.T) {
+	key := hashValue("sk-test")
+	user := hashValue("user\x00alice")
+	tests := []struct {
+		name          string
+		identity      ClientIdentity
+		input         string
+		forwardedFor  []string
+		authorization string
+		want          string
+	}{
+		{
+			name:          "all components",
+			input:         "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}",
+			authorization: "Bearer sk-test",
+			want:          "192.0.2.1|" + key + "|" + user,
+		},
+		{
+			name:         "forwarded for",
+			identity:     ClientIdentity{Depth: 1},
+			input:        "{\"model\": \"gpt-4.1\"}",
+			forwardedFor: []string{"10.0.0.1, 203.0.113.7", "198.51.100.2"},
+			want:         "198.51.100.2|-|-",
+		},
+		{
+			name:         "forwarded for with depth",
+			identity:     ClientIdentity{Depth: 2},
+			input:        "{\"model\": \"gpt-4.1\"}",
+			forwardedFor: []string{"10.0.0.1, 203.0.113.7", "198.51.100.2"},
+			want:         "203.0.113.7|-|-",
+		},
+		{
+			name:         "fewer forwarded hops than depth",
+			identity:     ClientIdentity{Depth: 3, Components: []string{"ip"}},
+			input:        "{\"model\": \"gpt-4.1\"}",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "",
+		},
+		{
+			name:          "selected components",
+			identity:      ClientIdentity{Header: "X-Client-Id", Components: []string{"user", "key"}, UserFields: []string{"safety_identifier", "user"}},
+			input:         "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"safety_identifier\": \"u-42\"}",
+			authorization: "Bearer sk-test",
+			want:          hashValue("safety_identifier\x00u-42") + "|" + key,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ClientIdentity = &tt.identity
+			header := tt.identity.Header
+			if header == "" {
+				header = ClientIdentityHeader
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.input))
+			req.Header.Set(header, "spoofed")
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.Get(header) != tt.want {
+				t.Errorf("expected identity %q but got %q", tt.want, got.Get(header))
+			}
+		})
+	}
+}
+
+func TestInvalidClientIdentity_New(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity ClientIdentity
+	}{
+		{name: "invalid header", identity: ClientIdentity{Header: "X Client"}},
+		{name: "unknown component", identity: ClientIdentity{Components: []string{"ip", "session"}}},
+		{name: "negative depth", identity: ClientIdentity{Depth: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ClientIdentity = &tt.identity
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package traefik_openai_header
+
+import (
+	"regexp"
+)
+
+// InjectionDetection configures the heuristic detection of prompt injection attempts
+type InjectionDetection struct {
+	Patterns map[string]string `json:"patterns"`
+	Roles    []string          `json:"roles"`
+}
+
+// defaultInjectionPatterns catch the most common instruction override phrases and chat template markers that try to
+// pass user text off as a system or assistant turn
+var defaultInjectionPatterns = []namedPattern{
+	{name: "ignore_instructions", regex: regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\s+(all\s+|any\s+)?(the\s+)?(previous|prior|above|earlier)\s+(instructions|prompts|rules|messages)`)},
+	{name: "role_confusion", regex: regexp.MustCompile(`(?i)(<\|im_start\|>\s*(system|assistant)|<\|(system|assistant)\|>|\[/?INST\]|<<SYS>>|(^|\n)\s*#{0,3}\s*(system|assistant)\s*:)`)},
+	{name: "prompt_leak", regex: regexp.MustCompile(`(?i)\b(reveal|print|repeat|show)\s+(me\s+)?(your|the)\s+(system\s+prompt|hidden\s+instructions|initial\s+instructions)`)},
+	{name: "jailbreak", regex: regexp.MustCompile(`(?i)\b(developer\s+mode|DAN\s+mode|do\s+anything\s+now|jailbreak)\b`)},
+}
+
+func newInjectionDetector(config *InjectionDetection) (*patternDetector, error) {
+	if config == nil {
+		return nil, nil
+	}
+	patterns, err := compileNamedPatterns("injectionDetection", config.Patterns, defaultInjectionPatterns)
+	if err != nil {
+		return nil, err
+	}
+	roles := config.Roles
+	if len(roles) == 0 {
+		roles = []string{"user"}
+	}
+	return &patternDetector{patterns: patterns, roles: toSet(roles)}, nil
+}
@@ -0,0 +1,122 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// JSONLimitHeader names the limit a request body exceeded, in which case it is forwarded without extraction
+const JSONLimitHeader = "X-OpenAI-JSON-Limit"
+
+// JSONLimits configures the limits on the structure of JSON bodies, so that adversarial payloads cannot exhaust the CPU
+// of the gateway during extraction
+type JSONLimits struct {
+	MaxDepth       int `json:"maxDepth"`
+	MaxArrayLength int `json:"maxArrayLength"`
+	MaxKeys        int `json:"maxKeys"`
+}
+
+// jsonLimits is the JSONLimits config with defaults applied
+type jsonLimits struct {
+	maxDepth       int
+	maxArrayLength int
+	maxKeys        int
+}
+
+func newJSONLimits(config *JSONLimits) (*jsonLimits, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	limits := &jsonLimits{maxDepth: 64, maxArrayLength: 100000, maxKeys: 100000}
+	for _, limit := range []struct {
+		option string
+		value  int
+		target *int
+	}{
+		{"maxDepth", config.MaxDepth, &limits.maxDepth},
+		{"maxArrayLength", config.MaxArrayLength, &limits.maxArrayLength},
+		{"maxKeys", config.MaxKeys, &limits.maxKeys},
+	} {
+		if limit.value < 0 {
+			return nil, fmt.Errorf("invalid jsonLimits %s %d", limit.option, limit.value)
+		}
+		if limit.value > 0 {
+			*limit.target = limit.value
+		}
+	}
+	return limits, nil
+}
+
+// exceeded scans the body once without decoding it and returns the name of the first limit it exceeds, or an empty
+// string. The nesting depth, the elements of every array and the keys of all objects together are counted.
+func (l *jsonLimits) exceeded(data []byte) string {
+	// the element count of every open array, or -1 for an open object
+	var open []int
+	keys := 0
+	inString, escaped := false, false
+	for _, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			if len(open) == l.maxDepth {
+				return "depth"
+			}
+			if c == '{' {
+				open = append(open, -1)
+			} else {
+				open = append(open, 0)
+			}
+		case '}', ']':
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case ',':
+			// the separators of an array are one less than its elements
+			if len(open) > 0 && open[len(open)-1] >= 0 {
+				open[len(open)-1]++
+				if open[len(open)-1] >= l.maxArrayLength {
+					return "array_length"
+				}
+			}
+		case ':':
+			keys++
+			if keys > l.maxKeys {
+				return "keys"
+			}
+		}
+	}
+	return ""
+}
+
+// exceedsJSONLimits reports whether the JSON body exceeds the limits, flagging the request when it does. Multipart
+// bodies are not JSON and are not checked.
+func (e *Handler) exceedsJSONLimits(r *http.Request, data []byte) bool {
+	if e.jsonLimits == nil {
+		return false
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "multipart/form-data" {
+		return false
+	}
+	limit := e.jsonLimits.exceeded(data)
+	if limit == "" {
+		return false
+	}
+	e.metrics.incLabel("json_limits_exceeded", limit)
+	r.Header.Set(JSONLimitHeader, limit)
+	return true
+}
@@ -0,0 +1,85 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONLimits_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantModel string
+		wantLimit string
+	}{
+		{
+			name:      "within limits",
+			input:     "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"[[[[{{{{ \\\"a\\\": 1, 2, 3\"}]}",
+			wantModel: "gpt-4.1",
+		},
+		{
+			name:      "nesting depth",
+			input:     "{\"model\": \"gpt-4.1\", \"metadata\": " + strings.Repeat("[", 10) + strings.Repeat("]", 10) + "}",
+			wantLimit: "depth",
+		},
+		{
+			name:      "array length",
+			input:     "{\"model\": \"gpt-4.1\", \"input\": [1" + strings.Repeat(", 1", 20) + "]}",
+			wantLimit: "array_length",
+		},
+		{
+			name:      "keys",
+			input:     "{\"model\": \"gpt-4.1\", \"a\": 1, \"b\": 2, \"c\": 3, \"d\": 4, \"e\": {\"f\": 5, \"g\": 6}}",
+			wantLimit: "keys",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.JSONLimits = &JSONLimits{MaxDepth: 8, MaxArrayLength: 20, MaxKeys: 6}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.input)))
+			if got.Get("X-OpenAI-Model") != tt.wantModel {
+				t.Errorf("expected model %q but got %q", tt.wantModel, got.Get("X-OpenAI-Model"))
+			}
+			if got.Get(JSONLimitHeader) != tt.wantLimit {
+				t.Errorf("expected limit %q but got %q", tt.wantLimit, got.Get(JSONLimitHeader))
+			}
+			if got.Get(ParseFailureHeader) != "" {
+				t.Errorf("expected no parse failure but got %q", got.Get(ParseFailureHeader))
+			}
+		})
+	}
+}
+
+func TestInvalidJSONLimits_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits JSONLimits
+	}{
+		{name: "negative depth", limits: JSONLimits{MaxDepth: -1}},
+		{name: "negative array length", limits: JSONLimits{MaxArrayLength: -1}},
+		{name: "negative keys", limits: JSONLimits{MaxKeys: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.JSONLimits = &tt.limits
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package traefik_openai_header
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxLanguageRunes bounds the prompt text considered by the language guess
+const maxLanguageRunes = 4096
+
+// scriptLanguages maps scripts used by a single language, or by one dominant language, to its ISO 639-1 code
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{script: unicode.Hangul, language: "ko"},
+	{script: unicode.Hiragana, language: "ja"},
+	{script: unicode.Katakana, language: "ja"},
+	{script: unicode.Han, language: "zh"},
+	{script: unicode.Cyrillic, language: "ru"},
+	{script: unicode.Arabic, language: "ar"},
+	{script: unicode.Hebrew, language: "he"},
+	{script: unicode.Greek, language: "el"},
+	{script: unicode.Thai, language: "th"},
+	{script: unicode.Devanagari, language: "hi"},
+}
+
+// stopwords are frequent function words that tell the languages written in Latin script apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "that", "it", "you", "with", "for", "this", "what", "how", "please", "can", "be"},
+	"nl": {"de", "het", "een", "en", "van", "dat", "niet", "ik", "je", "met", "voor", "wat", "hoe", "zijn", "op", "maar", "graag"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "für", "ein", "eine", "wie", "was", "auf", "zu", "sie", "bitte"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "pas", "je", "vous", "pour", "que", "qui", "avec", "dans", "ce"},
+	"es": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "de", "en", "por", "para", "con", "cómo", "qué", "está"},
+	"it": {"il", "lo", "la", "gli", "e", "è", "un", "una", "che", "di", "per", "non", "con", "come", "sono", "questo", "della"},
+	"pt": {"o", "os", "as", "e", "é", "um", "uma", "que", "de", "em", "para", "com", "não", "como", "você", "isso", "do"},
+}
+
+// stopwordLanguages is the reverse index of stopwords
+var stopwordLanguages = func() map[string][]string {
+	index := map[string][]string{}
+	for language, words := range stopwords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// detectLanguage guesses the language of the text from its script or, for Latin script, from its stopwords. It
+// returns an empty string when there is no clear winner.
+func detectLanguage(text string) string {
+	scripts := map[string]int{}
+	latin := 0
+	n := 0
+	for _, r := range text {
+		if n++; n > maxLanguageRunes {
+			break
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.script, r) {
+				scripts[s.language]++
+				break
+			}
+		}
+	}
+
+	// Japanese mixes kana with Han characters, so any kana decides for Japanese
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+	if language, count := winner(scripts); count > latin {
+		return language
+	}
+	if latin == 0 {
+		return ""
+	}
+
+	counts := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for i, word := range words {
+		if i >= maxLanguageRunes/4 {
+			break
+		}
+		for _, language := range stopwordLanguages[word] {
+			counts[language]++
+		}
+	}
+	if language, count := winner(counts); count >= 2 {
+		return language
+	}
+	return ""
+}
+
+// winner returns the language with the highest count, or no language when the highest count is shared
+func winner(counts map[string]int) (string, int) {
+	best, bestCount, tied := "", 0, false
+	for language, count := range counts {
+		switch {
+		case count > bestCount:
+			best, bestCount, tied = language, count, false
+		case count == bestCount:
+			tied = true
+		}
+	}
+	if tied {
+		return "", bestCount
+	}
+	return best, bestCount
+}
+
+// userText joins the text of the user messages
+func userText(texts []promptText) string {
+	var user []string
+	for _, text := range texts {
+		if text.role == "user" {
+			user = append(user, text.text)
+		}
+	}
+	return strings.Join(user, "\n")
+}
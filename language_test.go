@@ -0,0 +1,60 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "english", text: "What is the capital of France and how far is it from the coast?", want: "en"},
+		{name: "dutch", text: "Wat is de hoofdstad van Frankrijk en hoe ver ligt het van de kust?", want: "nl"},
+		{name: "german", text: "Was ist die Hauptstadt von Frankreich und wie weit ist sie von der Küste?", want: "de"},
+		{name: "french", text: "Quelle est la capitale de la France et est-ce que je peux la visiter avec vous?", want: "fr"},
+		{name: "spanish", text: "¿Cuál es la capital de Francia y qué tan lejos está de la costa para los turistas?", want: "es"},
+		{name: "italian", text: "Qual è la capitale della Francia e quanto dista dalla costa per gli turisti che non sono qui?", want: "it"},
+		{name: "portuguese", text: "Qual é a capital da França e como você chega lá? Isso é longe do mar?", want: "pt"},
+		{name: "russian", text: "Какая столица Франции?", want: "ru"},
+		{name: "japanese", text: "フランスの首都はどこですか？", want: "ja"},
+		{name: "chinese", text: "法国的首都是哪里？", want: "zh"},
+		{name: "korean", text: "프랑스의 수도는 어디입니까?", want: "ko"},
+		{name: "arabic", text: "ما هي عاصمة فرنسا؟", want: "ar"},
+		{name: "too short", text: "Paris?", want: ""},
+		{name: "code", text: "SELECT * FROM users;", want: ""},
+		{name: "empty", text: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLanguageDetection_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.LanguageDetection = true
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "language detection")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	input := "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"system\", \"content\": \"You are a helpful assistant and you answer in the language of the user.\"}, {\"role\": \"user\", \"content\": \"Kun je mij vertellen wat de hoofdstad van Frankrijk is?\"}]}"
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+	if want := "nl"; got.Get("X-OpenAI-Prompt-Lang") != want {
+		t.Errorf("expected %q but got %q", want, got.Get("X-OpenAI-Prompt-Lang"))
+	}
+}
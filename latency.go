@@ -0,0 +1,48 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// latencyWriter records when the first byte of the response was written
+type latencyWriter struct {
+	*responseWriter
+	start     time.Time
+	firstByte time.Time
+}
+
+func newLatencyWriter(w http.ResponseWriter, start time.Time) *latencyWriter {
+	l := &latencyWriter{start: start}
+	l.responseWriter = &responseWriter{ResponseWriter: w, onWrite: l.write}
+	return l
+}
+
+func (l *latencyWriter) write(data []byte) {
+	if l.firstByte.IsZero() && len(data) > 0 {
+		l.firstByte = time.Now()
+	}
+}
+
+// latencyLabel labels the latency of a request by model, endpoint kind and whether it streams, which Traefik's service
+// latency cannot be split by as they live in the body
+func latencyLabel(kinds []EndpointKind, values map[string]string) string {
+	endpoints := make([]string, len(kinds))
+	for i, kind := range kinds {
+		endpoints[i] = string(kind)
+	}
+	return "model=" + values["model"] + ",endpoint=" + strings.Join(endpoints, "+") +
+		",stream=" + strconv.FormatBool(values["stream"] == "true")
+}
+
+// observeLatency records the end-to-end latency of the request and the time to the first byte of its response, from
+// the moment the middleware received it
+func (e *Handler) observeLatency(l *latencyWriter, kinds []EndpointKind, values map[string]string) {
+	label := latencyLabel(kinds, values)
+	e.metrics.observe("latency_ms", label, time.Since(l.start))
+	if !l.firstByte.IsZero() {
+		e.metrics.observe("ttfb_ms", label, l.firstByte.Sub(l.start))
+	}
+}
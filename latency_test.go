@@ -0,0 +1,110 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatency_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		uri   string
+		body  string
+		label string
+		write bool
+	}{
+		{
+			name:  "chat completion",
+			uri:   "/v1/chat/completions",
+			body:  "{\"model\": \"gpt-4.1\"}",
+			label: "model=gpt-4.1,endpoint=chat_completion,stream=false",
+			write: true,
+		},
+		{
+			name:  "stream",
+			uri:   "/v1/chat/completions",
+			body:  "{\"model\": \"gpt-4.1\", \"stream\": true}",
+			label: "model=gpt-4.1,endpoint=chat_completion,stream=true",
+			write: true,
+		},
+		{
+			name:  "anthropic",
+			uri:   "/v1/messages",
+			body:  "{\"model\": \"claude-sonnet-4\", \"max_tokens\": 100}",
+			label: "model=claude-sonnet-4,endpoint=anthropic_messages,stream=false",
+			write: true,
+		},
+		{
+			name:  "no body",
+			uri:   "/v1/chat/completions",
+			body:  "{\"model\": \"gpt-4.1\"}",
+			label: "model=gpt-4.1,endpoint=chat_completion,stream=false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				time.Sleep(60 * time.Millisecond)
+				if tt.write {
+					_, _ = w.Write([]byte("{}"))
+				}
+			}), defaultConfig(), tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tt.uri, strings.NewReader(tt.body)))
+
+			histograms := e.(*Handler).metrics.snapshot().Histograms
+			latency, ok := histograms["latency_ms"][tt.label]
+			if !ok {
+				t.Fatalf("expected a latency histogram labeled %s but got %v", tt.label, histograms["latency_ms"])
+			}
+			if latency.Count != 1 || latency.SumMs < 60 || latency.Buckets["50"] != 0 || latency.Buckets["+Inf"] != 1 {
+				t.Errorf("expected one request of at least 60ms but got %+v", latency)
+			}
+			ttfb, ok := histograms["ttfb_ms"][tt.label]
+			if ok != tt.write {
+				t.Fatalf("expected a time to first byte histogram %v but got %v", tt.write, histograms["ttfb_ms"])
+			}
+			if tt.write && (ttfb.Count != 1 || ttfb.SumMs < 60) {
+				t.Errorf("expected a first byte after at least 60ms but got %+v", ttfb)
+			}
+		})
+	}
+}
+
+func TestLatencyWithoutModel_ServeHTTP(t *testing.T) {
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), defaultConfig(), "no model")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("not json")))
+
+	if histograms := e.(*Handler).metrics.snapshot().Histograms; len(histograms) != 0 {
+		t.Errorf("expected no latency without a model but got %v", histograms)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	m := newMetrics()
+	for _, duration := range []time.Duration{10 * time.Millisecond, 50 * time.Millisecond, 51 * time.Millisecond, 10 * time.Minute} {
+		m.observe("latency_ms", "gpt-4.1", duration)
+	}
+
+	got := m.snapshot().Histograms["latency_ms"]["gpt-4.1"]
+	want := map[string]int64{"50": 2, "100": 3, "300000": 3, "+Inf": 4}
+	for le, count := range want {
+		if got.Buckets[le] != count {
+			t.Errorf("expected %d durations up to %s but got %d", count, le, got.Buckets[le])
+		}
+	}
+	if got.Count != 4 || got.SumMs != 600111 {
+		t.Errorf("expected 4 durations of 600111ms in total but got %d of %dms", got.Count, got.SumMs)
+	}
+}
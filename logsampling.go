@@ -0,0 +1,242 @@
+package traefik_openai_header
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LogSampling logs one JSON line per matched or rejected request, sampled by outcome, so busy routes keep a sane log
+// volume while failures and rejections stay visible. Unset rates default to 1% of successful extractions and all
+// failures and rejections. With the cloudevents format every line is a CloudEvents 1.0 event in structured JSON mode
+// whose data is the plain line.
+type LogSampling struct {
+	Successes  *float64 `json:"successes"`
+	Failures   *float64 `json:"failures"`
+	Rejections *float64 `json:"rejections"`
+	Format     string   `json:"format"`
+	Source     string   `json:"source"`
+	Type       string   `json:"type"`
+}
+
+// Log formats
+const (
+	LogFormatJSON        = "json"
+	LogFormatCloudEvents = "cloudevents"
+)
+
+// defaultCloudEventType is the type of the CloudEvents, in which {outcome} is replaced by the outcome of the request
+const defaultCloudEventType = "com.github.rinokadijk.traefik-openai-header.request.{outcome}"
+
+// Outcomes of a logged request
+const (
+	logOutcomeExtracted = "extracted"
+	logOutcomeFailed    = "failed"
+	logOutcomeRejected  = "rejected"
+)
+
+// logSampling is the parsed LogSampling config
+type logSampling struct {
+	rates       map[string]float64
+	random      func() float64
+	cloudEvents bool
+	source      string
+	eventType   string
+}
+
+// newLogSampling parses the config; the source of the CloudEvents defaults to the name of the middleware
+func newLogSampling(config *LogSampling, name string) (*logSampling, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	switch config.Format {
+	case "", LogFormatJSON, LogFormatCloudEvents:
+	default:
+		return nil, fmt.Errorf("invalid logSampling format %q", config.Format)
+	}
+	source := config.Source
+	if source == "" {
+		source = "/traefik-openai-header/" + name
+	}
+	eventType := config.Type
+	if eventType == "" {
+		eventType = defaultCloudEventType
+	}
+
+	rates := map[string]float64{logOutcomeExtracted: 0.01, logOutcomeFailed: 1, logOutcomeRejected: 1}
+	for outcome, rate := range map[string]*float64{
+		logOutcomeExtracted: config.Successes,
+		logOutcomeFailed:    config.Failures,
+		logOutcomeRejected:  config.Rejections,
+	} {
+		if rate == nil {
+			continue
+		}
+		if *rate < 0 || *rate > 1 {
+			return nil, fmt.Errorf("invalid logSampling rate %v", *rate)
+		}
+		rates[outcome] = *rate
+	}
+	return &logSampling{
+		rates:       rates,
+		random:      rand.Float64,
+		cloudEvents: config.Format == LogFormatCloudEvents,
+		source:      source,
+		eventType:   eventType,
+	}, nil
+}
+
+// cloudEvent is a CloudEvents 1.0 event in structured JSON mode
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Time            time.Time   `json:"time"`
+	Subject         string      `json:"subject,omitempty"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// encode returns the line in the log format
+func (s *logSampling) encode(line logLine) ([]byte, error) {
+	if !s.cloudEvents {
+		return json.Marshal(line)
+	}
+	id := make([]byte, 16)
+	if _, err := crand.Read(id); err != nil {
+		return nil, err
+	}
+	return json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          s.source,
+		Type:            strings.ReplaceAll(s.eventType, "{outcome}", line.Outcome),
+		Time:            line.Time,
+		Subject:         line.Model,
+		DataContentType: "application/json",
+		Data:            line,
+	})
+}
+
+// logLine is the JSON line logged for a request
+type logLine struct {
+	Time       time.Time      `json:"time"`
+	Outcome    string         `json:"outcome"`
+	Method     string         `json:"method"`
+	Path       string         `json:"path"`
+	Status     int            `json:"status,omitempty"`
+	DurationMs int64          `json:"duration_ms"`
+	Kinds      []EndpointKind `json:"kinds,omitempty"`
+	Model      string         `json:"model,omitempty"`
+	Code       string         `json:"code,omitempty"`
+	Reason     string         `json:"reason,omitempty"`
+}
+
+// logWriter collects what is logged about a request while it is served
+type logWriter struct {
+	*responseWriter
+	start     time.Time
+	request   *http.Request
+	matched   bool
+	kinds     []EndpointKind
+	values    map[string]string
+	rejection string
+	failure   string
+}
+
+func newLogWriter(w http.ResponseWriter, r *http.Request) *logWriter {
+	return &logWriter{responseWriter: &responseWriter{ResponseWriter: w}, start: time.Now(), request: r}
+}
+
+// findLogWriter returns the log writer among the writers wrapped by w, if any
+func findLogWriter(w http.ResponseWriter) *logWriter {
+	for {
+		switch writer := w.(type) {
+		case *logWriter:
+			return writer
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// match records the endpoint kinds of a matched request
+func (l *logWriter) match(kinds []EndpointKind) {
+	if l == nil {
+		return
+	}
+	l.matched = true
+	l.kinds = kinds
+}
+
+// extracted records the values extracted from a matched request
+func (l *logWriter) extracted(values map[string]string) {
+	if l == nil {
+		return
+	}
+	l.values = values
+}
+
+// outcome returns the outcome of the request and its rejection code or failure reason
+func (l *logWriter) outcome() (string, string, string) {
+	failure := l.failure
+	if failure == "" && l.matched {
+		failure = l.request.Header.Get(ParseFailureHeader)
+	}
+	switch {
+	case failure != "":
+		return logOutcomeFailed, l.rejection, failure
+	case l.rejection != "":
+		return logOutcomeRejected, l.rejection, ""
+	case l.matched:
+		return logOutcomeExtracted, "", ""
+	}
+	return "", "", ""
+}
+
+// writeLog logs the request when its outcome is sampled, to the OTLP collector and the syslog server or else to stdout
+func (e *Handler) writeLog(l *logWriter) {
+	outcome, code, reason := l.outcome()
+	if outcome == "" {
+		return
+	}
+	if rate := e.logSampling.rates[outcome]; rate <= 0 || e.logSampling.random() >= rate {
+		e.metrics.inc("logs_sampled_out_total")
+		return
+	}
+
+	line := logLine{
+		Time:       l.start.UTC(),
+		Outcome:    outcome,
+		Method:     l.request.Method,
+		Path:       l.request.URL.Path,
+		Status:     l.status,
+		DurationMs: time.Since(l.start).Milliseconds(),
+		Kinds:      l.kinds,
+		Model:      l.values["model"],
+		Code:       code,
+		Reason:     reason,
+	}
+	data, err := e.logSampling.encode(line)
+	if err != nil {
+		return
+	}
+	if e.otlp != nil {
+		e.otlp.queueLog(line, data)
+	}
+	if e.syslog != nil {
+		e.syslog.queueLog(line, data)
+	}
+	if e.otlp == nil && e.syslog == nil {
+		fmt.Println(string(data))
+	}
+}
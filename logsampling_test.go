@@ -0,0 +1,188 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogSampling_ServeHTTP(t *testing.T) {
+	one := 1.0
+	tests := []struct {
+		name      string
+		sampling  LogSampling
+		method    string
+		uri       string
+		body      string
+		want      *logLine
+		sampleOut int64
+	}{
+		{
+			name:      "success sampled out",
+			method:    http.MethodPost,
+			uri:       "/v1/chat/completions",
+			body:      "{\"model\": \"gpt-4.1\"}",
+			sampleOut: 1,
+		},
+		{
+			name:     "success",
+			sampling: LogSampling{Successes: &one},
+			method:   http.MethodPost,
+			uri:      "/v1/chat/completions",
+			body:     "{\"model\": \"gpt-4.1\"}",
+			want:     &logLine{Outcome: "extracted", Method: "POST", Path: "/v1/chat/completions", Status: 200, Kinds: []EndpointKind{ChatCompletionEndpoint}, Model: "gpt-4.1"},
+		},
+		{
+			name:   "parse failure",
+			method: http.MethodPost,
+			uri:    "/v1/chat/completions",
+			body:   "not json",
+			want:   &logLine{Outcome: "failed", Method: "POST", Path: "/v1/chat/completions", Status: 200, Kinds: []EndpointKind{ChatCompletionEndpoint}, Reason: "invalid character 'o' in literal null (expecting 'u')"},
+		},
+		{
+			name:   "rejection",
+			method: http.MethodPost,
+			uri:    "/v1/batches",
+			body:   "{}",
+			want:   &logLine{Outcome: "rejected", Method: "POST", Path: "/v1/batches", Status: 403, Code: "endpoint_not_allowed"},
+		},
+		{
+			name:   "unmatched request",
+			method: http.MethodGet,
+			uri:    "/v1/models",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.DeniedEndpoints = []string{"batch"}
+			config.LogSampling = &tt.sampling
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("{}"))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			e.(*Handler).logSampling.random = func() float64 { return 0.5 }
+
+			output := captureStdout(t, func() {
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.uri, strings.NewReader(tt.body)))
+			})
+
+			if tt.want == nil {
+				if output != "" {
+					t.Errorf("expected no log line but got %s", output)
+				}
+			} else {
+				var got logLine
+				if err := json.Unmarshal([]byte(output), &got); err != nil {
+					t.Fatalf("expected a JSON log line but got %q: %s", output, err)
+				}
+				if got.Time.IsZero() {
+					t.Errorf("expected the time of the request")
+				}
+				got.Time, got.DurationMs = tt.want.Time, tt.want.DurationMs
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				if string(gotJSON) != string(wantJSON) {
+					t.Errorf("expected %s but got %s", wantJSON, gotJSON)
+				}
+			}
+			if got := e.(*Handler).metrics.counter("logs_sampled_out_total"); got != tt.sampleOut {
+				t.Errorf("expected %d sampled out log lines but got %d", tt.sampleOut, got)
+			}
+		})
+	}
+}
+
+func TestLogSamplingCloudEvents_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name      string
+		sampling  LogSampling
+		source    string
+		eventType string
+	}{
+		{
+			name:      "defaults",
+			sampling:  LogSampling{Format: "cloudevents"},
+			source:    "/traefik-openai-header/defaults",
+			eventType: "com.github.rinokadijk.traefik-openai-header.request.rejected",
+		},
+		{
+			name:      "configured source and type",
+			sampling:  LogSampling{Format: "cloudevents", Source: "urn:gateway:eu-west-1", Type: "com.example.llm.{outcome}.v1"},
+			source:    "urn:gateway:eu-west-1",
+			eventType: "com.example.llm.rejected.v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.BannedContent = &BannedContent{Action: BannedContentActionReject, Patterns: map[string]string{"secret": "forbidden"}}
+			config.LogSampling = &tt.sampling
+
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			output := captureStdout(t, func() {
+				body := "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"forbidden\"}]}"
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+			})
+
+			var event struct {
+				cloudEvent
+				Data logLine `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(output), &event); err != nil {
+				t.Fatalf("expected a JSON event but got %q: %s", output, err)
+			}
+			if event.SpecVersion != "1.0" || len(event.ID) != 32 || event.DataContentType != "application/json" || event.Time.IsZero() {
+				t.Errorf("expected the required CloudEvents attributes but got %s", output)
+			}
+			if event.Source != tt.source || event.Type != tt.eventType || event.Subject != "gpt-4.1" {
+				t.Errorf("expected source %s, type %s and subject gpt-4.1 but got %s", tt.source, tt.eventType, output)
+			}
+			if event.Data.Outcome != "rejected" || event.Data.Code != "banned_content" {
+				t.Errorf("expected the log line of the rejection as data but got %+v", event.Data)
+			}
+		})
+	}
+}
+
+func TestInvalidLogSampling_New(t *testing.T) {
+	rate := 1.5
+	for _, sampling := range []LogSampling{{Failures: &rate}, {Format: "xml"}} {
+		config := defaultConfig()
+		config.LogSampling = &sampling
+		if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "invalid"); err == nil {
+			t.Errorf("expected an error for %+v", sampling)
+		}
+	}
+}
+
+// captureStdout returns what f prints
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	f()
+
+	_ = writer.Close()
+	output, _ := io.ReadAll(reader)
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,301 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultHeaderNameTemplate generates header names like X-OpenAI-Max-Tokens for fields mapped to true
+const defaultHeaderNameTemplate = "X-{provider}-{Field}"
+
+// headerMapper turns extracted field values into headers according to the configuration
+type headerMapper struct {
+	requestFields  map[string][]string
+	valueMappings  map[string]map[string]string
+	valueMasks     valueMasks
+	hashFields     map[string]bool
+	redactor       *redactor
+	conditions     map[string][]condition
+	combinedHeader string
+	numberFormat   numberFormat
+	autoFields     *autoFields
+	neverEmit      map[string]bool
+	normalizer     *normalizer
+}
+
+func newHeaderMapper(config *Config) (*headerMapper, error) {
+	conditions := make(map[string][]condition, len(config.HeaderConditions))
+	for field, fieldConditions := range config.HeaderConditions {
+		compiled, err := compileConditions("headerConditions."+field, fieldConditions)
+		if err != nil {
+			return nil, err
+		}
+		conditions[field] = compiled
+	}
+
+	redactor, err := newRedactor(config.PIIRedaction)
+	if err != nil {
+		return nil, err
+	}
+
+	valueMasks, err := newValueMasks(config.ValueMasks)
+	if err != nil {
+		return nil, err
+	}
+
+	requestFields, err := headerNames(config)
+	if err != nil {
+		return nil, err
+	}
+
+	autoFields, err := newAutoFields(config.AutoFields, config.RequestFields, config.NeverEmit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &headerMapper{
+		requestFields:  requestFields,
+		valueMappings:  config.ValueMappings,
+		valueMasks:     valueMasks,
+		hashFields:     toSet(config.HashFields),
+		redactor:       redactor,
+		conditions:     conditions,
+		combinedHeader: config.CombinedHeader,
+		numberFormat: numberFormat{
+			precision:          config.FloatPrecision,
+			stripTrailingZeros: config.StripTrailingZeros,
+			raw:                config.RawNumbers,
+		},
+		autoFields: autoFields,
+		neverEmit:  toSet(config.NeverEmit),
+		normalizer: newNormalizer(config.UnicodeNormalization),
+	}, nil
+}
+
+// enabled reports whether any field is mapped to a header
+func (m *headerMapper) enabled() bool {
+	return len(m.requestFields) > 0 || m.autoFields != nil
+}
+
+// autoHeaders returns the headers of the top level scalar fields emitted by the auto fields
+func (m *headerMapper) autoHeaders(members map[string]json.RawMessage) map[string]string {
+	if m.autoFields == nil {
+		return nil
+	}
+	return m.autoFields.headers(members, m.numberFormat, func(field string, value string) string {
+		return m.translate(field, m.normalizer.normalize(value))
+	})
+}
+
+// headerName returns the first header configured for the field, or an empty string when the field is not mapped
+func (m *headerMapper) headerName(field string) string {
+	if names := m.requestFields[field]; len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// fieldHeaders returns every header configured for the field
+func (m *headerMapper) fieldHeaders(field string) []string {
+	return m.requestFields[field]
+}
+
+// headerNames resolves the headers of every mapped field. Fields mapped to true get a header generated from the
+// headerNameTemplate, fields mapped to a list get every header in the list, fields mapped to null or false are not
+// mapped.
+func headerNames(config *Config) (map[string][]string, error) {
+	template := config.HeaderNameTemplate
+	if template == "" {
+		template = defaultHeaderNameTemplate
+	}
+	if !strings.Contains(template, "{Field}") && !strings.Contains(template, "{field}") {
+		return nil, fmt.Errorf("headerNameTemplate %q requires {Field} or {field}", template)
+	}
+	provider := config.HeaderNameProvider
+	if provider == "" {
+		provider = "OpenAI"
+	}
+
+	names := make(map[string][]string, len(config.RequestFields))
+	for field, header := range config.RequestFields {
+		if list, ok := header.([]interface{}); ok {
+			for _, value := range list {
+				name, ok := value.(string)
+				if !ok || !validHeaderName(name) {
+					return nil, fmt.Errorf("invalid requestFields header %v for %s", value, field)
+				}
+				names[field] = append(names[field], name)
+			}
+			continue
+		}
+		switch header {
+		case nil, false, "false":
+			continue
+		case true, "true":
+			name := strings.NewReplacer(
+				"{provider}", provider,
+				"{Field}", kebabCase(field, true),
+				"{field}", kebabCase(field, false),
+			).Replace(template)
+			if !validHeaderName(name) {
+				return nil, fmt.Errorf("headerNameTemplate generates invalid header %q for %s", name, field)
+			}
+			names[field] = []string{name}
+		default:
+			names[field] = []string{fmt.Sprintf("%v", header)}
+		}
+	}
+	return names, nil
+}
+
+// kebabCase converts a snake_case or dotted field name to Kebab-Case, or to kebab-case when title is false
+func kebabCase(field string, title bool) string {
+	words := strings.FieldsFunc(field, func(r rune) bool {
+		return r == '_' || r == '.' || r == '-'
+	})
+	for i, word := range words {
+		if title {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		} else {
+			words[i] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(words, "-")
+}
+
+// validHeaderName reports whether the name is a valid HTTP header name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// extract extracts the field values from the body members and the request with the extractor of the endpoint kind,
+// keyed by field name, with the unicode normalization applied
+func (m *headerMapper) extract(extractor extractor, kind EndpointKind, members map[string]json.RawMessage, r *http.Request) (map[string]string, error) {
+	values, err := extractor.extract(&fieldDecoder{members: members, format: m.numberFormat}, r)
+	for field, value := range values {
+		values[field] = m.normalizer.normalize(value)
+	}
+	if kind == ChatCompletionEndpoint && m.headerName("model") == "" && m.autoFields == nil {
+		if err == nil {
+			err = errors.New("No model field configuration")
+		} else {
+			err = errors.New("Unknown model")
+		}
+	}
+	return values, err
+}
+
+// emitted returns the field values without the fields that must never be emitted
+func (m *headerMapper) emitted(values map[string]string) map[string]string {
+	if len(m.neverEmit) == 0 {
+		return values
+	}
+	emitted := make(map[string]string, len(values))
+	for field, value := range values {
+		if !m.neverEmit[field] {
+			emitted[field] = value
+		}
+	}
+	return emitted
+}
+
+// headers maps the extracted field values to the configured header names, translating the values that have an entry
+// in the value mapping table of their field and hashing the values of hashed fields. Fields whose header conditions do
+// not hold and fields that must never be emitted are left out.
+func (m *headerMapper) headers(values map[string]string, members map[string]json.RawMessage) map[string]string {
+	values = m.emitted(values)
+	if len(m.valueMappings) > 0 || len(m.valueMasks) > 0 || len(m.conditions) > 0 || len(m.hashFields) > 0 || m.redactor != nil {
+		emitted := make(map[string]string, len(values))
+		for field, value := range values {
+			if allHold(m.conditions[field], values) {
+				emitted[field] = m.translate(field, value)
+			}
+		}
+		values = emitted
+	}
+
+	headers := map[string]string{}
+	if m.combinedHeader != "" {
+		if combined := m.combine(values, members); combined != "" {
+			headers[m.combinedHeader] = combined
+		}
+		return headers
+	}
+
+	for field, value := range values {
+		for _, name := range m.fieldHeaders(field) {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// translate returns the value configured for the field value in the value mapping table, or the value itself when
+// it is not mapped, with the value masks of the field applied. Values of hashed fields are hashed after the
+// translation, personal data in other values is redacted.
+func (m *headerMapper) translate(field string, value string) string {
+	if mapped, ok := m.valueMappings[field][value]; ok {
+		value = mapped
+	}
+	value = m.valueMasks.mask(field, value)
+	if m.hashFields[field] {
+		return hashValue(value)
+	}
+	return m.redactor.redact(field, value)
+}
+
+// combine encodes the mapped field values as a single JSON object keyed by field name. Values that were sent as JSON
+// numbers or booleans are emitted unquoted.
+func (m *headerMapper) combine(values map[string]string, members map[string]json.RawMessage) string {
+	object := map[string]json.RawMessage{}
+	for field, value := range values {
+		if m.headerName(field) == "" {
+			continue
+		}
+		raw, ok := members[field]
+		if ok && len(raw) > 0 && raw[0] != '"' && isJSONScalar(value) {
+			object[field] = json.RawMessage(value)
+			continue
+		}
+		quoted, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		object[field] = quoted
+	}
+	if len(object) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// isJSONScalar reports whether the value can be emitted as a JSON number or boolean
+func isJSONScalar(value string) bool {
+	if value == "true" || value == "false" {
+		return true
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return false
+	}
+	return json.Valid([]byte(value))
+}
@@ -0,0 +1,508 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCombinedHeader_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "typed values",
+			input: "{\"model\": \"gpt-4.1\", \"temperature\": 0.7, \"stream\": true, \"user\": \"alice\"}",
+			want:  "{\"model\":\"gpt-4.1\",\"stream\":true,\"temperature\":0.7,\"user\":\"alice\"}",
+		},
+		{
+			name:  "numeric string stays quoted",
+			input: "{\"model\": \"123\"}",
+			want:  "{\"model\":\"123\"}",
+		},
+		{
+			name:  "tool choice object",
+			input: "{\"model\": \"gpt-4.1\", \"tool_choice\": {\"type\": \"function\", \"function\": {\"name\": \"lookup\"}}}",
+			want:  "{\"model\":\"gpt-4.1\",\"tool_choice\":\"function:lookup\"}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.CombinedHeader = "X-OpenAI-Params"
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			if got.Get("X-OpenAI-Params") != tt.want {
+				t.Errorf("expected %v but got %v", tt.want, got.Get("X-OpenAI-Params"))
+			}
+			if got.Get("X-OpenAI-Model") != "" {
+				t.Errorf("expected no individual headers in combined mode")
+			}
+		})
+	}
+}
+
+func TestValueMappings_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		combined bool
+		want     map[string]string
+	}{
+		{
+			name:  "mapped",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"svc-foo\"}",
+			want:  map[string]string{"X-OpenAI-Model": "tier-premium", "X-OpenAI-User": "team-platform"},
+		},
+		{
+			name:  "unmapped value",
+			input: "{\"model\": \"gpt-4o\", \"user\": \"alice\"}",
+			want:  map[string]string{"X-OpenAI-Model": "gpt-4o", "X-OpenAI-User": "alice"},
+		},
+		{
+			name:  "field without table",
+			input: "{\"model\": \"gpt-4.1\", \"temperature\": 1}",
+			want:  map[string]string{"X-OpenAI-Model": "tier-premium", "X-OpenAI-Temperature": "1"},
+		},
+		{
+			name:     "combined",
+			input:    "{\"model\": \"gpt-4.1\", \"stream\": true}",
+			combined: true,
+			want:     map[string]string{"X-OpenAI-Params": "{\"model\":\"tier-premium\",\"stream\":true}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ValueMappings = map[string]map[string]string{
+				"model": {"gpt-4.1": "tier-premium"},
+				"user":  {"svc-foo": "team-platform"},
+			}
+			if tt.combined {
+				config.CombinedHeader = "X-OpenAI-Params"
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestStaticHeaders_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{
+			name: "matched",
+			uri:  "/v1/chat/completions",
+			want: "prod",
+		},
+		{
+			name: "not matched",
+			uri:  "/v1/models",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.StaticHeaders = map[string]string{"X-OpenAI-Environment": "prod"}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", tt.uri, strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+			if got.Get("X-OpenAI-Environment") != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got.Get("X-OpenAI-Environment"))
+			}
+		})
+	}
+}
+
+func TestHashFields_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.HashFields = []string{"safety_identifier"}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "hash fields")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	input := "{\"model\": \"gpt-4.1\", \"safety_identifier\": \"user-1234\", \"prompt_cache_key\": \"support-bot-v3\"}"
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+	if want := hashValue("user-1234"); got.Get("X-OpenAI-Safety-Identifier") != want {
+		t.Errorf("expected hashed safety identifier %q but got %q", want, got.Get("X-OpenAI-Safety-Identifier"))
+	}
+	if got.Get("X-OpenAI-Prompt-Cache-Key") != "support-bot-v3" {
+		t.Errorf("expected the prompt cache key unhashed but got %q", got.Get("X-OpenAI-Prompt-Cache-Key"))
+	}
+}
+
+func TestFallbackModels_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantModel string
+		want      string
+	}{
+		{name: "listed model", input: "{\"model\": \"gpt-4.1\"}", wantModel: "tier-premium", want: "gpt-4.1-mini"},
+		{name: "unlisted model", input: "{\"model\": \"o3\"}", wantModel: "o3", want: ""},
+		{name: "no model", input: "{\"user\": \"alice\"}", wantModel: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.FallbackModels = map[string]string{"gpt-4.1": "gpt-4.1-mini"}
+			config.ValueMappings = map[string]map[string]string{"model": {"gpt-4.1": "tier-premium"}}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			if got.Get("X-OpenAI-Model") != tt.wantModel {
+				t.Errorf("expected model %q but got %q", tt.wantModel, got.Get("X-OpenAI-Model"))
+			}
+			if got.Get("X-OpenAI-Fallback-Model") != tt.want {
+				t.Errorf("expected fallback %q but got %q", tt.want, got.Get("X-OpenAI-Fallback-Model"))
+			}
+		})
+	}
+}
+
+func TestHeaderNameTemplate_ServeHTTP(t *testing.T) {
+	input := "{\"model\": \"gpt-4.1\", \"max_completion_tokens\": 100, \"user\": \"alice\"}"
+	tests := []struct {
+		name     string
+		template string
+		provider string
+		want     map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{"X-OpenAI-Max-Completion-Tokens": "100", "X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": ""},
+		},
+		{
+			name:     "provider",
+			provider: "Azure",
+			want:     map[string]string{"X-Azure-Max-Completion-Tokens": "100", "X-OpenAI-Model": "gpt-4.1"},
+		},
+		{
+			name:     "lowercase",
+			template: "x-llm-{field}",
+			want:     map[string]string{"X-Llm-Max-Completion-Tokens": "100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.HeaderNameTemplate = tt.template
+			config.HeaderNameProvider = tt.provider
+			config.RequestFields = map[string]interface{}{
+				"model":                 "X-OpenAI-Model",
+				"max_completion_tokens": true,
+				"user":                  false,
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestKebabCase(t *testing.T) {
+	tests := []struct {
+		field string
+		title bool
+		want  string
+	}{
+		{field: "model", title: true, want: "Model"},
+		{field: "max_completion_tokens", title: true, want: "Max-Completion-Tokens"},
+		{field: "metadata.team_name", title: true, want: "Metadata-Team-Name"},
+		{field: "Max_Tokens", want: "max-tokens"},
+		{field: "__private", title: true, want: "Private"},
+	}
+	for _, tt := range tests {
+		if got := kebabCase(tt.field, tt.title); got != tt.want {
+			t.Errorf("expected %q for %q but got %q", tt.want, tt.field, got)
+		}
+	}
+}
+
+func TestInvalidHeaderNameTemplate_New(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		provider string
+	}{
+		{name: "without field", template: "X-OpenAI-Model"},
+		{name: "invalid character", template: "X-{provider} {Field}"},
+		{name: "invalid provider", provider: "Open:AI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.HeaderNameTemplate = tt.template
+			config.HeaderNameProvider = tt.provider
+			config.RequestFields = map[string]interface{}{"model": true}
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestMultipleHeaders_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.RequestFields = map[string]interface{}{
+		"model": []interface{}{"X-OpenAI-Model", "X-RateLimit-Key"},
+		"user":  []interface{}{},
+	}
+	config.ValueMappings = map[string]map[string]string{"model": {"gpt-4.1": "flagship"}}
+	config.MirrorResponseFields = []string{"model"}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "multiple headers")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"user\": \"alice\"}")))
+
+	for header, value := range map[string]string{"X-OpenAI-Model": "flagship", "X-RateLimit-Key": "flagship", "X-OpenAI-User": ""} {
+		if got.Get(header) != value {
+			t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+		}
+		if recorder.Header().Get(header) != value {
+			t.Errorf("expected response header %v to be %q but got %q", header, value, recorder.Header().Get(header))
+		}
+	}
+}
+
+func TestInvalidMultipleHeaders_New(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []interface{}
+	}{
+		{name: "not a string", headers: []interface{}{"X-OpenAI-Model", true}},
+		{name: "invalid header", headers: []interface{}{"X-OpenAI Model"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.RequestFields = map[string]interface{}{"model": tt.headers}
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestNeverEmit_ServeHTTP(t *testing.T) {
+	input := "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"service_tier\": \"flex\", \"metadata\": {\"ssn\": \"123\"}}"
+	tests := []struct {
+		name     string
+		combined string
+		auto     *AutoFields
+		want     map[string]string
+	}{
+		{
+			name: "headers",
+			want: map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "", "Baggage": "llm.model=gpt-4.1"},
+		},
+		{
+			name:     "combined header",
+			combined: "X-OpenAI-Params",
+			want:     map[string]string{"X-OpenAI-Params": "{\"model\":\"gpt-4.1\"}"},
+		},
+		{
+			name: "auto fields",
+			auto: &AutoFields{Prefix: "X-Auto-"},
+			want: map[string]string{"X-Auto-Model": "gpt-4.1", "X-Auto-Service-Tier": "", "X-OpenAI-User": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.NeverEmit = []string{"user", "service_tier", "metadata.ssn"}
+			config.CombinedHeader = tt.combined
+			config.AutoFields = tt.auto
+			config.BaggageFields = map[string]string{"model": "llm.model", "user": "llm.user"}
+			if tt.auto != nil {
+				config.RequestFields = map[string]interface{}{}
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestValueMasks_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		hash  bool
+		want  map[string]string
+	}{
+		{
+			name:  "masked",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice@example.com\"}",
+			want:  map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "al***ce", "Baggage": "llm.user=al***ce"},
+		},
+		{
+			name:  "mapped before masking",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"svc-foo\"}",
+			want:  map[string]string{"X-OpenAI-User": "te***rm"},
+		},
+		{
+			name:  "no match",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"bob\"}",
+			want:  map[string]string{"X-OpenAI-User": "bob"},
+		},
+		{
+			name:  "hashed after masking",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice@example.com\"}",
+			hash:  true,
+			want:  map[string]string{"X-OpenAI-User": hashValue("al***ce")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ValueMappings = map[string]map[string]string{"user": {"svc-foo": "team-platform"}}
+			config.ValueMasks = map[string][]ValueMask{
+				"user": {
+					{Pattern: "@.*$"},
+					{Pattern: "^(.{2}).+(.{2})$", Replacement: "$1***$2"},
+				},
+			}
+			config.BaggageFields = map[string]string{"user": "llm.user"}
+			if tt.hash {
+				config.HashFields = []string{"user"}
+			}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestValueMasksNamedSubmatch_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.ValueMasks = map[string][]ValueMask{
+		"user": {{Pattern: "^(?P<name>[^@]+)@(?P<domain>.+)$", Replacement: "${domain}/${name}"}},
+	}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "named submatch")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"user\": \"alice@example.com\"}")))
+	if got.Get("X-OpenAI-User") != "example.com/alice" {
+		t.Errorf("expected the named submatches to be replaced but got %q", got.Get("X-OpenAI-User"))
+	}
+}
+
+func TestInvalidValueMasks_New(t *testing.T) {
+	config := defaultConfig()
+	config.ValueMasks = map[string][]ValueMask{"user": {{Pattern: "("}}}
+	if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "invalid"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,44 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ValueMask replaces the matches of a regex in the values of a field. The replacement may refer to submatches as $1 or
+// ${name}, so neither the pattern nor the replacement is expanded as an environment variable reference.
+type ValueMask struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// valueMask is a compiled ValueMask
+type valueMask struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// valueMasks holds the masks of every field, applied in the configured order
+type valueMasks map[string][]valueMask
+
+func newValueMasks(config map[string][]ValueMask) (valueMasks, error) {
+	masks := make(valueMasks, len(config))
+	for field, fieldMasks := range config {
+		for i, mask := range fieldMasks {
+			regex, err := regexp.Compile(mask.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid valueMasks.%s[%d] pattern: %w", field, i, err)
+			}
+			masks[field] = append(masks[field], valueMask{regex: regex, replacement: mask.Replacement})
+		}
+	}
+	return masks, nil
+}
+
+// mask applies the masks of the field to the value
+func (m valueMasks) mask(field string, value string) string {
+	for _, mask := range m[field] {
+		value = mask.regex.ReplaceAllString(value, mask.replacement)
+	}
+	return value
+}
@@ -0,0 +1,172 @@
+package traefik_openai_header
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxLabels bounds the distinct labels counted per labeled counter; further labels are counted as "other"
+const maxLabels = 1000
+
+// latencyBuckets are the upper bounds in milliseconds of the latency histogram buckets, from a cached answer to a long
+// reasoning run
+var latencyBuckets = []int64{50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 120000, 300000}
+
+// metrics counts events of the middleware instance since it was created
+type metrics struct {
+	mu         sync.Mutex
+	started    time.Time
+	counters   map[string]int64
+	labeled    map[string]map[string]int64
+	histograms map[string]map[string]*histogram
+}
+
+// histogram counts durations per latency bucket, the last count being the durations beyond the last bucket
+type histogram struct {
+	counts []int64
+	count  int64
+	sumMs  int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		started:    time.Now(),
+		counters:   map[string]int64{},
+		labeled:    map[string]map[string]int64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+}
+
+// inc increments the named counter
+func (m *metrics) inc(name string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name]++
+}
+
+// incLabel increments the label of the named labeled counter
+func (m *metrics) incLabel(name string, label string) {
+	m.addLabel(name, label, 1)
+}
+
+// addLabel adds the value to the label of the named labeled counter
+func (m *metrics) addLabel(name string, label string, value int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels, ok := m.labeled[name]
+	if !ok {
+		labels = map[string]int64{}
+		m.labeled[name] = labels
+	}
+	if _, ok := labels[label]; !ok && len(labels) >= maxLabels {
+		label = "other"
+	}
+	labels[label] += value
+}
+
+// observe records the duration in the label of the named histogram
+func (m *metrics) observe(name string, label string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels, ok := m.histograms[name]
+	if !ok {
+		labels = map[string]*histogram{}
+		m.histograms[name] = labels
+	}
+	if _, ok := labels[label]; !ok && len(labels) >= maxLabels {
+		label = "other"
+	}
+	h, ok := labels[label]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(latencyBuckets)+1)}
+		labels[label] = h
+	}
+
+	ms := duration.Milliseconds()
+	bucket := 0
+	for bucket < len(latencyBuckets) && ms > latencyBuckets[bucket] {
+		bucket++
+	}
+	h.counts[bucket]++
+	h.count++
+	h.sumMs += ms
+}
+
+// counter returns the current value of the named counter
+func (m *metrics) counter(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+// stats is the JSON representation of the metrics served by the stats endpoint
+type stats struct {
+	Started       time.Time                   `json:"started"`
+	UptimeSeconds int64                       `json:"uptime_seconds"`
+	Counters      map[string]int64            `json:"counters"`
+	Labeled       map[string]map[string]int64 `json:"labeled"`
+	// Histograms hold the cumulative bucket counts by upper bound in milliseconds, as in Prometheus
+	Histograms map[string]map[string]histogramStats `json:"histograms"`
+}
+
+// histogramStats is the JSON representation of a histogram
+type histogramStats struct {
+	Buckets map[string]int64 `json:"buckets"`
+	Count   int64            `json:"count"`
+	SumMs   int64            `json:"sum_ms"`
+}
+
+// snapshot returns a copy of all counters
+func (m *metrics) snapshot() stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters := make(map[string]int64, len(m.counters))
+	for name, value := range m.counters {
+		counters[name] = value
+	}
+	labeled := make(map[string]map[string]int64, len(m.labeled))
+	for name, labels := range m.labeled {
+		copied := make(map[string]int64, len(labels))
+		for label, value := range labels {
+			copied[label] = value
+		}
+		labeled[name] = copied
+	}
+	histograms := make(map[string]map[string]histogramStats, len(m.histograms))
+	for name, labels := range m.histograms {
+		copied := make(map[string]histogramStats, len(labels))
+		for label, h := range labels {
+			buckets := make(map[string]int64, len(h.counts))
+			var cumulative int64
+			for i, count := range h.counts {
+				cumulative += count
+				le := "+Inf"
+				if i < len(latencyBuckets) {
+					le = strconv.FormatInt(latencyBuckets[i], 10)
+				}
+				buckets[le] = cumulative
+			}
+			copied[label] = histogramStats{Buckets: buckets, Count: h.count, SumMs: h.sumMs}
+		}
+		histograms[name] = copied
+	}
+
+	return stats{
+		Started:       m.started,
+		UptimeSeconds: int64(time.Since(m.started) / time.Second),
+		Counters:      counters,
+		Labeled:       labeled,
+		Histograms:    histograms,
+	}
+}
@@ -0,0 +1,149 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultMockContent is the assistant message of the built-in fixture
+const defaultMockContent = "This is a mock response from the OpenAI header test mode."
+
+// TestMode answers requests with a canned completion instead of calling the upstream
+type TestMode struct {
+	Fixture    string `json:"fixture"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// mockUpstream replaces the next handler in test mode. Requests with stream set get the completion as server-sent
+// chat.completion.chunk events.
+type mockUpstream struct {
+	fixture    []byte
+	content    string
+	statusCode int
+}
+
+func newMockUpstream(config *TestMode) (*mockUpstream, error) {
+	m := &mockUpstream{content: defaultMockContent, statusCode: config.StatusCode}
+	if m.statusCode == 0 {
+		m.statusCode = http.StatusOK
+	}
+	if m.statusCode < 200 || m.statusCode > 599 {
+		return nil, fmt.Errorf("invalid testMode statusCode %d", config.StatusCode)
+	}
+
+	if config.Fixture != "" {
+		var completion chatCompletion
+		if err := json.Unmarshal([]byte(config.Fixture), &completion); err != nil {
+			return nil, fmt.Errorf("invalid testMode fixture: %w", err)
+		}
+		m.fixture = []byte(config.Fixture)
+		if len(completion.Choices) > 0 && completion.Choices[0].Message != nil {
+			m.content = completion.Choices[0].Message.Content
+		}
+	}
+	return m, nil
+}
+
+// chatCompletion is the part of a chat completion response the mock fills in or streams
+type chatCompletion struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+	Usage   *chatCompletionUsage   `json:"usage,omitempty"`
+}
+
+type chatCompletionChoice struct {
+	Index        int                  `json:"index"`
+	Message      *chatCompletionDelta `json:"message,omitempty"`
+	Delta        *chatCompletionDelta `json:"delta,omitempty"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+type chatCompletionDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (m *mockUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	data, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(data, &request)
+
+	if request.Stream && m.statusCode == http.StatusOK {
+		m.stream(w, request.Model)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(m.statusCode)
+	if m.fixture != nil {
+		_, _ = w.Write(m.fixture)
+		return
+	}
+
+	stop := "stop"
+	words := len(strings.Fields(m.content))
+	_ = json.NewEncoder(w).Encode(chatCompletion{
+		ID:      "chatcmpl-mock",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+		Choices: []chatCompletionChoice{{
+			Message:      &chatCompletionDelta{Role: "assistant", Content: m.content},
+			FinishReason: &stop,
+		}},
+		Usage: &chatCompletionUsage{CompletionTokens: words, TotalTokens: words},
+	})
+}
+
+// stream sends the content word by word as chat.completion.chunk events followed by [DONE]
+func (m *mockUpstream) stream(w http.ResponseWriter, model string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	created := time.Now().Unix()
+	send := func(delta *chatCompletionDelta, finishReason *string) {
+		data, _ := json.Marshal(chatCompletion{
+			ID:      "chatcmpl-mock",
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []chatCompletionChoice{{Delta: delta, FinishReason: finishReason}},
+		})
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(&chatCompletionDelta{Role: "assistant"}, nil)
+	for i, word := range strings.Fields(m.content) {
+		if i > 0 {
+			word = " " + word
+		}
+		send(&chatCompletionDelta{Content: word}, nil)
+	}
+	stop := "stop"
+	send(&chatCompletionDelta{}, &stop)
+	_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,85 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTestMode_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.TestMode = &TestMode{}
+	config.MirrorResponseFields = []string{"model"}
+
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		t.Errorf("expected the upstream not to be called in test mode")
+	}), config, "test mode")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200 but got %d", recorder.Code)
+	}
+	if recorder.Header().Get("X-OpenAI-Model") != "gpt-4.1" {
+		t.Errorf("expected extraction to still run in test mode")
+	}
+	var completion chatCompletion
+	if err := json.Unmarshal(recorder.Body.Bytes(), &completion); err != nil {
+		t.Fatalf("invalid completion %s: %s", recorder.Body.String(), err)
+	}
+	if completion.Model != "gpt-4.1" || completion.Object != "chat.completion" || completion.Choices[0].Message.Content != defaultMockContent {
+		t.Errorf("unexpected completion %s", recorder.Body.String())
+	}
+}
+
+func TestTestModeStream_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.TestMode = &TestMode{Fixture: "{\"id\": \"fixture\", \"choices\": [{\"message\": {\"role\": \"assistant\", \"content\": \"Hello there\"}}]}"}
+
+	e, err := New(nil, http.NotFoundHandler(), config, "test mode stream")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"stream\": true}")))
+
+	if recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream but got %s", recorder.Header().Get("Content-Type"))
+	}
+	var content string
+	events := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n\n")
+	for _, event := range events[:len(events)-1] {
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %s", event, err)
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Hello there" {
+		t.Errorf("expected the fixture content to be streamed but got %q", content)
+	}
+	if events[len(events)-1] != "data: [DONE]" {
+		t.Errorf("expected the stream to end with [DONE] but got %s", events[len(events)-1])
+	}
+
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+	if recorder.Body.String() != config.TestMode.Fixture {
+		t.Errorf("expected the fixture verbatim but got %s", recorder.Body.String())
+	}
+}
+
+func TestInvalidTestMode_New(t *testing.T) {
+	config := CreateConfig()
+	config.TestMode = &TestMode{Fixture: "{\"choices\": "}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid fixture")
+	}
+}
@@ -0,0 +1,108 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// maxFormValueBytes limits the size of text form fields that are decoded
+const maxFormValueBytes = 4096
+
+// multipartFile describes a file part of a multipart form body
+type multipartFile struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Bytes       *int64 `json:"bytes,omitempty"`
+}
+
+// decodeBody decodes the top-level members of a JSON body, or the form fields of a multipart/form-data body
+func decodeBody(r *http.Request, data []byte, truncated bool) (map[string]json.RawMessage, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && mediaType == "multipart/form-data" {
+		return decodeMultipartMembers(data, truncated, params["boundary"], r.ContentLength)
+	}
+	return decodeMembers(data, truncated)
+}
+
+// decodeMultipartMembers converts the fields of a multipart form into members: text fields become JSON strings and file
+// parts a multipartFile object. The size of a file that continues beyond a truncated prefix is derived from the
+// content length, assuming the file is the last part of the form as sent by the OpenAI SDKs.
+func decodeMultipartMembers(data []byte, truncated bool, boundary string, contentLength int64) (map[string]json.RawMessage, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart body without boundary")
+	}
+
+	members := map[string]json.RawMessage{}
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			if truncated && len(members) > 0 {
+				return members, nil
+			}
+			return members, err
+		}
+
+		if part.FileName() == "" && part.Header.Get("Content-Type") == "" {
+			text, err := io.ReadAll(io.LimitReader(part, maxFormValueBytes))
+			if err != nil {
+				if truncated {
+					return members, nil
+				}
+				return members, err
+			}
+			if raw, err := json.Marshal(strings.TrimSpace(string(text))); err == nil {
+				members[part.FormName()] = raw
+			}
+			continue
+		}
+
+		file := multipartFile{Filename: part.FileName(), ContentType: part.Header.Get("Content-Type")}
+		size, err := io.Copy(io.Discard, part)
+		complete := err == nil
+		if !complete && !truncated {
+			return members, err
+		}
+		if complete {
+			file.Bytes = &size
+		} else if remaining := remainingFileBytes(data, part.FormName(), boundary, contentLength); remaining >= 0 {
+			file.Bytes = &remaining
+		}
+		if raw, err := json.Marshal(file); err == nil {
+			members[part.FormName()] = raw
+		}
+		if !complete {
+			return members, nil
+		}
+	}
+}
+
+// remainingFileBytes estimates the size of the truncated last file part from the content length of the request
+func remainingFileBytes(data []byte, formName string, boundary string, contentLength int64) int64 {
+	if contentLength < 0 {
+		return -1
+	}
+	disposition := bytes.Index(data, []byte("name=\""+formName+"\""))
+	if disposition < 0 {
+		return -1
+	}
+	headerEnd := bytes.Index(data[disposition:], []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return -1
+	}
+	start := int64(disposition + headerEnd + 4)
+	closing := int64(len("\r\n--" + boundary + "--\r\n"))
+	if remaining := contentLength - start - closing; remaining >= 0 {
+		return remaining
+	}
+	return -1
+}
@@ -0,0 +1,126 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func multipartUpload(t *testing.T, fields [][2]string, filename string, content string) (*bytes.Buffer, string) {
+	return multipartForm(t, fields, "file", filename, content)
+}
+
+func multipartForm(t *testing.T, fields [][2]string, fileField string, filename string, content string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if filename != "" {
+		part, err := writer.CreateFormFile(fileField, filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, writer.FormDataContentType()
+}
+
+func TestFileUpload_ServeHTTP(t *testing.T) {
+	content := strings.Repeat("{\"prompt\": \"x\"}\n", 512)
+	tests := []struct {
+		name         string
+		fields       [][2]string
+		filename     string
+		maxBodyBytes int64
+		want         map[string]string
+	}{
+		{
+			name:         "complete",
+			fields:       [][2]string{{"purpose", "fine-tune"}},
+			filename:     "train.jsonl",
+			maxBodyBytes: 1 << 20,
+			want:         map[string]string{"X-OpenAI-File-Purpose": "fine-tune", "X-OpenAI-File-Size": "8192"},
+		},
+		{
+			name:         "truncated file",
+			fields:       [][2]string{{"purpose", "batch"}},
+			filename:     "batch.jsonl",
+			maxBodyBytes: 1024,
+			want:         map[string]string{"X-OpenAI-File-Purpose": "batch", "X-OpenAI-File-Size": "8192"},
+		},
+		{
+			name:         "purpose only",
+			fields:       [][2]string{{"purpose", "vision"}},
+			maxBodyBytes: 1 << 20,
+			want:         map[string]string{"X-OpenAI-File-Purpose": "vision", "X-OpenAI-File-Size": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.MaxBodyBytes = tt.maxBodyBytes
+
+			var got http.Header
+			var forwarded int
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				var body bytes.Buffer
+				_, _ = body.ReadFrom(r.Body)
+				forwarded = body.Len()
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			body, contentType := multipartUpload(t, tt.fields, tt.filename, content)
+			length := body.Len()
+			request := httptest.NewRequest("POST", "/v1/files", body)
+			request.Header.Set("Content-Type", contentType)
+			e.ServeHTTP(httptest.NewRecorder(), request)
+
+			if forwarded != length {
+				t.Errorf("expected %d bytes to be forwarded but got %d", length, forwarded)
+			}
+			if got.Get(ParseFailureHeader) != "" {
+				t.Errorf("not expected parse failure %v", got.Get(ParseFailureHeader))
+			}
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestUploadPart_ServeHTTP(t *testing.T) {
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), CreateConfig(), "upload-part")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	body, contentType := multipartForm(t, nil, "data", "blob", strings.Repeat("x", 4096))
+	request := httptest.NewRequest("POST", "/v1/uploads/upload_abc123/parts", body)
+	request.Header.Set("Content-Type", contentType)
+	e.ServeHTTP(httptest.NewRecorder(), request)
+
+	if got.Get("X-OpenAI-Upload-Part-Size") != "4096" {
+		t.Errorf("expected part size 4096 but got %q", got.Get("X-OpenAI-Upload-Part-Size"))
+	}
+}
@@ -0,0 +1,59 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		stripInvisible bool
+		want           string
+	}{
+		{name: "ascii", value: "gpt-4.1", want: "gpt-4.1"},
+		{name: "composed", value: "jos\u00e9", want: "jos\u00e9"},
+		{name: "decomposed", value: "jose\u0301", want: "jos\u00e9"},
+		{name: "two marks", value: "e\u0302\u0301", want: "\u1ebf"},
+		{name: "hangul", value: "\u1100\u1161\u11a8", want: "\uac01"},
+		{name: "mark without composite", value: "x\u0301", want: "x\u0301"},
+		{name: "invisible kept", value: "gpt\u200b-4.1", want: "gpt\u200b-4.1"},
+		{name: "zero width", value: "gpt\u200b-4.1\ufeff", stripInvisible: true, want: "gpt-4.1"},
+		{name: "bidi", value: "\u202ealice\u202c\u2066", stripInvisible: true, want: "alice"},
+		{name: "invisible between character and mark", value: "e\u200d\u0301", stripInvisible: true, want: "\u00e9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNormalizer(&UnicodeNormalization{StripInvisible: tt.stripInvisible})
+			if got := n.normalize(tt.value); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUnicodeNormalization_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.UnicodeNormalization = &UnicodeNormalization{StripInvisible: true}
+	config.ValueMappings = map[string]map[string]string{"model": {"gpt-4.1": "flagship"}}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "unicode normalization")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt\u200b-4.1\", \"user\": \"jose\u0301\u202e\"}")))
+	if got.Get("X-OpenAI-Model") != "flagship" {
+		t.Errorf("expected the normalized model to be mapped but got %q", got.Get("X-OpenAI-Model"))
+	}
+	if got.Get("X-OpenAI-User") != "jos\u00e9" {
+		t.Errorf("expected the normalized user but got %q", got.Get("X-OpenAI-User"))
+	}
+}
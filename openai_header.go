@@ -2,24 +2,136 @@
 package traefik_openai_header
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"regexp"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const ParseFailureHeader = "X-OpenAI-Parse-Failure"
 const UserAgentHeader = "X-OpenAI-User-Agent"
+const SkippedHeader = "X-OpenAI-Skipped"
+const TagsHeader = "X-OpenAI-Tags"
+const RequestBytesHeader = "X-OpenAI-Request-Bytes"
+
+// Header policies controlling how extracted values are written to headers already present on the request
+const (
+	HeaderPolicyOverwrite = "overwrite"
+	HeaderPolicyPreserve  = "preserve"
+	HeaderPolicyAppend    = "append"
+)
+
+// Failure modes controlling what happens to a request when the middleware itself fails
+const (
+	FailureModeOpen   = "open"
+	FailureModeClosed = "closed"
+)
 
 // Config the plugin configuration.
 type Config struct {
-	RequestFields          map[string]interface{} `json:"requestFields"`
-	RequestURIRegex        string                 `json:"requestUriRegex"`
-	ChatCompletionUriRegex string                 `json:"chatCompletionUriRegex"`
-	BatchUriRegex          string                 `json:"batchUriRegex"`
+	RequestFields                 map[string]interface{}       `json:"requestFields"`
+	RequestFieldsCsv              string                       `json:"requestFieldsCsv"`
+	HeaderNameTemplate            string                       `json:"headerNameTemplate"`
+	HeaderNameProvider            string                       `json:"headerNameProvider"`
+	AutoFields                    *AutoFields                  `json:"autoFields"`
+	NeverEmit                     []string                     `json:"neverEmit"`
+	UnicodeNormalization          *UnicodeNormalization        `json:"unicodeNormalization"`
+	RequestURIRegex               string                       `json:"requestUriRegex"`
+	ChatCompletionUriRegex        string                       `json:"chatCompletionUriRegex"`
+	BatchUriRegex                 string                       `json:"batchUriRegex"`
+	AnthropicMessagesUriRegex     string                       `json:"anthropicMessagesUriRegex"`
+	AnthropicCountTokensUriRegex  string                       `json:"anthropicCountTokensUriRegex"`
+	GeminiGenerateContentUriRegex string                       `json:"geminiGenerateContentUriRegex"`
+	FilesUriRegex                 string                       `json:"filesUriRegex"`
+	UploadsUriRegex               string                       `json:"uploadsUriRegex"`
+	UploadPartsUriRegex           string                       `json:"uploadPartsUriRegex"`
+	EvalsUriRegex                 string                       `json:"evalsUriRegex"`
+	EvalRunsUriRegex              string                       `json:"evalRunsUriRegex"`
+	CompletionsUriRegex           string                       `json:"completionsUriRegex"`
+	Endpoints                     []Endpoint                   `json:"endpoints"`
+	MirrorResponseFields          []string                     `json:"mirrorResponseFields"`
+	ValueMappings                 map[string]map[string]string `json:"valueMappings"`
+	ValueMappingsCsv              string                       `json:"valueMappingsCsv"`
+	ValueMasks                    map[string][]ValueMask       `json:"valueMasks"`
+	HashFields                    []string                     `json:"hashFields"`
+	StickyFields                  []string                     `json:"stickyFields"`
+	Canary                        *Canary                      `json:"canary"`
+	FallbackModels                map[string]string            `json:"fallbackModels"`
+	FallbackModelsCsv             string                       `json:"fallbackModelsCsv"`
+	ModelBackends                 map[string]string            `json:"modelBackends"`
+	ModelBackendsCsv              string                       `json:"modelBackendsCsv"`
+	DefaultBackend                string                       `json:"defaultBackend"`
+	Backoff                       *Backoff                     `json:"backoff"`
+	Deadline                      *Deadline                    `json:"deadline"`
+	Shadow                        *Shadow                      `json:"shadow"`
+	Capture                       *Capture                     `json:"capture"`
+	PIIRedaction                  *PIIRedaction                `json:"piiRedaction"`
+	PIIDetection                  *PIIDetection                `json:"piiDetection"`
+	InjectionDetection            *InjectionDetection          `json:"injectionDetection"`
+	BannedContent                 *BannedContent               `json:"bannedContent"`
+	ChoiceLimit                   *ChoiceLimit                 `json:"choiceLimit"`
+	LanguageDetection             bool                         `json:"languageDetection"`
+	CostCenter                    *CostCenter                  `json:"costCenter"`
+	StaticHeaders                 map[string]string            `json:"staticHeaders"`
+	StaticHeadersCsv              string                       `json:"staticHeadersCsv"`
+	HeaderConditions              map[string][]Condition       `json:"headerConditions"`
+	Rules                         []Rule                       `json:"rules"`
+	ResponseCache                 *ResponseCache               `json:"responseCache"`
+	Redis                         *RedisConfig                 `json:"redis"`
+	Idempotency                   *Idempotency                 `json:"idempotency"`
+	Stats                         *Stats                       `json:"stats"`
+	ConfigFile                    string                       `json:"configFile"`
+	ConfigFrom                    string                       `json:"configFrom"`
+	ConfigFilePollInterval        string                       `json:"configFilePollInterval"`
+	TenantHeader                  string                       `json:"tenantHeader"`
+	Tenants                       map[string]TenantConfig      `json:"tenants"`
+	MaxBodyBytes                  int64                        `json:"maxBodyBytes"`
+	JSONLimits                    *JSONLimits                  `json:"jsonLimits"`
+	BypassAboveBytes              int64                        `json:"bypassAboveBytes"`
+	MarkSkipped                   bool                         `json:"markSkipped"`
+	ExtractionTimeout             string                       `json:"extractionTimeout"`
+	BodyReadTimeout               string                       `json:"bodyReadTimeout"`
+	BodyReadTimeoutAction         string                       `json:"bodyReadTimeoutAction"`
+	ExpectContinue                string                       `json:"expectContinue"`
+	AuthScheme                    string                       `json:"authScheme"`
+	HeaderPolicy                  string                       `json:"headerPolicy"`
+	CombinedHeader                string                       `json:"combinedHeader"`
+	BaggageFields                 map[string]string            `json:"baggageFields"`
+	BaggageFieldsCsv              string                       `json:"baggageFieldsCsv"`
+	BaggageHashFields             []string                     `json:"baggageHashFields"`
+	FloatPrecision                int                          `json:"floatPrecision"`
+	StripTrailingZeros            bool                         `json:"stripTrailingZeros"`
+	RawNumbers                    bool                         `json:"rawNumbers"`
+	AllowedEndpoints              []string                     `json:"allowedEndpoints"`
+	DeniedEndpoints               []string                     `json:"deniedEndpoints"`
+	ReadOnly                      bool                         `json:"readOnly"`
+	FailureMode                   string                       `json:"failureMode"`
+	FailureStatusCode             int                          `json:"failureStatusCode"`
+	RejectionTemplates            map[string]RejectionTemplate `json:"rejectionTemplates"`
+	RejectionStatusCodes          map[string]int               `json:"rejectionStatusCodes"`
+	RejectionStatusCodesCsv       string                       `json:"rejectionStatusCodesCsv"`
+	TestMode                      *TestMode                    `json:"testMode"`
+	Chaos                         *Chaos                       `json:"chaos"`
+	Prices                        map[string]ModelPrice        `json:"prices"`
+	PriceCatalog                  *PriceCatalog                `json:"priceCatalog"`
+	Budget                        *Budget                      `json:"budget"`
+	DailyRequests                 *DailyRequests               `json:"dailyRequests"`
+	TokenRateLimit                *TokenRateLimit              `json:"tokenRateLimit"`
+	RoutingHint                   *RoutingHint                 `json:"routingHint"`
+	UpstreamRequestID             *UpstreamRequestID           `json:"upstreamRequestId"`
+	ClientIdentity                *ClientIdentity              `json:"clientIdentity"`
+	OpenAIAccount                 *OpenAIAccount               `json:"openaiAccount"`
+	ResponsesTranslation          *ResponsesTranslation        `json:"responsesTranslation"`
+	AnthropicTranslation          *AnthropicTranslation        `json:"anthropicTranslation"`
+	UsageHeaders                  bool                         `json:"usageHeaders"`
+	ThroughputTrailer             bool                         `json:"throughputTrailer"`
+	LogSampling                   *LogSampling                 `json:"logSampling"`
+	OTLP                          *OTLP                        `json:"otlp"`
+	Syslog                        *Syslog                      `json:"syslog"`
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -30,36 +142,217 @@ func CreateConfig() *Config {
 	fields["user"] = "X-OpenAI-User"
 	fields["temperature"] = "X-OpenAI-Temperature"
 	fields["top_p"] = "X-OpenAI-Top-P"
+	fields["top_k"] = "X-OpenAI-Top-K"
+	fields["min_p"] = "X-OpenAI-Min-P"
+	fields["repetition_penalty"] = "X-OpenAI-Repetition-Penalty"
 	fields["max_completion_tokens"] = "X-OpenAI-Max-Completion-Tokens"
+	fields["max_tokens"] = "X-OpenAI-Max-Tokens"
 	fields["presence_penalty"] = "X-OpenAI-Presence-Penalty"
 	fields["logprobs"] = "X-OpenAI-Logprobs"
 	fields["top_logprobs"] = "X-OpenAI-Top-Logprobs"
 	fields["tool_choice"] = "X-OpenAI-Tool-Choice"
 	fields["stream"] = "X-OpenAI-Stream"
+	fields["echo"] = "X-OpenAI-Echo"
+	fields["suffix"] = "X-OpenAI-Suffix"
 	fields["completion_window"] = "X-OpenAI-Completion-Window"
 	fields["oai_endpoint"] = "X-OpenAI-Endpoint"
+	fields["thinking_type"] = "X-OpenAI-Thinking-Type"
+	fields["thinking_budget_tokens"] = "X-OpenAI-Thinking-Budget-Tokens"
+	fields["operation"] = "X-OpenAI-Operation"
+	fields["purpose"] = "X-OpenAI-File-Purpose"
+	fields["file_size"] = "X-OpenAI-File-Size"
+	fields["filename"] = "X-OpenAI-Filename"
+	fields["bytes"] = "X-OpenAI-Upload-Bytes"
+	fields["mime_type"] = "X-OpenAI-Mime-Type"
+	fields["part_size"] = "X-OpenAI-Upload-Part-Size"
+	fields["data_source_type"] = "X-OpenAI-Eval-Data-Source"
+	fields["instruction_role"] = "X-OpenAI-Instruction-Role"
+	fields["audio_input"] = "X-OpenAI-Audio-Input"
+	fields["audio_format"] = "X-OpenAI-Audio-Format"
+	fields["audio_seconds"] = "X-OpenAI-Audio-Seconds"
+	fields["file_input"] = "X-OpenAI-File-Input"
+	fields["image_tokens"] = "X-OpenAI-Estimated-Image-Tokens"
+	fields["prompt_cache_key"] = "X-OpenAI-Prompt-Cache-Key"
+	fields["safety_identifier"] = "X-OpenAI-Safety-Identifier"
+	fields["cache_key"] = "X-OpenAI-Cache-Key"
+	fields["pii_detected"] = "X-OpenAI-PII-Detected"
+	fields["injection_suspect"] = "X-OpenAI-Injection-Suspect"
+	fields["banned_content"] = "X-OpenAI-Banned-Content"
+	fields["prompt_lang"] = "X-OpenAI-Prompt-Lang"
+	fields["sticky_key"] = "X-OpenAI-Sticky-Key"
+	fields["canary"] = "X-OpenAI-Canary"
+	fields["fallback_model"] = "X-OpenAI-Fallback-Model"
+	fields["backend"] = BackendHeader
+	fields["deprecated_params"] = "X-OpenAI-Deprecated-Params"
 	return &Config{
-		RequestFields:          fields,
-		RequestURIRegex:        "/v1/chat/completions",
-		ChatCompletionUriRegex: "/v1/chat/completions",
-		BatchUriRegex:          "/v1/batches",
+		RequestFields:                 fields,
+		RequestURIRegex:               "/v1/chat/completions",
+		ChatCompletionUriRegex:        "/v1/chat/completions",
+		BatchUriRegex:                 "/v1/batches",
+		AnthropicMessagesUriRegex:     `/v1/messages(\?|$)`,
+		AnthropicCountTokensUriRegex:  "/v1/messages/count_tokens",
+		GeminiGenerateContentUriRegex: "/models/[^/]+:(stream)?[gG]enerateContent",
+		FilesUriRegex:                 `/v1/files(\?|$)`,
+		UploadsUriRegex:               `/v1/uploads(\?|$)`,
+		UploadPartsUriRegex:           "/v1/uploads/[^/]+/parts",
+		EvalsUriRegex:                 `/v1/evals(\?|$)`,
+		EvalRunsUriRegex:              `/v1/evals/[^/]+/runs(\?|$)`,
+		CompletionsUriRegex:           `/v1/completions(\?|$)`,
+		MirrorResponseFields:          []string{},
+		ConfigFilePollInterval:        "30s",
+		MaxBodyBytes:                  1 << 20,
+		HeaderPolicy:                  HeaderPolicyOverwrite,
+		FailureMode:                   FailureModeOpen,
+		FailureStatusCode:             http.StatusServiceUnavailable,
+		BaggageFields:                 map[string]string{},
+		BaggageHashFields:             []string{},
 	}
 }
 
 // Handler contains the config for the plugin
 type Handler struct {
-	name                 string
-	next                 http.Handler
-	requestFields        map[string]interface{}
-	requestURIRegex      string
-	batchRequestURIRegex string
+	name                  string
+	next                  http.Handler
+	config                *Config
+	mapper                *headerMapper
+	endpoints             []endpointExtractor
+	policy                *endpointPolicy
+	readOnly              bool
+	failClosed            bool
+	failureStatusCode     int
+	rejectionTemplates    map[string]RejectionTemplate
+	rejectionStatusCodes  map[string]int
+	costCenter            *CostCenter
+	staticHeaders         map[string]string
+	rules                 []rule
+	piiDetector           *patternDetector
+	injectionDetector     *patternDetector
+	bannedContent         *bannedContent
+	choiceLimit           *choiceLimit
+	languageDetection     bool
+	tenantHeader          string
+	tenants               map[string]*Handler
+	tenantName            string
+	statsPath             string
+	stickyFields          []string
+	canary                *Canary
+	fallbackModels        map[string]string
+	modelBackends         map[string]string
+	defaultBackend        string
+	backoff               *backoff
+	deadline              *deadline
+	shadow                *shadow
+	capture               *capture
+	chaos                 *chaos
+	budget                *budget
+	dailyRequests         *dailyRequests
+	tokenRateLimit        *tokenRateLimit
+	routingHint           *routingHint
+	upstreamRequestID     *upstreamRequestID
+	clientIdentity        *clientIdentity
+	openAIAccount         []openAIAccountHeader
+	responsesTranslation  *responsesTranslation
+	anthropicTranslation  *anthropicTranslation
+	usageHeaders          bool
+	throughputTrailer     bool
+	logSampling           *logSampling
+	otlp                  *otlpExporter
+	syslog                *syslogSink
+	responseCache         *responseCache
+	deduplicator          *deduplicator
+	metrics               *metrics
+	mirrorResponseFields  []string
+	maxBodyBytes          int64
+	jsonLimits            *jsonLimits
+	extractionTimeout     time.Duration
+	bodyReadTimeout       time.Duration
+	bodyReadTimeoutAction string
+	expectContinue        string
+	authScheme            string
+	bypassAboveBytes      int64
+	markSkipped           bool
+	headerPolicy          string
+	baggageFields         map[string]string
+	baggageHashFields     map[string]bool
+	mu                    sync.RWMutex
 }
 
 // New Creates a new HTTP Handler to translate the openai model into headers
-func New(_ context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
 	if config == nil {
 		config = CreateConfig()
 	}
+	config, err := loadConfigFrom(config)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := config
+	config, err = expandConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyCsvConfig(config); err != nil {
+		return nil, err
+	}
+
+	switch config.HeaderPolicy {
+	case "":
+		config.HeaderPolicy = HeaderPolicyOverwrite
+	case HeaderPolicyOverwrite, HeaderPolicyPreserve, HeaderPolicyAppend:
+	default:
+		return nil, fmt.Errorf("invalid headerPolicy %q", config.HeaderPolicy)
+	}
+
+	switch config.FailureMode {
+	case "":
+		config.FailureMode = FailureModeOpen
+	case FailureModeOpen, FailureModeClosed:
+	default:
+		return nil, fmt.Errorf("invalid failureMode %q", config.FailureMode)
+	}
+	if config.FailureStatusCode == 0 {
+		config.FailureStatusCode = http.StatusServiceUnavailable
+	}
+	if config.FailureStatusCode < 500 || config.FailureStatusCode > 599 {
+		return nil, fmt.Errorf("invalid failureStatusCode %d", config.FailureStatusCode)
+	}
+	var extractionTimeout time.Duration
+	if config.ExtractionTimeout != "" {
+		if extractionTimeout, err = time.ParseDuration(config.ExtractionTimeout); err != nil || extractionTimeout <= 0 {
+			return nil, fmt.Errorf("invalid extractionTimeout %q", config.ExtractionTimeout)
+		}
+	}
+	var bodyReadTimeout time.Duration
+	if config.BodyReadTimeout != "" {
+		if bodyReadTimeout, err = time.ParseDuration(config.BodyReadTimeout); err != nil || bodyReadTimeout <= 0 {
+			return nil, fmt.Errorf("invalid bodyReadTimeout %q", config.BodyReadTimeout)
+		}
+	}
+	switch config.BodyReadTimeoutAction {
+	case "":
+		config.BodyReadTimeoutAction = BodyReadTimeoutActionBypass
+	case BodyReadTimeoutActionBypass, BodyReadTimeoutActionReject:
+	default:
+		return nil, fmt.Errorf("invalid bodyReadTimeoutAction %q", config.BodyReadTimeoutAction)
+	}
+	switch config.ExpectContinue {
+	case "":
+		config.ExpectContinue = ExpectContinueExtract
+	case ExpectContinueExtract, ExpectContinueBypass:
+	default:
+		return nil, fmt.Errorf("invalid expectContinue %q", config.ExpectContinue)
+	}
+	switch config.AuthScheme {
+	case "", AuthSchemeBearer, AuthSchemeAPIKey:
+	default:
+		return nil, fmt.Errorf("invalid authScheme %q", config.AuthScheme)
+	}
+	for code, status := range config.RejectionStatusCodes {
+		if status < 400 || status > 599 {
+			return nil, fmt.Errorf("invalid rejectionStatusCodes status %d for %s", status, code)
+		}
+	}
 
 	chatCompletionUri := ""
 	if config.RequestURIRegex != "" {
@@ -68,217 +361,628 @@ func New(_ context.Context, next http.Handler, config *Config, name string) (htt
 		chatCompletionUri = config.ChatCompletionUriRegex
 	}
 
-	return &Handler{
-		name:                 name,
-		requestFields:        config.RequestFields,
-		requestURIRegex:      chatCompletionUri,
-		batchRequestURIRegex: config.BatchUriRegex,
-		next:                 next,
-	}, nil
-}
+	endpoints, err := compileEndpoints(map[EndpointKind]string{
+		ChatCompletionEndpoint:        chatCompletionUri,
+		BatchEndpoint:                 config.BatchUriRegex,
+		AnthropicMessagesEndpoint:     config.AnthropicMessagesUriRegex,
+		AnthropicCountTokensEndpoint:  config.AnthropicCountTokensUriRegex,
+		GeminiGenerateContentEndpoint: config.GeminiGenerateContentUriRegex,
+		FileUploadEndpoint:            config.FilesUriRegex,
+		UploadEndpoint:                config.UploadsUriRegex,
+		UploadPartEndpoint:            config.UploadPartsUriRegex,
+		EvalEndpoint:                  config.EvalsUriRegex,
+		EvalRunEndpoint:               config.EvalRunsUriRegex,
+		CompletionEndpoint:            config.CompletionsUriRegex,
+	}, config.Endpoints)
+	if err != nil {
+		return nil, err
+	}
 
-type audio struct {
-	Format string `json:"format,omitempty"`
-	Voice  string `json:"voice,omitempty"`
-}
+	mapper, err := newHeaderMapper(config)
+	if err != nil {
+		return nil, err
+	}
 
-type responseFormat struct {
-	Type string `json:"type,omitempty"`
-}
+	policy, err := newEndpointPolicy(config.AllowedEndpoints, config.DeniedEndpoints)
+	if err != nil {
+		return nil, err
+	}
 
-type streamOptions struct {
-	IncludeUsage *bool `json:"include_usage,omitempty"`
-}
+	rules, err := compileRules(config.Rules)
+	if err != nil {
+		return nil, err
+	}
 
-type approximate struct {
-	City     string `json:"city,omitempty"`
-	Country  string `json:"country,omitempty"`
-	Region   string `json:"region,omitempty"`
-	TimeZone string `json:"timezone,omitempty"`
-}
+	piiDetector, err := newPIIDetector(config.PIIDetection)
+	if err != nil {
+		return nil, err
+	}
 
-type userLocation struct {
-	Approximate approximate `json:"approximate,omitempty"`
-}
+	injectionDetector, err := newInjectionDetector(config.InjectionDetection)
+	if err != nil {
+		return nil, err
+	}
 
-type webSearchOptions struct {
-	SearchContextSize string       `json:"search_context_size,omitempty"`
-	UserLocation      userLocation `json:"user_location,omitempty"`
-}
+	bannedContent, err := newBannedContent(config.BannedContent)
+	if err != nil {
+		return nil, err
+	}
 
-type chatCompletionRequest struct {
-	Model               string            `json:"model"`
-	Messages            json.RawMessage   `json:"messages,omitempty"`
-	Audio               audio             `json:"audio,omitempty"`
-	FrequencyPenalty    *float32          `json:"frequency_penalty,omitempty"`
-	MaxCompletionTokens *float32          `json:"max_completion_tokens,omitempty"`
-	Metadata            map[string]string `json:"metadata,omitempty"`
-	Modalities          []string          `json:"modalities,omitempty"`
-	N                   *int              `json:"n,omitempty"`
-	PresencePenalty     *float32          `json:"presence_penalty,omitempty"`
-	ReasoningEffort     string            `json:"reasoning_effort,omitempty"`
-	ResponseFormat      responseFormat    `json:"response_format,omitempty"`
-	Seed                *int              `json:"seed,omitempty"`
-	ServiceTier         string            `json:"service_tier,omitempty"`
-	Store               *bool             `json:"store,omitempty"`
-	Stream              *bool             `json:"stream,omitempty"`
-	StreamOptions       streamOptions     `json:"stream_options,omitempty"`
-	Temperature         *float32          `json:"temperature,omitempty"`
-	TopP                *float32          `json:"top_p,omitempty"`
-	User                string            `json:"user,omitempty"`
-	WebSearchOptions    webSearchOptions  `json:"web_search_options,omitempty"`
-	Logprobs            *int              `json:"logprobs"`
-	TopLogprobs         *int              `json:"top_logprobs"`
-	ToolChoice          interface{}       `json:"tool_choice"`
-}
+	choiceLimit, err := newChoiceLimit(config.ChoiceLimit)
+	if err != nil {
+		return nil, err
+	}
 
-type chatCompletionModelOnlyRequest struct {
-	Model string `json:"model"`
-}
+	canary, err := newCanary(config.Canary)
+	if err != nil {
+		return nil, err
+	}
 
-type batchRequest struct {
-	CompletionWindow string `json:"completion_window"`
-	Endpoint         string `json:"endpoint"`
-}
+	jsonLimits, err := newJSONLimits(config.JSONLimits)
+	if err != nil {
+		return nil, err
+	}
 
-func (e *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	isChatCompletionRequest, err := regexp.MatchString(e.requestURIRegex, r.RequestURI)
+	backoff, err := newBackoff(config.Backoff)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, err := newDeadline(config.Deadline)
 	if err != nil {
-		fmt.Println("Error while matching RequestURI", err.Error())
+		return nil, err
 	}
 
-	isBatchRequest, err := regexp.MatchString(e.batchRequestURIRegex, r.RequestURI)
+	chaos, err := newChaos(config.Chaos)
 	if err != nil {
-		fmt.Println("Error while matching BatchRequestURI", err.Error())
+		return nil, err
 	}
 
-	if (isChatCompletionRequest || isBatchRequest) && r.Method == "POST" {
-		var body bytes.Buffer
-		tee := io.TeeReader(r.Body, &body)
+	prices, err := newPrices(config.Prices, config.PriceCatalog)
+	if err != nil {
+		return nil, err
+	}
+	budget, err := newBudget(config.Budget, prices, config.Redis)
+	if err != nil {
+		return nil, err
+	}
+	dailyRequests, err := newDailyRequests(config.DailyRequests, config.Redis)
+	if err != nil {
+		return nil, err
+	}
+	tokenRateLimit, err := newTokenRateLimit(config.TokenRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	routingHint, err := newRoutingHint(config.RoutingHint)
+	if err != nil {
+		return nil, err
+	}
 
-		data, err := io.ReadAll(tee)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	cache, err := newResponseCache(config.ResponseCache, config.Redis)
+	if err != nil {
+		return nil, err
+	}
+	deduplicator, err := newDeduplicator(config.Idempotency)
+	if err != nil {
+		return nil, err
+	}
+	if config.ReadOnly {
+		cache = nil
+		deduplicator = nil
+	}
+
+	upstreamRequestID, err := newUpstreamRequestID(config.UpstreamRequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientIdentity, err := newClientIdentity(config.ClientIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	responsesTranslation, err := newResponsesTranslation(config.ResponsesTranslation)
+	if err != nil {
+		return nil, err
+	}
+
+	anthropicTranslation, err := newAnthropicTranslation(config.AnthropicTranslation)
+	if err != nil {
+		return nil, err
+	}
+	if responsesTranslation != nil && anthropicTranslation != nil {
+		return nil, errors.New("responsesTranslation and anthropicTranslation cannot be combined")
+	}
+
+	logSampling, err := newLogSampling(config.LogSampling, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ThroughputTrailer && !config.UsageHeaders {
+		return nil, errors.New("throughputTrailer requires usageHeaders")
+	}
+
+	statsPath := ""
+	if config.Stats != nil && config.Stats.Address == "" {
+		statsPath = config.Stats.Path
+		if statsPath == "" {
+			return nil, errors.New("stats requires a path or an address")
 		}
+	}
 
-		if len(data) < 1 {
-			r.Header.Set(ParseFailureHeader, "empty body")
+	if config.TestMode != nil {
+		if next, err = newMockUpstream(config.TestMode); err != nil {
+			return nil, err
 		}
+	}
 
-		if len(data) > 0 && len(e.requestFields) > 0 && isChatCompletionRequest {
-			e.handleChatCompletionRequest(data, r)
+	handler := &Handler{
+		name:                  name,
+		config:                config,
+		mapper:                mapper,
+		endpoints:             endpoints,
+		policy:                policy,
+		readOnly:              config.ReadOnly,
+		failClosed:            config.FailureMode == FailureModeClosed && !config.ReadOnly,
+		failureStatusCode:     config.FailureStatusCode,
+		rejectionTemplates:    config.RejectionTemplates,
+		rejectionStatusCodes:  config.RejectionStatusCodes,
+		costCenter:            config.CostCenter,
+		staticHeaders:         config.StaticHeaders,
+		rules:                 rules,
+		piiDetector:           piiDetector,
+		injectionDetector:     injectionDetector,
+		bannedContent:         bannedContent,
+		choiceLimit:           choiceLimit,
+		languageDetection:     config.LanguageDetection,
+		responseCache:         cache,
+		deduplicator:          deduplicator,
+		metrics:               newMetrics(),
+		mirrorResponseFields:  config.MirrorResponseFields,
+		maxBodyBytes:          config.MaxBodyBytes,
+		jsonLimits:            jsonLimits,
+		extractionTimeout:     extractionTimeout,
+		bodyReadTimeout:       bodyReadTimeout,
+		bodyReadTimeoutAction: config.BodyReadTimeoutAction,
+		expectContinue:        config.ExpectContinue,
+		authScheme:            config.AuthScheme,
+		bypassAboveBytes:      config.BypassAboveBytes,
+		markSkipped:           config.MarkSkipped,
+		headerPolicy:          config.HeaderPolicy,
+		baggageFields:         config.BaggageFields,
+		baggageHashFields:     toSet(config.BaggageHashFields),
+		tenantHeader:          config.TenantHeader,
+		statsPath:             statsPath,
+		stickyFields:          config.StickyFields,
+		canary:                canary,
+		fallbackModels:        config.FallbackModels,
+		modelBackends:         config.ModelBackends,
+		defaultBackend:        config.DefaultBackend,
+		backoff:               backoff,
+		deadline:              deadline,
+		chaos:                 chaos,
+		budget:                budget,
+		dailyRequests:         dailyRequests,
+		tokenRateLimit:        tokenRateLimit,
+		routingHint:           routingHint,
+		upstreamRequestID:     upstreamRequestID,
+		clientIdentity:        clientIdentity,
+		openAIAccount:         newOpenAIAccount(config.OpenAIAccount),
+		responsesTranslation:  responsesTranslation,
+		anthropicTranslation:  anthropicTranslation,
+		usageHeaders:          config.UsageHeaders,
+		throughputTrailer:     config.ThroughputTrailer,
+		logSampling:           logSampling,
+		next:                  next,
+	}
+
+	if handler.shadow, err = newShadow(ctx, config.Shadow, handler.metrics); err != nil {
+		return nil, err
+	}
+	if handler.capture, err = newCapture(ctx, config.Capture, handler.metrics); err != nil {
+		return nil, err
+	}
+	if handler.otlp, err = newOTLPExporter(ctx, config.OTLP, handler.metrics); err != nil {
+		return nil, err
+	}
+	if config.Syslog != nil && config.LogSampling == nil {
+		return nil, errors.New("syslog requires logSampling")
+	}
+	if handler.syslog, err = newSyslogSink(ctx, config.Syslog, handler.metrics); err != nil {
+		return nil, err
+	}
+	if err := handler.watchPriceCatalog(ctx, prices); err != nil {
+		return nil, err
+	}
+	if err := handler.newTenantHandlers(ctx, raw); err != nil {
+		return nil, err
+	}
+	if err := handler.startStatsListener(ctx, config.Stats); err != nil {
+		return nil, err
+	}
+
+	if config.ConfigFile != "" {
+		if err := handler.watchConfigFile(ctx, config.ConfigFile, config.ConfigFilePollInterval); err != nil {
+			return nil, err
 		}
+	}
 
-		if len(data) > 0 && len(e.requestFields) > 0 && isBatchRequest {
-			e.handleBatchRequest(data, r)
+	return handler, nil
+}
+
+func (e *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if e.statsPath != "" && r.URL.Path == e.statsPath {
+		e.serveStats(w, r)
+		return
+	}
+
+	if tenant := e.tenant(r); tenant != nil {
+		tenant.ServeHTTP(w, r)
+		return
+	}
+
+	var log *logWriter
+	if e.logSampling != nil {
+		log = newLogWriter(w, r)
+		defer e.writeLog(log)
+		w = log
+	}
+
+	kinds := e.matchEndpoints(r)
+	if policy, _ := e.policies(); !e.readOnly && !policy.permits(kinds, r.URL.Path) {
+		e.rejectEndpoint(w, r)
+		return
+	}
+
+	if e.openAIAccount != nil && e.enforceOpenAIAccount(w, r) {
+		return
+	}
+
+	if e.authScheme != "" && !e.readOnly {
+		e.normalizeAuthScheme(r)
+	}
+
+	if len(kinds) > 0 && r.Method == "POST" {
+		start := time.Now()
+		e.metrics.inc("requests_matched_total")
+		log.match(kinds)
+		if e.backoff != nil {
+			w = newBackoffWriter(w, e.backoff)
+		}
+		if e.upstreamRequestID != nil {
+			w = e.copyUpstreamRequestID(w)
+		}
+		mapper, mirrorResponseFields := e.fieldMappings()
+		e.clearBackend(r, mapper)
+
+		e.setRequestBytes(r, r.ContentLength)
+
+		var values map[string]string
+		var scanned bool
+		if e.bypassAboveBytes > 0 && r.ContentLength > e.bypassAboveBytes {
+			e.bypassLargeBody(r)
+		} else if e.expectContinue == ExpectContinueBypass && expectsContinue(r) {
+			e.bypassExpectContinue(r)
+		} else {
+			var err error
+			values, scanned, err = e.extractBody(r, mapper, kinds)
+			log.extracted(values)
+			switch {
+			case errors.Is(err, context.Canceled):
+				// the client is gone, there is nobody to answer
+				return
+			case errors.Is(err, errBodyReadTimeout):
+				if e.handleSlowBody(w, r) {
+					return
+				}
+			case errors.Is(err, errBodyTooLarge):
+				e.metrics.inc("unknown_length_bypassed_total")
+				e.bypassLargeBody(r)
+			case err != nil:
+				if e.fail(w, err) || e.enforceUnscannedBannedContent(w, r, kinds) {
+					return
+				}
+				e.setCostCenter(r, nil)
+				e.next.ServeHTTP(w, r)
+				return
+			default:
+				if model := values["model"]; model != "" {
+					e.metrics.incLabel("requests_by_model", model)
+				}
+				if e.enforceBannedContent(w, r, values) {
+					return
+				}
+				if e.choiceLimit != nil && e.limitChoices(w, r, kinds, values) {
+					return
+				}
+				if e.applyRules(w, r, mapper, values) {
+					return
+				}
+			}
+		}
+
+		if !scanned && e.enforceUnscannedBannedContent(w, r, kinds) {
+			return
+		}
+
+		e.appendBaggage(r, mapper, values)
+
+		for name, value := range e.staticHeaders {
+			e.setHeader(r.Header, name, value)
+		}
+
+		if e.clientIdentity != nil {
+			e.setClientIdentity(r, values)
 		}
 
 		if len(r.Header.Get("User-Agent")) > 0 {
-			r.Header.Set(UserAgentHeader, r.Header.Get("User-Agent"))
+			e.setHeader(r.Header, UserAgentHeader, r.Header.Get("User-Agent"))
 		}
 
-		r.Body = io.NopCloser(bytes.NewReader(data))
+		if e.deadline != nil {
+			var release func()
+			r, release = e.setDeadline(r, values)
+			defer release()
+		}
+
+		mirrorResponseHeaders(w, r, mapper, mirrorResponseFields)
+		e.mirrorShadow(r, mapper, kinds, values)
+		e.captureRequest(r, mapper, kinds, values)
+
+		quotas := &quotaHeaders{header: w.Header()}
+		if e.dailyRequests != nil && e.countDailyRequests(w, r, quotas) {
+			return
+		}
+		if e.tokenRateLimit != nil && e.limitTokenRate(w, r, values, quotas) {
+			return
+		}
+
+		if values["model"] != "" {
+			latency := newLatencyWriter(w, start)
+			defer e.observeLatency(latency, kinds, values)
+			w = latency
+		}
+		if e.budget != nil || e.usageHeaders {
+			// the usage is read from the response, which an encoded body would hide
+			r.Header.Del("Accept-Encoding")
+		}
+		if e.budget != nil {
+			tenant := e.budgetTenant(r)
+			if e.enforceBudget(w, r, tenant, quotas) {
+				return
+			}
+			meter := newUsageWriter(w)
+			defer e.chargeBudget(r, tenant, values, meter)
+			w = meter
+		}
+		if e.usageHeaders {
+			hold := newHoldWriter(w, r, e.streamTrailers())
+			meter := newUsageWriter(hold)
+			defer e.setUsageHeaders(hold, meter, values)
+			w = meter
+		}
+
+		var injected bool
+		if w, injected = e.injectChaos(w, r, values); injected {
+			return
+		}
+		if e.routingHint != nil {
+			w = e.hintRouting(w, r, values)
+		}
+
+		if e.responsesTranslation != nil && !e.readOnly {
+			var translation *translationWriter
+			if w, translation = e.translateRequest(w, r, kinds, values); translation != nil {
+				defer e.finishTranslation(translation)
+			}
+		}
+		if e.anthropicTranslation != nil && !e.readOnly {
+			var translation *translationWriter
+			var rejected bool
+			if w, translation, rejected = e.translateToAnthropic(w, r, kinds); rejected {
+				return
+			}
+			if translation != nil {
+				defer e.finishTranslation(translation)
+			}
+		}
+
+		next := e.next
+		if e.responseCache != nil {
+			if key, ok := e.responseCache.key(r, kinds, values); ok {
+				next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					e.serveCached(w, r, key)
+				})
+			}
+		}
+		if e.deduplicator != nil {
+			if key, ok := e.deduplicator.key(r, values); ok {
+				e.serveDeduplicated(w, r, key, next)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+		return
 	}
 
 	e.next.ServeHTTP(w, r)
 }
 
-func (e *Handler) handleChatCompletionRequest(data []byte, r *http.Request) {
-	request := chatCompletionRequest{}
-	modelField := fmt.Sprintf("%v", e.requestFields["model"])
-	if err := json.Unmarshal(data, &request); err != nil {
-		r.Header.Set(ParseFailureHeader, err.Error())
-		fmt.Println("Unable to unmarshal", err.Error())
-		modelOnlyRequest := chatCompletionModelOnlyRequest{}
-		err = json.Unmarshal(data, &modelOnlyRequest)
-		if err != nil || len(modelField) < 1 {
-			r.Header.Set(ParseFailureHeader, "Unknown model")
-		} else {
-			r.Header.Set(modelField, request.Model)
-		}
-	} else {
-		if len(modelField) < 1 {
-			r.Header.Set(ParseFailureHeader, "No model field configuration")
-		} else {
-			r.Header.Set(modelField, request.Model)
-		}
+// setRequestBytes sets the size of the request body, or removes the header when the size is not known
+func (e *Handler) setRequestBytes(r *http.Request, size int64) {
+	if size < 0 {
+		r.Header.Del(RequestBytesHeader)
+		return
 	}
+	e.setHeader(r.Header, RequestBytesHeader, strconv.FormatInt(size, 10))
+}
 
-	if request.User != "" {
-		r.Header.Set(fmt.Sprintf("%v", e.requestFields["user"]), request.User)
+// bypassLargeBody forwards a request whose body is too large for extraction untouched
+func (e *Handler) bypassLargeBody(r *http.Request) {
+	if e.markSkipped {
+		r.Header.Set(SkippedHeader, "too-large")
 	}
+	e.setCostCenter(r, nil)
+}
 
-	if request.Temperature != nil {
-		field := fmt.Sprintf("%v", e.requestFields["temperature"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.Temperature))
-		}
+// extractBody reads the request body, sets the headers extracted from it and returns the extracted field values and
+// whether the prompt text of the complete body was scanned. An error is only returned when the body cannot be read;
+// unparsable bodies are reported in the parse failure header.
+func (e *Handler) extractBody(r *http.Request, mapper *headerMapper, kinds []EndpointKind) (map[string]string, bool, error) {
+	ctx := r.Context()
+	if e.extractionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.extractionTimeout)
+		defer cancel()
 	}
 
-	if request.MaxCompletionTokens != nil {
-		field := fmt.Sprintf("%v", e.requestFields["max_completion_tokens"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.MaxCompletionTokens))
-		}
+	readCtx := ctx
+	if e.bodyReadTimeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, e.bodyReadTimeout)
+		defer cancel()
 	}
 
-	if request.Logprobs != nil {
-		field := fmt.Sprintf("%v", e.requestFields["logprobs"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.Logprobs))
+	// a body of unknown length, such as a chunked upload, is never buffered completely without bounds: one byte more
+	// than the cap is read to tell whether it fits, and a body that does not is forwarded without extraction
+	limit, capped := e.maxBodyBytes, int64(0)
+	if limit <= 0 && r.ContentLength < 0 {
+		capped = e.bypassAboveBytes
+		if capped <= 0 {
+			capped = maxUnknownLengthBodyBytes
 		}
+		limit = capped + 1
 	}
 
-	if request.TopLogprobs != nil {
-		field := fmt.Sprintf("%v", e.requestFields["top_logprobs"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.TopLogprobs))
-		}
+	data, truncated, err := readBodyPrefixContext(readCtx, r, limit)
+	e.continued(r)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		return nil, false, errBodyReadTimeout
+	case errors.Is(err, context.DeadlineExceeded):
+		e.metrics.inc("extraction_timeouts_total")
+		return nil, false, fmt.Errorf("unable to read body within extractionTimeout: %w", err)
+	case errors.Is(err, context.Canceled):
+		e.metrics.inc("extraction_canceled_total")
+		return nil, false, err
+	case err != nil:
+		return nil, false, fmt.Errorf("unable to read body: %w", err)
+	case capped > 0 && truncated:
+		return nil, false, errBodyTooLarge
+	case r.ContentLength < 0 && !truncated:
+		// the complete body of unknown length was read, so its size is known now
+		e.setRequestBytes(r, int64(len(data)))
 	}
 
-	if toolChoice, ok := request.ToolChoice.(string); ok {
-		field := fmt.Sprintf("%v", e.requestFields["tool_choice"])
-		if len(field) > 0 {
-			r.Header.Set(field, toolChoice)
-		}
+	var members map[string]json.RawMessage
+	defer func() {
+		e.setCostCenter(r, members)
+	}()
+
+	if len(data) < 1 {
+		e.parseFailure(r, "empty body")
+		return nil, true, nil
 	}
 
-	if request.FrequencyPenalty != nil {
-		field := fmt.Sprintf("%v", e.requestFields["frequency_penalty"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.FrequencyPenalty))
+	if !mapper.enabled() && !e.costCenter.enabled() {
+		return nil, false, nil
+	}
+
+	if e.exceedsJSONLimits(r, data) {
+		return nil, false, nil
+	}
+
+	members, err = decodeBody(r, data, truncated)
+	if err != nil {
+		e.parseFailure(r, err.Error())
+		if e.logSampling == nil {
+			fmt.Println("Unable to unmarshal", err.Error())
 		}
+		return nil, false, nil
+	}
+
+	if !mapper.enabled() {
+		return nil, false, nil
+	}
+
+	values := map[string]string{}
+	for _, kind := range kinds {
+		e.setExtractedHeaders(kind, members, r, mapper, values)
 	}
+	for name, value := range mapper.autoHeaders(members) {
+		e.setHeader(r.Header, name, value)
+	}
+	return values, !truncated, nil
+}
 
-	if request.PresencePenalty != nil {
-		field := fmt.Sprintf("%v", e.requestFields["presence_penalty"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.PresencePenalty))
+// setExtractedHeaders sets the headers extracted from the body on the request, reports parse failures and collects the
+// extracted field values
+func (e *Handler) setExtractedHeaders(kind EndpointKind, members map[string]json.RawMessage, r *http.Request, mapper *headerMapper, values map[string]string) {
+	extracted, err := mapper.extract(e.extractorFor(kind, r), kind, members, r)
+	if err != nil {
+		e.parseFailure(r, err.Error())
+	}
+	if extracted == nil {
+		extracted = map[string]string{}
+	}
+	for field, value := range e.contentValues(kind, members) {
+		extracted[field] = value
+	}
+	if key := stickyKey(e.stickyFields, extracted, members); key != "" {
+		extracted["sticky_key"] = key
+	}
+	if e.canary != nil {
+		if canary, ok := e.canary.bucket(r, extracted, members); ok {
+			extracted["canary"] = canary
 		}
 	}
+	if fallback, ok := e.fallbackModels[extracted["model"]]; ok && extracted["model"] != "" {
+		extracted["fallback_model"] = fallback
+	}
+	if backend := e.routeBackend(extracted["model"]); backend != "" {
+		extracted["backend"] = backend
+	}
+	e.countDeprecatedParams(extracted["deprecated_params"])
+	for name, value := range mapper.headers(extracted, members) {
+		e.setHeader(r.Header, name, value)
+	}
+	for field, value := range extracted {
+		values[field] = value
+	}
+}
 
-	if request.TopP != nil {
-		field := fmt.Sprintf("%v", e.requestFields["top_p"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.TopP))
+// setHeader writes the value according to the header policy when the header is already present
+func (e *Handler) setHeader(header http.Header, name string, value string) {
+	if len(header.Values(name)) > 0 {
+		switch e.headerPolicy {
+		case HeaderPolicyPreserve:
+			return
+		case HeaderPolicyAppend:
+			header.Add(name, value)
+			return
 		}
 	}
+	header.Set(name, value)
+}
 
-	if request.Stream != nil {
-		field := fmt.Sprintf("%v", e.requestFields["stream"])
-		if len(field) > 0 {
-			r.Header.Set(field, fmt.Sprintf("%v", *request.Stream))
+// mirrorResponseHeaders copies the extracted request headers of the configured fields onto the response
+func mirrorResponseHeaders(w http.ResponseWriter, r *http.Request, mapper *headerMapper, mirrorResponseFields []string) {
+	for _, field := range mirrorResponseFields {
+		for _, name := range mapper.fieldHeaders(field) {
+			if value := r.Header.Get(name); len(value) > 0 {
+				w.Header().Set(name, value)
+			}
 		}
 	}
 }
 
-func (e *Handler) handleBatchRequest(data []byte, r *http.Request) {
-	request := batchRequest{}
-	if err := json.Unmarshal(data, &request); err != nil {
-		r.Header.Set(ParseFailureHeader, err.Error())
-		fmt.Println("Unable to unmarshal", err.Error())
-	} else {
-		r.Header.Set(fmt.Sprintf("%v", e.requestFields["completion_window"]), request.CompletionWindow)
-		r.Header.Set(fmt.Sprintf("%v", e.requestFields["oai_endpoint"]), request.Endpoint)
+// toSet converts a list of configured names into a lookup set
+func toSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
 	}
+	return set
 }
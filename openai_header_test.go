@@ -98,12 +98,12 @@ func TestChatCompletionHeaders_ServeHTTP(t *testing.T) {
 			name:          "openai-functions-toolchoice-object",
 			input:         "{\n  \"model\": \"gpt-4.1\",\n  \"messages\": [\n    {\n      \"role\": \"user\",\n      \"content\": \"What is the weather like in Boston today?\"\n    }\n  ],\n  \"tools\": [\n    {\n      \"type\": \"function\",\n      \"function\": {\n        \"name\": \"get_current_weather\",\n        \"description\": \"Get the current weather in a given location\",\n        \"parameters\": {\n          \"type\": \"object\",\n          \"properties\": {\n            \"location\": {\n              \"type\": \"string\",\n              \"description\": \"The city and state, e.g. San Francisco, CA\"\n            },\n            \"unit\": {\n              \"type\": \"string\",\n              \"enum\": [\"celsius\", \"fahrenheit\"]\n            }\n          },\n          \"required\": [\"location\"]\n        }\n      }\n    }\n  ],\n  \"tool_choice\": {\"type\":\"file_search\"}\n}",
 			requestFields: map[string]string{},
-			want:          "X-OpenAI-Model",
+			want:          "X-OpenAI-Tool-Choice",
 			error:         false,
 		},
 		{
 			name:          "openai-logprobs",
-			input:         "{\n    \"model\": \"gpt-4.1\",\n    \"messages\": [\n      {\n        \"role\": \"user\",\n        \"content\": \"Hello!\"\n      }\n    ],\n    \"logprobs\": 5,\n    \"top_logprobs\": 2\n  }",
+			input:         "{\n    \"model\": \"gpt-4.1\",\n    \"messages\": [\n      {\n        \"role\": \"user\",\n        \"content\": \"Hello!\"\n      }\n    ],\n    \"top_logprobs\": 2\n  }",
 			requestFields: map[string]string{},
 			want:          "X-OpenAI-Top-Logprobs",
 			error:         false,
@@ -415,6 +415,125 @@ func TestBatchHeaders_ServeHTTP(t *testing.T) {
 	}
 }
 
+func TestMirrorResponseFields_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		fields []string
+		want   map[string]string
+	}{
+		{
+			name:   "disabled",
+			input:  "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}",
+			fields: []string{},
+			want:   map[string]string{"X-OpenAI-Model": "", "X-OpenAI-User": ""},
+		},
+		{
+			name:   "model-user-stream",
+			input:  "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"stream\": true, \"temperature\": 0.5}",
+			fields: []string{"model", "user", "stream"},
+			want:   map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": "alice", "X-OpenAI-Stream": "true", "X-OpenAI-Temperature": ""},
+		},
+		{
+			name:   "missing-value",
+			input:  "{\"model\": \"gpt-4.1\"}",
+			fields: []string{"model", "user", "unknown"},
+			want:   map[string]string{"X-OpenAI-Model": "gpt-4.1", "X-OpenAI-User": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MirrorResponseFields = tt.fields
+			e, err := New(nil, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			for header, value := range tt.want {
+				if got := recorder.Header().Get(header); got != value {
+					t.Errorf("expected response header %v to be %q but got %q", header, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatToolChoice(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		want  string
+	}{
+		{name: "nil", input: nil, want: ""},
+		{name: "string", input: "auto", want: "auto"},
+		{name: "type only", input: map[string]interface{}{"type": "file_search"}, want: "file_search"},
+		{name: "function", input: map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_current_weather"}}, want: "function:get_current_weather"},
+		{name: "responses function", input: map[string]interface{}{"type": "function", "name": "get_current_weather"}, want: "function:get_current_weather"},
+		{name: "unsupported", input: 1.0, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatToolChoice(tt.input); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHeaderPolicy_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   []string
+		error  bool
+	}{
+		{name: "default", policy: "", want: []string{"alice"}},
+		{name: "overwrite", policy: HeaderPolicyOverwrite, want: []string{"alice"}},
+		{name: "preserve", policy: HeaderPolicyPreserve, want: []string{"precomputed"}},
+		{name: "append", policy: HeaderPolicyAppend, want: []string{"precomputed", "alice"}},
+		{name: "invalid", policy: "merge", error: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.HeaderPolicy = tt.policy
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if tt.error {
+				if err == nil {
+					t.Errorf("expected an error for header policy %q", tt.policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			request := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"user\": \"alice\"}"))
+			request.Header.Set("X-OpenAI-User", "precomputed")
+			e.ServeHTTP(httptest.NewRecorder(), request)
+
+			values := got.Values("X-OpenAI-User")
+			if strings.Join(values, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v but got %v", tt.want, values)
+			}
+			if got.Get("X-OpenAI-Model") != "gpt-4.1" {
+				t.Errorf("expected absent headers to be set regardless of policy")
+			}
+		})
+	}
+}
+
 type String string
 
 func (s String) AsReader() io.Reader {
@@ -0,0 +1,441 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP exports the metrics and the sampled log lines to an OpenTelemetry collector over OTLP/HTTP with JSON encoding.
+// The endpoint is the base URL of the collector, to which /v1/metrics and /v1/logs are appended.
+type OTLP struct {
+	Endpoint    string            `json:"endpoint"`
+	Headers     map[string]string `json:"headers"`
+	Interval    string            `json:"interval"`
+	Timeout     string            `json:"timeout"`
+	ServiceName string            `json:"serviceName"`
+	QueueSize   int               `json:"queueSize"`
+}
+
+// otlpScope is the instrumentation scope of the exported metrics and logs
+const otlpScope = "traefik-openai-header"
+
+// Log lines are exported in batches of up to otlpLogBatchSize records, at least every otlpLogFlushInterval
+const (
+	otlpLogBatchSize     = 100
+	otlpLogFlushInterval = time.Second
+)
+
+// otlpExporter pushes the metrics on an interval and the queued log lines in batches from a single worker, so the
+// request never waits for the collector
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	interval time.Duration
+	client   *http.Client
+	resource otlpResource
+	logs     chan otlpLog
+	metrics  *metrics
+}
+
+// otlpLog is a queued log line with the body encoded in the log format
+type otlpLog struct {
+	line logLine
+	body string
+}
+
+func newOTLPExporter(ctx context.Context, config *OTLP, m *metrics) (*otlpExporter, error) {
+	if config == nil {
+		return nil, nil
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %q", config.Endpoint)
+	}
+	for name := range config.Headers {
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid otlp header %q", name)
+		}
+	}
+
+	interval := time.Minute
+	if config.Interval != "" {
+		if interval, err = time.ParseDuration(config.Interval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid otlp interval %q", config.Interval)
+		}
+	}
+	timeout := 5 * time.Second
+	if config.Timeout != "" {
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid otlp timeout %q", config.Timeout)
+		}
+	}
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = otlpScope
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	o := &otlpExporter{
+		endpoint: strings.TrimSuffix(config.Endpoint, "/"),
+		headers:  config.Headers,
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+		resource: otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", serviceName)}},
+		logs:     make(chan otlpLog, queueSize),
+		metrics:  m,
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go o.run(ctx)
+	return o, nil
+}
+
+// run exports the metrics every interval and the log lines whenever a batch is full or the flush interval passed,
+// until the context is done
+func (o *otlpExporter) run(ctx context.Context) {
+	metricsTicker := time.NewTicker(o.interval)
+	defer metricsTicker.Stop()
+	logsTicker := time.NewTicker(otlpLogFlushInterval)
+	defer logsTicker.Stop()
+
+	var batch []otlpLog
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		o.export("/v1/logs", o.logsRequest(batch))
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-metricsTicker.C:
+			o.export("/v1/metrics", o.metricsRequest(o.metrics.snapshot(), time.Now()))
+		case <-logsTicker.C:
+			flush()
+		case log := <-o.logs:
+			batch = append(batch, log)
+			if len(batch) >= otlpLogBatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+// queueLog queues a log line and its encoded body for export and drops it when the queue is full
+func (o *otlpExporter) queueLog(line logLine, body []byte) {
+	select {
+	case o.logs <- otlpLog{line: line, body: string(body)}:
+	default:
+		o.metrics.inc("otlp_logs_dropped_total")
+	}
+}
+
+// export posts the request to the path of the collector
+func (o *otlpExporter) export(path string, request interface{}) {
+	if err := o.post(path, request); err != nil {
+		o.metrics.inc("otlp_export_failures_total")
+		fmt.Println("Unable to export to OTLP", err.Error())
+	}
+}
+
+func (o *otlpExporter) post(path string, request interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, o.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range o.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// otlpResource and the types below are the OTLP/HTTP JSON encoding of the metrics and logs export requests, in which
+// 64 bit integers are strings
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    string  `json:"intValue,omitempty"`
+}
+
+type otlpScopeName struct {
+	Name string `json:"name"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScopeName `json:"scope"`
+	Metrics []otlpMetric  `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScopeName   `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber"`
+	SeverityText   string          `json:"severityText"`
+	Body           otlpValue       `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes"`
+}
+
+// otlpCumulative is the aggregation temporality of counters that only grow since the start time
+const otlpCumulative = 2
+
+func stringAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: strconv.FormatInt(value, 10)}}
+}
+
+// sortedNames returns the names of the counters in order
+func sortedNames(counters map[string]int64) []string {
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// labelAttributes turns the label of a labeled counter or histogram into attributes: a label of key=value pairs,
+// such as the latency labels, into one attribute per pair, any other label into a label attribute
+func labelAttributes(label string) []otlpAttribute {
+	pairs := strings.Split(label, ",")
+	attributes := make([]otlpAttribute, 0, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return []otlpAttribute{stringAttribute("label", label)}
+		}
+		attributes = append(attributes, stringAttribute(key, value))
+	}
+	return attributes
+}
+
+// metricsRequest converts a snapshot to cumulative sums for the counters and labeled counters and to histograms in
+// milliseconds, in a stable order
+func (o *otlpExporter) metricsRequest(snapshot stats, now time.Time) otlpMetricsRequest {
+	start, end := unixNano(snapshot.Started), unixNano(now)
+	var metrics []otlpMetric
+
+	for _, name := range sortedNames(snapshot.Counters) {
+		metrics = append(metrics, otlpMetric{Name: name, Sum: &otlpSum{
+			AggregationTemporality: otlpCumulative,
+			IsMonotonic:            true,
+			DataPoints: []otlpNumberPoint{{
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				AsInt:             strconv.FormatInt(snapshot.Counters[name], 10),
+			}},
+		}})
+	}
+
+	names := make([]string, 0, len(snapshot.Labeled))
+	for name := range snapshot.Labeled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		labels := snapshot.Labeled[name]
+		sum := &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		for _, label := range sortedNames(labels) {
+			sum.DataPoints = append(sum.DataPoints, otlpNumberPoint{
+				Attributes:        labelAttributes(label),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				AsInt:             strconv.FormatInt(labels[label], 10),
+			})
+		}
+		metrics = append(metrics, otlpMetric{Name: name, Sum: sum})
+	}
+
+	bounds := make([]float64, len(latencyBuckets))
+	for i, bound := range latencyBuckets {
+		bounds[i] = float64(bound)
+	}
+	names = names[:0]
+	for name := range snapshot.Histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		histograms := snapshot.Histograms[name]
+		labels := make([]string, 0, len(histograms))
+		for label := range histograms {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		histogram := &otlpHistogram{AggregationTemporality: otlpCumulative}
+		for _, label := range labels {
+			h := histograms[label]
+			// the snapshot buckets are cumulative, OTLP counts every bucket on its own
+			counts := make([]string, 0, len(latencyBuckets)+1)
+			var previous int64
+			for i := 0; i <= len(latencyBuckets); i++ {
+				le := "+Inf"
+				if i < len(latencyBuckets) {
+					le = strconv.FormatInt(latencyBuckets[i], 10)
+				}
+				counts = append(counts, strconv.FormatInt(h.Buckets[le]-previous, 10))
+				previous = h.Buckets[le]
+			}
+			histogram.DataPoints = append(histogram.DataPoints, otlpHistogramPoint{
+				Attributes:        labelAttributes(label),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				Count:             strconv.FormatInt(h.Count, 10),
+				Sum:               float64(h.SumMs),
+				BucketCounts:      counts,
+				ExplicitBounds:    bounds,
+			})
+		}
+		metrics = append(metrics, otlpMetric{Name: name, Unit: "ms", Histogram: histogram})
+	}
+
+	return otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     o.resource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScopeName{Name: otlpScope}, Metrics: metrics}},
+	}}}
+}
+
+// logsRequest converts log lines to log records whose body is the encoded line and whose attributes are its fields.
+// Failures are logged as warnings.
+func (o *otlpExporter) logsRequest(logs []otlpLog) otlpLogsRequest {
+	records := make([]otlpLogRecord, 0, len(logs))
+	for _, log := range logs {
+		line, text := log.line, log.body
+		severity, severityText := 9, "INFO"
+		if line.Outcome == logOutcomeFailed {
+			severity, severityText = 13, "WARN"
+		}
+
+		attributes := []otlpAttribute{
+			stringAttribute("outcome", line.Outcome),
+			stringAttribute("http.request.method", line.Method),
+			stringAttribute("url.path", line.Path),
+			intAttribute("duration_ms", line.DurationMs),
+		}
+		if line.Status != 0 {
+			attributes = append(attributes, intAttribute("http.response.status_code", int64(line.Status)))
+		}
+		for _, attribute := range [][2]string{{"model", line.Model}, {"code", line.Code}, {"reason", line.Reason}} {
+			if attribute[1] != "" {
+				attributes = append(attributes, stringAttribute(attribute[0], attribute[1]))
+			}
+		}
+
+		records = append(records, otlpLogRecord{
+			TimeUnixNano:   unixNano(line.Time),
+			SeverityNumber: severity,
+			SeverityText:   severityText,
+			Body:           otlpValue{StringValue: &text},
+			Attributes:     attributes,
+		})
+	}
+
+	return otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource:  o.resource,
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScopeName{Name: otlpScope}, LogRecords: records}},
+	}}}
+}
@@ -0,0 +1,160 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLP_ServeHTTP(t *testing.T) {
+	type export struct {
+		path          string
+		contentType   string
+		authorization string
+		body          []byte
+	}
+	exports := make(chan export, 100)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		exports <- export{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), authorization: r.Header.Get("Authorization"), body: body}
+	}))
+	defer collector.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	one := 1.0
+	config := defaultConfig()
+	config.LogSampling = &LogSampling{Successes: &one}
+	config.OTLP = &OTLP{
+		Endpoint:    collector.URL + "/",
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+		Interval:    "20ms",
+		ServiceName: "llm-gateway",
+	}
+	e, err := New(ctx, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "otlp")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	output := captureStdout(t, func() {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+	})
+	if output != "" {
+		t.Errorf("expected the log line to be exported instead of printed but got %s", output)
+	}
+
+	var metrics otlpMetricsRequest
+	var logs otlpLogsRequest
+	timeout := time.After(5 * time.Second)
+	for metrics.ResourceMetrics == nil || logs.ResourceLogs == nil {
+		select {
+		case got := <-exports:
+			if got.contentType != "application/json" || got.authorization != "Bearer secret" {
+				t.Errorf("expected a JSON export with the configured headers but got %q and %q", got.contentType, got.authorization)
+			}
+			switch got.path {
+			case "/v1/metrics":
+				if err := json.Unmarshal(got.body, &metrics); err != nil {
+					t.Fatalf("invalid metrics %s: %s", got.body, err)
+				}
+			case "/v1/logs":
+				if err := json.Unmarshal(got.body, &logs); err != nil {
+					t.Fatalf("invalid logs %s: %s", got.body, err)
+				}
+			default:
+				t.Errorf("unexpected export to %s", got.path)
+			}
+		case <-timeout:
+			t.Fatalf("expected metrics and logs to be exported")
+		}
+	}
+
+	if service := *metrics.ResourceMetrics[0].Resource.Attributes[0].Value.StringValue; service != "llm-gateway" {
+		t.Errorf("expected the service name llm-gateway but got %s", service)
+	}
+	found := false
+	for _, metric := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name == "requests_matched_total" {
+			found = metric.Sum != nil && metric.Sum.IsMonotonic && metric.Sum.DataPoints[0].AsInt == "1"
+		}
+	}
+	if !found {
+		t.Errorf("expected the requests_matched_total counter to be exported")
+	}
+
+	records := logs.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 1 {
+		t.Fatalf("expected one log record but got %d", len(records))
+	}
+	var line logLine
+	if err := json.Unmarshal([]byte(*records[0].Body.StringValue), &line); err != nil || line.Outcome != "extracted" || line.Model != "gpt-4.1" {
+		t.Errorf("expected the log line of the extraction but got %s", *records[0].Body.StringValue)
+	}
+}
+
+func TestOTLPMetricsRequest(t *testing.T) {
+	m := newMetrics()
+	m.incLabel("requests_by_model", "gpt-4.1")
+	m.observe("latency_ms", "model=gpt-4.1,endpoint=chat_completion,stream=false", 70*time.Millisecond)
+	m.observe("latency_ms", "model=gpt-4.1,endpoint=chat_completion,stream=false", 80*time.Millisecond)
+	m.observe("latency_ms", "model=gpt-4.1,endpoint=chat_completion,stream=false", 400*time.Millisecond)
+
+	o := &otlpExporter{}
+	request := o.metricsRequest(m.snapshot(), time.Now())
+	metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics but got %d", len(metrics))
+	}
+
+	labeled := metrics[0]
+	if labeled.Name != "requests_by_model" || labeled.Sum.DataPoints[0].Attributes[0].Key != "label" ||
+		*labeled.Sum.DataPoints[0].Attributes[0].Value.StringValue != "gpt-4.1" {
+		t.Errorf("expected the model as label attribute but got %+v", labeled)
+	}
+
+	histogram := metrics[1]
+	point := histogram.Histogram.DataPoints[0]
+	if histogram.Name != "latency_ms" || histogram.Unit != "ms" || point.Count != "3" || point.Sum != 550 {
+		t.Errorf("expected 3 latencies of 550ms in total but got %+v", histogram)
+	}
+	want := []string{"0", "2", "0", "1", "0", "0", "0", "0", "0", "0", "0", "0", "0"}
+	if strings.Join(point.BucketCounts, ",") != strings.Join(want, ",") || len(point.ExplicitBounds) != len(latencyBuckets) {
+		t.Errorf("expected bucket counts %v but got %v", want, point.BucketCounts)
+	}
+	var attributes []string
+	for _, attribute := range point.Attributes {
+		attributes = append(attributes, attribute.Key+"="+*attribute.Value.StringValue)
+	}
+	if got := strings.Join(attributes, ","); got != "model=gpt-4.1,endpoint=chat_completion,stream=false" {
+		t.Errorf("expected an attribute per label pair but got %s", got)
+	}
+}
+
+func TestInvalidOTLP_New(t *testing.T) {
+	tests := []struct {
+		name string
+		otlp OTLP
+	}{
+		{name: "no endpoint", otlp: OTLP{}},
+		{name: "invalid endpoint", otlp: OTLP{Endpoint: "collector:4318"}},
+		{name: "invalid header", otlp: OTLP{Endpoint: "http://collector:4318", Headers: map[string]string{"Api Key": "secret"}}},
+		{name: "invalid interval", otlp: OTLP{Endpoint: "http://collector:4318", Interval: "soon"}},
+		{name: "invalid timeout", otlp: OTLP{Endpoint: "http://collector:4318", Timeout: "-1s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.OTLP = &tt.otlp
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
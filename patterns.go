@@ -0,0 +1,69 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// namedPattern is a regex whose name is reported instead of the text it matched
+type namedPattern struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// compileNamedPatterns compiles the named patterns in name order, or returns the defaults when none are configured
+func compileNamedPatterns(option string, exprs map[string]string, defaults []namedPattern) ([]namedPattern, error) {
+	if len(exprs) == 0 {
+		return defaults, nil
+	}
+
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	patterns := make([]namedPattern, 0, len(names))
+	for _, name := range names {
+		regex, err := regexp.Compile(exprs[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %s: %w", option, name, err)
+		}
+		patterns = append(patterns, namedPattern{name: name, regex: regex})
+	}
+	return patterns, nil
+}
+
+// patternDetector reports which named patterns occur in the prompt text of the scanned roles
+type patternDetector struct {
+	patterns []namedPattern
+	roles    map[string]bool
+}
+
+// detect returns the names of the patterns that match any of the texts, without the matched text itself. Text matched
+// by a pattern is not considered by the patterns after it, so a card number is not also reported as a phone number.
+// Without roles the texts of all roles are scanned.
+func (d *patternDetector) detect(texts []promptText) []string {
+	remaining := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if len(d.roles) == 0 || d.roles[text.role] {
+			remaining = append(remaining, text.text)
+		}
+	}
+
+	var names []string
+	for _, pattern := range d.patterns {
+		found := false
+		for i, text := range remaining {
+			if pattern.regex.MatchString(text) {
+				found = true
+				remaining[i] = pattern.regex.ReplaceAllLiteralString(text, " ")
+			}
+		}
+		if found {
+			names = append(names, pattern.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,77 @@
+package traefik_openai_header
+
+import (
+	"regexp"
+)
+
+// PIIDetection configures the detection of personal data in the prompt text
+type PIIDetection struct {
+	Patterns map[string]string `json:"patterns"`
+}
+
+// PIIRedaction configures the redaction of personal data in the header values of the listed fields
+type PIIRedaction struct {
+	Fields      []string          `json:"fields"`
+	Patterns    map[string]string `json:"patterns"`
+	Placeholder string            `json:"placeholder"`
+}
+
+// defaultPIIPatterns are used when no patterns are configured. Card numbers go first so the phone pattern does not
+// consume them.
+var defaultPIIPatterns = []namedPattern{
+	{name: "credit_card", regex: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)},
+	{name: "email", regex: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{name: "phone", regex: regexp.MustCompile(`\+?\d[\d ().-]{7,}\d`)},
+}
+
+func newPIIDetector(config *PIIDetection) (*patternDetector, error) {
+	if config == nil {
+		return nil, nil
+	}
+	patterns, err := compileNamedPatterns("piiDetection", config.Patterns, defaultPIIPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &patternDetector{patterns: patterns}, nil
+}
+
+// redactor replaces personal data in field values with a placeholder
+type redactor struct {
+	fields      map[string]bool
+	patterns    []namedPattern
+	placeholder string
+}
+
+func newRedactor(config *PIIRedaction) (*redactor, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	fields := config.Fields
+	if len(fields) == 0 {
+		fields = []string{"user"}
+	}
+
+	patterns, err := compileNamedPatterns("piiRedaction", config.Patterns, defaultPIIPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholder := config.Placeholder
+	if placeholder == "" {
+		placeholder = "[redacted]"
+	}
+
+	return &redactor{fields: toSet(fields), patterns: patterns, placeholder: placeholder}, nil
+}
+
+// redact replaces the matches of all patterns in the value of a redacted field
+func (r *redactor) redact(field string, value string) string {
+	if r == nil || !r.fields[field] {
+		return value
+	}
+	for _, pattern := range r.patterns {
+		value = pattern.regex.ReplaceAllLiteralString(value, r.placeholder)
+	}
+	return value
+}
@@ -0,0 +1,128 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := newRedactor(&PIIRedaction{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value string
+		want  string
+	}{
+		{name: "email", field: "user", value: "alice@example.com", want: "[redacted]"},
+		{name: "email in text", field: "user", value: "svc for bob.smith+ci@corp.example.org", want: "svc for [redacted]"},
+		{name: "phone", field: "user", value: "call +31 (0)20 123-4567", want: "call [redacted]"},
+		{name: "credit card", field: "user", value: "4111 1111 1111 1111", want: "[redacted]"},
+		{name: "no pii", field: "user", value: "svc-foo-42", want: "svc-foo-42"},
+		{name: "other field", field: "model", value: "alice@example.com", want: "alice@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redact(tt.field, tt.value); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPIIRedaction_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.PIIRedaction = &PIIRedaction{
+		Fields:      []string{"user"},
+		Patterns:    map[string]string{"employee_id": "E[0-9]{6}"},
+		Placeholder: "***",
+	}
+	config.BaggageFields = map[string]string{"user": "llm.user"}
+
+	var got http.Header
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "pii redaction")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	input := "{\"model\": \"gpt-4.1\", \"user\": \"E123456 alice@example.com\"}"
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+	if want := "*** alice@example.com"; got.Get("X-OpenAI-User") != want {
+		t.Errorf("expected user %q but got %q", want, got.Get("X-OpenAI-User"))
+	}
+	if want := "llm.user=***%20alice@example.com"; got.Get("Baggage") != want {
+		t.Errorf("expected baggage %q but got %q", want, got.Get("Baggage"))
+	}
+}
+
+func TestInvalidPIIRedaction_New(t *testing.T) {
+	config := CreateConfig()
+	config.PIIRedaction = &PIIRedaction{Patterns: map[string]string{"broken": "E[0-9"}}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestPIIDetection_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		uri   string
+		input string
+		want  string
+	}{
+		{
+			name:  "string content",
+			uri:   "/v1/chat/completions",
+			input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Mail alice@example.com or call +31 20 123 4567\"}]}",
+			want:  "email,phone",
+		},
+		{
+			name:  "text parts",
+			uri:   "/v1/chat/completions",
+			input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": [{\"type\": \"text\", \"text\": \"My card is 4111-1111-1111-1111\"}]}]}",
+			want:  "credit_card",
+		},
+		{
+			name:  "anthropic system prompt",
+			uri:   "/v1/messages",
+			input: "{\"model\": \"claude-sonnet-4-5\", \"system\": [{\"type\": \"text\", \"text\": \"Escalate to ops@example.com\"}], \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			want:  "email",
+		},
+		{
+			name:  "no personal data",
+			uri:   "/v1/chat/completions",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice@example.com\", \"messages\": [{\"role\": \"user\", \"content\": \"Hello!\"}]}",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.PIIDetection = &PIIDetection{}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", tt.uri, strings.NewReader(tt.input)))
+
+			if got.Get("X-OpenAI-PII-Detected") != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got.Get("X-OpenAI-PII-Detected"))
+			}
+		})
+	}
+}
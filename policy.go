@@ -0,0 +1,89 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// endpointPolicy decides which endpoint kinds and request paths the middleware instance lets through
+type endpointPolicy struct {
+	allowed endpointSet
+	denied  endpointSet
+}
+
+// endpointSet is a policy option: the endpoint kinds it lists and the path regexes of the other entries
+type endpointSet struct {
+	kinds   map[EndpointKind]bool
+	regexes []*regexp.Regexp
+}
+
+// newEndpointPolicy checks the allowed and denied endpoints. Without allowed endpoints all endpoints are allowed.
+func newEndpointPolicy(allowed []string, denied []string) (*endpointPolicy, error) {
+	allowedSet, err := newEndpointSet("allowedEndpoints", allowed)
+	if err != nil {
+		return nil, err
+	}
+	deniedSet, err := newEndpointSet("deniedEndpoints", denied)
+	if err != nil {
+		return nil, err
+	}
+	return &endpointPolicy{allowed: allowedSet, denied: deniedSet}, nil
+}
+
+// permits reports whether the endpoint kinds or the path of the request are allowed and none is denied. A request
+// that matches no allowed entry is only permitted when nothing is allowed explicitly.
+func (p *endpointPolicy) permits(kinds []EndpointKind, path string) bool {
+	if p.denied.matches(kinds, path) {
+		return false
+	}
+	return p.allowed.empty() || p.allowed.matches(kinds, path)
+}
+
+// newEndpointSet splits the entries of a config option into the registered endpoint kinds and path regexes, so
+// endpoints without an extractor, such as /v1/fine_tuning, can be listed too
+func newEndpointSet(option string, entries []string) (endpointSet, error) {
+	set := endpointSet{kinds: map[EndpointKind]bool{}}
+	for _, entry := range entries {
+		if _, ok := extractors[EndpointKind(entry)]; ok {
+			set.kinds[EndpointKind(entry)] = true
+			continue
+		}
+		regex, err := regexp.Compile(entry)
+		if err != nil {
+			return endpointSet{}, fmt.Errorf("invalid %s entry %q: not an endpoint kind nor a regex: %w", option, entry, err)
+		}
+		set.regexes = append(set.regexes, regex)
+	}
+	return set, nil
+}
+
+func (s endpointSet) empty() bool {
+	return len(s.kinds) == 0 && len(s.regexes) == 0
+}
+
+// matches reports whether one of the kinds is in the set or the path matches one of its regexes
+func (s endpointSet) matches(kinds []EndpointKind, path string) bool {
+	for _, kind := range kinds {
+		if s.kinds[kind] {
+			return true
+		}
+	}
+	for _, regex := range s.regexes {
+		if regex.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectEndpoint responds with an OpenAI style error for a request to an endpoint this instance does not allow
+func (e *Handler) rejectEndpoint(w http.ResponseWriter, r *http.Request) {
+	e.reject(w, rejection{
+		status:    http.StatusForbidden,
+		errorType: "invalid_request_error",
+		code:      "endpoint_not_allowed",
+		message:   fmt.Sprintf("The endpoint %s is not allowed.", r.URL.Path),
+		values:    map[string]string{"path": r.URL.Path},
+	})
+}
@@ -0,0 +1,188 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpointPolicy_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		config  func(*Config)
+		method  string
+		uri     string
+		want    int
+	}{
+		{
+			name:   "no policy",
+			method: "POST",
+			uri:    "/v1/batches",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "denied",
+			denied: []string{"batch", "file_upload"},
+			method: "POST",
+			uri:    "/v1/batches",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "denied regardless of method",
+			denied: []string{"batch", "file_upload"},
+			method: "GET",
+			uri:    "/v1/batches/batch_1",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "not denied",
+			denied: []string{"batch", "file_upload"},
+			method: "POST",
+			uri:    "/v1/chat/completions",
+			want:   http.StatusOK,
+		},
+		{
+			name:    "allowed",
+			allowed: []string{"chat_completion"},
+			method:  "POST",
+			uri:     "/v1/chat/completions",
+			want:    http.StatusOK,
+		},
+		{
+			name:    "not allowed",
+			allowed: []string{"chat_completion"},
+			method:  "POST",
+			uri:     "/v1/embeddings",
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "deny wins over allow",
+			allowed: []string{"chat_completion", "batch"},
+			denied:  []string{"batch"},
+			method:  "POST",
+			uri:     "/v1/batches",
+			want:    http.StatusForbidden,
+		},
+		{
+			name:   "custom uri regex",
+			denied: []string{"chat_completion"},
+			config: func(c *Config) { c.RequestURIRegex = "/gateway/chat" },
+			method: "POST",
+			uri:    "/gateway/chat",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "denied path",
+			denied: []string{"batch", "^/v1/fine_tuning"},
+			method: "POST",
+			uri:    "/v1/fine_tuning/jobs",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "denied path with query",
+			denied: []string{"^/v1/fine_tuning/jobs$"},
+			method: "GET",
+			uri:    "/v1/fine_tuning/jobs?limit=1",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:    "allowed path",
+			allowed: []string{"chat_completion", "^/v1/models"},
+			method:  "GET",
+			uri:     "/v1/models",
+			want:    http.StatusOK,
+		},
+		{
+			name:    "registered endpoint",
+			allowed: []string{"chat_completion"},
+			config:  func(c *Config) { c.Endpoints = []Endpoint{{Kind: "chat_completion", UriRegex: "/proxy/chat"}} },
+			method:  "POST",
+			uri:     "/proxy/chat",
+			want:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.AllowedEndpoints = tt.allowed
+			config.DeniedEndpoints = tt.denied
+			if tt.config != nil {
+				tt.config(config)
+			}
+
+			called := false
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				called = true
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.uri, strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+			if recorder.Code != tt.want {
+				t.Errorf("expected status %d but got %d", tt.want, recorder.Code)
+			}
+			if called != (tt.want == http.StatusOK) {
+				t.Errorf("expected next handler called to be %v", tt.want == http.StatusOK)
+			}
+			if tt.want != http.StatusForbidden {
+				return
+			}
+
+			var body errorBody
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("expected an OpenAI style error body: %s", err)
+			}
+			if body.Error.Code != "endpoint_not_allowed" || body.Error.Type != "invalid_request_error" {
+				t.Errorf("unexpected error body %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestInvalidEndpointPolicy_New(t *testing.T) {
+	config := CreateConfig()
+	config.DeniedEndpoints = []string{"/v1/(batches"}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for a deniedEndpoints entry that is neither a kind nor a regex")
+	}
+}
+
+func TestReadOnly_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.DeniedEndpoints = []string{"chat_completion"}
+	config.ReadOnly = true
+
+	input := "{\"model\": \"gpt-4.1\"}"
+	var got http.Header
+	var body string
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}), config, "read only")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the request not to be rejected but got status %d", recorder.Code)
+	}
+	if body != input {
+		t.Errorf("expected the body to be forwarded untouched, got %q", body)
+	}
+	if got.Get("X-OpenAI-Model") != "gpt-4.1" {
+		t.Errorf("expected headers to be set, got %q", got.Get("X-OpenAI-Model"))
+	}
+}
@@ -0,0 +1,81 @@
+package traefik_openai_header
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// priceTable holds the price of every model, keyed by model name
+type priceTable map[string]ModelPrice
+
+func newPriceTable(prices map[string]ModelPrice) (priceTable, error) {
+	table := make(priceTable, len(prices))
+	for model, price := range prices {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("invalid prices for %s", model)
+		}
+		table[model] = price
+	}
+	return table, nil
+}
+
+// lookup returns the price of the model. Dated snapshots such as gpt-4o-2024-08-06 fall back to the price of the
+// longest model name they start with.
+func (p priceTable) lookup(model string) (ModelPrice, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range p {
+		if len(name) > len(best) && strings.HasPrefix(model, name+"-") {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return p[best], true
+}
+
+// prices is the active price table: the configured prices, which take precedence, over the last good price catalog
+type prices struct {
+	configured priceTable
+	catalog    *PriceCatalog
+	mu         sync.RWMutex
+	loaded     priceTable
+}
+
+func newPrices(configured map[string]ModelPrice, catalog *PriceCatalog) (*prices, error) {
+	table, err := newPriceTable(configured)
+	if err != nil {
+		return nil, err
+	}
+	return &prices{configured: table, catalog: catalog}, nil
+}
+
+// available reports whether any prices are configured or can be loaded
+func (p *prices) available() bool {
+	return len(p.configured) > 0 || p.catalog != nil
+}
+
+// lookup returns the price of the model from the configured prices, or else from the price catalog
+func (p *prices) lookup(model string) (ModelPrice, bool) {
+	if price, ok := p.configured.lookup(model); ok {
+		return price, true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.loaded.lookup(model)
+}
+
+// cost returns the cost of the token usage in USD
+func (p ModelPrice) cost(usage tokenUsage) float64 {
+	return (float64(usage.input)*p.Input + float64(usage.output)*p.Output) / 1e6
+}
@@ -0,0 +1,161 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// PriceCatalog loads model prices from an HTTPS URL or a file and refreshes them on an interval. The catalog is a JSON
+// object in the format of the prices option.
+type PriceCatalog struct {
+	URL      string `json:"url"`
+	File     string `json:"file"`
+	Interval string `json:"interval"`
+	Timeout  string `json:"timeout"`
+}
+
+// maxPriceCatalogBytes limits the size of a price catalog
+const maxPriceCatalogBytes = 4 << 20
+
+// priceCatalogLoader fetches and validates the price catalog
+type priceCatalogLoader struct {
+	url      string
+	file     string
+	interval time.Duration
+	client   *http.Client
+}
+
+func newPriceCatalogLoader(config *PriceCatalog) (*priceCatalogLoader, error) {
+	if (config.URL == "") == (config.File == "") {
+		return nil, errors.New("priceCatalog requires either a url or a file")
+	}
+	if config.URL != "" {
+		u, err := url.Parse(config.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid priceCatalog url %q", config.URL)
+		}
+	}
+
+	interval := time.Hour
+	if config.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(config.Interval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid priceCatalog interval %q", config.Interval)
+		}
+	}
+
+	timeout := 10 * time.Second
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid priceCatalog timeout %q", config.Timeout)
+		}
+	}
+
+	return &priceCatalogLoader{
+		url:      config.URL,
+		file:     config.File,
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// load reads the catalog and returns its prices. A catalog that cannot be parsed, has unknown fields, negative prices
+// or no models at all is rejected.
+func (l *priceCatalogLoader) load() (priceTable, error) {
+	data, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var catalog map[string]ModelPrice
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("invalid price catalog: %w", err)
+	}
+	if len(catalog) == 0 {
+		return nil, errors.New("invalid price catalog: no models")
+	}
+	return newPriceTable(catalog)
+}
+
+func (l *priceCatalogLoader) read() ([]byte, error) {
+	if l.file != "" {
+		return os.ReadFile(l.file)
+	}
+
+	resp, err := l.client.Get(l.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price catalog returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPriceCatalogBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPriceCatalogBytes {
+		return nil, errors.New("price catalog is too large")
+	}
+	return data, nil
+}
+
+// refresh loads the catalog and makes it the active one. On failure the last good catalog stays active.
+func (e *Handler) refreshPriceCatalog(prices *prices, loader *priceCatalogLoader) {
+	table, err := loader.load()
+	if err != nil {
+		e.metrics.inc("price_catalog_failures_total")
+		fmt.Println("Unable to load price catalog", err.Error())
+		return
+	}
+	e.metrics.inc("price_catalog_refreshes_total")
+
+	prices.mu.Lock()
+	defer prices.mu.Unlock()
+	prices.loaded = table
+}
+
+// watchPriceCatalog loads the price catalog once and keeps refreshing it until the context is done. A catalog that
+// cannot be loaded at startup leaves only the configured prices active until a refresh succeeds.
+func (e *Handler) watchPriceCatalog(ctx context.Context, prices *prices) error {
+	if prices.catalog == nil {
+		return nil
+	}
+	loader, err := newPriceCatalogLoader(prices.catalog)
+	if err != nil {
+		return err
+	}
+
+	e.refreshPriceCatalog(prices, loader)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		ticker := time.NewTicker(loader.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			e.refreshPriceCatalog(prices, loader)
+		}
+	}()
+
+	return nil
+}
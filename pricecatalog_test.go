@@ -0,0 +1,106 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPriceCatalogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"gpt-4o": {"input": 2.5, "output": 10}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := defaultConfig()
+	config.Prices = map[string]ModelPrice{"gpt-4o-mini": {Input: 0.15, Output: 0.6}}
+	config.PriceCatalog = &PriceCatalog{File: path}
+	config.Budget = &Budget{Monthly: 10}
+
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "file")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	handler := e.(*Handler)
+	prices := handler.budget.prices
+
+	if price, ok := prices.lookup("gpt-4o-2024-08-06"); !ok || price.Input != 2.5 {
+		t.Errorf("expected the catalog price but got %v %v", price, ok)
+	}
+	if price, ok := prices.lookup("gpt-4o-mini"); !ok || price.Input != 0.15 {
+		t.Errorf("expected the configured price to take precedence but got %v %v", price, ok)
+	}
+
+	invalid := []string{`{"gpt-4o": {"input": -1}}`, `{"gpt-4o": {"inputPrice": 1}}`, `{}`, `not json`}
+	for _, catalog := range invalid {
+		if err := os.WriteFile(path, []byte(catalog), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		handler.refreshPriceCatalog(prices, &priceCatalogLoader{file: path})
+		if price, ok := prices.lookup("gpt-4o"); !ok || price.Input != 2.5 {
+			t.Errorf("expected the last good catalog to stay active after %s but got %v %v", catalog, price, ok)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"gpt-4o": {"input": 2, "output": 8}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	handler.refreshPriceCatalog(prices, &priceCatalogLoader{file: path})
+	if price, _ := prices.lookup("gpt-4o"); price.Input != 2 {
+		t.Errorf("expected the refreshed price but got %v", price)
+	}
+
+	counters := handler.metrics.snapshot().Counters
+	if counters["price_catalog_refreshes_total"] != 2 || counters["price_catalog_failures_total"] != 4 {
+		t.Errorf("expected the loads to be counted but got %v", counters)
+	}
+}
+
+func TestPriceCatalogURL(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"claude-sonnet-4": {"input": 3, "output": 15}}`))
+	}))
+	defer server.Close()
+
+	loader, err := newPriceCatalogLoader(&PriceCatalog{URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	loader.client = server.Client()
+
+	table, err := loader.load()
+	if err != nil || table["claude-sonnet-4"].Output != 15 {
+		t.Errorf("expected the catalog to load but got %v %v", table, err)
+	}
+
+	status = http.StatusInternalServerError
+	if _, err := loader.load(); err == nil {
+		t.Errorf("expected an error for a failed fetch")
+	}
+}
+
+func TestInvalidPriceCatalog_New(t *testing.T) {
+	tests := []struct {
+		name    string
+		catalog *PriceCatalog
+	}{
+		{name: "no source", catalog: &PriceCatalog{}},
+		{name: "both sources", catalog: &PriceCatalog{URL: "https://prices.example.com", File: "prices.json"}},
+		{name: "plain http", catalog: &PriceCatalog{URL: "http://prices.example.com"}},
+		{name: "interval", catalog: &PriceCatalog{File: "prices.json", Interval: "soon"}},
+		{name: "timeout", catalog: &PriceCatalog{File: "prices.json", Timeout: "-1s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.PriceCatalog = tt.catalog
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package traefik_openai_header
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Quota headers set on the response when a budget, request count limit or rate limit applies to the request
+const (
+	QuotaLimitHeader     = "X-Quota-Limit"
+	QuotaRemainingHeader = "X-Quota-Remaining"
+	QuotaResetHeader     = "X-Quota-Reset"
+)
+
+// quotaHeaders sets the quota headers of the response from the quota with the smallest fraction remaining of all
+// quotas observed for the request, so clients throttle on the limit they will hit first
+type quotaHeaders struct {
+	header   http.Header
+	fraction float64
+	set      bool
+}
+
+// observe reports a quota: its limit, what remains of it after the request and the time until it is reset. The
+// precision is the number of decimals of the limit and remaining values.
+func (q *quotaHeaders) observe(limit float64, remaining float64, reset time.Duration, precision int) {
+	if limit <= 0 {
+		return
+	}
+	remaining = math.Max(0, remaining)
+	fraction := remaining / limit
+	if q.set && fraction >= q.fraction {
+		return
+	}
+	q.set = true
+	q.fraction = fraction
+
+	q.header.Set(QuotaLimitHeader, strconv.FormatFloat(limit, 'f', precision, 64))
+	q.header.Set(QuotaRemainingHeader, strconv.FormatFloat(remaining, 'f', precision, 64))
+	q.header.Set(QuotaResetHeader, strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10))
+}
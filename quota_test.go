@@ -0,0 +1,122 @@
+package traefik_openai_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotaHeadersObserve(t *testing.T) {
+	quotas := &quotaHeaders{header: http.Header{}}
+	quotas.observe(100, 80, 90*time.Second, 0)
+	quotas.observe(10, 1.5, 30*time.Minute, 2)
+	quotas.observe(1000, 500, time.Hour, 0)
+	quotas.observe(0, 0, time.Hour, 0)
+
+	want := map[string]string{QuotaLimitHeader: "10.00", QuotaRemainingHeader: "1.50", QuotaResetHeader: "1800"}
+	for name, value := range want {
+		if got := quotas.header.Get(name); got != value {
+			t.Errorf("expected %s %q but got %q", name, value, got)
+		}
+	}
+}
+
+func TestQuotaHeaders_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        func(config *Config)
+		requests      int
+		wantLimit     string
+		wantRemaining string
+		wantReset     string
+	}{
+		{
+			name:          "none",
+			config:        func(config *Config) {},
+			requests:      1,
+			wantLimit:     "",
+			wantRemaining: "",
+			wantReset:     "",
+		},
+		{
+			name: "daily requests",
+			config: func(config *Config) {
+				config.DailyRequests = &DailyRequests{SoftLimit: 10}
+			},
+			requests:      3,
+			wantLimit:     "10",
+			wantRemaining: "7",
+			wantReset:     "1800",
+		},
+		{
+			name: "token rate limit",
+			config: func(config *Config) {
+				config.TokenRateLimit = &TokenRateLimit{TokensPerMinute: 6000}
+			},
+			requests:      1,
+			wantLimit:     "6000",
+			wantRemaining: "4990",
+			wantReset:     "11",
+		},
+		{
+			name: "tightest quota",
+			config: func(config *Config) {
+				config.DailyRequests = &DailyRequests{SoftLimit: 10}
+				config.Prices = map[string]ModelPrice{"gpt-4.1": {Output: 1000000}}
+				config.Budget = &Budget{Monthly: 4}
+			},
+			requests:      3,
+			wantLimit:     "4.00",
+			wantRemaining: "2.00",
+			wantReset:     "41400",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			tt.config(config)
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, `{"usage": {"completion_tokens": 1}}`)
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+			now := func() time.Time {
+				return time.Date(2025, 6, 30, 12, 30, 0, 0, time.UTC)
+			}
+			handler := e.(*Handler)
+			if handler.dailyRequests != nil {
+				handler.dailyRequests.now = now
+			}
+			if handler.tokenRateLimit != nil {
+				handler.tokenRateLimit.now = now
+			}
+			if handler.budget != nil {
+				handler.budget.now = now
+			}
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"max_tokens\": 1000}"))
+				req.Header.Set("Authorization", "Bearer sk-test")
+				recorder = httptest.NewRecorder()
+				e.ServeHTTP(recorder, req)
+			}
+
+			if got := recorder.Header().Get(QuotaLimitHeader); got != tt.wantLimit {
+				t.Errorf("expected limit %q but got %q", tt.wantLimit, got)
+			}
+			if got := recorder.Header().Get(QuotaRemainingHeader); got != tt.wantRemaining {
+				t.Errorf("expected remaining %q but got %q", tt.wantRemaining, got)
+			}
+			if got := recorder.Header().Get(QuotaResetHeader); got != tt.wantReset {
+				t.Errorf("expected reset %q but got %q", tt.wantReset, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenRateLimitedHeader flags a request over its token rate limit on read only instances
+const TokenRateLimitedHeader = "X-OpenAI-Token-Rate-Limited"
+
+// TokenRateLimit limits the estimated tokens per minute of the requests with the same values of the key fields
+type TokenRateLimit struct {
+	TokensPerMinute int64    `json:"tokensPerMinute"`
+	Burst           int64    `json:"burst"`
+	Fields          []string `json:"fields"`
+}
+
+// tokenRateLimit is a leaky bucket per key. Every request pours its estimated tokens into the bucket of its key, which
+// leaks at the configured rate; a request that would overflow the bucket is refused.
+type tokenRateLimit struct {
+	rate       float64
+	capacity   float64
+	fields     []string
+	mu         sync.Mutex
+	buckets    map[string]*leakyBucket
+	lastPruned time.Time
+	now        func() time.Time
+}
+
+type leakyBucket struct {
+	level   float64
+	updated time.Time
+}
+
+func newTokenRateLimit(config *TokenRateLimit) (*tokenRateLimit, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.TokensPerMinute <= 0 {
+		return nil, errors.New("tokenRateLimit requires tokensPerMinute")
+	}
+	if config.Burst < 0 {
+		return nil, errors.New("invalid tokenRateLimit burst")
+	}
+
+	capacity := config.Burst
+	if capacity == 0 {
+		capacity = config.TokensPerMinute
+	}
+	fields := config.Fields
+	if len(fields) == 0 {
+		fields = []string{"user", "model"}
+	}
+
+	return &tokenRateLimit{
+		rate:     float64(config.TokensPerMinute) / time.Minute.Seconds(),
+		capacity: float64(capacity),
+		fields:   fields,
+		buckets:  map[string]*leakyBucket{},
+		now:      time.Now,
+	}, nil
+}
+
+// key returns the bucket key from the values of the key fields. Most clients send no user, so a request without one
+// is keyed by the fingerprint of its API key instead of sharing a single bucket with all of them.
+func (l *tokenRateLimit) key(r *http.Request, values map[string]string) string {
+	parts := make([]string, len(l.fields))
+	for i, field := range l.fields {
+		parts[i] = values[field]
+		if field == "user" {
+			// the prefixes keep a user from naming the bucket of an API key
+			if parts[i] != "" {
+				parts[i] = "u" + parts[i]
+			} else if fingerprint := keyFingerprint(r); fingerprint != "" {
+				parts[i] = "k" + fingerprint
+			}
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// take pours the tokens into the bucket of the key and returns the level of the bucket. When they do not fit it returns
+// false and how long until they would, without changing the bucket unless force is set.
+func (l *tokenRateLimit) take(key string, tokens int64, force bool) (bool, time.Duration, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastPruned) > time.Minute {
+		l.lastPruned = now
+		for k, bucket := range l.buckets {
+			if l.drained(bucket, now) == 0 {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &leakyBucket{}
+		l.buckets[key] = bucket
+	}
+	bucket.level = l.drained(bucket, now)
+	bucket.updated = now
+
+	level := bucket.level + float64(tokens)
+	if level <= l.capacity || force {
+		bucket.level = level
+		return level <= l.capacity, 0, bucket.level
+	}
+	wait := math.Ceil((level - l.capacity) / l.rate)
+	return false, time.Duration(wait) * time.Second, bucket.level
+}
+
+// drained returns the level of the bucket after leaking since it was last updated
+func (l *tokenRateLimit) drained(bucket *leakyBucket, now time.Time) float64 {
+	return math.Max(0, bucket.level-now.Sub(bucket.updated).Seconds()*l.rate)
+}
+
+// limitTokenRate refuses a request whose estimated tokens, the prompt size estimate plus its output token limit, do
+// not fit in the bucket of its key. It returns true when the request was answered. A request larger than the bucket
+// is refused as too large rather than asked to retry. Read only instances only flag. The room left in the bucket is
+// reported as a quota that resets when the bucket has drained.
+func (e *Handler) limitTokenRate(w http.ResponseWriter, r *http.Request, values map[string]string, quotas *quotaHeaders) bool {
+	usage := estimateUsage(r, values)
+	tokens := usage.input + usage.output
+
+	l := e.tokenRateLimit
+	ok, wait, level := l.take(l.key(r, values), tokens, e.readOnly)
+	quotas.observe(l.capacity, math.Floor(l.capacity-level), time.Duration(level/l.rate*float64(time.Second)), 0)
+	if ok {
+		return false
+	}
+	e.metrics.inc("token_rate_limited_total")
+	if e.readOnly {
+		r.Header.Set(TokenRateLimitedHeader, "true")
+		return false
+	}
+
+	// a request larger than the bucket never fits, so retrying it is pointless
+	if float64(tokens) > l.capacity {
+		e.reject(w, rejection{
+			status:    http.StatusRequestEntityTooLarge,
+			errorType: "invalid_request_error",
+			code:      "token_rate_limit_too_large",
+			message:   "The request exceeds the tokens per minute limit and can never be served; reduce the prompt or max tokens.",
+			values: map[string]string{
+				"tokens":   strconv.FormatInt(tokens, 10),
+				"capacity": strconv.FormatFloat(l.capacity, 'f', -1, 64),
+			},
+		})
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(wait/time.Second), 10))
+	e.reject(w, rejection{
+		status:    http.StatusTooManyRequests,
+		errorType: "tokens",
+		code:      "token_rate_limit_exceeded",
+		message:   "Rate limit reached for tokens per minute. Please try again later.",
+		values: map[string]string{
+			"tokens":      strconv.FormatInt(tokens, 10),
+			"retry_after": strconv.FormatInt(int64(wait/time.Second), 10),
+		},
+	})
+	return true
+}
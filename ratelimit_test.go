@@ -0,0 +1,167 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenRateLimitTake(t *testing.T) {
+	limit, err := newTokenRateLimit(&TokenRateLimit{TokensPerMinute: 600})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limit.now = func() time.Time { return now }
+
+	if ok, _, _ := limit.take("a", 500, false); !ok {
+		t.Errorf("expected 500 tokens to fit")
+	}
+	ok, wait, _ := limit.take("a", 200, false)
+	if ok || wait != 10*time.Second {
+		t.Errorf("expected 200 more tokens to wait 10s but got %v %v", ok, wait)
+	}
+	if ok, _, _ := limit.take("b", 200, false); !ok {
+		t.Errorf("expected other keys to have their own bucket")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _, _ := limit.take("a", 200, false); !ok {
+		t.Errorf("expected the bucket to leak 100 tokens in 10s")
+	}
+}
+
+func TestTokenRateLimit_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		readOnly    bool
+		bodies      []string
+		keys        []string
+		chunked     bool
+		wantStatus  int
+		wantCode    string
+		wantFlagged bool
+	}{
+		{
+			name:       "within limit",
+			bodies:     []string{`{"model": "gpt-4.1", "user": "a", "max_tokens": 400}`, `{"model": "gpt-4.1", "user": "a", "max_tokens": 400}`},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "over limit",
+			bodies:     []string{`{"model": "gpt-4.1", "user": "a", "max_tokens": 900}`, `{"model": "gpt-4.1", "user": "a", "max_tokens": 400}`},
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   "token_rate_limit_exceeded",
+		},
+		{
+			name:       "other user",
+			bodies:     []string{`{"model": "gpt-4.1", "user": "a", "max_tokens": 900}`, `{"model": "gpt-4.1", "user": "b", "max_tokens": 400}`},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "same api key without user",
+			bodies:     []string{`{"model": "gpt-4.1", "max_tokens": 900}`, `{"model": "gpt-4.1", "max_tokens": 400}`},
+			keys:       []string{"sk-1", "sk-1"},
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   "token_rate_limit_exceeded",
+		},
+		{
+			name:       "other api key without user",
+			bodies:     []string{`{"model": "gpt-4.1", "max_tokens": 900}`, `{"model": "gpt-4.1", "max_tokens": 400}`},
+			keys:       []string{"sk-1", "sk-2"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "image estimated from its detail",
+			bodies:     []string{`{"model": "gpt-4.1", "max_tokens": 100, "messages": [{"role": "user", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "data:image/webp;base64,` + strings.Repeat("A", 8000) + `"}}]}]}`},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "chunked",
+			bodies:     []string{`{"model": "gpt-4.1", "max_tokens": 100, "messages": [{"role": "user", "content": "` + strings.Repeat("a", 4000) + `"}]}`},
+			chunked:    true,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "token_rate_limit_too_large",
+		},
+		{
+			name:       "larger than bucket",
+			bodies:     []string{`{"model": "gpt-4.1", "user": "a", "max_tokens": 5000}`},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "token_rate_limit_too_large",
+		},
+		{
+			name:        "read only",
+			readOnly:    true,
+			bodies:      []string{`{"model": "gpt-4.1", "user": "a", "max_tokens": 5000}`},
+			wantStatus:  http.StatusOK,
+			wantFlagged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ReadOnly = tt.readOnly
+			config.TokenRateLimit = &TokenRateLimit{TokensPerMinute: 1000}
+
+			var upstream *http.Request
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				upstream = r
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			var recorder *httptest.ResponseRecorder
+			for i, body := range tt.bodies {
+				upstream = nil
+				recorder = httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+				if tt.chunked {
+					req.ContentLength = -1
+				}
+				if tt.keys != nil {
+					req.Header.Set("Authorization", "Bearer "+tt.keys[i])
+				}
+				e.ServeHTTP(recorder, req)
+			}
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantCode != "" {
+				if upstream != nil || !strings.Contains(recorder.Body.String(), "\"code\":\""+tt.wantCode+"\"") {
+					t.Errorf("expected the request to be rejected but got %s", recorder.Body.String())
+				}
+				if retry := recorder.Header().Get("Retry-After") != ""; retry != (tt.wantStatus == http.StatusTooManyRequests) {
+					t.Errorf("expected Retry-After only on a 429 but got %q", recorder.Header().Get("Retry-After"))
+				}
+				return
+			}
+			if flagged := upstream.Header.Get(TokenRateLimitedHeader) == "true"; flagged != tt.wantFlagged {
+				t.Errorf("expected flagged %v but got %v", tt.wantFlagged, flagged)
+			}
+		})
+	}
+}
+
+func TestInvalidTokenRateLimit_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *TokenRateLimit
+	}{
+		{name: "no rate", config: &TokenRateLimit{}},
+		{name: "negative burst", config: &TokenRateLimit{TokensPerMinute: 1, Burst: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.TokenRateLimit = tt.config
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
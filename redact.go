@@ -0,0 +1,146 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// promptRedactor replaces the matches of its patterns in the prompt text of a request body
+type promptRedactor struct {
+	patterns    []namedPattern
+	placeholder string
+}
+
+// redactPrompt replaces the matches in the system prompt and the text of the messages
+func (p *promptRedactor) redactPrompt(members map[string]json.RawMessage) error {
+	if system, ok := members["system"]; ok {
+		redacted, err := p.redactContent(system)
+		if err != nil {
+			return err
+		}
+		members["system"] = redacted
+	}
+
+	raw, ok := members["messages"]
+	if !ok {
+		return nil
+	}
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return err
+	}
+	for _, message := range messages {
+		content, ok := message["content"]
+		if !ok {
+			continue
+		}
+		redacted, err := p.redactContent(content)
+		if err != nil {
+			return err
+		}
+		message["content"] = redacted
+	}
+
+	redacted, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	members["messages"] = redacted
+	return nil
+}
+
+// redactContent replaces the matches in string content and in the text parts of array content
+func (p *promptRedactor) redactContent(content json.RawMessage) (json.RawMessage, error) {
+	if len(content) == 0 {
+		return content, nil
+	}
+	if content[0] == '"' {
+		return p.redactString(content)
+	}
+	if content[0] != '[' {
+		return content, nil
+	}
+
+	var parts []map[string]json.RawMessage
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		if text, ok := part["text"]; ok && strings.TrimSpace(string(part["type"])) == `"text"` {
+			redacted, err := p.redactString(text)
+			if err != nil {
+				return nil, err
+			}
+			part["text"] = redacted
+		}
+	}
+	return json.Marshal(parts)
+}
+
+// redactString replaces the matches in a JSON string
+func (p *promptRedactor) redactString(raw json.RawMessage) (json.RawMessage, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return nil, err
+	}
+	for _, pattern := range p.patterns {
+		text = pattern.regex.ReplaceAllLiteralString(text, p.placeholder)
+	}
+	return json.Marshal(text)
+}
+
+// bodyRedactor copies request bodies with top level fields and personal data in the prompt text redacted, for bodies
+// that leave the request path such as shadow events and captures
+type bodyRedactor struct {
+	maxBodyBytes int64
+	fields       []string
+	redactor     *promptRedactor
+}
+
+// newBodyRedactor redacts the given top level fields, by default user, of bodies up to maxBodyBytes (default 1 MiB)
+func newBodyRedactor(maxBodyBytes int64, fields []string) *bodyRedactor {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = 1 << 20
+	}
+	if fields == nil {
+		fields = []string{"user"}
+	}
+	return &bodyRedactor{
+		maxBodyBytes: maxBodyBytes,
+		fields:       fields,
+		redactor:     &promptRedactor{patterns: defaultPIIPatterns, placeholder: "[redacted]"},
+	}
+}
+
+// redactedBody returns the redacted body without the fields that must never be emitted, or nil when the body is larger
+// than the limit or not a JSON object. The request body is left intact for the upstream.
+func (b *bodyRedactor) redactedBody(r *http.Request, neverEmit map[string]bool) json.RawMessage {
+	data, truncated, err := readBodyPrefix(r, b.maxBodyBytes)
+	if err != nil || truncated {
+		return nil
+	}
+
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil
+	}
+	for path := range neverEmit {
+		deletePath(members, path)
+	}
+	placeholder, _ := json.Marshal(b.redactor.placeholder)
+	for _, field := range b.fields {
+		if _, ok := members[field]; ok {
+			members[field] = placeholder
+		}
+	}
+	if err := b.redactor.redactPrompt(members); err != nil {
+		return nil
+	}
+
+	redacted, err := json.Marshal(members)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
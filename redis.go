@@ -0,0 +1,221 @@
+package traefik_openai_header
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisConfig is the Redis server shared by the features that keep state across Traefik instances
+type RedisConfig struct {
+	Address   string `json:"address"`
+	Password  string `json:"password"`
+	DB        int    `json:"db"`
+	Timeout   string `json:"timeout"`
+	KeyPrefix string `json:"keyPrefix"`
+}
+
+// maxIdleRedisConnections is the number of connections kept open between commands
+const maxIdleRedisConnections = 4
+
+// redisClient is a minimal client for the Redis serialization protocol, sufficient for the few commands the
+// middleware needs without pulling in a dependency the plugin interpreter cannot load
+type redisClient struct {
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+	prefix   string
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// errRedisNil is returned for a nil reply, such as a GET of a missing key
+var errRedisNil = errors.New("redis: nil")
+
+func newRedisClient(config *RedisConfig) (*redisClient, error) {
+	if config == nil || config.Address == "" {
+		return nil, errors.New("redis address is not configured")
+	}
+
+	timeout := time.Second
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid redis timeout %q", config.Timeout)
+		}
+	}
+
+	prefix := config.KeyPrefix
+	if prefix == "" {
+		prefix = "openai-header:"
+	}
+
+	return &redisClient{
+		address:  config.Address,
+		password: config.Password,
+		db:       config.DB,
+		timeout:  timeout,
+		prefix:   prefix,
+		idle:     make(chan *redisConn, maxIdleRedisConnections),
+	}, nil
+}
+
+// key returns the key prefixed with the configured namespace
+func (c *redisClient) key(key string) string {
+	return c.prefix + key
+}
+
+// do sends a command and returns its reply: a string, an int64, nil or a slice of replies. Error replies are returned
+// as errors.
+func (c *redisClient) do(args ...string) (interface{}, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.command(c.timeout, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		_ = conn.conn.Close()
+		return nil, err
+	}
+
+	select {
+	case c.idle <- conn:
+	default:
+		_ = conn.conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one, authenticating and selecting the database
+func (c *redisClient) conn() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.password != "" {
+		if _, err := conn.command(c.timeout, "AUTH", c.password); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.command(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// command writes the command as an array of bulk strings and reads the reply
+func (c *redisConn) command(timeout time.Duration, args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	var command strings.Builder
+	command.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		command.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := c.conn.Write([]byte(command.String())); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.reader)
+}
+
+// readRedisReply reads a single reply of the Redis serialization protocol
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		replies := make([]interface{}, count)
+		for i := range replies {
+			if replies[i], err = readRedisReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// get returns the value of the key, or errRedisNil when it does not exist
+func (c *redisClient) get(key string) (string, error) {
+	reply, err := c.do("GET", c.key(key))
+	if err != nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", errRedisNil
+	}
+	return value, nil
+}
+
+// set stores the value with an expiry
+func (c *redisClient) set(key string, value string, ttl time.Duration) error {
+	_, err := c.do("SET", c.key(key), value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
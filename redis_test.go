@@ -0,0 +1,161 @@
+package traefik_openai_header
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process server speaking enough of the Redis protocol for the commands the middleware sends
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %s", err)
+	}
+	server := &fakeRedis{listener: listener, values: map[string]string{}}
+	go server.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return server
+}
+
+func (s *fakeRedis) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readRedisReply(reader)
+		if err != nil {
+			return
+		}
+		parts := reply.([]interface{})
+		args := make([]string, len(parts))
+		for i, part := range parts {
+			args[i] = part.(string)
+		}
+		_, _ = conn.Write([]byte(s.execute(args)))
+	}
+}
+
+func (s *fakeRedis) execute(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, strings.Join(args, " "))
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case "SET":
+		s.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "INCR":
+		value, _ := strconv.Atoi(s.values[args[1]])
+		value++
+		s.values[args[1]] = strconv.Itoa(value)
+		return ":" + strconv.Itoa(value) + "\r\n"
+	case "INCRBY":
+		value, _ := strconv.Atoi(s.values[args[1]])
+		increment, _ := strconv.Atoi(args[2])
+		value += increment
+		s.values[args[1]] = strconv.Itoa(value)
+		return ":" + strconv.Itoa(value) + "\r\n"
+	case "MGET":
+		reply := "*" + strconv.Itoa(len(args)-1) + "\r\n"
+		for _, key := range args[1:] {
+			value, ok := s.values[key]
+			if !ok {
+				reply += "$-1\r\n"
+				continue
+			}
+			reply += "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+		}
+		return reply
+	case "PEXPIRE":
+		if _, ok := s.values[args[1]]; !ok {
+			return ":0\r\n"
+		}
+		return ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func TestRedisClient(t *testing.T) {
+	server := newFakeRedis(t)
+	client, err := newRedisClient(&RedisConfig{Address: server.address(), Password: "secret", DB: 2, Timeout: "1s"})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	if _, err := client.get("missing"); err != errRedisNil {
+		t.Errorf("expected a nil reply for a missing key but got %v", err)
+	}
+	if err := client.set("key", "value\r\nwith newline", time.Minute); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	value, err := client.get("key")
+	if err != nil || value != "value\r\nwith newline" {
+		t.Errorf("expected the stored value but got %q %v", value, err)
+	}
+	if _, err := client.do("INCR", client.key("counter")); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.commands[0] != "AUTH secret" || server.commands[1] != "SELECT 2" {
+		t.Errorf("expected the connection to authenticate and select the database once, got %v", server.commands)
+	}
+	if len(server.commands) != 6 {
+		t.Errorf("expected the connection to be reused, got %v", server.commands)
+	}
+	if _, ok := server.values["openai-header:key"]; !ok {
+		t.Errorf("expected keys to be prefixed, got %v", server.values)
+	}
+}
+
+func TestRedisClientWrongPassword(t *testing.T) {
+	server := newFakeRedis(t)
+	client, err := newRedisClient(&RedisConfig{Address: server.address(), Password: "wrong"})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, err := client.get("key"); err == nil {
+		t.Errorf("expected an error for a wrong password")
+	}
+}
@@ -0,0 +1,73 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// extractor extracts the field values of the requests of one endpoint kind. r is nil when only the body is available,
+// as for Extract.
+type extractor interface {
+	extract(d *fieldDecoder, r *http.Request) (map[string]string, error)
+}
+
+// endpointExtractor is an extractor registered for the requests it claims. The kind it declares selects the options
+// that apply to the requests, such as the endpoint policy and the features of chat completions; match may claim a
+// request by anything in it, not only its URI.
+type endpointExtractor interface {
+	extractor
+	kind() EndpointKind
+	match(r *http.Request) bool
+}
+
+// bodyExtractor extracts the field values from the body alone
+type bodyExtractor func(d *fieldDecoder) (map[string]string, error)
+
+func (f bodyExtractor) extract(d *fieldDecoder, _ *http.Request) (map[string]string, error) {
+	return f(d)
+}
+
+// operationExtractor adds a fixed operation to the values of an extractor shared by several endpoint kinds
+type operationExtractor struct {
+	extractor
+	operation string
+}
+
+func (o operationExtractor) extract(d *fieldDecoder, r *http.Request) (map[string]string, error) {
+	values, err := o.extractor.extract(d, r)
+	values["operation"] = o.operation
+	return values, err
+}
+
+// geminiExtractor adds the model and streaming mode, which Gemini only has in the request URI
+type geminiExtractor struct{}
+
+func (geminiExtractor) extract(d *fieldDecoder, r *http.Request) (map[string]string, error) {
+	values, err := extractGeminiGenerateContentFields(d)
+	if r == nil {
+		return values, err
+	}
+	if match := geminiMethod.FindStringSubmatch(r.URL.Path); match != nil {
+		values["model"] = match[1]
+		streaming := match[2] == "streamGenerateContent" || r.URL.Query().Get("alt") == "sse"
+		values["stream"] = strconv.FormatBool(streaming)
+	}
+	return values, err
+}
+
+// extractors registers the extractor of every endpoint kind. A new endpoint kind only needs an entry here and a URI
+// regex in the configuration, which registers the extractor as a uriExtractor; ServeHTTP asks the registered
+// extractors which claim a request without knowing the kinds.
+var extractors = map[EndpointKind]extractor{
+	ChatCompletionEndpoint:        bodyExtractor(extractChatCompletionFields),
+	BatchEndpoint:                 bodyExtractor(extractBatchFields),
+	AnthropicMessagesEndpoint:     bodyExtractor(extractAnthropicMessagesFields),
+	AnthropicCountTokensEndpoint:  operationExtractor{extractor: bodyExtractor(extractAnthropicMessagesFields), operation: "count_tokens"},
+	GeminiGenerateContentEndpoint: geminiExtractor{},
+	FileUploadEndpoint:            bodyExtractor(extractFileUploadFields),
+	UploadEndpoint:                bodyExtractor(extractUploadFields),
+	UploadPartEndpoint:            bodyExtractor(extractUploadPartFields),
+	EvalEndpoint:                  bodyExtractor(extractEvalFields),
+	EvalRunEndpoint:               bodyExtractor(extractEvalRunFields),
+	CompletionEndpoint:            bodyExtractor(extractCompletionFields),
+}
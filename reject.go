@@ -0,0 +1,134 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RejectionTemplate is the response returned for a rejection reason instead of the default OpenAI style error
+type RejectionTemplate struct {
+	ContentType string `json:"contentType"`
+	Body        string `json:"body"`
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message string      `json:"message"`
+	Type    string      `json:"type"`
+	Param   interface{} `json:"param"`
+	Code    string      `json:"code"`
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// rejection describes why the middleware answers a request itself. The code identifies the rejection reason and
+// selects the configured template; values fill the template placeholders.
+type rejection struct {
+	status    int
+	errorType string
+	code      string
+	message   string
+	values    map[string]string
+}
+
+// reject responds with the rejection, rendered with the template configured for its code if there is one. A status
+// configured for the code replaces the default status of the rejection.
+func (e *Handler) reject(w http.ResponseWriter, rej rejection) {
+	e.metrics.inc("rejections_total")
+	e.metrics.incLabel("rejections_by_code", rej.code)
+	if e.logSampling != nil {
+		if log := findLogWriter(w); log != nil {
+			log.rejection = rej.code
+		}
+	}
+	if status, ok := e.rejectionStatusCodes[rej.code]; ok {
+		rej.status = status
+	}
+
+	template, ok := e.rejectionTemplates[rej.code]
+	if !ok {
+		writeError(w, rej.status, rej.errorType, rej.code, rej.message)
+		return
+	}
+
+	contentType := template.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	escape := strings.Contains(contentType, "json")
+
+	body := placeholder.ReplaceAllStringFunc(template.Body, func(reference string) string {
+		value := rej.placeholderValue(placeholder.FindStringSubmatch(reference)[1])
+		if escape {
+			return jsonEscape(value)
+		}
+		return value
+	})
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(rej.status)
+	_, _ = w.Write([]byte(body))
+}
+
+// placeholderValue returns the value of a template placeholder, or an empty string for unknown placeholders
+func (rej rejection) placeholderValue(name string) string {
+	switch name {
+	case "status":
+		return strconv.Itoa(rej.status)
+	case "type":
+		return rej.errorType
+	case "code":
+		return rej.code
+	case "message":
+		return rej.message
+	}
+	return rej.values[name]
+}
+
+// jsonEscape escapes a value for use inside a JSON string
+func jsonEscape(value string) string {
+	quoted, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(quoted[1 : len(quoted)-1])
+}
+
+// writeError responds with an error in the envelope the OpenAI API uses, so client SDKs surface the message
+func writeError(w http.ResponseWriter, status int, errorType string, code string, message string) {
+	body, err := json.Marshal(errorBody{Error: errorDetail{Message: message, Type: errorType, Code: code}})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// fail handles an error of the middleware itself. It reports whether the request was rejected; in the open failure
+// mode the request is passed on untouched instead.
+func (e *Handler) fail(w http.ResponseWriter, err error) bool {
+	if log := findLogWriter(w); e.logSampling != nil && log != nil {
+		log.failure = err.Error()
+	} else {
+		fmt.Println("Unable to process request", err.Error())
+	}
+	if !e.failClosed {
+		return false
+	}
+	e.reject(w, rejection{
+		status:    e.failureStatusCode,
+		errorType: "server_error",
+		code:      "middleware_failure",
+		message:   "The request could not be processed.",
+	})
+	return true
+}
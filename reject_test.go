@@ -0,0 +1,238 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read(_ []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestFailureMode_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name              string
+		failureMode       string
+		failureStatusCode int
+		readOnly          bool
+		wantStatus        int
+		wantNext          bool
+	}{
+		{
+			name:       "open",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:        "closed",
+			failureMode: FailureModeClosed,
+			wantStatus:  http.StatusServiceUnavailable,
+		},
+		{
+			name:              "closed with status",
+			failureMode:       FailureModeClosed,
+			failureStatusCode: http.StatusBadGateway,
+			wantStatus:        http.StatusBadGateway,
+		},
+		{
+			name:        "closed but read only",
+			failureMode: FailureModeClosed,
+			readOnly:    true,
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.FailureMode = tt.failureMode
+			config.FailureStatusCode = tt.failureStatusCode
+			config.ReadOnly = tt.readOnly
+
+			calls := 0
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				calls++
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", io.NopCloser(failingReader{})))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantNext && calls != 1 {
+				t.Errorf("expected the request to be passed on once but got %d calls", calls)
+			}
+			if !tt.wantNext && calls != 0 {
+				t.Errorf("expected the request to be rejected but next was called")
+			}
+			if tt.wantNext && got.Get(ParseFailureHeader) != "" {
+				t.Errorf("expected the request to be passed on untouched, got %s", got.Get(ParseFailureHeader))
+			}
+		})
+	}
+}
+
+func TestInvalidFailureMode_New(t *testing.T) {
+	config := CreateConfig()
+	config.FailureMode = "sometimes"
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid failureMode")
+	}
+
+	config = CreateConfig()
+	config.FailureStatusCode = http.StatusForbidden
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for a non 5xx failureStatusCode")
+	}
+}
+
+func TestRejectionTemplates_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		templates   map[string]RejectionTemplate
+		wantType    string
+		wantBody    string
+		wantDefault bool
+	}{
+		{
+			name:        "default",
+			wantType:    "application/json",
+			wantDefault: true,
+		},
+		{
+			name: "json template",
+			templates: map[string]RejectionTemplate{
+				"endpoint_not_allowed": {Body: "{\"status\": {{status}}, \"reason\": \"{{code}}\", \"path\": \"{{ path }}\", \"unknown\": \"{{unknown}}\"}"},
+			},
+			wantType: "application/json",
+			wantBody: "{\"status\": 403, \"reason\": \"endpoint_not_allowed\", \"path\": \"/v1/batches\", \"unknown\": \"\"}",
+		},
+		{
+			name: "text template",
+			templates: map[string]RejectionTemplate{
+				"endpoint_not_allowed": {ContentType: "text/plain", Body: "{{message}}"},
+			},
+			wantType: "text/plain",
+			wantBody: "The endpoint /v1/batches is not allowed.",
+		},
+		{
+			name: "template for another reason",
+			templates: map[string]RejectionTemplate{
+				"middleware_failure": {Body: "{}"},
+			},
+			wantType:    "application/json",
+			wantDefault: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.DeniedEndpoints = []string{"batch"}
+			config.RejectionTemplates = tt.templates
+
+			e, err := New(nil, http.NotFoundHandler(), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/batches", strings.NewReader("{}")))
+
+			if recorder.Code != http.StatusForbidden {
+				t.Errorf("expected status %d but got %d", http.StatusForbidden, recorder.Code)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("expected content type %q but got %q", tt.wantType, got)
+			}
+			if tt.wantDefault {
+				var body errorBody
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Error.Code != "endpoint_not_allowed" {
+					t.Errorf("expected the default error body but got %s", recorder.Body.String())
+				}
+				return
+			}
+			if recorder.Body.String() != tt.wantBody {
+				t.Errorf("expected body %s but got %s", tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestRejectionTemplateEscaping(t *testing.T) {
+	e := &Handler{rejectionTemplates: map[string]RejectionTemplate{
+		"model_not_allowed": {Body: "{\"model\": \"{{model}}\"}"},
+	}}
+	recorder := httptest.NewRecorder()
+	e.reject(recorder, rejection{status: http.StatusForbidden, code: "model_not_allowed", values: map[string]string{"model": "gpt-\"4\""}})
+
+	want := "{\"model\": \"gpt-\\\"4\\\"\"}"
+	if recorder.Body.String() != want {
+		t.Errorf("expected body %s but got %s", want, recorder.Body.String())
+	}
+}
+
+func TestRejectionStatusCodes_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCodes map[string]int
+		want        int
+	}{
+		{
+			name: "default",
+			want: http.StatusForbidden,
+		},
+		{
+			name:        "configured",
+			statusCodes: map[string]int{"endpoint_not_allowed": http.StatusNotFound},
+			want:        http.StatusNotFound,
+		},
+		{
+			name:        "configured for another reason",
+			statusCodes: map[string]int{"middleware_failure": http.StatusBadGateway},
+			want:        http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.DeniedEndpoints = []string{"batch"}
+			config.RejectionStatusCodes = tt.statusCodes
+
+			e, err := New(nil, http.NotFoundHandler(), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/batches", strings.NewReader("{}")))
+
+			if recorder.Code != tt.want {
+				t.Errorf("expected status %d but got %d", tt.want, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidRejectionStatusCodes_New(t *testing.T) {
+	config := CreateConfig()
+	config.RejectionStatusCodes = map[string]int{"endpoint_not_allowed": http.StatusOK}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for a non error rejection status")
+	}
+}
@@ -0,0 +1,137 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fieldMappings returns the currently active field mappings, which may be replaced by a config file reload
+func (e *Handler) fieldMappings() (*headerMapper, []string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.mapper, e.mirrorResponseFields
+}
+
+// policies returns the currently active endpoint policy and rules, which may be replaced by a config file reload
+func (e *Handler) policies() (*endpointPolicy, []rule) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policy, e.rules
+}
+
+// loadConfigFile reads the JSON config file and replaces the field mappings, value mappings, header conditions,
+// allowed and denied endpoints and rules of the static config with the ones it contains
+func (e *Handler) loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fileConfig := &Config{}
+	if err := json.Unmarshal(data, fileConfig); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	fileConfig, err = expandConfig(fileConfig)
+	if err != nil {
+		return err
+	}
+
+	merged := *e.config
+	if fileConfig.RequestFields != nil {
+		merged.RequestFields = fileConfig.RequestFields
+	}
+	if fileConfig.MirrorResponseFields != nil {
+		merged.MirrorResponseFields = fileConfig.MirrorResponseFields
+	}
+	if fileConfig.ValueMappings != nil {
+		merged.ValueMappings = fileConfig.ValueMappings
+	}
+	if fileConfig.HeaderConditions != nil {
+		merged.HeaderConditions = fileConfig.HeaderConditions
+	}
+	if fileConfig.AllowedEndpoints != nil {
+		merged.AllowedEndpoints = fileConfig.AllowedEndpoints
+	}
+	if fileConfig.DeniedEndpoints != nil {
+		merged.DeniedEndpoints = fileConfig.DeniedEndpoints
+	}
+	if fileConfig.Rules != nil {
+		merged.Rules = fileConfig.Rules
+	}
+
+	mapper, err := newHeaderMapper(&merged)
+	if err != nil {
+		return err
+	}
+	policy, err := newEndpointPolicy(merged.AllowedEndpoints, merged.DeniedEndpoints)
+	if err != nil {
+		return err
+	}
+	rules, err := compileRules(merged.Rules)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mapper = mapper
+	e.mirrorResponseFields = merged.MirrorResponseFields
+	e.policy = policy
+	e.rules = rules
+	return nil
+}
+
+// watchConfigFile loads the config file once and keeps polling it for changes until the context is done
+func (e *Handler) watchConfigFile(ctx context.Context, path string, pollInterval string) error {
+	interval, err := time.ParseDuration(pollInterval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid configFilePollInterval %q", pollInterval)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := e.loadConfigFile(path); err != nil {
+		return err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		modTime := info.ModTime()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Println("Unable to stat config file", err.Error())
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+
+			if err := e.loadConfigFile(path); err != nil {
+				fmt.Println("Unable to reload config file", err.Error())
+				continue
+			}
+			modTime = info.ModTime()
+		}
+	}()
+
+	return nil
+}
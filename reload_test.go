@@ -0,0 +1,143 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFileReload_ServeHTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fields.json")
+	if err := os.WriteFile(path, []byte(`{"requestFields": {"model": "X-Model-V1"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := defaultConfig()
+	config.ConfigFile = path
+	config.ConfigFilePollInterval = "10ms"
+
+	var got http.Header
+	e, err := New(ctx, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), config, "reload")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	serve := func() {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+	}
+
+	serve()
+	if got.Get("X-Model-V1") != "gpt-4.1" {
+		t.Fatalf("expected initial config file mapping to be applied, got %v", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"requestFields": {"model": "X-Model-V2"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		serve()
+		if got.Get("X-Model-V2") == "gpt-4.1" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected reloaded mapping to be applied, got %v", got)
+}
+
+func TestConfigFileReloadPolicy_ServeHTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"deniedEndpoints": ["batch"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := defaultConfig()
+	config.ConfigFile = path
+	config.ConfigFilePollInterval = "10ms"
+
+	e, err := New(ctx, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "reload policy")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	serve := func(uri string, model string) int {
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, httptest.NewRequest("POST", uri, strings.NewReader("{\"model\": \""+model+"\"}")))
+		return recorder.Code
+	}
+
+	if serve("/v1/batches", "gpt-4.1") != http.StatusForbidden || serve("/v1/chat/completions", "o1") != http.StatusOK {
+		t.Fatalf("expected the initial denied endpoints to be applied")
+	}
+
+	reloaded := `{"deniedEndpoints": ["^/v1/fine_tuning"], "rules": [{"name": "no-o1", "when": [{"field": "model", "equals": "o1"}], "reject": {}}]}`
+	if err := os.WriteFile(path, []byte(reloaded), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if serve("/v1/fine_tuning/jobs", "gpt-4.1") == http.StatusForbidden {
+			if serve("/v1/batches", "gpt-4.1") != http.StatusOK {
+				t.Errorf("expected the reloaded policy to allow batches")
+			}
+			if serve("/v1/chat/completions", "o1") == http.StatusOK {
+				t.Errorf("expected the reloaded rule to reject o1")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected the reloaded denied endpoints to be applied")
+}
+
+func TestConfigFileInvalid_New(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("requestFields: {}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		interval string
+	}{
+		{name: "missing", path: filepath.Join(dir, "missing.json"), interval: "1s"},
+		{name: "invalid json", path: invalid, interval: "1s"},
+		{name: "invalid interval", path: invalid, interval: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ConfigFile = tt.path
+			config.ConfigFilePollInterval = tt.interval
+			if _, err := New(context.Background(), http.NotFoundHandler(), config, tt.name); err == nil {
+				t.Errorf("expected an error for config file %s", tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package traefik_openai_header
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter is the base of the response wrappers of the middleware. It records the status, calls onHeader once
+// before the header is written and onWrite with every chunk of the body before it is written. Flushes, hijacks and
+// ReadFrom are passed on to the wrapped writer, so wrapping a response never holds back a stream or breaks a protocol
+// upgrade.
+type responseWriter struct {
+	http.ResponseWriter
+	status   int
+	onHeader func(status int)
+	onWrite  func(data []byte)
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		if w.onHeader != nil {
+			w.onHeader(status)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.onWrite != nil {
+		w.onWrite(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// ReadFrom passes the body on to the ReadFrom of the wrapped writer, such as the sendfile path of the server, unless
+// the body has to be seen chunk by chunk
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.onWrite != nil {
+		return io.Copy(writerOnly{w}, src)
+	}
+	if readerFrom, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return readerFrom.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{w.ResponseWriter}, src)
+}
+
+// Flush forwards flushes so streamed responses are not held back
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over for protocol upgrades such as websockets
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking: %w", w.ResponseWriter, http.ErrNotSupported)
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writerOnly hides the ReadFrom of a writer, so io.Copy writes to it chunk by chunk
+type writerOnly struct {
+	io.Writer
+}
+
+// captureWriter passes the response on to the client while keeping a copy of the body up to a limit
+type captureWriter struct {
+	*responseWriter
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int64) *captureWriter {
+	c := &captureWriter{limit: limit}
+	c.responseWriter = &responseWriter{ResponseWriter: w, onWrite: c.capture}
+	return c
+}
+
+func (c *captureWriter) capture(data []byte) {
+	if c.overflow {
+		return
+	}
+	if int64(c.body.Len()+len(data)) > c.limit {
+		c.overflow = true
+		c.body.Reset()
+		return
+	}
+	c.body.Write(data)
+}
@@ -0,0 +1,148 @@
+package traefik_openai_header
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readerFromRecorder records whether the body was passed on through ReadFrom
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestResponseWriterPassthrough(t *testing.T) {
+	recorder := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	var status int
+	writer := &responseWriter{ResponseWriter: recorder, onHeader: func(s int) { status = s }}
+
+	if _, err := writer.ReadFrom(strings.NewReader("body")); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !recorder.readFrom || recorder.Body.String() != "body" {
+		t.Errorf("expected ReadFrom to be passed on but got %v %q", recorder.readFrom, recorder.Body.String())
+	}
+	if status != http.StatusOK || writer.status != http.StatusOK {
+		t.Errorf("expected the header hook to see status 200 but got %d", status)
+	}
+
+	writer.Flush()
+	if !recorder.Flushed {
+		t.Errorf("expected the flush to be passed on")
+	}
+	if _, _, err := writer.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("expected hijacking a recorder not to be supported but got %v", err)
+	}
+	if writer.Unwrap() != recorder {
+		t.Errorf("expected Unwrap to return the wrapped writer")
+	}
+}
+
+func TestResponseWriterReadFromObserved(t *testing.T) {
+	recorder := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	capture := newCaptureWriter(recorder, 1024)
+
+	if _, err := io.Copy(capture, strings.NewReader("body")); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if recorder.readFrom {
+		t.Errorf("expected a capturing writer not to pass ReadFrom on")
+	}
+	if capture.body.String() != "body" || recorder.Body.String() != "body" {
+		t.Errorf("expected the body to be captured and passed on but got %q %q", capture.body.String(), recorder.Body.String())
+	}
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	config := defaultConfig()
+	config.Backoff = &Backoff{}
+	config.RoutingHint = &RoutingHint{Threshold: "1s"}
+
+	handler, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, buffer, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		_, _ = buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		_ = buffer.Flush()
+	}), config, "hijack")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("expected the connection to be hijacked through the wrappers but got %d", resp.StatusCode)
+	}
+}
+
+func TestStreamedChatCompletionFlushes(t *testing.T) {
+	config := defaultConfig()
+	config.Backoff = &Backoff{}
+	config.RoutingHint = &RoutingHint{Threshold: "1s"}
+	config.Prices = map[string]ModelPrice{"gpt-4.1": {Input: 2, Output: 8}}
+	config.Budget = &Budget{Monthly: 100}
+	config.ResponseCache = &ResponseCache{}
+	config.Idempotency = &Idempotency{}
+
+	received := make(chan struct{})
+	handler, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": \"chunk %d\"}}]}\n\n", i)
+			w.(http.Flusher).Flush()
+			// the next chunk is only sent once the client received this one
+			select {
+			case <-received:
+			case <-time.After(2 * time.Second):
+				return
+			}
+		}
+	}), config, "stream")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"stream\": true}"))
+	req.Header.Set("Idempotency-Key", "stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected chunk %d to be flushed but got %v", i, err)
+		}
+		if !strings.Contains(line, fmt.Sprintf("chunk %d", i)) {
+			t.Fatalf("expected chunk %d but got %q", i, line)
+		}
+		_, _ = reader.ReadString('\n')
+		received <- struct{}{}
+	}
+}
@@ -0,0 +1,170 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RoutingHintHeader is set on the request and the response when the model is slow
+const RoutingHintHeader = "X-OpenAI-Routing-Hint"
+
+// RoutingHintDegraded is the routing hint of a model whose p95 latency is above the threshold
+const RoutingHintDegraded = "degraded"
+
+// maxLatencySamples limits the latencies kept per model and backend
+const maxLatencySamples = 1000
+
+// RoutingHint configures the degraded routing hint for models whose p95 time to first byte over a rolling window
+// exceeds a threshold
+type RoutingHint struct {
+	Threshold     string `json:"threshold"`
+	Window        string `json:"window"`
+	MinSamples    int    `json:"minSamples"`
+	BackendHeader string `json:"backendHeader"`
+}
+
+// routingHint tracks the latency per model and backend
+type routingHint struct {
+	threshold     time.Duration
+	window        time.Duration
+	minSamples    int
+	backendHeader string
+	mu            sync.Mutex
+	latencies     map[string]*latencySamples
+	now           func() time.Time
+}
+
+// latencySamples is a ring of recent latencies with the p95 last computed from them
+type latencySamples struct {
+	times     []time.Time
+	latencies []time.Duration
+	next      int
+	p95       time.Duration
+	computed  time.Time
+	counted   int
+}
+
+func newRoutingHint(config *RoutingHint) (*routingHint, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Threshold == "" {
+		return nil, errors.New("routingHint requires a threshold")
+	}
+	threshold, err := time.ParseDuration(config.Threshold)
+	if err != nil || threshold <= 0 {
+		return nil, fmt.Errorf("invalid routingHint threshold %q", config.Threshold)
+	}
+
+	window := 5 * time.Minute
+	if config.Window != "" {
+		if window, err = time.ParseDuration(config.Window); err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid routingHint window %q", config.Window)
+		}
+	}
+
+	minSamples := config.MinSamples
+	if minSamples < 0 || minSamples > maxLatencySamples {
+		return nil, fmt.Errorf("invalid routingHint minSamples %d", config.MinSamples)
+	}
+	if minSamples == 0 {
+		minSamples = 20
+	}
+
+	return &routingHint{
+		threshold:     threshold,
+		window:        window,
+		minSamples:    minSamples,
+		backendHeader: config.BackendHeader,
+		latencies:     map[string]*latencySamples{},
+		now:           time.Now,
+	}, nil
+}
+
+// key returns the model, with the backend when a backend header is configured
+func (h *routingHint) key(r *http.Request, model string) string {
+	if h.backendHeader == "" {
+		return model
+	}
+	return model + "\x00" + r.Header.Get(h.backendHeader)
+}
+
+// observe records the latency of a response
+func (h *routingHint) observe(key string, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples, ok := h.latencies[key]
+	if !ok {
+		samples = &latencySamples{}
+		h.latencies[key] = samples
+	}
+	if len(samples.latencies) < maxLatencySamples {
+		samples.times = append(samples.times, h.now())
+		samples.latencies = append(samples.latencies, latency)
+		return
+	}
+	samples.times[samples.next] = h.now()
+	samples.latencies[samples.next] = latency
+	samples.next = (samples.next + 1) % maxLatencySamples
+}
+
+// degraded reports whether the p95 latency within the window is above the threshold. Once there are enough samples the
+// p95 is recomputed at most once a second.
+func (h *routingHint) degraded(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples, ok := h.latencies[key]
+	if !ok {
+		return false
+	}
+	now := h.now()
+	if now.Sub(samples.computed) >= time.Second || samples.counted < h.minSamples {
+		samples.computed = now
+		samples.p95 = 0
+
+		var recent []time.Duration
+		for i, latency := range samples.latencies {
+			if now.Sub(samples.times[i]) <= h.window {
+				recent = append(recent, latency)
+			}
+		}
+		samples.counted = len(recent)
+		if len(recent) >= h.minSamples {
+			sort.Slice(recent, func(i, j int) bool { return recent[i] < recent[j] })
+			samples.p95 = recent[(len(recent)*95+99)/100-1]
+		}
+	}
+	return samples.p95 > h.threshold
+}
+
+// hintRouting sets the degraded routing hint on the request and the response when the model is slow, and returns the
+// writer that measures the time to first byte of the response
+func (e *Handler) hintRouting(w http.ResponseWriter, r *http.Request, values map[string]string) http.ResponseWriter {
+	model := values["model"]
+	if model == "" {
+		return w
+	}
+
+	key := e.routingHint.key(r, model)
+	if e.routingHint.degraded(key) {
+		e.metrics.incLabel("routing_degraded_by_model", model)
+		r.Header.Set(RoutingHintHeader, RoutingHintDegraded)
+		w.Header().Set(RoutingHintHeader, RoutingHintDegraded)
+	}
+
+	start := e.routingHint.now()
+	writer := &responseWriter{ResponseWriter: w}
+	writer.onHeader = func(int) {
+		// responses answered from the cache or coalesced with a duplicate say nothing about the upstream
+		if writer.Header().Get(CacheHeader) != "hit" && writer.Header().Get(DeduplicatedHeader) != "coalesced" {
+			e.routingHint.observe(key, e.routingHint.now().Sub(start))
+		}
+	}
+	return writer
+}
@@ -0,0 +1,109 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoutingHintDegraded(t *testing.T) {
+	hint, err := newRoutingHint(&RoutingHint{Threshold: "1s", Window: "1m", MinSamples: 20})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	hint.now = func() time.Time { return now }
+
+	for i := 0; i < 19; i++ {
+		hint.observe("gpt-4.1", 5*time.Second)
+	}
+	if hint.degraded("gpt-4.1") {
+		t.Errorf("expected too few samples not to be degraded")
+	}
+
+	now = now.Add(time.Second)
+	for i := 0; i < 81; i++ {
+		hint.observe("gpt-4.1", 100*time.Millisecond)
+	}
+	if !hint.degraded("gpt-4.1") {
+		t.Errorf("expected a p95 of 5s to be degraded")
+	}
+
+	now = now.Add(2 * time.Second)
+	for i := 0; i < 300; i++ {
+		hint.observe("gpt-4.1", 100*time.Millisecond)
+	}
+	if hint.degraded("gpt-4.1") {
+		t.Errorf("expected a p95 of 100ms not to be degraded")
+	}
+
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 19; i++ {
+		hint.observe("gpt-4.1", 5*time.Second)
+	}
+	if hint.degraded("gpt-4.1") {
+		t.Errorf("expected samples outside the window to be ignored")
+	}
+	if hint.degraded("gpt-4o") {
+		t.Errorf("expected unknown models not to be degraded")
+	}
+}
+
+func TestRoutingHint_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.RoutingHint = &RoutingHint{Threshold: "20ms", MinSamples: 2, BackendHeader: "X-Backend"}
+
+	var upstream *http.Request
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+		if r.Header.Get("X-Backend") == "slow" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}), config, "routing")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	serve := func(backend string) (string, string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+		req.Header.Set("X-Backend", backend)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return upstream.Header.Get(RoutingHintHeader), recorder.Header().Get(RoutingHintHeader)
+	}
+
+	for i := 0; i < 2; i++ {
+		serve("slow")
+		serve("fast")
+	}
+	if request, response := serve("slow"); request != RoutingHintDegraded || response != RoutingHintDegraded {
+		t.Errorf("expected the slow backend to be degraded but got %q %q", request, response)
+	}
+	if request, _ := serve("fast"); request != "" {
+		t.Errorf("expected the fast backend not to be degraded but got %q", request)
+	}
+}
+
+func TestInvalidRoutingHint_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RoutingHint
+	}{
+		{name: "no threshold", config: &RoutingHint{}},
+		{name: "threshold", config: &RoutingHint{Threshold: "slow"}},
+		{name: "window", config: &RoutingHint{Threshold: "1s", Window: "0s"}},
+		{name: "min samples", config: &RoutingHint{Threshold: "1s", MinSamples: maxLatencySamples + 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.RoutingHint = tt.config
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
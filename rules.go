@@ -0,0 +1,169 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Rule applies its actions to requests whose extracted fields satisfy all When conditions. Rules are evaluated in order
+// and a rejecting rule stops the evaluation.
+type Rule struct {
+	Name       string                 `json:"name"`
+	When       []Condition            `json:"when"`
+	SetHeaders map[string]string      `json:"setHeaders"`
+	SetFields  map[string]interface{} `json:"setFields"`
+	Tag        string                 `json:"tag"`
+	Reject     *RuleRejection         `json:"reject"`
+}
+
+// RuleRejection is the response of a rejecting rule
+type RuleRejection struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// rule is a compiled Rule
+type rule struct {
+	name       string
+	when       []condition
+	setHeaders map[string]string
+	setFields  map[string]json.RawMessage
+	tag        string
+	reject     *RuleRejection
+}
+
+// compileRules compiles the conditions of the rules and encodes the field values they set
+func compileRules(rules []Rule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		option := fmt.Sprintf("rules[%d]", i)
+		when, err := compileConditions(option, r.When)
+		if err != nil {
+			return nil, err
+		}
+
+		setFields := make(map[string]json.RawMessage, len(r.SetFields))
+		for field, value := range r.SetFields {
+			if setFields[field], err = encodeFieldValue(value); err != nil {
+				return nil, fmt.Errorf("invalid %s value for %s: %w", option, field, err)
+			}
+		}
+
+		var reject *RuleRejection
+		if r.Reject != nil {
+			rejection := *r.Reject
+			if rejection.Code == "" {
+				rejection.Code = "rule_rejected"
+			}
+			if rejection.StatusCode == 0 {
+				rejection.StatusCode = http.StatusForbidden
+			}
+			if rejection.StatusCode < 400 || rejection.StatusCode > 599 {
+				return nil, fmt.Errorf("invalid %s reject statusCode %d", option, rejection.StatusCode)
+			}
+			if rejection.Message == "" {
+				rejection.Message = "The request was rejected by policy."
+			}
+			reject = &rejection
+		}
+
+		compiled = append(compiled, rule{
+			name:       r.Name,
+			when:       when,
+			setHeaders: r.SetHeaders,
+			setFields:  setFields,
+			tag:        r.Tag,
+			reject:     reject,
+		})
+	}
+	return compiled, nil
+}
+
+// encodeFieldValue encodes a configured field value as JSON. Strings holding a number or boolean are encoded as such,
+// because configuration from labels only provides strings.
+func encodeFieldValue(value interface{}) (json.RawMessage, error) {
+	if text, ok := value.(string); ok && isJSONScalar(text) {
+		return json.RawMessage(text), nil
+	}
+	return json.Marshal(value)
+}
+
+// applyRules evaluates the rules against the extracted field values and applies the actions of the rules that match.
+// It reports whether the request was rejected. Read-only mode skips the field rewrites and rejections.
+func (e *Handler) applyRules(w http.ResponseWriter, r *http.Request, mapper *headerMapper, values map[string]string) bool {
+	_, rules := e.policies()
+	if len(rules) == 0 {
+		return false
+	}
+	if values == nil {
+		values = map[string]string{}
+	}
+
+	rewrites := map[string]json.RawMessage{}
+	var tags []string
+	for _, rule := range rules {
+		if !allHold(rule.when, values) {
+			continue
+		}
+
+		for name, value := range rule.setHeaders {
+			e.setHeader(r.Header, name, value)
+		}
+		if rule.tag != "" {
+			tags = append(tags, rule.tag)
+		}
+		if e.readOnly {
+			continue
+		}
+
+		for field, value := range rule.setFields {
+			rewrites[field] = value
+			if text, ok := scalarText(value); ok {
+				values[field] = text
+			} else {
+				delete(values, field)
+			}
+		}
+		if rule.reject != nil {
+			placeholders := map[string]string{"rule": rule.name}
+			for field, value := range values {
+				placeholders[field] = value
+			}
+			e.reject(w, rejection{
+				status:    rule.reject.StatusCode,
+				errorType: "invalid_request_error",
+				code:      rule.reject.Code,
+				message:   rule.reject.Message,
+				values:    placeholders,
+			})
+			return true
+		}
+	}
+
+	if len(tags) > 0 {
+		e.setHeader(r.Header, TagsHeader, strings.Join(tags, ","))
+	}
+	if len(rewrites) == 0 {
+		return false
+	}
+
+	if err := rewriteBodyFields(r, rewrites); err != nil {
+		return e.fail(w, fmt.Errorf("unable to rewrite body: %w", err))
+	}
+
+	rewritten := map[string]bool{mapper.combinedHeader: mapper.combinedHeader != ""}
+	for field := range rewrites {
+		for _, name := range mapper.fieldHeaders(field) {
+			rewritten[name] = true
+		}
+	}
+	for name, value := range mapper.headers(values, nil) {
+		if rewritten[name] {
+			r.Header.Set(name, value)
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRules_ServeHTTP(t *testing.T) {
+	rules := []Rule{
+		{
+			Name: "cap-temperature",
+			When: []Condition{
+				{Field: "model", Glob: "gpt-4*"},
+				{Field: "temperature", GreaterThan: floatPointer(1.5)},
+			},
+			SetFields: map[string]interface{}{"temperature": "1.5"},
+			Tag:       "temperature-capped",
+		},
+		{
+			Name:       "anonymous",
+			When:       []Condition{{Field: "user", Absent: true}},
+			SetHeaders: map[string]string{"X-OpenAI-Anonymous": "true"},
+			Tag:        "anonymous",
+		},
+		{
+			Name:   "no-legacy-models",
+			When:   []Condition{{Field: "model", Matches: "^gpt-3"}},
+			Reject: &RuleRejection{Code: "model_not_allowed", Message: "Legacy models are no longer available."},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		readOnly   bool
+		wantStatus int
+		wantBody   map[string]string
+		want       map[string]string
+	}{
+		{
+			name:       "no rule matches",
+			input:      "{\"model\": \"gpt-4.1\", \"temperature\": 0.7, \"user\": \"alice\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]string{"temperature": "0.7"},
+			want:       map[string]string{"X-OpenAI-Temperature": "0.7", TagsHeader: "", "X-OpenAI-Anonymous": ""},
+		},
+		{
+			name:       "rewrite field",
+			input:      "{\"model\": \"gpt-4.1\", \"temperature\": 1.9, \"user\": \"alice\"}",
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]string{"temperature": "1.5", "model": "\"gpt-4.1\""},
+			want:       map[string]string{"X-OpenAI-Temperature": "1.5", TagsHeader: "temperature-capped"},
+		},
+		{
+			name:       "several rules match",
+			input:      "{\"model\": \"gpt-4.1\", \"temperature\": 1.9}",
+			wantStatus: http.StatusOK,
+			want:       map[string]string{TagsHeader: "temperature-capped,anonymous", "X-OpenAI-Anonymous": "true"},
+		},
+		{
+			name:       "reject",
+			input:      "{\"model\": \"gpt-3.5-turbo\", \"user\": \"alice\"}",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "read only",
+			input:      "{\"model\": \"gpt-3.5-turbo\", \"temperature\": 1.9}",
+			readOnly:   true,
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]string{"temperature": "1.9"},
+			want:       map[string]string{"X-OpenAI-Temperature": "1.9", TagsHeader: "anonymous"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Rules = rules
+			config.ReadOnly = tt.readOnly
+
+			var got http.Header
+			var body map[string]json.RawMessage
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				data, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(data, &body); err != nil {
+					t.Errorf("expected a JSON body to be forwarded: %s", err)
+				}
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				var rejected errorBody
+				if err := json.Unmarshal(recorder.Body.Bytes(), &rejected); err != nil || rejected.Error.Code != "model_not_allowed" {
+					t.Errorf("expected a model_not_allowed error but got %s", recorder.Body.String())
+				}
+				return
+			}
+			for field, value := range tt.wantBody {
+				if string(body[field]) != value {
+					t.Errorf("expected body field %s to be %s but got %s", field, value, body[field])
+				}
+			}
+			for header, value := range tt.want {
+				if got.Get(header) != value {
+					t.Errorf("expected header %v to be %q but got %q", header, value, got.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidRules_New(t *testing.T) {
+	config := CreateConfig()
+	config.Rules = []Rule{{Name: "status", Reject: &RuleRejection{StatusCode: http.StatusOK}}}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for a non error reject status")
+	}
+
+	config = CreateConfig()
+	config.Rules = []Rule{{Name: "glob", When: []Condition{{Field: "model", Glob: "gpt-["}}}}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid glob")
+	}
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,161 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Shadow configures the asynchronous mirroring of request metadata, and optionally redacted bodies, to a secondary
+// endpoint
+type Shadow struct {
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	Timeout      string            `json:"timeout"`
+	QueueSize    int               `json:"queueSize"`
+	Body         bool              `json:"body"`
+	MaxBodyBytes int64             `json:"maxBodyBytes"`
+	RedactFields []string          `json:"redactFields"`
+}
+
+// shadowEvent is the JSON document posted to the shadow endpoint for every extracted request
+type shadowEvent struct {
+	Time   time.Time         `json:"time"`
+	Method string            `json:"method"`
+	Host   string            `json:"host"`
+	Path   string            `json:"path"`
+	Kinds  []EndpointKind    `json:"kinds"`
+	Values map[string]string `json:"values"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// shadow posts the queued events from a single worker so the primary request never waits for the shadow endpoint
+type shadow struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	queue   chan shadowEvent
+	body    *bodyRedactor
+	metrics *metrics
+}
+
+func newShadow(ctx context.Context, config *Shadow, m *metrics) (*shadow, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	target, err := url.Parse(config.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid shadow url %q", config.URL)
+	}
+
+	timeout := 2 * time.Second
+	if config.Timeout != "" {
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid shadow timeout %q", config.Timeout)
+		}
+	}
+
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	var body *bodyRedactor
+	if config.Body {
+		body = newBodyRedactor(config.MaxBodyBytes, config.RedactFields)
+	}
+
+	s := &shadow{
+		url:     config.URL,
+		headers: config.Headers,
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan shadowEvent, queueSize),
+		body:    body,
+		metrics: m,
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go s.run(ctx)
+	return s, nil
+}
+
+// run posts the queued events until the context is done
+func (s *shadow) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			if err := s.send(event); err != nil {
+				s.metrics.inc("shadow_failures_total")
+				fmt.Println("Unable to mirror request", err.Error())
+				continue
+			}
+			s.metrics.inc("shadow_sent_total")
+		}
+	}
+}
+
+func (s *shadow) send(event shadowEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("shadow endpoint responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// mirrorShadow queues the extracted values of the request, hashed and redacted like their headers, and the redacted
+// body when configured. Events are dropped when the queue is full.
+func (e *Handler) mirrorShadow(r *http.Request, mapper *headerMapper, kinds []EndpointKind, values map[string]string) {
+	if e.shadow == nil || values == nil {
+		return
+	}
+
+	translated := make(map[string]string, len(values))
+	for field, value := range mapper.emitted(values) {
+		translated[field] = mapper.translate(field, value)
+	}
+	event := shadowEvent{
+		Time:   time.Now().UTC(),
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		Kinds:  kinds,
+		Values: translated,
+	}
+	if e.shadow.body != nil {
+		event.Body = e.shadow.body.redactedBody(r, mapper.neverEmit)
+	}
+
+	select {
+	case e.shadow.queue <- event:
+	default:
+		e.metrics.inc("shadow_dropped_total")
+	}
+}
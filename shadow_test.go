@@ -0,0 +1,132 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShadow_ServeHTTP(t *testing.T) {
+	events := make(chan shadowEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event shadowEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid shadow event: %s", err)
+		}
+		if r.Header.Get("X-Shadow-Token") != "secret" {
+			t.Errorf("expected the configured shadow headers")
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := defaultConfig()
+	config.HashFields = []string{"user"}
+	config.Shadow = &Shadow{URL: server.URL, Headers: map[string]string{"X-Shadow-Token": "secret"}, Body: true}
+
+	var forwarded string
+	e, err := New(ctx, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		forwarded = string(data)
+	}), config, "shadow")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	input := "{\"model\":\"gpt-4.1\",\"user\":\"alice\",\"messages\":[{\"role\":\"user\",\"content\":\"Mail bob@example.com\"}]}"
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+	if forwarded != input {
+		t.Errorf("expected the upstream to receive the original body but got %s", forwarded)
+	}
+
+	select {
+	case event := <-events:
+		if event.Path != "/v1/chat/completions" || event.Values["model"] != "gpt-4.1" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if want := hashValue("alice"); event.Values["user"] != want {
+			t.Errorf("expected the hashed user %q but got %q", want, event.Values["user"])
+		}
+		if want := "{\"messages\":[{\"content\":\"Mail [redacted]\",\"role\":\"user\"}],\"model\":\"gpt-4.1\",\"user\":\"[redacted]\"}"; string(event.Body) != want {
+			t.Errorf("expected body %s but got %s", want, event.Body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected a shadow event")
+	}
+}
+
+func TestNeverEmitShadow_ServeHTTP(t *testing.T) {
+	events := make(chan shadowEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var event shadowEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid shadow event: %s", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := defaultConfig()
+	config.NeverEmit = []string{"user", "messages", "metadata.ssn"}
+	config.Shadow = &Shadow{URL: server.URL, Body: true, RedactFields: []string{}}
+
+	e, err := New(ctx, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "shadow")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	input := "{\"model\":\"gpt-4.1\",\"user\":\"alice\",\"metadata\":{\"ssn\":\"123\",\"team\":\"search\"},\"messages\":[{\"role\":\"user\",\"content\":\"hi\"}]}"
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+	select {
+	case event := <-events:
+		if _, ok := event.Values["user"]; ok || event.Values["model"] != "gpt-4.1" {
+			t.Errorf("expected the user to be left out of the values but got %v", event.Values)
+		}
+		if want := "{\"metadata\":{\"team\":\"search\"},\"model\":\"gpt-4.1\"}"; string(event.Body) != want {
+			t.Errorf("expected body %s but got %s", want, event.Body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected a shadow event")
+	}
+}
+
+func TestShadowQueueFull(t *testing.T) {
+	m := newMetrics()
+	e := &Handler{
+		metrics: m,
+		shadow:  &shadow{queue: make(chan shadowEvent, 1), metrics: m},
+	}
+	mapper, err := newHeaderMapper(CreateConfig())
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	e.mirrorShadow(req, mapper, []EndpointKind{ChatCompletionEndpoint}, map[string]string{"model": "gpt-4.1"})
+	e.mirrorShadow(req, mapper, []EndpointKind{ChatCompletionEndpoint}, map[string]string{"model": "gpt-4.1"})
+
+	if got := m.counter("shadow_dropped_total"); got != 1 {
+		t.Errorf("expected 1 dropped event but got %d", got)
+	}
+}
+
+func TestInvalidShadow_New(t *testing.T) {
+	config := CreateConfig()
+	config.Shadow = &Shadow{URL: "staging-eval:8080/ingest"}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for an invalid shadow url")
+	}
+}
@@ -0,0 +1,65 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Stats exposes the counters of the middleware as JSON, either on a path of the routed traffic or, when an address is
+// set, on a separate listener
+type Stats struct {
+	Path    string `json:"path"`
+	Address string `json:"address"`
+}
+
+// startStatsListener serves the stats on their own address, at the stats path or /stats, until the context is done.
+// The address is bound before returning so that a conflict is a configuration error.
+func (e *Handler) startStatsListener(ctx context.Context, config *Stats) error {
+	if config == nil || config.Address == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return fmt.Errorf("invalid stats address %s: %w", config.Address, err)
+	}
+
+	path := config.Path
+	if path == "" {
+		path = "/stats"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, e.serveStats)
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			fmt.Println("Unable to serve stats", err.Error())
+		}
+	}()
+	if ctx != nil {
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+	}
+	return nil
+}
+
+// serveStats writes a snapshot of the counters
+func (e *Handler) serveStats(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(e.metrics.snapshot()); err != nil {
+		fmt.Println("Unable to write stats", err.Error())
+	}
+}
+
+// parseFailure reports why the body could not be extracted from in the parse failure header
+func (e *Handler) parseFailure(r *http.Request, reason string) {
+	r.Header.Set(ParseFailureHeader, reason)
+	e.metrics.inc("parse_failures_total")
+}
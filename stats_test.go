@@ -0,0 +1,94 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStats_ServeHTTP(t *testing.T) {
+	config := CreateConfig()
+	config.Stats = &Stats{Path: "/_openai-header/stats"}
+	config.DeniedEndpoints = []string{"batch"}
+
+	forwarded := 0
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		forwarded++
+	}), config, "stats")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	for _, input := range []string{"{\"model\": \"gpt-4.1\"}", "{\"model\": \"gpt-4.1\"}", "{\"model\": \"o3\"}", "not json"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/batches", strings.NewReader("{}")))
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("GET", "/_openai-header/stats", nil))
+	if forwarded != 4 {
+		t.Errorf("expected the stats request not to be forwarded but got %d forwarded requests", forwarded)
+	}
+
+	var got stats
+	if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid stats %s: %s", recorder.Body.String(), err)
+	}
+	for name, want := range map[string]int64{"requests_matched_total": 4, "parse_failures_total": 1, "rejections_total": 1} {
+		if got.Counters[name] != want {
+			t.Errorf("expected %s to be %d but got %d", name, want, got.Counters[name])
+		}
+	}
+	if want := int64(2); got.Labeled["requests_by_model"]["gpt-4.1"] != want {
+		t.Errorf("expected %d gpt-4.1 requests but got %v", want, got.Labeled["requests_by_model"])
+	}
+	if want := int64(1); got.Labeled["rejections_by_code"]["endpoint_not_allowed"] != want {
+		t.Errorf("expected %d endpoint_not_allowed rejections but got %v", want, got.Labeled["rejections_by_code"])
+	}
+}
+
+func TestStatsListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := CreateConfig()
+	config.Stats = &Stats{Address: address}
+	e, err := New(ctx, http.NotFoundHandler(), config, "stats listener")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+	response, err := http.Get("http://" + address + "/stats")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer response.Body.Close()
+
+	var got stats
+	if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+		t.Fatalf("invalid stats: %s", err)
+	}
+	if want := int64(1); got.Counters["requests_matched_total"] != want {
+		t.Errorf("expected %d matched requests but got %d", want, got.Counters["requests_matched_total"])
+	}
+}
+
+func TestInvalidStats_New(t *testing.T) {
+	config := CreateConfig()
+	config.Stats = &Stats{}
+	if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+		t.Errorf("expected an error for stats without a path or an address")
+	}
+}
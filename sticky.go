@@ -0,0 +1,16 @@
+package traefik_openai_header
+
+import (
+	"encoding/json"
+)
+
+// stickyKey hashes the value of the first of the fields that is set, so all requests of a user or conversation get the
+// same key. The field name is part of the hash, so a user and a conversation with the same identifier do not share a
+// key.
+func stickyKey(fields []string, values map[string]string, members map[string]json.RawMessage) string {
+	field, value, ok := firstFieldValue(fields, values, members)
+	if !ok {
+		return ""
+	}
+	return hashValue(field + "\x00" + value)
+}
@@ -0,0 +1,58 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStickyKey_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "conversation",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice\", \"metadata\": {\"conversation_id\": \"c-42\"}}",
+			want:  hashValue("metadata.conversation_id\x00c-42"),
+		},
+		{
+			name:  "user",
+			input: "{\"model\": \"gpt-4.1\", \"user\": \"alice\"}",
+			want:  hashValue("user\x00alice"),
+		},
+		{
+			name:  "empty conversation",
+			input: "{\"model\": \"o3\", \"user\": \"alice\", \"metadata\": {\"conversation_id\": \"\"}}",
+			want:  hashValue("user\x00alice"),
+		},
+		{
+			name:  "none",
+			input: "{\"model\": \"gpt-4.1\"}",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.StickyFields = []string{"metadata.conversation_id", "user"}
+
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.input)))
+
+			if got.Get("X-OpenAI-Sticky-Key") != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got.Get("X-OpenAI-Sticky-Key"))
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Syslog sends the sampled log lines as RFC 5424 messages to a syslog server over UDP or TCP. Over TCP the messages are
+// framed by octet counting as in RFC 6587.
+type Syslog struct {
+	Address   string `json:"address"`
+	Network   string `json:"network"`
+	Facility  int    `json:"facility"`
+	AppName   string `json:"appName"`
+	Hostname  string `json:"hostname"`
+	Timeout   string `json:"timeout"`
+	QueueSize int    `json:"queueSize"`
+}
+
+// Syslog severities of the log lines
+const (
+	syslogWarning       = 4
+	syslogInformational = 6
+)
+
+// syslogMessage is a queued log line with the body encoded in the log format
+type syslogMessage struct {
+	line logLine
+	body []byte
+}
+
+// syslogSink writes the queued messages from a single worker over one connection, which is dialed again after an
+// error, so the request never waits for the syslog server
+type syslogSink struct {
+	address  string
+	network  string
+	facility int
+	appName  string
+	hostname string
+	timeout  time.Duration
+	queue    chan syslogMessage
+	metrics  *metrics
+	conn     net.Conn
+}
+
+func newSyslogSink(ctx context.Context, config *Syslog, m *metrics) (*syslogSink, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q", config.Address)
+	}
+	network := config.Network
+	if network == "" {
+		network = "udp"
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("invalid syslog network %q", config.Network)
+	}
+	// local0 to local7 are 16 to 23
+	facility := config.Facility
+	if facility == 0 {
+		facility = 16
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility %d", config.Facility)
+	}
+	timeout := 5 * time.Second
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid syslog timeout %q", config.Timeout)
+		}
+	}
+	appName := config.AppName
+	if appName == "" {
+		appName = "traefik-openai-header"
+	}
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	s := &syslogSink{
+		address:  config.Address,
+		network:  network,
+		facility: facility,
+		appName:  syslogField(appName, 48),
+		hostname: syslogField(hostname, 255),
+		timeout:  timeout,
+		queue:    make(chan syslogMessage, queueSize),
+		metrics:  m,
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go s.run(ctx)
+	return s, nil
+}
+
+// syslogField returns the value for a header field of at most max printable ASCII characters, or the nil value -
+func syslogField(value string, max int) string {
+	field := make([]byte, 0, len(value))
+	for i := 0; i < len(value) && len(field) < max; i++ {
+		if value[i] > ' ' && value[i] < 0x7f {
+			field = append(field, value[i])
+		}
+	}
+	if len(field) == 0 {
+		return "-"
+	}
+	return string(field)
+}
+
+// run sends the queued messages until the context is done
+func (s *syslogSink) run(ctx context.Context) {
+	defer func() {
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-s.queue:
+			if err := s.send(message); err != nil {
+				s.metrics.inc("syslog_failures_total")
+				fmt.Println("Unable to send to syslog", err.Error())
+			}
+		}
+	}
+}
+
+// queueLog queues a log line and its encoded body and drops it when the queue is full
+func (s *syslogSink) queueLog(line logLine, body []byte) {
+	select {
+	case s.queue <- syslogMessage{line: line, body: body}:
+	default:
+		s.metrics.inc("syslog_dropped_total")
+	}
+}
+
+// send writes the message, dialing the server first when there is no connection
+func (s *syslogSink) send(message syslogMessage) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	data := s.format(message, time.Now())
+	if s.network == "tcp" {
+		data = append([]byte(strconv.Itoa(len(data))+" "), data...)
+	}
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(data); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// format returns the RFC 5424 message of the log line: the outcome is the message ID and failures are warnings
+func (s *syslogSink) format(message syslogMessage, now time.Time) []byte {
+	severity := syslogInformational
+	if message.line.Outcome == logOutcomeFailed {
+		severity = syslogWarning
+	}
+	timestamp := message.line.Time
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ", s.facility*8+severity,
+		timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.appName, os.Getpid(),
+		syslogField(message.line.Outcome, 32))
+	return append([]byte(header), message.body...)
+}
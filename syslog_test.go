@@ -0,0 +1,143 @@
+package traefik_openai_header
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslog_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+	}{
+		{name: "udp", network: "udp"},
+		{name: "tcp", network: "tcp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := make(chan string, 10)
+			var address string
+			if tt.network == "udp" {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+				defer conn.Close()
+				address = conn.LocalAddr().String()
+				go func() {
+					buffer := make([]byte, 65536)
+					for {
+						n, _, err := conn.ReadFrom(buffer)
+						if err != nil {
+							return
+						}
+						messages <- string(buffer[:n])
+					}
+				}()
+			} else {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+				defer listener.Close()
+				address = listener.Addr().String()
+				go func() {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					reader := bufio.NewReader(conn)
+					for {
+						length, err := reader.ReadString(' ')
+						if err != nil {
+							return
+						}
+						n, _ := strconv.Atoi(strings.TrimSpace(length))
+						message := make([]byte, n)
+						if _, err := io.ReadFull(reader, message); err != nil {
+							return
+						}
+						messages <- string(message)
+					}
+				}()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			config := defaultConfig()
+			config.LogSampling = &LogSampling{}
+			config.Syslog = &Syslog{Address: address, Network: tt.network, Hostname: "gateway-1"}
+			e, err := New(ctx, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			output := captureStdout(t, func() {
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("not json")))
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("")))
+			})
+			if output != "" {
+				t.Errorf("expected the log lines to be sent to syslog instead of printed but got %s", output)
+			}
+
+			for i := 0; i < 2; i++ {
+				select {
+				case message := <-messages:
+					header := regexp.MustCompile(`^<(\d+)>1 \S+Z gateway-1 traefik-openai-header \d+ (\S+) - `)
+					match := header.FindStringSubmatch(message)
+					if match == nil {
+						t.Fatalf("expected an RFC 5424 message but got %q", message)
+					}
+					// local0 warning
+					if match[1] != "132" || match[2] != "failed" {
+						t.Errorf("expected priority 132 and message ID failed but got %s and %s", match[1], match[2])
+					}
+					var line logLine
+					if err := json.Unmarshal([]byte(message[len(match[0]):]), &line); err != nil || line.Outcome != "failed" {
+						t.Errorf("expected the log line as message but got %q", message[len(match[0]):])
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("expected a syslog message")
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidSyslog_New(t *testing.T) {
+	tests := []struct {
+		name        string
+		logSampling *LogSampling
+		syslog      Syslog
+	}{
+		{name: "no log sampling", syslog: Syslog{Address: "127.0.0.1:514"}},
+		{name: "no address", logSampling: &LogSampling{}},
+		{name: "invalid network", logSampling: &LogSampling{}, syslog: Syslog{Address: "127.0.0.1:514", Network: "unix"}},
+		{name: "invalid facility", logSampling: &LogSampling{}, syslog: Syslog{Address: "127.0.0.1:514", Facility: 24}},
+		{name: "invalid timeout", logSampling: &LogSampling{}, syslog: Syslog{Address: "127.0.0.1:514", Timeout: "0s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.LogSampling = tt.logSampling
+			config.Syslog = &tt.syslog
+			if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, tt.name); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package traefik_openai_header
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TenantConfig overrides the field mappings, policies and limits of the middleware for a single tenant. Options that
+// are not set are inherited from the middleware configuration; set maps and lists replace the inherited ones.
+type TenantConfig struct {
+	RequestFields        map[string]interface{}       `json:"requestFields"`
+	MirrorResponseFields []string                     `json:"mirrorResponseFields"`
+	ValueMappings        map[string]map[string]string `json:"valueMappings"`
+	HashFields           []string                     `json:"hashFields"`
+	StaticHeaders        map[string]string            `json:"staticHeaders"`
+	HeaderConditions     map[string][]Condition       `json:"headerConditions"`
+	Rules                []Rule                       `json:"rules"`
+	AllowedEndpoints     []string                     `json:"allowedEndpoints"`
+	DeniedEndpoints      []string                     `json:"deniedEndpoints"`
+	MaxBodyBytes         int64                        `json:"maxBodyBytes"`
+	BypassAboveBytes     int64                        `json:"bypassAboveBytes"`
+	HeaderPolicy         string                       `json:"headerPolicy"`
+	FailureMode          string                       `json:"failureMode"`
+	OpenAIAccount        *OpenAIAccount               `json:"openaiAccount"`
+	TokenRateLimit       *TokenRateLimit              `json:"tokenRateLimit"`
+	DailyRequests        *DailyRequests               `json:"dailyRequests"`
+	// Budget and ResponseCache are only accepted to reject them: the budget has per tenant limits of its own and the
+	// cache is shared
+	Budget        *Budget        `json:"budget"`
+	ResponseCache *ResponseCache `json:"responseCache"`
+}
+
+// apply returns a copy of the config with the tenant overrides. A map the tenant sets also replaces the flat form of
+// the inherited map.
+func (t TenantConfig) apply(config *Config) *Config {
+	merged := *config
+	if t.RequestFields != nil {
+		merged.RequestFields = t.RequestFields
+		merged.RequestFieldsCsv = ""
+	}
+	if t.MirrorResponseFields != nil {
+		merged.MirrorResponseFields = t.MirrorResponseFields
+	}
+	if t.ValueMappings != nil {
+		merged.ValueMappings = t.ValueMappings
+		merged.ValueMappingsCsv = ""
+	}
+	if t.HashFields != nil {
+		merged.HashFields = t.HashFields
+	}
+	if t.StaticHeaders != nil {
+		merged.StaticHeaders = t.StaticHeaders
+		merged.StaticHeadersCsv = ""
+	}
+	if t.HeaderConditions != nil {
+		merged.HeaderConditions = t.HeaderConditions
+	}
+	if t.Rules != nil {
+		merged.Rules = t.Rules
+	}
+	if t.AllowedEndpoints != nil {
+		merged.AllowedEndpoints = t.AllowedEndpoints
+	}
+	if t.DeniedEndpoints != nil {
+		merged.DeniedEndpoints = t.DeniedEndpoints
+	}
+	if t.MaxBodyBytes != 0 {
+		merged.MaxBodyBytes = t.MaxBodyBytes
+	}
+	if t.BypassAboveBytes != 0 {
+		merged.BypassAboveBytes = t.BypassAboveBytes
+	}
+	if t.HeaderPolicy != "" {
+		merged.HeaderPolicy = t.HeaderPolicy
+	}
+	if t.FailureMode != "" {
+		merged.FailureMode = t.FailureMode
+	}
+	if t.OpenAIAccount != nil {
+		merged.OpenAIAccount = t.OpenAIAccount
+	}
+	if t.TokenRateLimit != nil {
+		merged.TokenRateLimit = t.TokenRateLimit
+	}
+	if t.DailyRequests != nil {
+		merged.DailyRequests = t.DailyRequests
+	}
+	return &merged
+}
+
+// validate rejects the options a tenant cannot override, which would otherwise be silently ignored
+func (t TenantConfig) validate(tenant string) error {
+	if t.Budget != nil {
+		return fmt.Errorf("invalid tenant %q: budget cannot be set per tenant, set its limit in the budget tenants", tenant)
+	}
+	if t.ResponseCache != nil {
+		return fmt.Errorf("invalid tenant %q: responseCache cannot be set per tenant, the cache is shared", tenant)
+	}
+	return nil
+}
+
+// newTenantHandlers creates a handler per tenant from the unexpanded config. The tenant handlers share the metrics,
+// response cache, in-flight requests, shadow queue, capture, budget, latency samples, OTLP exporter and syslog sink of
+// the middleware and do not watch the config file. They share the daily request counts and the token rate limit too,
+// unless the tenant sets its own.
+func (e *Handler) newTenantHandlers(ctx context.Context, config *Config) error {
+	if len(config.Tenants) == 0 {
+		return nil
+	}
+
+	e.tenants = make(map[string]*Handler, len(config.Tenants))
+	for tenant, overrides := range config.Tenants {
+		if err := overrides.validate(tenant); err != nil {
+			return err
+		}
+		merged := overrides.apply(config)
+		merged.Tenants = nil
+		merged.TenantHeader = ""
+		merged.ConfigFile = ""
+		merged.ResponseCache = nil
+		merged.Idempotency = nil
+		merged.Stats = nil
+		merged.Shadow = nil
+		merged.Capture = nil
+		merged.Budget = nil
+		merged.PriceCatalog = nil
+		if overrides.DailyRequests == nil {
+			merged.DailyRequests = nil
+		}
+		if overrides.TokenRateLimit == nil {
+			merged.TokenRateLimit = nil
+		}
+		merged.RoutingHint = nil
+		merged.OTLP = nil
+		merged.Syslog = nil
+
+		handler, err := New(ctx, e.next, merged, e.name+"/"+tenant)
+		if err != nil {
+			return err
+		}
+		tenantHandler := handler.(*Handler)
+		tenantHandler.metrics = e.metrics
+		tenantHandler.responseCache = e.responseCache
+		tenantHandler.deduplicator = e.deduplicator
+		tenantHandler.shadow = e.shadow
+		tenantHandler.capture = e.capture
+		tenantHandler.budget = e.budget
+		if overrides.DailyRequests == nil {
+			tenantHandler.dailyRequests = e.dailyRequests
+		}
+		if overrides.TokenRateLimit == nil {
+			tenantHandler.tokenRateLimit = e.tokenRateLimit
+		}
+		tenantHandler.routingHint = e.routingHint
+		tenantHandler.otlp = e.otlp
+		tenantHandler.syslog = e.syslog
+		tenantHandler.tenantName = tenant
+		e.tenants[tenant] = tenantHandler
+	}
+	return nil
+}
+
+// tenant returns the handler of the tenant of the request, selected by the tenant header or else by the host, or nil
+// when the request has no configured tenant
+func (e *Handler) tenant(r *http.Request) *Handler {
+	if len(e.tenants) == 0 {
+		return nil
+	}
+	return e.tenants[e.tenantKey(r)]
+}
+
+// tenantKey returns the value of the tenant header, or the host of the request without the port
+func (e *Handler) tenantKey(r *http.Request) string {
+	if e.tenantHeader != "" {
+		if tenant := r.Header.Get(e.tenantHeader); tenant != "" {
+			return tenant
+		}
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,132 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTenants_ServeHTTP(t *testing.T) {
+	config := CreateConfig()
+	config.TenantHeader = "X-Tenant-ID"
+	config.Tenants = map[string]TenantConfig{
+		"acme": {
+			RequestFields:   map[string]interface{}{"model": "X-Acme-Model"},
+			DeniedEndpoints: []string{"batch"},
+		},
+		"api.globex.example": {
+			StaticHeaders: map[string]string{"X-LLM-Tenant": "globex"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		tenant     string
+		uri        string
+		wantStatus int
+		wantHeader string
+		wantValue  string
+	}{
+		{name: "tenant header", tenant: "acme", uri: "/v1/chat/completions", wantStatus: http.StatusOK, wantHeader: "X-Acme-Model", wantValue: "gpt-4.1"},
+		{name: "tenant header replaces field map", tenant: "acme", uri: "/v1/chat/completions", wantStatus: http.StatusOK, wantHeader: "X-OpenAI-Model", wantValue: ""},
+		{name: "tenant policy", tenant: "acme", uri: "/v1/batches", wantStatus: http.StatusForbidden},
+		{name: "host with port", host: "API.globex.example:8443", uri: "/v1/chat/completions", wantStatus: http.StatusOK, wantHeader: "X-LLM-Tenant", wantValue: "globex"},
+		{name: "tenant inherits field map", host: "api.globex.example", uri: "/v1/chat/completions", wantStatus: http.StatusOK, wantHeader: "X-OpenAI-Model", wantValue: "gpt-4.1"},
+		{name: "unknown tenant", tenant: "initech", uri: "/v1/batches", wantStatus: http.StatusOK, wantHeader: "X-OpenAI-Model", wantValue: ""},
+		{name: "no tenant", uri: "/v1/chat/completions", wantStatus: http.StatusOK, wantHeader: "X-OpenAI-Model", wantValue: "gpt-4.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest("POST", tt.uri, strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.tenant != "" {
+				req.Header.Set("X-Tenant-ID", tt.tenant)
+			}
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantHeader != "" && got.Get(tt.wantHeader) != tt.wantValue {
+				t.Errorf("expected header %v to be %q but got %q", tt.wantHeader, tt.wantValue, got.Get(tt.wantHeader))
+			}
+		})
+	}
+}
+
+func TestTenantLimits_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.TenantHeader = "X-Tenant-ID"
+	config.TokenRateLimit = &TokenRateLimit{TokensPerMinute: 1000}
+	config.DailyRequests = &DailyRequests{SoftLimit: 100}
+	config.Tenants = map[string]TenantConfig{
+		"acme":   {TokenRateLimit: &TokenRateLimit{TokensPerMinute: 100}, DailyRequests: &DailyRequests{SoftLimit: 1}},
+		"globex": {},
+	}
+
+	e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "limits")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"max_tokens\": 60}"))
+		req.Header.Set("X-Tenant-ID", tenant)
+		req.Header.Set("Authorization", "Bearer sk-"+tenant)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if recorder := serve("acme"); recorder.Code != http.StatusOK || recorder.Header().Get(DailyRequestsHeader) != "1" {
+		t.Fatalf("expected the first acme request to pass but got %d", recorder.Code)
+	}
+	recorder := serve("acme")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the second acme request to exceed the tenant token rate limit but got %d", recorder.Code)
+	}
+	if recorder.Header().Get(DailyLimitExceededHeader) != "true" {
+		t.Errorf("expected the tenant daily soft limit to flag the second acme request")
+	}
+	for i := 0; i < 2; i++ {
+		if recorder := serve("globex"); recorder.Code != http.StatusOK || recorder.Header().Get(DailyLimitExceededHeader) != "" {
+			t.Errorf("expected globex to inherit the limits of the middleware but got %d", recorder.Code)
+		}
+	}
+}
+
+func TestInvalidTenant_New(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant TenantConfig
+	}{
+		{name: "header policy", tenant: TenantConfig{HeaderPolicy: "merge"}},
+		{name: "budget", tenant: TenantConfig{Budget: &Budget{Monthly: 10}}},
+		{name: "response cache", tenant: TenantConfig{ResponseCache: &ResponseCache{}}},
+		{name: "token rate limit", tenant: TenantConfig{TokenRateLimit: &TokenRateLimit{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.Tenants = map[string]TenantConfig{"acme": tt.tenant}
+			if _, err := New(nil, http.NotFoundHandler(), config, "invalid"); err == nil {
+				t.Errorf("expected an error for the tenant %s", tt.name)
+			}
+		})
+	}
+}
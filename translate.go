@@ -0,0 +1,580 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TranslationHeader is set on the request and the response, to the API that serves a translated chat completion
+const TranslationHeader = "X-OpenAI-Translation"
+
+// ResponsesTranslation configures the translation of chat completion requests to the Responses API and of their
+// responses back, so the backend can be migrated without changing the clients
+type ResponsesTranslation struct {
+	Path   string   `json:"path"`
+	Models []string `json:"models"`
+}
+
+// responsesTranslation is the parsed ResponsesTranslation config
+type responsesTranslation struct {
+	path   string
+	models map[string]bool
+}
+
+func newResponsesTranslation(config *ResponsesTranslation) (*responsesTranslation, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Path != "" && !strings.HasPrefix(config.Path, "/") {
+		return nil, fmt.Errorf("invalid responsesTranslation path %q", config.Path)
+	}
+	return &responsesTranslation{path: config.Path, models: allowedSet(config.Models)}, nil
+}
+
+// chatPassthroughFields are the chat completion fields the Responses API accepts as they are
+var chatPassthroughFields = map[string]bool{
+	"model":               true,
+	"temperature":         true,
+	"top_p":               true,
+	"user":                true,
+	"metadata":            true,
+	"parallel_tool_calls": true,
+	"store":               true,
+	"service_tier":        true,
+	"safety_identifier":   true,
+	"prompt_cache_key":    true,
+}
+
+// translatedMessage is a chat message with the tool calls and results that are translated to function call items
+type translatedMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []chatToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+}
+
+// chatToolCall is a function call of an assistant message
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// chatTool is a function tool of a chat completion request
+type chatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+		Strict      *bool           `json:"strict,omitempty"`
+	} `json:"function"`
+}
+
+// chatResponseFormat is the response format of a chat completion request
+type chatResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema *struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Schema      json.RawMessage `json:"schema,omitempty"`
+		Strict      *bool           `json:"strict,omitempty"`
+	} `json:"json_schema"`
+}
+
+// chatToResponses converts the members of a chat completion request to the members of a Responses API request. An
+// error is returned for fields that have no Responses API equivalent, in which case the request is not translated.
+// The response is not stored unless the client sets store, as with chat completions.
+func chatToResponses(members map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	translated := map[string]json.RawMessage{}
+	for field, value := range members {
+		var err error
+		switch {
+		case chatPassthroughFields[field]:
+			translated[field] = value
+		case field == "max_completion_tokens" && string(value) != "null":
+			translated["max_output_tokens"] = value
+		case field == "max_tokens" && string(value) != "null":
+			// max_completion_tokens replaces the deprecated max_tokens when both are sent
+			if completion, ok := members["max_completion_tokens"]; !ok || string(completion) == "null" {
+				translated["max_output_tokens"] = value
+			}
+		case field == "messages":
+			translated["input"], err = translateMessages(value)
+		case field == "tools":
+			translated["tools"], err = translateTools(value)
+		case field == "tool_choice":
+			translated["tool_choice"], err = translateToolChoice(value)
+		case field == "response_format":
+			translated["text"], err = translateResponseFormat(value)
+		case field == "reasoning_effort":
+			translated["reasoning"], err = json.Marshal(map[string]json.RawMessage{"effort": value})
+		case field == "n" && string(value) == "1", field == "stream" && string(value) == "false", string(value) == "null":
+			// the defaults of both APIs
+		default:
+			err = fmt.Errorf("unsupported field %s", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := translated["input"]; !ok {
+		return nil, errors.New("no messages")
+	}
+	// chat completions are not stored unless asked for, responses are stored by default
+	if store, ok := translated["store"]; !ok || string(store) == "null" {
+		translated["store"] = json.RawMessage("false")
+	}
+	return translated, nil
+}
+
+// translateMessages converts chat messages to Responses API input items. Tool calls of assistant messages and tool
+// results become function call items.
+func translateMessages(value json.RawMessage) (json.RawMessage, error) {
+	var messages []translatedMessage
+	if err := json.Unmarshal(value, &messages); err != nil {
+		return nil, err
+	}
+
+	var input []interface{}
+	for _, message := range messages {
+		switch message.Role {
+		case "tool":
+			var output string
+			if err := json.Unmarshal(message.Content, &output); err != nil {
+				return nil, errors.New("unsupported tool message content")
+			}
+			input = append(input, map[string]interface{}{"type": "function_call_output", "call_id": message.ToolCallID, "output": output})
+			continue
+		case "system", "developer", "user", "assistant":
+		default:
+			return nil, fmt.Errorf("unsupported message role %s", message.Role)
+		}
+
+		if len(message.Content) > 0 && string(message.Content) != "null" {
+			content, err := translateContent(message.Role, message.Content)
+			if err != nil {
+				return nil, err
+			}
+			input = append(input, map[string]interface{}{"role": message.Role, "content": content})
+		}
+		for _, call := range message.ToolCalls {
+			input = append(input, map[string]interface{}{
+				"type":      "function_call",
+				"call_id":   call.ID,
+				"name":      call.Function.Name,
+				"arguments": call.Function.Arguments,
+			})
+		}
+	}
+	return json.Marshal(input)
+}
+
+// translateContent converts the content of a chat message, a string or a list of text and image parts
+func translateContent(role string, value json.RawMessage) (interface{}, error) {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []chatContentPart
+	if err := json.Unmarshal(value, &parts); err != nil {
+		return nil, err
+	}
+	textType := "input_text"
+	if role == "assistant" {
+		textType = "output_text"
+	}
+	content := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			content = append(content, map[string]interface{}{"type": textType, "text": part.Text})
+		case part.Type == "image_url" && part.ImageURL.URL != "" && role != "assistant":
+			image := map[string]interface{}{"type": "input_image", "image_url": part.ImageURL.URL, "detail": "auto"}
+			if part.ImageURL.Detail != "" {
+				image["detail"] = part.ImageURL.Detail
+			}
+			content = append(content, image)
+		default:
+			return nil, fmt.Errorf("unsupported content part %s", part.Type)
+		}
+	}
+	return content, nil
+}
+
+// translateTools flattens chat function tools into Responses API function tools
+func translateTools(value json.RawMessage) (json.RawMessage, error) {
+	var tools []chatTool
+	if err := json.Unmarshal(value, &tools); err != nil {
+		return nil, err
+	}
+	translated := make([]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool %s", tool.Type)
+		}
+		function := map[string]interface{}{"type": "function", "name": tool.Function.Name}
+		if tool.Function.Description != "" {
+			function["description"] = tool.Function.Description
+		}
+		if len(tool.Function.Parameters) > 0 {
+			function["parameters"] = tool.Function.Parameters
+		}
+		if tool.Function.Strict != nil {
+			function["strict"] = *tool.Function.Strict
+		}
+		translated = append(translated, function)
+	}
+	return json.Marshal(translated)
+}
+
+// translateToolChoice keeps the auto, none and required choices and flattens a forced function
+func translateToolChoice(value json.RawMessage) (json.RawMessage, error) {
+	var choice string
+	if err := json.Unmarshal(value, &choice); err == nil {
+		return value, nil
+	}
+	var forced chatToolCall
+	if err := json.Unmarshal(value, &forced); err != nil || forced.Type != "function" {
+		return nil, errors.New("unsupported tool_choice")
+	}
+	return json.Marshal(map[string]string{"type": "function", "name": forced.Function.Name})
+}
+
+// translateResponseFormat converts the response format to the text format of the Responses API
+func translateResponseFormat(value json.RawMessage) (json.RawMessage, error) {
+	var format chatResponseFormat
+	if err := json.Unmarshal(value, &format); err != nil {
+		return nil, err
+	}
+	switch format.Type {
+	case "text", "json_object":
+		return json.Marshal(map[string]interface{}{"format": map[string]string{"type": format.Type}})
+	case "json_schema":
+		if format.JSONSchema == nil {
+			return nil, errors.New("json_schema response format without schema")
+		}
+		schema := map[string]interface{}{"type": "json_schema", "name": format.JSONSchema.Name}
+		if format.JSONSchema.Description != "" {
+			schema["description"] = format.JSONSchema.Description
+		}
+		if len(format.JSONSchema.Schema) > 0 {
+			schema["schema"] = format.JSONSchema.Schema
+		}
+		if format.JSONSchema.Strict != nil {
+			schema["strict"] = *format.JSONSchema.Strict
+		}
+		return json.Marshal(map[string]interface{}{"format": schema})
+	}
+	return nil, fmt.Errorf("unsupported response_format %s", format.Type)
+}
+
+// responsesResponse is the part of a Responses API response that has a chat completion equivalent
+type responsesResponse struct {
+	ID                string `json:"id"`
+	CreatedAt         int64  `json:"created_at"`
+	Model             string `json:"model"`
+	Status            string `json:"status"`
+	ServiceTier       string `json:"service_tier"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Output []struct {
+		Type    string `json:"type"`
+		Content []struct {
+			Type    string `json:"type"`
+			Text    string `json:"text"`
+			Refusal string `json:"refusal"`
+		} `json:"content"`
+		CallID    string `json:"call_id"`
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"output"`
+	Usage *struct {
+		InputTokens        int64 `json:"input_tokens"`
+		OutputTokens       int64 `json:"output_tokens"`
+		TotalTokens        int64 `json:"total_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int64 `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokensDetails struct {
+			ReasoningTokens int64 `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	} `json:"usage"`
+}
+
+// responsesToChat converts a Responses API response to a chat completion with a single choice. Reasoning and built-in
+// tool items have no chat completion equivalent and are left out.
+func responsesToChat(data []byte) ([]byte, error) {
+	var response responsesResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if response.Output == nil {
+		return nil, errors.New("no output")
+	}
+
+	var text, refusal strings.Builder
+	var toolCalls []interface{}
+	for _, item := range response.Output {
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				text.WriteString(content.Text)
+				refusal.WriteString(content.Refusal)
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       item.CallID,
+				"type":     "function",
+				"function": map[string]string{"name": item.Name, "arguments": item.Arguments},
+			})
+		}
+	}
+
+	message := map[string]interface{}{"role": "assistant", "content": nil, "refusal": nil}
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+	if refusal.Len() > 0 {
+		message["refusal"] = refusal.String()
+	}
+	finishReason := "stop"
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+		finishReason = "tool_calls"
+	}
+	if response.Status == "incomplete" && response.IncompleteDetails != nil {
+		switch response.IncompleteDetails.Reason {
+		case "max_output_tokens":
+			finishReason = "length"
+		case "content_filter":
+			finishReason = "content_filter"
+		}
+	}
+
+	completion := map[string]interface{}{
+		"id":      response.ID,
+		"object":  "chat.completion",
+		"created": response.CreatedAt,
+		"model":   response.Model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       message,
+			"logprobs":      nil,
+			"finish_reason": finishReason,
+		}},
+	}
+	if response.ServiceTier != "" {
+		completion["service_tier"] = response.ServiceTier
+	}
+	if response.Usage != nil {
+		completion["usage"] = map[string]interface{}{
+			"prompt_tokens":             response.Usage.InputTokens,
+			"completion_tokens":         response.Usage.OutputTokens,
+			"total_tokens":              response.Usage.TotalTokens,
+			"prompt_tokens_details":     map[string]int64{"cached_tokens": response.Usage.InputTokensDetails.CachedTokens},
+			"completion_tokens_details": map[string]int64{"reasoning_tokens": response.Usage.OutputTokensDetails.ReasoningTokens},
+		}
+	}
+	return json.Marshal(completion)
+}
+
+// translatedPath returns the Responses API path for a chat completions path, keeping its prefix such as /v1 or
+// /openai/v1, or the configured path
+func (t *responsesTranslation) translatedPath(path string) string {
+	if t.path != "" {
+		return t.path
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(path, "/"), "/chat/completions") + "/responses"
+}
+
+// translateRequest rewrites a non-streaming chat completion request of a translated model to the Responses API and
+// returns the writer that translates the response back, or the writer itself when the request is not translated
+func (e *Handler) translateRequest(w http.ResponseWriter, r *http.Request, kinds []EndpointKind, values map[string]string) (http.ResponseWriter, *translationWriter) {
+	if !containsKind(kinds, ChatCompletionEndpoint) {
+		return w, nil
+	}
+	if e.responsesTranslation.models != nil && !e.responsesTranslation.models[values["model"]] {
+		e.metrics.incLabel("responses_translation_skipped", "model")
+		return w, nil
+	}
+	// the events of a stream differ too much to be translated back
+	if values["stream"] == "true" {
+		e.metrics.incLabel("responses_translation_skipped", "stream")
+		return w, nil
+	}
+
+	err := rewriteBody(r, func(members map[string]json.RawMessage) error {
+		translated, err := chatToResponses(members)
+		if err != nil {
+			return err
+		}
+		for field := range members {
+			delete(members, field)
+		}
+		for field, value := range translated {
+			members[field] = value
+		}
+		return nil
+	})
+	if err != nil {
+		e.metrics.incLabel("responses_translation_skipped", "unsupported")
+		return w, nil
+	}
+
+	r.URL.Path = e.responsesTranslation.translatedPath(r.URL.Path)
+	r.URL.RawPath = ""
+	r.RequestURI = r.URL.RequestURI()
+	r.Header.Set(TranslationHeader, "responses")
+	// an encoded response could not be translated back
+	r.Header.Del("Accept-Encoding")
+	e.metrics.inc("responses_translated_total")
+
+	translation := newTranslationWriter(w, "responses", func(_ int, data []byte) ([]byte, error) {
+		return responsesToChat(data)
+	})
+	return translation, translation
+}
+
+// isEncoded reports whether a response has a content encoding other than identity
+func isEncoded(header http.Header) bool {
+	encoding := header.Get("Content-Encoding")
+	return encoding != "" && !strings.EqualFold(encoding, "identity")
+}
+
+// streamTranslator translates the events of a streamed response, returning the translated events that are complete
+type streamTranslator interface {
+	translate(data []byte) []byte
+}
+
+// maxTranslatedResponseBytes limits the JSON responses held back to be translated; a larger response is passed on as
+// it is
+const maxTranslatedResponseBytes = 8 << 20
+
+// translationWriter holds back a JSON response so it can be translated back to a chat completion once it is complete,
+// and translates an event stream as it arrives when it has a stream translator. Error responses are only translated
+// with translateErrors; other responses pass through.
+type translationWriter struct {
+	*responseWriter
+	api             string
+	translate       func(status int, data []byte) ([]byte, error)
+	translateErrors bool
+	stream          streamTranslator
+	holding         bool
+	streaming       bool
+	overflow        bool
+	encoded         bool
+	body            bytes.Buffer
+}
+
+func newTranslationWriter(w http.ResponseWriter, api string, translate func(status int, data []byte) ([]byte, error)) *translationWriter {
+	return &translationWriter{responseWriter: &responseWriter{ResponseWriter: w}, api: api, translate: translate}
+}
+
+func (t *translationWriter) WriteHeader(status int) {
+	if t.status != 0 {
+		return
+	}
+	contentType := t.Header().Get("Content-Type")
+	// an upstream that encodes its response regardless of the request cannot be translated
+	t.encoded = isEncoded(t.Header())
+	t.holding = !t.encoded && strings.HasPrefix(contentType, "application/json") && (t.translateErrors || status >= 200 && status < 300)
+	t.streaming = !t.encoded && t.stream != nil && strings.HasPrefix(contentType, "text/event-stream")
+	t.Header().Set(TranslationHeader, t.api)
+	if t.streaming {
+		t.Header().Del("Content-Length")
+	}
+	if t.holding {
+		// the status is recorded but only written with the translated body
+		t.status = status
+		return
+	}
+	t.responseWriter.WriteHeader(status)
+}
+
+func (t *translationWriter) Write(data []byte) (int, error) {
+	if t.status == 0 {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.holding && int64(t.body.Len()+len(data)) > maxTranslatedResponseBytes {
+		t.overflow = true
+		if err := t.release(t.body.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	if t.holding {
+		return t.body.Write(data)
+	}
+	if t.streaming {
+		if translated := t.stream.translate(data); len(translated) > 0 {
+			if _, err := t.responseWriter.Write(translated); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	}
+	return t.responseWriter.Write(data)
+}
+
+// ReadFrom copies a held or translated body through Write and passes any other body on
+func (t *translationWriter) ReadFrom(src io.Reader) (int64, error) {
+	if t.status == 0 {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.holding || t.streaming {
+		return io.Copy(writerOnly{t}, src)
+	}
+	return t.responseWriter.ReadFrom(src)
+}
+
+// Flush forwards flushes once the response is no longer held
+func (t *translationWriter) Flush() {
+	if t.holding {
+		return
+	}
+	t.responseWriter.Flush()
+}
+
+// release writes the held status followed by the body and stops holding
+func (t *translationWriter) release(data []byte) error {
+	t.holding = false
+	t.responseWriter.WriteHeader(t.status)
+	_, err := t.responseWriter.Write(data)
+	t.body.Reset()
+	return err
+}
+
+// finishTranslation writes the held response translated to a chat completion, or as it is when it cannot be translated
+func (e *Handler) finishTranslation(t *translationWriter) {
+	if t.overflow {
+		e.metrics.inc(t.api + "_translation_overflows_total")
+	}
+	if t.encoded {
+		e.metrics.inc(t.api + "_translation_encoded_total")
+	}
+	if !t.holding {
+		return
+	}
+
+	data := t.body.Bytes()
+	if translated, err := t.translate(t.status, data); err == nil {
+		data = translated
+		t.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	} else {
+		e.metrics.inc(t.api + "_translation_failures_total")
+	}
+	if err := t.release(data); err != nil {
+		fmt.Println("Unable to write translated response", err.Error())
+	}
+}
@@ -0,0 +1,341 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestChatToResponses(t *testing.T) {
+	input := `{
+		"model": "gpt-4.1",
+		"max_completion_tokens": 200,
+		"max_tokens": 100,
+		"n": 1,
+		"stream": false,
+		"reasoning_effort": "low",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}, "strict": true}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}},
+		"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}}
+	}`
+	want := `{
+		"model": "gpt-4.1",
+		"max_output_tokens": 200,
+		"store": false,
+		"reasoning": {"effort": "low"},
+		"input": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "input_text", "text": "What is this?"}, {"type": "input_image", "image_url": "https://example.com/cat.png", "detail": "auto"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "lookup", "arguments": "{\"q\":\"cat\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "a cat"}
+		],
+		"tools": [{"type": "function", "name": "lookup", "parameters": {"type": "object"}, "strict": true}],
+		"tool_choice": {"type": "function", "name": "lookup"},
+		"text": {"format": {"type": "json_schema", "name": "answer", "schema": {"type": "object"}}}
+	}`
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &members); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	translated, err := chatToResponses(members)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	data, err := json.Marshal(translated)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	var got, expected interface{}
+	_ = json.Unmarshal(data, &got)
+	_ = json.Unmarshal([]byte(want), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %s but got %s", want, data)
+	}
+}
+
+func TestResponsesToChat(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name: "message",
+			response: `{"id": "resp_1", "created_at": 1700000000, "model": "gpt-4.1", "status": "completed", "output": [
+				{"type": "reasoning", "summary": []},
+				{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "A cat."}]}
+			], "usage": {"input_tokens": 10, "output_tokens": 3, "total_tokens": 13, "input_tokens_details": {"cached_tokens": 2}, "output_tokens_details": {"reasoning_tokens": 1}}}`,
+			want: `{"id": "resp_1", "object": "chat.completion", "created": 1700000000, "model": "gpt-4.1", "choices": [
+				{"index": 0, "message": {"role": "assistant", "content": "A cat.", "refusal": null}, "logprobs": null, "finish_reason": "stop"}
+			], "usage": {"prompt_tokens": 10, "completion_tokens": 3, "total_tokens": 13, "prompt_tokens_details": {"cached_tokens": 2}, "completion_tokens_details": {"reasoning_tokens": 1}}}`,
+		},
+		{
+			name: "function call",
+			response: `{"id": "resp_2", "created_at": 1700000000, "model": "gpt-4.1", "status": "completed", "output": [
+				{"type": "function_call", "call_id": "call_1", "name": "lookup", "arguments": "{}"}
+			]}`,
+			want: `{"id": "resp_2", "object": "chat.completion", "created": 1700000000, "model": "gpt-4.1", "choices": [
+				{"index": 0, "message": {"role": "assistant", "content": null, "refusal": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{}"}}]}, "logprobs": null, "finish_reason": "tool_calls"}
+			]}`,
+		},
+		{
+			name: "incomplete",
+			response: `{"id": "resp_3", "created_at": 1700000000, "model": "gpt-4.1", "status": "incomplete", "incomplete_details": {"reason": "max_output_tokens"}, "output": [
+				{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "A"}]}
+			]}`,
+			want: `{"id": "resp_3", "object": "chat.completion", "created": 1700000000, "model": "gpt-4.1", "choices": [
+				{"index": 0, "message": {"role": "assistant", "content": "A", "refusal": null}, "logprobs": null, "finish_reason": "length"}
+			]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := responsesToChat([]byte(tt.response))
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			var got, expected interface{}
+			_ = json.Unmarshal(data, &got)
+			_ = json.Unmarshal([]byte(tt.want), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %s but got %s", tt.want, data)
+			}
+		})
+	}
+}
+
+func TestResponsesTranslation_ServeHTTP(t *testing.T) {
+	response := `{"id": "resp_1", "created_at": 1700000000, "model": "gpt-4.1", "status": "completed", "output": [{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Hi."}]}]}`
+	tests := []struct {
+		name       string
+		path       string
+		models     []string
+		input      string
+		wantPath   string
+		wantObject string
+	}{
+		{name: "translated", path: "/v1/chat/completions", input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantPath: "/v1/responses", wantObject: "chat.completion"},
+		{name: "listed model", path: "/v1/chat/completions", models: []string{"gpt-4.1"}, input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantPath: "/v1/responses", wantObject: "chat.completion"},
+		{name: "unlisted model", path: "/v1/chat/completions", models: []string{"o3"}, input: "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantPath: "/v1/chat/completions", wantObject: "response"},
+		{name: "stream", path: "/v1/chat/completions", input: "{\"model\": \"gpt-4.1\", \"stream\": true, \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantPath: "/v1/chat/completions", wantObject: "response"},
+		{name: "unsupported field", path: "/v1/chat/completions", input: "{\"model\": \"gpt-4.1\", \"logprobs\": true, \"messages\": [{\"role\": \"user\", \"content\": \"Hi\"}]}", wantPath: "/v1/chat/completions", wantObject: "response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ResponsesTranslation = &ResponsesTranslation{Models: tt.models}
+
+			var path string
+			var body map[string]json.RawMessage
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				data, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(data, &body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Length", "1")
+				_, _ = w.Write([]byte(strings.Replace(response, "\"id\"", "\"object\": \"response\", \"id\"", 1)))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.input)))
+
+			if path != tt.wantPath {
+				t.Errorf("expected path %s but got %s", tt.wantPath, path)
+			}
+			if _, translated := body["input"]; translated != (tt.wantPath == "/v1/responses") {
+				t.Errorf("expected the body to be translated only with the path but got %v", body)
+			}
+			var completion struct {
+				Object  string `json:"object"`
+				Choices []struct {
+					Message struct {
+						Content string `json:"content"`
+					} `json:"message"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &completion); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if completion.Object != tt.wantObject {
+				t.Errorf("expected a %s but got %s", tt.wantObject, recorder.Body.String())
+			}
+			if tt.wantObject == "chat.completion" {
+				if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Hi." {
+					t.Errorf("expected the output text as message content but got %s", recorder.Body.String())
+				}
+				if recorder.Header().Get("Content-Length") != strconv.Itoa(recorder.Body.Len()) {
+					t.Errorf("expected the content length of the translated body but got %s", recorder.Header().Get("Content-Length"))
+				}
+			}
+		})
+	}
+}
+
+func TestResponsesTranslationStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantStore string
+		wantMax   string
+	}{
+		{name: "default", input: `{"messages": [], "max_tokens": 100}`, wantStore: "false", wantMax: "100"},
+		{name: "stored", input: `{"messages": [], "store": true, "max_completion_tokens": 200, "max_tokens": 100}`, wantStore: "true", wantMax: "200"},
+		{name: "null", input: `{"messages": [], "store": null, "max_completion_tokens": null, "max_tokens": 100}`, wantStore: "false", wantMax: "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var members map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.input), &members); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			translated, err := chatToResponses(members)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if string(translated["store"]) != tt.wantStore {
+				t.Errorf("expected store %s but got %s", tt.wantStore, translated["store"])
+			}
+			if string(translated["max_output_tokens"]) != tt.wantMax {
+				t.Errorf("expected max_output_tokens %s but got %s", tt.wantMax, translated["max_output_tokens"])
+			}
+		})
+	}
+}
+
+func TestResponsesTranslationLargeResponse_ServeHTTP(t *testing.T) {
+	response := `{"object": "response", "id": "resp_1", "status": "completed", "output": [{"type": "message", "content": [{"type": "output_text", "text": "` +
+		strings.Repeat("a", maxTranslatedResponseBytes) + `"}]}]}`
+	tests := []struct {
+		name       string
+		response   string
+		wantObject string
+	}{
+		{name: "small", response: `{"object": "response", "id": "resp_1", "status": "completed", "output": []}`, wantObject: "chat.completion"},
+		{name: "large", response: response, wantObject: "response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ResponsesTranslation = &ResponsesTranslation{}
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				// the body is copied through ReadFrom, as a file or proxied response would be
+				_, _ = io.Copy(w, strings.NewReader(tt.response))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4.1", "messages": [{"role": "user", "content": "Hi"}]}`)))
+
+			var completion struct {
+				Object string `json:"object"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &completion); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if completion.Object != tt.wantObject {
+				t.Errorf("expected a %s but got %s", tt.wantObject, completion.Object)
+			}
+			overflows := e.(*Handler).metrics.snapshot().Counters["responses_translation_overflows_total"]
+			if overflows != 0 != (tt.name == "large") {
+				t.Errorf("expected an overflow only for the large response but got %d", overflows)
+			}
+		})
+	}
+}
+
+func TestResponsesTranslationEncoding_ServeHTTP(t *testing.T) {
+	response := `{"object": "response", "id": "resp_1", "status": "completed", "output": [], "usage": {"input_tokens": 3, "output_tokens": 2, "total_tokens": 5}}`
+	tests := []struct {
+		name        string
+		always      bool
+		wantObject  string
+		wantEncoded int64
+	}{
+		{name: "negotiated", wantObject: "chat.completion"},
+		{name: "always", always: true, wantObject: "response", wantEncoded: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.ResponsesTranslation = &ResponsesTranslation{}
+			config.UsageHeaders = true
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if !tt.always && !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					_, _ = w.Write([]byte(response))
+					return
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = w.Write(gzipped(response))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4.1", "messages": [{"role": "user", "content": "Hi"}]}`))
+			req.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			body := recorder.Body.Bytes()
+			if recorder.Header().Get("Content-Encoding") == "gzip" {
+				reader, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+				if body, err = io.ReadAll(reader); err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+			}
+			var completion struct {
+				Object string `json:"object"`
+			}
+			if err := json.Unmarshal(body, &completion); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if completion.Object != tt.wantObject {
+				t.Errorf("expected a %s but got %s", tt.wantObject, body)
+			}
+			if encoded := e.(*Handler).metrics.snapshot().Counters["responses_translation_encoded_total"]; encoded != tt.wantEncoded {
+				t.Errorf("expected %v encoded responses but got %v", tt.wantEncoded, encoded)
+			}
+		})
+	}
+}
+
+// gzipped returns the data compressed with gzip
+func gzipped(data string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, _ = writer.Write([]byte(data))
+	_ = writer.Close()
+	return buffer.Bytes()
+}
@@ -0,0 +1,61 @@
+package traefik_openai_header
+
+import (
+	"errors"
+	"net/http"
+)
+
+// UpstreamRequestIDHeader is the default response header holding the request ID of the provider
+const UpstreamRequestIDHeader = "X-Upstream-Request-Id"
+
+// UpstreamRequestID copies the request ID the provider returned, which support tickets ask for, to one response header
+// whatever the provider
+type UpstreamRequestID struct {
+	Header        string   `json:"header"`
+	SourceHeaders []string `json:"sourceHeaders"`
+}
+
+// upstreamRequestID is the parsed UpstreamRequestID config
+type upstreamRequestID struct {
+	header        string
+	sourceHeaders []string
+}
+
+func newUpstreamRequestID(config *UpstreamRequestID) (*upstreamRequestID, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	header := config.Header
+	if header == "" {
+		header = UpstreamRequestIDHeader
+	}
+	if !validHeaderName(header) {
+		return nil, errors.New("invalid upstreamRequestId header")
+	}
+
+	// OpenAI, Anthropic and Azure OpenAI in that order
+	sourceHeaders := config.SourceHeaders
+	if len(sourceHeaders) == 0 {
+		sourceHeaders = []string{"X-Request-Id", "Request-Id", "Apim-Request-Id"}
+	}
+
+	return &upstreamRequestID{header: header, sourceHeaders: sourceHeaders}, nil
+}
+
+// copyUpstreamRequestID returns the writer that copies the first request ID the upstream response carries to the
+// configured header. A response without one, such as a rejection by the middleware, gets no header.
+func (e *Handler) copyUpstreamRequestID(w http.ResponseWriter) http.ResponseWriter {
+	writer := &responseWriter{ResponseWriter: w}
+	writer.onHeader = func(int) {
+		header := writer.Header()
+		for _, source := range e.upstreamRequestID.sourceHeaders {
+			if id := header.Get(source); id != "" {
+				header.Set(e.upstreamRequestID.header, id)
+				return
+			}
+		}
+		header.Del(e.upstreamRequestID.header)
+	}
+	return writer
+}
@@ -0,0 +1,79 @@
+package traefik_openai_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamRequestID_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *UpstreamRequestID
+		upstream map[string]string
+		header   string
+		want     string
+	}{
+		{
+			name:     "openai",
+			config:   &UpstreamRequestID{},
+			upstream: map[string]string{"X-Request-Id": "req_123"},
+			header:   UpstreamRequestIDHeader,
+			want:     "req_123",
+		},
+		{
+			name:     "anthropic",
+			config:   &UpstreamRequestID{},
+			upstream: map[string]string{"Request-Id": "req_011"},
+			header:   UpstreamRequestIDHeader,
+			want:     "req_011",
+		},
+		{
+			name:     "configured",
+			config:   &UpstreamRequestID{Header: "X-Provider-Request-Id", SourceHeaders: []string{"X-Ms-Request-Id"}},
+			upstream: map[string]string{"X-Request-Id": "req_123", "X-Ms-Request-Id": "ms_456"},
+			header:   "X-Provider-Request-Id",
+			want:     "ms_456",
+		},
+		{
+			name:     "missing",
+			config:   &UpstreamRequestID{},
+			upstream: map[string]string{UpstreamRequestIDHeader: "stale"},
+			header:   UpstreamRequestIDHeader,
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UpstreamRequestID = tt.config
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for name, value := range tt.upstream {
+					w.Header().Set(name, value)
+				}
+				_, _ = w.Write([]byte("{}"))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+			if got := recorder.Header().Get(tt.header); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInvalidUpstreamRequestID_New(t *testing.T) {
+	config := defaultConfig()
+	config.UpstreamRequestID = &UpstreamRequestID{Header: "X Request Id"}
+	if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "invalid"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
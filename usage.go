@@ -0,0 +1,289 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// streamMarkers are the keys of stream events worth parsing for their usage or finish reason
+var streamMarkers = [][]byte{
+	[]byte(`"usage"`),
+	[]byte(`"usageMetadata"`),
+	[]byte(`"finish_reason"`),
+	[]byte(`"stop_reason"`),
+	[]byte(`"finishReason"`),
+	[]byte(`"status"`),
+}
+
+// tokenUsage is the token usage an upstream reported for a response
+type tokenUsage struct {
+	model     string
+	input     int64
+	output    int64
+	cached    int64
+	reasoning int64
+}
+
+// usageCounts covers the usage objects of the OpenAI chat completions and responses APIs and the Anthropic messages API
+type usageCounts struct {
+	PromptTokens         int64         `json:"prompt_tokens"`
+	CompletionTokens     int64         `json:"completion_tokens"`
+	InputTokens          int64         `json:"input_tokens"`
+	OutputTokens         int64         `json:"output_tokens"`
+	PromptTokensDetails  *tokenDetails `json:"prompt_tokens_details"`
+	InputTokensDetails   *tokenDetails `json:"input_tokens_details"`
+	CacheReadInputTokens int64         `json:"cache_read_input_tokens"`
+	CompletionDetails    *tokenDetails `json:"completion_tokens_details"`
+	OutputTokensDetails  *tokenDetails `json:"output_tokens_details"`
+	ThoughtsTokens       int64         `json:"-"`
+}
+
+// tokenDetails breaks down the prompt and completion tokens of the OpenAI APIs
+type tokenDetails struct {
+	CachedTokens    int64 `json:"cached_tokens"`
+	ReasoningTokens int64 `json:"reasoning_tokens"`
+}
+
+// cachedTokens returns the prompt tokens read from the prompt cache
+func (c *usageCounts) cachedTokens() int64 {
+	cached := c.CacheReadInputTokens
+	for _, details := range []*tokenDetails{c.PromptTokensDetails, c.InputTokensDetails} {
+		if details != nil {
+			cached = maxInt64(cached, details.CachedTokens)
+		}
+	}
+	return cached
+}
+
+// reasoningTokens returns the completion tokens spent on reasoning, which are billed but not part of the content
+func (c *usageCounts) reasoningTokens() int64 {
+	reasoning := c.ThoughtsTokens
+	for _, details := range []*tokenDetails{c.CompletionDetails, c.OutputTokensDetails} {
+		if details != nil {
+			reasoning = maxInt64(reasoning, details.ReasoningTokens)
+		}
+	}
+	return reasoning
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount        int64 `json:"promptTokenCount"`
+	CandidatesTokenCount    int64 `json:"candidatesTokenCount"`
+	CachedContentTokenCount int64 `json:"cachedContentTokenCount"`
+	ThoughtsTokenCount      int64 `json:"thoughtsTokenCount"`
+}
+
+// finishFields are the fields of the Anthropic messages API and the OpenAI responses API that tell why generation stopped
+type finishFields struct {
+	StopReason        string `json:"stop_reason"`
+	Status            string `json:"status"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+// finishReason returns the stop reason of an Anthropic message, the reason an OpenAI response is incomplete or
+// completed for a complete one
+func (f finishFields) finishReason() string {
+	switch {
+	case f.StopReason != "":
+		return f.StopReason
+	case f.Status == "incomplete" && f.IncompleteDetails != nil:
+		return f.IncompleteDetails.Reason
+	case f.Status == "completed":
+		return f.Status
+	}
+	return ""
+}
+
+type usageDocument struct {
+	finishFields
+	Model string       `json:"model"`
+	Usage *usageCounts `json:"usage"`
+}
+
+// usageEvent is a response body or stream event that may carry usage: at the top level, in the message of an Anthropic
+// message_start event, in the response of an OpenAI response.completed event or as Gemini usage metadata. The finish
+// reason is in the choices of OpenAI chat completions, the delta of an Anthropic message_delta event, the candidates
+// of Gemini or in the finish fields of the documents.
+type usageEvent struct {
+	finishFields
+	Model         string               `json:"model"`
+	Usage         *usageCounts         `json:"usage"`
+	Message       *usageDocument       `json:"message"`
+	Response      *usageDocument       `json:"response"`
+	ModelVersion  string               `json:"modelVersion"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata"`
+	Choices       []struct {
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Delta *struct {
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Candidates []struct {
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+}
+
+// finishReason returns the finish reason the event carries, if any
+func (e *usageEvent) finishReason() string {
+	reason := e.finishFields.finishReason()
+	for _, document := range []*usageDocument{e.Message, e.Response} {
+		if document != nil && document.finishReason() != "" {
+			reason = document.finishReason()
+		}
+	}
+	for _, choice := range e.Choices {
+		if choice.FinishReason != "" {
+			reason = choice.FinishReason
+		}
+	}
+	if e.Delta != nil && e.Delta.StopReason != "" {
+		reason = e.Delta.StopReason
+	}
+	for _, candidate := range e.Candidates {
+		if candidate.FinishReason != "" {
+			reason = candidate.FinishReason
+		}
+	}
+	return reason
+}
+
+// usageWriter passes the response on to the client while reading the token usage from it. JSON responses are kept up
+// to a limit and parsed at the end; event streams are scanned line by line as they pass. Encoded responses, such as
+// gzip bodies of an upstream that ignores the request's Accept-Encoding, are not read.
+type usageWriter struct {
+	*responseWriter
+	stream   bool
+	encoded  bool
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+	usage    tokenUsage
+	found    bool
+	// chunks counts the data events of a stream
+	chunks int64
+	// finishReason is the last finish reason seen, the one of the terminal chunk of a stream
+	finishReason string
+}
+
+func newUsageWriter(w http.ResponseWriter) *usageWriter {
+	u := &usageWriter{limit: 1 << 20}
+	u.responseWriter = &responseWriter{ResponseWriter: w, onHeader: u.header, onWrite: u.scan}
+	return u
+}
+
+func (u *usageWriter) header(int) {
+	u.stream = strings.HasPrefix(u.Header().Get("Content-Type"), "text/event-stream")
+	u.encoded = isEncoded(u.Header())
+}
+
+func (u *usageWriter) scan(data []byte) {
+	if u.encoded {
+		return
+	}
+	limit := u.limit
+
+	switch {
+	case u.stream:
+		u.body.Write(data)
+		for {
+			end := bytes.IndexByte(u.body.Bytes(), '\n')
+			if end < 0 {
+				break
+			}
+			u.scanLine(u.body.Next(end + 1))
+		}
+		if u.body.Len() > limit {
+			u.body.Reset()
+		}
+	case !u.overflow:
+		if u.body.Len()+len(data) > limit {
+			u.overflow = true
+			u.body.Reset()
+		} else {
+			u.body.Write(data)
+		}
+	}
+}
+
+// scanLine reads the usage from a data line of an event stream
+func (u *usageWriter) scanLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if len(data) > 0 && !bytes.Equal(data, []byte("[DONE]")) {
+		u.chunks++
+	}
+	for _, marker := range streamMarkers {
+		if bytes.Contains(data, marker) {
+			u.merge(data)
+			return
+		}
+	}
+}
+
+// merge adds the usage of a response body or stream event. Streams report cumulative counts, so the largest count
+// seen wins.
+func (u *usageWriter) merge(data []byte) {
+	var event usageEvent
+	if json.Unmarshal(data, &event) != nil {
+		return
+	}
+	if reason := event.finishReason(); reason != "" {
+		u.finishReason = reason
+	}
+
+	documents := []*usageDocument{{Model: event.Model, Usage: event.Usage}, event.Message, event.Response}
+	if event.UsageMetadata != nil {
+		documents = append(documents, &usageDocument{
+			Model: event.ModelVersion,
+			Usage: &usageCounts{
+				InputTokens:          event.UsageMetadata.PromptTokenCount,
+				OutputTokens:         event.UsageMetadata.CandidatesTokenCount,
+				CacheReadInputTokens: event.UsageMetadata.CachedContentTokenCount,
+				ThoughtsTokens:       event.UsageMetadata.ThoughtsTokenCount,
+			},
+		})
+	}
+
+	for _, document := range documents {
+		if document == nil {
+			continue
+		}
+		if u.usage.model == "" {
+			u.usage.model = document.Model
+		}
+		if document.Usage == nil {
+			continue
+		}
+		u.found = true
+		u.usage.input = maxInt64(u.usage.input, document.Usage.PromptTokens, document.Usage.InputTokens)
+		u.usage.output = maxInt64(u.usage.output, document.Usage.CompletionTokens, document.Usage.OutputTokens)
+		u.usage.cached = maxInt64(u.usage.cached, document.Usage.cachedTokens())
+		u.usage.reasoning = maxInt64(u.usage.reasoning, document.Usage.reasoningTokens())
+	}
+}
+
+// result returns the token usage of the response and whether the response reported any
+func (u *usageWriter) result() (tokenUsage, bool) {
+	if !u.stream && !u.overflow && u.body.Len() > 0 {
+		u.merge(u.body.Bytes())
+		u.body.Reset()
+	}
+	return u.usage, u.found
+}
+
+func maxInt64(values ...int64) int64 {
+	var max int64
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+	return max
+}
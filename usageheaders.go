@@ -0,0 +1,232 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachedTokensHeader is set on JSON responses to the prompt tokens read from the provider's prompt cache
+const CachedTokensHeader = "X-OpenAI-Cached-Tokens"
+
+// ReasoningTokensHeader is set on JSON responses to the completion tokens spent on reasoning
+const ReasoningTokensHeader = "X-OpenAI-Reasoning-Tokens"
+
+// FinishReasonHeader is set on JSON responses, and sent as a trailer of event streams, to the reason generation stopped
+const FinishReasonHeader = "X-OpenAI-Finish-Reason"
+
+// TotalTokensHeader is sent as a trailer of event streams to the input and output tokens the stream reported
+const TotalTokensHeader = "X-OpenAI-Total-Tokens"
+
+// TTFTHeader is sent as a trailer of event streams to the milliseconds until the first byte of the stream
+const TTFTHeader = "X-OpenAI-TTFT-Ms"
+
+// TokensPerSecondHeader is sent as a trailer of event streams, with throughputTrailer, to the output tokens generated
+// per second after the first byte
+const TokensPerSecondHeader = "X-OpenAI-Tokens-Per-Second"
+
+// streamTrailers returns the trailers announced on event streams to clients that accept trailers
+func (e *Handler) streamTrailers() []string {
+	trailers := []string{TotalTokensHeader, TTFTHeader, FinishReasonHeader}
+	if e.throughputTrailer {
+		trailers = append(trailers, TokensPerSecondHeader)
+	}
+	return trailers
+}
+
+// truncatedFinishReasons are the finish reasons of responses cut off at their token limit
+var truncatedFinishReasons = map[string]bool{
+	"length":            true,
+	"max_tokens":        true,
+	"max_output_tokens": true,
+	"MAX_TOKENS":        true,
+}
+
+// maxHeldResponseBytes limits the JSON responses held back until their usage is known
+const maxHeldResponseBytes = 1 << 20
+
+// holdWriter holds back a JSON response until it is complete, so headers derived from its body can still be added.
+// Event streams and other responses pass through, as do JSON responses that outgrow the limit. Event streams to clients
+// that accept trailers announce the stream trailers.
+type holdWriter struct {
+	*responseWriter
+	holding bool
+	body    bytes.Buffer
+	// trailers are the trailers to announce when the client accepts them, announced is set once they are announced on
+	// an event stream
+	trailers  []string
+	announced bool
+	// start is when the request was passed on, firstByte and lastByte when the first and the last byte of the response
+	// were written
+	start     time.Time
+	firstByte time.Time
+	lastByte  time.Time
+}
+
+func newHoldWriter(w http.ResponseWriter, r *http.Request, trailers []string) *holdWriter {
+	if !acceptsTrailers(r) {
+		trailers = nil
+	}
+	return &holdWriter{responseWriter: &responseWriter{ResponseWriter: w}, trailers: trailers, start: time.Now()}
+}
+
+// acceptsTrailers tells whether the client can consume trailers: every HTTP/2 client can, an HTTP/1.1 client says so
+// with TE: trailers
+func acceptsTrailers(r *http.Request) bool {
+	if r.ProtoMajor >= 2 {
+		return true
+	}
+	for _, value := range r.Header.Values("TE") {
+		for _, coding := range strings.Split(value, ",") {
+			coding, _, _ = strings.Cut(coding, ";")
+			if strings.EqualFold(strings.TrimSpace(coding), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (h *holdWriter) WriteHeader(status int) {
+	if h.status != 0 {
+		return
+	}
+	h.holding = strings.HasPrefix(h.Header().Get("Content-Type"), "application/json")
+	if h.holding {
+		// the status is recorded but only written when the body is released
+		h.status = status
+		return
+	}
+	// a response with a length is not chunked over HTTP/1.1 and cannot carry trailers
+	if len(h.trailers) > 0 && h.Header().Get("Content-Length") == "" &&
+		strings.HasPrefix(h.Header().Get("Content-Type"), "text/event-stream") {
+		h.announced = true
+		h.Header().Add("Trailer", strings.Join(h.trailers, ", "))
+	}
+	h.responseWriter.WriteHeader(status)
+}
+
+func (h *holdWriter) Write(data []byte) (int, error) {
+	if h.status == 0 {
+		h.WriteHeader(http.StatusOK)
+	}
+	if len(data) > 0 {
+		h.lastByte = time.Now()
+		if h.firstByte.IsZero() {
+			h.firstByte = h.lastByte
+		}
+	}
+	if h.holding && h.body.Len()+len(data) > maxHeldResponseBytes {
+		if err := h.release(); err != nil {
+			return 0, err
+		}
+	}
+	if h.holding {
+		return h.body.Write(data)
+	}
+	return h.responseWriter.Write(data)
+}
+
+// ReadFrom copies the body through Write, so a JSON body is held and the time of its first and last byte is recorded
+func (h *holdWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{h}, src)
+}
+
+// release writes the held status and body
+func (h *holdWriter) release() error {
+	if !h.holding {
+		return nil
+	}
+	h.holding = false
+	h.responseWriter.WriteHeader(h.status)
+	_, err := h.responseWriter.Write(h.body.Bytes())
+	h.body.Reset()
+	return err
+}
+
+// Flush forwards flushes once the response is no longer held
+func (h *holdWriter) Flush() {
+	if h.holding {
+		return
+	}
+	h.responseWriter.Flush()
+}
+
+// setUsageHeaders adds the headers derived from the usage and the finish reason of a held JSON response and releases
+// it. The total tokens, time to first byte and finish reason of an event stream, which only its last chunks carry, are
+// sent as trailers when the client accepts them, as is the throughput with throughputTrailer. The reasoning tokens and
+// finish reasons of every response from the upstream, streamed or not, are counted, as are the total tokens, time to
+// first byte and throughput of every stream.
+func (e *Handler) setUsageHeaders(hold *holdWriter, meter *usageWriter, values map[string]string) {
+	if meter.encoded {
+		e.metrics.incLabel("usage_encoded_responses", "usage_headers")
+	}
+	usage, ok := meter.result()
+	reason := meter.finishReason
+	// the time to first byte is the wait for the upstream, the time from the first to the last byte the generation
+	var ttft, generation time.Duration
+	if !hold.firstByte.IsZero() {
+		ttft = hold.firstByte.Sub(hold.start)
+		generation = hold.lastByte.Sub(hold.firstByte)
+	}
+	if hold.Header().Get(CacheHeader) != "hit" && hold.Header().Get(DeduplicatedHeader) != "coalesced" {
+		model := usage.model
+		if model == "" {
+			model = values["model"]
+		}
+		if ok {
+			e.metrics.addLabel("reasoning_tokens_by_model", model, usage.reasoning)
+		}
+		if reason != "" {
+			e.metrics.incLabel("finish_reasons", reason)
+		}
+		if truncatedFinishReasons[reason] {
+			e.metrics.incLabel("truncated_by_model", model)
+		}
+		if meter.stream {
+			e.metrics.incLabel("streams_by_model", model)
+			e.metrics.addLabel("stream_ttft_ms_by_model", model, ttft.Milliseconds())
+			e.metrics.addLabel("stream_generation_ms_by_model", model, generation.Milliseconds())
+			e.metrics.addLabel("stream_chunks_by_model", model, meter.chunks)
+			if ok {
+				e.metrics.addLabel("stream_total_tokens_by_model", model, usage.input+usage.output)
+				e.metrics.addLabel("stream_output_tokens_by_model", model, usage.output)
+			}
+			if !hold.announced {
+				e.metrics.inc("stream_trailers_unsupported_total")
+			}
+		}
+	}
+
+	switch {
+	case hold.holding:
+		if ok {
+			hold.Header().Set(CachedTokensHeader, strconv.FormatInt(usage.cached, 10))
+			hold.Header().Set(ReasoningTokensHeader, strconv.FormatInt(usage.reasoning, 10))
+		}
+		if reason != "" {
+			hold.Header().Set(FinishReasonHeader, reason)
+		}
+	case hold.announced:
+		if ok {
+			hold.Header().Set(TotalTokensHeader, strconv.FormatInt(usage.input+usage.output, 10))
+		}
+		if !hold.firstByte.IsZero() {
+			hold.Header().Set(TTFTHeader, strconv.FormatInt(ttft.Milliseconds(), 10))
+		}
+		if reason != "" {
+			hold.Header().Set(FinishReasonHeader, reason)
+		}
+		if e.throughputTrailer && ok && generation > 0 {
+			perSecond := float64(usage.output) / generation.Seconds()
+			hold.Header().Set(TokensPerSecondHeader, strconv.FormatFloat(perSecond, 'f', 1, 64))
+		}
+	}
+	if err := hold.release(); err != nil {
+		fmt.Println("Unable to write response", err.Error())
+	}
+}
@@ -0,0 +1,564 @@
+package traefik_openai_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageHeaders_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		readFrom    bool
+		want        string
+	}{
+		{
+			name:        "chat completion",
+			contentType: "application/json",
+			body:        "{\"model\": \"gpt-4.1\", \"usage\": {\"prompt_tokens\": 2006, \"completion_tokens\": 300, \"prompt_tokens_details\": {\"cached_tokens\": 1920}}}",
+			want:        "1920",
+		},
+		{
+			name:        "responses",
+			contentType: "application/json",
+			body:        "{\"model\": \"gpt-4.1\", \"usage\": {\"input_tokens\": 2006, \"output_tokens\": 300, \"input_tokens_details\": {\"cached_tokens\": 1024}}}",
+			want:        "1024",
+		},
+		{
+			name:        "anthropic",
+			contentType: "application/json",
+			body:        "{\"model\": \"claude-sonnet-4\", \"usage\": {\"input_tokens\": 20, \"output_tokens\": 300, \"cache_read_input_tokens\": 4096}}",
+			want:        "4096",
+		},
+		{
+			name:        "gemini",
+			contentType: "application/json; charset=utf-8",
+			body:        "{\"modelVersion\": \"gemini-2.5-pro\", \"usageMetadata\": {\"promptTokenCount\": 2006, \"cachedContentTokenCount\": 512}}",
+			want:        "512",
+		},
+		{
+			name:        "copied",
+			contentType: "application/json",
+			body:        "{\"model\": \"gpt-4.1\", \"usage\": {\"prompt_tokens\": 2006, \"completion_tokens\": 300, \"prompt_tokens_details\": {\"cached_tokens\": 1920}}}",
+			readFrom:    true,
+			want:        "1920",
+		},
+		{
+			name:        "no cache hit",
+			contentType: "application/json",
+			body:        "{\"model\": \"gpt-4.1\", \"usage\": {\"prompt_tokens\": 20, \"completion_tokens\": 300}}",
+			want:        "0",
+		},
+		{
+			name:        "no usage",
+			contentType: "application/json",
+			body:        "{\"error\": {\"message\": \"invalid\"}}",
+			want:        "",
+		},
+		{
+			name:        "stream",
+			contentType: "text/event-stream",
+			body:        "data: {\"usage\": {\"prompt_tokens\": 20, \"prompt_tokens_details\": {\"cached_tokens\": 10}}}\n\n",
+			want:        "",
+		},
+		{
+			name:        "too large",
+			contentType: "application/json",
+			body:        "{\"padding\": \"" + strings.Repeat("a", maxHeldResponseBytes) + "\", \"usage\": {\"prompt_tokens_details\": {\"cached_tokens\": 10}}}",
+			want:        "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UsageHeaders = true
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.readFrom {
+					_, _ = w.(io.ReaderFrom).ReadFrom(strings.NewReader(tt.body))
+					return
+				}
+				for i := 0; i < len(tt.body); i += 4096 {
+					_, _ = w.Write([]byte(tt.body[i:min(i+4096, len(tt.body))]))
+				}
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+			if got := recorder.Header().Get(CachedTokensHeader); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+			if recorder.Body.String() != tt.body {
+				t.Errorf("expected the body to be passed on unchanged")
+			}
+		})
+	}
+}
+
+func TestUsageHeadersEncoding_ServeHTTP(t *testing.T) {
+	body := "{\"model\": \"gpt-4.1\", \"usage\": {\"prompt_tokens\": 2006, \"completion_tokens\": 300, \"prompt_tokens_details\": {\"cached_tokens\": 1920}}}"
+	tests := []struct {
+		name        string
+		always      bool
+		want        string
+		wantEncoded int64
+	}{
+		{name: "negotiated", want: "1920"},
+		{name: "always", always: true, want: "", wantEncoded: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UsageHeaders = true
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.always || strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					w.Header().Set("Content-Encoding", "gzip")
+					_, _ = w.Write(gzipped(body))
+					return
+				}
+				_, _ = w.Write([]byte(body))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			req.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get(CachedTokensHeader); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+			if got := e.(*Handler).metrics.snapshot().Labeled["usage_encoded_responses"]["usage_headers"]; got != tt.wantEncoded {
+				t.Errorf("expected %d encoded responses but got %d", tt.wantEncoded, got)
+			}
+		})
+	}
+}
+
+func TestUsageHeadersStatus_ServeHTTP(t *testing.T) {
+	config := defaultConfig()
+	config.UsageHeaders = true
+
+	e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("{\"usage\": {\"prompt_tokens_details\": {\"cached_tokens\": 10}}}"))
+	}), config, "status")
+	if err != nil {
+		t.Fatalf("Failed initializing Handler: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}")))
+
+	if recorder.Code != http.StatusCreated || recorder.Header().Get(CachedTokensHeader) != "10" {
+		t.Errorf("expected the held status and header but got %d %q", recorder.Code, recorder.Header().Get(CachedTokensHeader))
+	}
+}
+
+func TestReasoningTokens_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		counted     int64
+	}{
+		{
+			name:        "chat completion",
+			contentType: "application/json",
+			body:        "{\"model\": \"o3\", \"usage\": {\"prompt_tokens\": 20, \"completion_tokens\": 1300, \"completion_tokens_details\": {\"reasoning_tokens\": 1024}}}",
+			want:        "1024",
+			counted:     1024,
+		},
+		{
+			name:        "responses",
+			contentType: "application/json",
+			body:        "{\"model\": \"o3\", \"usage\": {\"input_tokens\": 20, \"output_tokens\": 600, \"output_tokens_details\": {\"reasoning_tokens\": 512}}}",
+			want:        "512",
+			counted:     512,
+		},
+		{
+			name:        "gemini",
+			contentType: "application/json",
+			body:        "{\"modelVersion\": \"o3\", \"usageMetadata\": {\"candidatesTokenCount\": 600, \"thoughtsTokenCount\": 256}}",
+			want:        "256",
+			counted:     256,
+		},
+		{
+			name:        "stream",
+			contentType: "text/event-stream",
+			body:        "data: {\"model\": \"o3\", \"usage\": {\"completion_tokens\": 900, \"completion_tokens_details\": {\"reasoning_tokens\": 128}}}\n\ndata: [DONE]\n\n",
+			want:        "",
+			counted:     128,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UsageHeaders = true
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = w.Write([]byte(tt.body))
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{\"model\": \"o3\"}")))
+
+			if got := recorder.Header().Get(ReasoningTokensHeader); got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+			if got := e.(*Handler).metrics.snapshot().Labeled["reasoning_tokens_by_model"]["o3"]; got != tt.counted {
+				t.Errorf("expected %d reasoning tokens to be counted but got %d", tt.counted, got)
+			}
+		})
+	}
+}
+
+func TestFinishReason_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		header      string
+		trailer     string
+		truncated   int64
+	}{
+		{
+			name:        "chat completion",
+			contentType: "application/json",
+			body:        "{\"model\": \"gpt-4.1\", \"choices\": [{\"index\": 0, \"finish_reason\": \"stop\"}]}",
+			header:      "stop",
+		},
+		{
+			name:        "chat completion stream",
+			contentType: "text/event-stream",
+			body: "data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {\"content\": \"Hi\"}, \"finish_reason\": null}]}\n\n" +
+				"data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {}, \"finish_reason\": \"length\"}]}\n\n" +
+				"data: [DONE]\n\n",
+			trailer:   "length",
+			truncated: 1,
+		},
+		{
+			name:        "anthropic stream",
+			contentType: "text/event-stream",
+			body: "event: message_start\ndata: {\"type\": \"message_start\", \"message\": {\"model\": \"gpt-4.1\", \"stop_reason\": null}}\n\n" +
+				"event: message_delta\ndata: {\"type\": \"message_delta\", \"delta\": {\"stop_reason\": \"max_tokens\"}}\n\n",
+			trailer:   "max_tokens",
+			truncated: 1,
+		},
+		{
+			name:        "responses incomplete",
+			contentType: "application/json",
+			body:        "{\"model\": \"gpt-4.1\", \"status\": \"incomplete\", \"incomplete_details\": {\"reason\": \"max_output_tokens\"}}",
+			header:      "max_output_tokens",
+			truncated:   1,
+		},
+		{
+			name:        "responses stream",
+			contentType: "text/event-stream",
+			body: "event: response.created\ndata: {\"type\": \"response.created\", \"response\": {\"status\": \"in_progress\"}}\n\n" +
+				"event: response.completed\ndata: {\"type\": \"response.completed\", \"response\": {\"model\": \"gpt-4.1\", \"status\": \"completed\"}}\n\n",
+			trailer: "completed",
+		},
+		{
+			name:        "gemini",
+			contentType: "application/json",
+			body:        "{\"candidates\": [{\"finishReason\": \"MAX_TOKENS\"}], \"modelVersion\": \"gpt-4.1\"}",
+			header:      "MAX_TOKENS",
+			truncated:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UsageHeaders = true
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				for _, event := range strings.SplitAfter(tt.body, "\n\n") {
+					_, _ = w.Write([]byte(event))
+					w.(http.Flusher).Flush()
+				}
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\"}"))
+			req.Header.Set("TE", "trailers")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if string(body) != tt.body {
+				t.Errorf("expected the body to be passed on unchanged but got %q", body)
+			}
+			if got := resp.Header.Get(FinishReasonHeader); got != tt.header {
+				t.Errorf("expected header %q but got %q", tt.header, got)
+			}
+			if got := resp.Trailer.Get(FinishReasonHeader); got != tt.trailer {
+				t.Errorf("expected trailer %q but got %q", tt.trailer, got)
+			}
+			if got := e.(*Handler).metrics.snapshot().Labeled["truncated_by_model"]["gpt-4.1"]; got != tt.truncated {
+				t.Errorf("expected %d truncated responses but got %d", tt.truncated, got)
+			}
+		})
+	}
+}
+
+func TestStreamTrailers_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		http2       bool
+		te          string
+		contentType string
+		length      bool
+		announced   bool
+		unsupported int64
+	}{
+		{
+			name:        "http/1.1 with te trailers",
+			te:          "trailers",
+			contentType: "text/event-stream",
+			announced:   true,
+		},
+		{
+			name:        "http/1.1 with te trailers and a transfer coding",
+			te:          "gzip;q=0.5, Trailers",
+			contentType: "text/event-stream",
+			announced:   true,
+		},
+		{
+			name:        "http/2",
+			http2:       true,
+			contentType: "text/event-stream",
+			announced:   true,
+		},
+		{
+			name:        "http/1.1 without te",
+			contentType: "text/event-stream",
+			unsupported: 1,
+		},
+		{
+			name:        "stream with a content length",
+			te:          "trailers",
+			contentType: "text/event-stream",
+			length:      true,
+			unsupported: 1,
+		},
+		{
+			name:        "not a stream",
+			te:          "trailers",
+			contentType: "text/plain",
+		},
+	}
+
+	body := "data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {\"content\": \"Hi\"}}]}\n\n" +
+		"data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}]}\n\n" +
+		"data: {\"model\": \"gpt-4.1\", \"choices\": [], \"usage\": {\"prompt_tokens\": 20, \"completion_tokens\": 2}}\n\n" +
+		"data: [DONE]\n\n"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UsageHeaders = true
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.length {
+					w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				}
+				for _, event := range strings.SplitAfter(body, "\n\n") {
+					_, _ = w.Write([]byte(event))
+					w.(http.Flusher).Flush()
+				}
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			server := httptest.NewUnstartedServer(e)
+			server.EnableHTTP2 = tt.http2
+			if tt.http2 {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"stream\": true}"))
+			if tt.te != "" {
+				req.Header.Set("TE", tt.te)
+			}
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			got, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if tt.http2 && resp.ProtoMajor != 2 {
+				t.Fatalf("expected an HTTP/2 response but got %s", resp.Proto)
+			}
+			if string(got) != body {
+				t.Errorf("expected the body to be passed on unchanged but got %q", got)
+			}
+
+			_, announced := resp.Trailer[http.CanonicalHeaderKey(TotalTokensHeader)]
+			if announced != tt.announced {
+				t.Errorf("expected trailers announced %v but got %v", tt.announced, announced)
+			}
+			want := map[string]string{TotalTokensHeader: "", FinishReasonHeader: ""}
+			if tt.announced {
+				want = map[string]string{TotalTokensHeader: "22", FinishReasonHeader: "stop"}
+			}
+			for name, value := range want {
+				if resp.Trailer.Get(name) != value {
+					t.Errorf("expected trailer %s %q but got %q", name, value, resp.Trailer.Get(name))
+				}
+			}
+			if tt.announced {
+				if _, err := strconv.Atoi(resp.Trailer.Get(TTFTHeader)); err != nil {
+					t.Errorf("expected the time to first byte in milliseconds but got %q", resp.Trailer.Get(TTFTHeader))
+				}
+			}
+
+			snapshot := e.(*Handler).metrics.snapshot()
+			if got := snapshot.Counters["stream_trailers_unsupported_total"]; got != tt.unsupported {
+				t.Errorf("expected %d streams without trailers but got %d", tt.unsupported, got)
+			}
+			streams, tokens := int64(1), int64(22)
+			if tt.contentType != "text/event-stream" {
+				streams, tokens = 0, 0
+			}
+			if got := snapshot.Labeled["streams_by_model"]["gpt-4.1"]; got != streams {
+				t.Errorf("expected %d streams but got %d", streams, got)
+			}
+			if got := snapshot.Labeled["stream_total_tokens_by_model"]["gpt-4.1"]; got != tokens {
+				t.Errorf("expected %d stream tokens but got %d", tokens, got)
+			}
+		})
+	}
+}
+
+func TestThroughputTrailer_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		throughput bool
+		usage      bool
+		want       bool
+	}{
+		{name: "throughput trailer", throughput: true, usage: true, want: true},
+		{name: "stream without usage", throughput: true},
+		{name: "metrics only", usage: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.UsageHeaders = true
+			config.ThroughputTrailer = tt.throughput
+
+			events := []string{
+				"data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {\"content\": \"Hello\"}}]}\n\n",
+				"data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {\"content\": \" world\"}}]}\n\n",
+				"data: {\"model\": \"gpt-4.1\", \"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}]}\n\n",
+			}
+			if tt.usage {
+				events = append(events, "data: {\"model\": \"gpt-4.1\", \"choices\": [], \"usage\": {\"prompt_tokens\": 20, \"completion_tokens\": 40}}\n\n")
+			}
+			events = append(events, "data: [DONE]\n\n")
+
+			e, err := New(nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, event := range events {
+					_, _ = w.Write([]byte(event))
+					w.(http.Flusher).Flush()
+					time.Sleep(10 * time.Millisecond)
+				}
+			}), config, tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader("{\"model\": \"gpt-4.1\", \"stream\": true}"))
+			req.Header.Set("TE", "trailers")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			_, announced := resp.Trailer[http.CanonicalHeaderKey(TokensPerSecondHeader)]
+			if announced != tt.throughput {
+				t.Errorf("expected the throughput trailer announced %v but got %v", tt.throughput, announced)
+			}
+			value := resp.Trailer.Get(TokensPerSecondHeader)
+			if !tt.want {
+				if value != "" {
+					t.Errorf("expected no throughput but got %q", value)
+				}
+			} else if perSecond, err := strconv.ParseFloat(value, 64); err != nil || perSecond <= 0 || perSecond > 40000 {
+				t.Errorf("expected a throughput in tokens per second but got %q", value)
+			}
+
+			snapshot := e.(*Handler).metrics.snapshot()
+			if got := snapshot.Labeled["stream_chunks_by_model"]["gpt-4.1"]; got != int64(len(events)-1) {
+				t.Errorf("expected %d chunks but got %d", len(events)-1, got)
+			}
+			if got := snapshot.Labeled["stream_generation_ms_by_model"]["gpt-4.1"]; got < int64(len(events)-2)*10 {
+				t.Errorf("expected at least %d ms of generation but got %d", (len(events)-2)*10, got)
+			}
+			output := int64(0)
+			if tt.usage {
+				output = 40
+			}
+			if got := snapshot.Labeled["stream_output_tokens_by_model"]["gpt-4.1"]; got != output {
+				t.Errorf("expected %d output tokens but got %d", output, got)
+			}
+		})
+	}
+}
+
+func TestInvalidThroughputTrailer_New(t *testing.T) {
+	config := defaultConfig()
+	config.ThroughputTrailer = true
+	if _, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), config, "invalid"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
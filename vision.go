@@ -0,0 +1,92 @@
+package traefik_openai_header
+
+import (
+	"encoding/base64"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+// Image token costs of the OpenAI vision models: a low detail image costs the base tokens, a high detail image the base
+// tokens plus the tile tokens for every 512px tile of the scaled image
+const (
+	imageBaseTokens = 85
+	imageTileTokens = 170
+	imageTileSize   = 512
+)
+
+// unknownImageTokens is the estimate for a high detail image whose dimensions cannot be read: a square image scaled to
+// 768px, four tiles
+const unknownImageTokens = imageBaseTokens + 4*imageTileTokens
+
+// imageTokens estimates the input tokens of the image_url parts. The detail level decides between the low and the high
+// detail cost; auto is estimated as high. The dimensions are read from the header of inline data URLs in PNG, JPEG or
+// GIF format, other images are assumed to be a square that scales to four tiles.
+func imageTokens(parts []chatContentPart) (int, bool) {
+	found := false
+	tokens := 0
+	for _, part := range parts {
+		if part.Type != "image_url" {
+			continue
+		}
+		found = true
+		if part.ImageURL.Detail == "low" {
+			tokens += imageBaseTokens
+			continue
+		}
+		width, height, ok := dataURLDimensions(part.ImageURL.URL)
+		if !ok {
+			tokens += unknownImageTokens
+			continue
+		}
+		tokens += highDetailTokens(width, height)
+	}
+	return tokens, found
+}
+
+// highDetailTokens returns the tokens of a high detail image: it is scaled to fit 2048x2048, then its shortest side is
+// scaled down to 768px, and every 512px tile costs the tile tokens
+func highDetailTokens(width int, height int) int {
+	w, h := float64(width), float64(height)
+	if w <= 0 || h <= 0 {
+		return imageBaseTokens
+	}
+	if scale := 2048 / math.Max(w, h); scale < 1 {
+		w, h = w*scale, h*scale
+	}
+	if scale := 768 / math.Min(w, h); scale < 1 {
+		w, h = w*scale, h*scale
+	}
+	tiles := math.Ceil(w/imageTileSize) * math.Ceil(h/imageTileSize)
+	return imageBaseTokens + int(tiles)*imageTileTokens
+}
+
+// dataURLDimensions reads the dimensions of a base64 data URL image from its header, without decoding the image
+func dataURLDimensions(url string) (int, int, bool) {
+	header, data, ok := strings.Cut(url, ",")
+	if !ok || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return 0, 0, false
+	}
+
+	var decodeConfig func(io.Reader) (image.Config, error)
+	switch strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64") {
+	case "image/png":
+		decodeConfig = png.DecodeConfig
+	case "image/jpeg", "image/jpg":
+		decodeConfig = jpeg.DecodeConfig
+	case "image/gif":
+		decodeConfig = gif.DecodeConfig
+	default:
+		return 0, 0, false
+	}
+
+	config, err := decodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if err != nil {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
@@ -0,0 +1,80 @@
+package traefik_openai_header
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func pngDataURL(t *testing.T, width int, height int) string {
+	var data bytes.Buffer
+	if err := png.Encode(&data, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("unable to encode image: %s", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data.Bytes())
+}
+
+func TestEstimatedImageTokens_ServeHTTP(t *testing.T) {
+	image := func(url string, detail string) string {
+		return "{\"type\": \"image_url\", \"image_url\": {\"url\": \"" + url + "\", \"detail\": \"" + detail + "\"}}"
+	}
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{name: "text only", parts: []string{"{\"type\": \"text\", \"text\": \"hi\"}"}, want: ""},
+		{name: "low detail", parts: []string{image("https://example.com/cat.png", "low")}, want: "85"},
+		{name: "remote high detail", parts: []string{image("https://example.com/cat.png", "high")}, want: "765"},
+		{name: "inline small", parts: []string{image(pngDataURL(t, 400, 300), "auto")}, want: "255"},
+		{name: "inline large", parts: []string{image(pngDataURL(t, 4096, 2048), "high")}, want: "1105"},
+		{name: "unknown format", parts: []string{image("data:image/webp;base64,UklGRg==", "high")}, want: "765"},
+		{
+			name:  "several",
+			parts: []string{image("https://example.com/a.png", "low"), image(pngDataURL(t, 1024, 1024), "high")},
+			want:  "850",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			e, err := New(nil, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("X-OpenAI-Estimated-Image-Tokens")
+			}), defaultConfig(), tt.name)
+			if err != nil {
+				t.Fatalf("Failed initializing Handler: %s", err)
+			}
+
+			input := "{\"model\": \"gpt-4.1\", \"messages\": [{\"role\": \"user\", \"content\": [" + strings.Join(tt.parts, ", ") + "]}]}"
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(input)))
+
+			if got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHighDetailTokens(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          int
+	}{
+		{width: 512, height: 512, want: 255},
+		{width: 1024, height: 1024, want: 765},
+		{width: 2048, height: 4096, want: 1105},
+		{width: 800, height: 600, want: 765},
+		{width: 0, height: 10, want: 85},
+	}
+	for _, tt := range tests {
+		if got := highDetailTokens(tt.width, tt.height); got != tt.want {
+			t.Errorf("expected %d tokens for %dx%d but got %d", tt.want, tt.width, tt.height, got)
+		}
+	}
+}